@@ -1,4 +1,11 @@
 export interface User extends Document {
     email: string;
     id: number;
+    // Student profile fields, forwarded by the gateway in X-User
+    school?: string;
+    degree?: string;
+    majors?: string[];
+    expectedGraduation?: string;
+    targetJobTypes?: string[];
+    targetSeasons?: string[];
 }
@@ -1,30 +1,8 @@
-/* Table to contain User records
-   Note: varchar limits were selected to be a practical limit.
-   These limits are not enforced in user.go
+/* The gateway's tables (users, usersignins and sessions) are
+   created by its versioned migrations in gateway/migrations,
+   applied with "gateway migrate up", so applications.userID
+   references the users table they create.
 */
-create table if not exists users (
-    id         serial       primary key,
-    email      varchar(320) unique       not null, /* https://tools.ietf.org/html/rfc3696 */
-    passhash   bytea                     not null,
-    username   varchar(255) unique       not null,
-    firstname  varchar(32),
-    lastname   varchar(32),
-    photourl   varchar(68)               not null  -- TODO: remove
-);
-
--- Populate users table with a couple of test users on startup;
-insert into users (email, passhash, username, firstname, lastname, photourl)
-values ('test@test.com', 'passhash', 'test1', 'test', 'test', 'photourl');
-
-insert into users (email, passhash, username, firstname, lastname, photourl)
-values ('test2@test.com', 'passhash', 'test2', 'test', 'test', 'photourl');
-
-create table if not exists usersignins (
-    id          serial primary key,
-    userid      int not null,
-    signintime  timestamp not null,
-    IP          varchar(45) not null
-);
 
 /* Note on varchar column lengths
    - Categories and tags: 32
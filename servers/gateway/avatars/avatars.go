@@ -0,0 +1,126 @@
+package avatars
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"sync"
+
+	//register the formats accepted for uploads with image.Decode
+	_ "image/gif"
+	_ "image/png"
+
+	"golang.org/x/image/draw"
+)
+
+//MaxUploadBytes is the largest image accepted for an avatar
+const MaxUploadBytes = 5 << 20
+
+//Size is the width and height in pixels of every stored avatar
+const Size = 256
+
+//ContentType is the media type of every stored avatar
+const ContentType = "image/jpeg"
+
+//maxPixels bounds the decoded size of an upload, since a small
+//compressed file can decode into a very large image
+const maxPixels = 50 * 1000 * 1000
+
+//jpegQuality is the quality avatars are encoded with
+const jpegQuality = 85
+
+//ContentTypes are the media types of the images accepted for an avatar
+var ContentTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+//formats are the image.Decode formats of ContentTypes
+var formats = map[string]bool{
+	"jpeg": true,
+	"png":  true,
+	"gif":  true,
+}
+
+//ErrUnsupportedType is returned when an upload isn't a JPEG, PNG or GIF image
+var ErrUnsupportedType = errors.New("avatar must be a JPEG, PNG or GIF image")
+
+//ErrInvalidImage is returned when an upload can't be decoded
+var ErrInvalidImage = errors.New("avatar image could not be decoded")
+
+//ErrTooManyPixels is returned when an upload is too large once decoded
+var ErrTooManyPixels = errors.New("avatar image has too many pixels")
+
+//Process decodes the uploaded image, crops it to a centered
+//square, scales it to Size by Size pixels and encodes it as a JPEG.
+//The image's format is detected from its contents, so it doesn't
+//matter what the client claimed it was.
+func Process(upload []byte) ([]byte, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(upload))
+	if errors.Is(err, image.ErrFormat) {
+		return nil, ErrUnsupportedType
+	}
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+	if !formats[format] {
+		return nil, ErrUnsupportedType
+	}
+	if config.Width <= 0 || config.Height <= 0 {
+		return nil, ErrInvalidImage
+	}
+	if config.Width*config.Height > maxPixels {
+		return nil, ErrTooManyPixels
+	}
+	img, _, err := image.Decode(bytes.NewReader(upload))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+
+	//transparent areas become white, since JPEGs have no alpha channel
+	avatar := image.NewRGBA(image.Rect(0, 0, Size, Size))
+	draw.Draw(avatar, avatar.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(avatar, avatar.Bounds(), img, centerSquare(img.Bounds()), draw.Over, nil)
+
+	buf := &bytes.Buffer{}
+	if err := jpeg.Encode(buf, avatar, &jpeg.Options{Quality: jpegQuality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+//centerSquare returns the largest square centered in `r`
+func centerSquare(r image.Rectangle) image.Rectangle {
+	side := r.Dx()
+	if r.Dy() < side {
+		side = r.Dy()
+	}
+	min := r.Min.Add(image.Pt((r.Dx()-side)/2, (r.Dy()-side)/2))
+	return image.Rectangle{Min: min, Max: min.Add(image.Pt(side, side))}
+}
+
+//placeholderColor is the color of the placeholder avatar
+var placeholderColor = color.RGBA{R: 0xdd, G: 0xdd, B: 0xdd, A: 0xff}
+
+//placeholder is the encoded placeholder avatar, made on first use
+var placeholder struct {
+	once sync.Once
+	jpeg []byte
+}
+
+//Placeholder returns the avatar of users who haven't uploaded one:
+//a plain Size by Size JPEG that says nothing about the user
+func Placeholder() []byte {
+	placeholder.once.Do(func() {
+		avatar := image.NewRGBA(image.Rect(0, 0, Size, Size))
+		draw.Draw(avatar, avatar.Bounds(), image.NewUniform(placeholderColor), image.Point{}, draw.Src)
+		buf := &bytes.Buffer{}
+		//encoding an in-memory image into a buffer can't fail
+		jpeg.Encode(buf, avatar, &jpeg.Options{Quality: jpegQuality})
+		placeholder.jpeg = buf.Bytes()
+	})
+	return placeholder.jpeg
+}
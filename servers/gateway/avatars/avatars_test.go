@@ -0,0 +1,105 @@
+package avatars
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+//encode returns a `width` by `height` image encoded with `encode`,
+//whose left half is red and right half is blue
+func encode(t *testing.T, width int, height int, encode func(*bytes.Buffer, image.Image) error) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			c := color.RGBA{R: 255, A: 255}
+			if x >= width/2 {
+				c = color.RGBA{B: 255, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	buf := &bytes.Buffer{}
+	if err := encode(buf, img); err != nil {
+		t.Fatalf("error encoding test image: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func encodePNG(buf *bytes.Buffer, img image.Image) error { return png.Encode(buf, img) }
+
+func encodeJPEG(buf *bytes.Buffer, img image.Image) error { return jpeg.Encode(buf, img, nil) }
+
+func encodeGIF(buf *bytes.Buffer, img image.Image) error { return gif.Encode(buf, img, nil) }
+
+//bigGIFHeader is the start of a 65535x65535 GIF, which is enough
+//to read its size without allocating the image in the test
+var bigGIFHeader = []byte("GIF89a\xff\xff\xff\xff\x00\x00\x00")
+
+func TestProcess(t *testing.T) {
+	cases := []struct {
+		name        string
+		upload      []byte
+		expectedErr error
+	}{
+		{"PNG", encode(t, 640, 480, encodePNG), nil},
+		{"JPEG", encode(t, 100, 300, encodeJPEG), nil},
+		{"GIF", encode(t, 32, 32, encodeGIF), nil},
+		{"Not An Image", []byte("<svg xmlns=\"http://www.w3.org/2000/svg\"></svg>"), ErrUnsupportedType},
+		{"Truncated PNG", encode(t, 64, 64, encodePNG)[:60], ErrInvalidImage},
+		{"Too Many Pixels", bigGIFHeader, ErrTooManyPixels},
+	}
+	for _, c := range cases {
+		avatar, err := Process(c.upload)
+		if c.expectedErr != nil {
+			if !errors.Is(err, c.expectedErr) {
+				t.Errorf("case %s: incorrect error: expected %v but got %v", c.name, c.expectedErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %s: unexpected error: %v", c.name, err)
+			continue
+		}
+		img, format, err := image.Decode(bytes.NewReader(avatar))
+		if err != nil || format != "jpeg" {
+			t.Errorf("case %s: avatar is not a JPEG: %s, %v", c.name, format, err)
+			continue
+		}
+		if img.Bounds().Dx() != Size || img.Bounds().Dy() != Size {
+			t.Errorf("case %s: incorrect avatar size: expected %dx%d but got %v", c.name, Size, Size, img.Bounds())
+		}
+	}
+}
+
+func TestCenterSquare(t *testing.T) {
+	cases := []struct {
+		bounds   image.Rectangle
+		expected image.Rectangle
+	}{
+		{image.Rect(0, 0, 640, 480), image.Rect(80, 0, 560, 480)},
+		{image.Rect(0, 0, 100, 300), image.Rect(0, 100, 100, 200)},
+		{image.Rect(10, 10, 42, 42), image.Rect(10, 10, 42, 42)},
+	}
+	for _, c := range cases {
+		if got := centerSquare(c.bounds); got != c.expected {
+			t.Errorf("incorrect square for %v: expected %v but got %v", c.bounds, c.expected, got)
+		}
+	}
+}
+
+func TestPlaceholder(t *testing.T) {
+	img, format, err := image.Decode(bytes.NewReader(Placeholder()))
+	if err != nil || format != "jpeg" {
+		t.Fatalf("placeholder is not a JPEG: %s, %v", format, err)
+	}
+	if img.Bounds().Dx() != Size || img.Bounds().Dy() != Size {
+		t.Errorf("placeholder should be %dx%d but is %v", Size, Size, img.Bounds())
+	}
+}
@@ -0,0 +1,99 @@
+package blobs
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+//FSStore represents a blob store backed by a directory
+//on the local filesystem. Each blob is one file, at the
+//key's path under the directory.
+type FSStore struct {
+	Dir string
+}
+
+//NewFSStore constructs a new FSStore keeping its blobs under `dir`,
+//which is created if it doesn't exist
+func NewFSStore(dir string) (*FSStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &FSStore{Dir: dir}, nil
+}
+
+//Put stores the contents of `r` under `key`. The contents are
+//written to a temporary file that is then renamed over the blob,
+//so the blob is replaced all at once.
+func (fss *FSStore) Put(ctx context.Context, key string, r io.Reader) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	name, err := fss.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	//removing fails harmlessly once the file has been renamed
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+//Get returns the blob stored under `key`
+func (fss *FSStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	name, err := fss.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return nil, ErrBlobNotFound
+	}
+	return f, err
+}
+
+//Delete deletes the blob stored under `key`
+func (fss *FSStore) Delete(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	name, err := fss.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+//path returns the name of the file holding the blob stored
+//under `key`, or ErrInvalidKey if the key is not a valid
+//path within the store's directory
+func (fss *FSStore) path(key string) (string, error) {
+	if !fs.ValidPath(key) || key == "." {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(fss.Dir, filepath.FromSlash(key)), nil
+}
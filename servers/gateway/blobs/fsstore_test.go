@@ -0,0 +1,82 @@
+package blobs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+//get returns the contents of the blob stored under `key`
+func get(t *testing.T, store Store, key string) ([]byte, error) {
+	t.Helper()
+	blob, err := store.Get(context.Background(), key)
+	if err != nil {
+		return nil, err
+	}
+	defer blob.Close()
+	return io.ReadAll(blob)
+}
+
+func TestFSStore(t *testing.T) {
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "blobs")
+	store, err := NewFSStore(dir)
+	if err != nil {
+		t.Fatalf("error creating FSStore: %v", err)
+	}
+
+	if _, err := get(t, store, "avatars/1.jpg"); !errors.Is(err, ErrBlobNotFound) {
+		t.Errorf("incorrect error getting a missing blob: expected %v but got %v", ErrBlobNotFound, err)
+	}
+
+	for _, contents := range []string{"first", "second"} {
+		if err := store.Put(ctx, "avatars/1.jpg", bytes.NewBufferString(contents)); err != nil {
+			t.Fatalf("error putting blob: %v", err)
+		}
+		got, err := get(t, store, "avatars/1.jpg")
+		if err != nil {
+			t.Fatalf("error getting blob: %v", err)
+		}
+		if string(got) != contents {
+			t.Errorf("incorrect blob contents: expected %q but got %q", contents, got)
+		}
+	}
+
+	//only the blob is left in the directory, not temporary files
+	entries, err := os.ReadDir(filepath.Join(dir, "avatars"))
+	if err != nil {
+		t.Fatalf("error reading the store's directory: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected only the blob in the store's directory but found %d files", len(entries))
+	}
+
+	if err := store.Delete(ctx, "avatars/1.jpg"); err != nil {
+		t.Fatalf("error deleting blob: %v", err)
+	}
+	if _, err := get(t, store, "avatars/1.jpg"); !errors.Is(err, ErrBlobNotFound) {
+		t.Errorf("incorrect error getting a deleted blob: expected %v but got %v", ErrBlobNotFound, err)
+	}
+	if err := store.Delete(ctx, "avatars/1.jpg"); err != nil {
+		t.Errorf("unexpected error deleting a missing blob: %v", err)
+	}
+}
+
+func TestFSStoreInvalidKeys(t *testing.T) {
+	store, err := NewFSStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("error creating FSStore: %v", err)
+	}
+	for _, key := range []string{"", ".", "../escape", "/absolute", "avatars/../../escape"} {
+		if err := store.Put(context.Background(), key, bytes.NewBufferString("blob")); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("incorrect error putting key %q: expected %v but got %v", key, ErrInvalidKey, err)
+		}
+		if _, err := store.Get(context.Background(), key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("incorrect error getting key %q: expected %v but got %v", key, ErrInvalidKey, err)
+		}
+	}
+}
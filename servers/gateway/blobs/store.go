@@ -0,0 +1,36 @@
+package blobs
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+//ErrBlobNotFound is returned from Store.Get() when no blob
+//is stored under the requested key
+var ErrBlobNotFound = errors.New("no blob was found in the blob store")
+
+//ErrInvalidKey is returned when a key can't be stored,
+//such as one that is empty or would escape the store
+var ErrInvalidKey = errors.New("invalid blob key")
+
+//Store represents a store of binary objects, such as uploaded images.
+//This is an abstract interface that can be implemented against
+//several different kinds of storage. For example, blobs could be
+//kept in a local directory, or in an object store like S3.
+//
+//Keys are slash-separated paths such as "avatars/1.jpg".
+type Store interface {
+	//Put stores the contents of `r` under `key`, replacing any
+	//blob already stored there. Readers of the key see either
+	//the old or the new blob, never a partial one.
+	Put(ctx context.Context, key string, r io.Reader) error
+
+	//Get returns the blob stored under `key`.
+	//The caller must close it when done.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+
+	//Delete deletes the blob stored under `key`.
+	//Deleting a key that doesn't exist is not an error.
+	Delete(ctx context.Context, key string) error
+}
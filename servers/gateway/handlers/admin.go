@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"JobTracker/servers/gateway/models/passwordresets"
+	"JobTracker/servers/gateway/models/users"
+	"JobTracker/servers/gateway/sessions"
+	"JobTracker/servers/problem"
+)
+
+//adminPathPrefix is the path the admin user endpoints are under
+const adminPathPrefix = "/v1/admin/users"
+
+//defaultPageSize is how many users or sign-ins are listed at once,
+//unless the request has a smaller limit. maxPageSize is the most.
+const (
+	defaultPageSize = 50
+	maxPageSize     = 100
+)
+
+//adminUser is how users are shown to admins, with
+//the account details other users can't see
+type adminUser struct {
+	*users.User
+	Email       string     `json:"email"`
+	Disabled    bool       `json:"disabled"`
+	SignedOutAt *time.Time `json:"signedOutAt,omitempty"`
+}
+
+//newAdminUser returns the admin's view of the user
+func newAdminUser(u *users.User) *adminUser {
+	return &adminUser{User: u, Email: u.Email, Disabled: u.Disabled, SignedOutAt: u.SignedOutAt}
+}
+
+//adminUsersPage is the body of a response listing users. Next is
+//the `after` parameter for the next page, or 0 if this is the last.
+type adminUsersPage struct {
+	Users []*adminUser `json:"users"`
+	Next  int64        `json:"next,omitempty"`
+}
+
+//signInsPage is the body of a response listing a user's sign-ins. Next
+//is the `before` parameter for the next page, or 0 if this is the last.
+type signInsPage struct {
+	SignIns []*users.UserSignIn `json:"signIns"`
+	Next    int64               `json:"next,omitempty"`
+}
+
+//issuedPasswordReset is the body of a response issuing a password
+//reset, the only time its token is shown
+type issuedPasswordReset struct {
+	*passwordresets.Reset
+	Token string `json:"token"`
+}
+
+//pageParams returns the limit and the ID parameter named
+//`cursor` from the request's query string
+func pageParams(r *http.Request, cursor string) (int, int64, error) {
+	query := r.URL.Query()
+	limit := defaultPageSize
+	if v := query.Get("limit"); len(v) != 0 {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPageSize {
+			return 0, 0, fmt.Errorf("limit must be 1 to %d", maxPageSize)
+		}
+		limit = n
+	}
+	var id int64
+	if v := query.Get(cursor); len(v) != 0 {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			return 0, 0, fmt.Errorf("%s must be a user ID", cursor)
+		}
+		id = n
+	}
+	return limit, id, nil
+}
+
+//AdminUsersHandler handles the admin API for managing users, and must
+//be wrapped with RequireAdmin:
+//
+//	GET   /v1/admin/users?after={UserID}&limit={n}  list users in order of ID
+//	PATCH /v1/admin/users/{UserID}                  change their role, or disable or enable them
+//	POST  /v1/admin/users/{UserID}/signout          end all of their sessions
+//	GET   /v1/admin/users/{UserID}/signins          list their sign-ins, newest first
+//	POST  /v1/admin/users/{UserID}/passwordreset    issue a token they can choose a new password with
+func (ctx *HandlerContext) AdminUsersHandler(w http.ResponseWriter, r *http.Request) {
+	admin := RequestUser(r)
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, adminPathPrefix), "/"), "/")
+
+	if len(parts[0]) == 0 {
+		if r.Method != http.MethodGet {
+			problem.Error(w, r, "only GET method is allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		limit, after, err := pageParams(r, "after")
+		if err != nil {
+			problem.Error(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		//get one more than the limit to know if there is another page
+		listed, err := ctx.UserStore.List(r.Context(), after, limit+1)
+		if err != nil {
+			userStoreError(w, r, err)
+			return
+		}
+		page := &adminUsersPage{Users: []*adminUser{}}
+		if len(listed) > limit {
+			listed = listed[:limit]
+			page.Next = listed[limit-1].ID
+		}
+		for _, u := range listed {
+			page.Users = append(page.Users, newAdminUser(u))
+		}
+		respondWithJSON(w, r, http.StatusOK, page)
+		return
+	}
+
+	userID, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || len(parts) > 2 {
+		problem.Error(w, r, "invalid resource path", http.StatusBadRequest)
+		return
+	}
+	action := ""
+	if len(parts) == 2 {
+		action = parts[1]
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodPatch:
+		if !strings.HasPrefix(r.Header.Get(headerContentType), contentTypeJson) {
+			problem.Error(w, r, "request body must be in JSON", http.StatusUnsupportedMediaType)
+			return
+		}
+		defer r.Body.Close()
+		updates := &users.AccountUpdates{}
+		if err := json.NewDecoder(r.Body).Decode(updates); err != nil {
+			problem.Error(w, r, "error decoding account updates", http.StatusBadRequest)
+			return
+		}
+		if updates.Role != nil && !users.ValidRole(*updates.Role) {
+			validationError(w, r, users.ValidationErrors{{Field: "role", Message: fmt.Sprintf("must be %q or %q", users.RoleUser, users.RoleAdmin)}})
+			return
+		}
+		//admins can't lock themselves out
+		if userID == admin.ID && ((updates.Role != nil && *updates.Role != users.RoleAdmin) || (updates.Disabled != nil && *updates.Disabled)) {
+			problem.Error(w, r, "you can't disable your own account or remove your own admin role", http.StatusConflict)
+			return
+		}
+
+		u, err := ctx.UserStore.UpdateAccount(r.Context(), userID, updates)
+		if err != nil {
+			userStoreError(w, r, err)
+			return
+		}
+		ctx.SessionUsers.forget(userID)
+		respondWithJSON(w, r, http.StatusOK, newAdminUser(u))
+
+	case action == "signout" && r.Method == http.MethodPost:
+		err := ctx.UserStore.SignOut(r.Context(), userID, time.Now())
+		if err != nil {
+			userStoreError(w, r, err)
+			return
+		}
+		ctx.SessionUsers.forget(userID)
+		//the sessions are already refused by checkSession, so failing
+		//to delete them only leaves them in the store until they expire
+		if _, err := sessions.DeleteUserSessions(r.Context(), ctx.SessionStore, userID); err != nil {
+			log.Printf("error deleting the sessions of user %d: %v", userID, err)
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("signed out everywhere"))
+
+	case action == "signins" && r.Method == http.MethodGet:
+		limit, before, err := pageParams(r, "before")
+		if err != nil {
+			problem.Error(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if _, err := ctx.UserStore.GetByID(r.Context(), userID); err != nil {
+			userStoreError(w, r, err)
+			return
+		}
+		signIns, err := ctx.UserStore.GetSignIns(r.Context(), userID, before, limit+1)
+		if err != nil {
+			userStoreError(w, r, err)
+			return
+		}
+		page := &signInsPage{SignIns: signIns}
+		if len(signIns) > limit {
+			page.SignIns = signIns[:limit]
+			page.Next = signIns[limit-1].ID
+		}
+		respondWithJSON(w, r, http.StatusOK, page)
+
+	case action == "passwordreset" && r.Method == http.MethodPost:
+		if ctx.PasswordResetStore == nil {
+			problem.Error(w, r, "password resets are not available", http.StatusNotImplemented)
+			return
+		}
+		if _, err := ctx.UserStore.GetByID(r.Context(), userID); err != nil {
+			userStoreError(w, r, err)
+			return
+		}
+		token, hash, err := passwordresets.NewToken()
+		if err != nil {
+			problem.Internal(w, r, err, "unexpected error issuing password reset", http.StatusInternalServerError)
+			return
+		}
+		reset := &passwordresets.Reset{UserID: userID, ExpiresAt: time.Now().Add(passwordresets.Duration)}
+		if err := ctx.PasswordResetStore.Begin(r.Context(), hash, reset); err != nil {
+			problem.Internal(w, r, err, "unexpected error issuing password reset", http.StatusInternalServerError)
+			return
+		}
+		//the token is only shown now, for the admin to give to the user
+		respondWithJSON(w, r, http.StatusCreated, &issuedPasswordReset{Reset: reset, Token: token})
+
+	case action != "" && action != "signout" && action != "signins" && action != "passwordreset":
+		problem.Error(w, r, "invalid resource path", http.StatusNotFound)
+
+	default:
+		problem.Error(w, r, "request method not allowed", http.StatusMethodNotAllowed)
+	}
+}
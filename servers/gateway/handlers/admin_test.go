@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"JobTracker/servers/gateway/models/users"
+	"JobTracker/servers/gateway/sessions"
+)
+
+//adminRole is users.RoleAdmin, to take the address of for AccountUpdates
+var adminRole = users.RoleAdmin
+
+//newAdminTest returns a handler context with an admin, a session
+//for them and `n` other users
+func newAdminTest(t *testing.T, n int) *handlerTest {
+	tt := newHandlerTest(t)
+	me, _ := tt.ctx.UserStore.GetByEmail(context.Background(), "neo@matrix.net")
+	if _, err := tt.ctx.UserStore.UpdateAccount(context.Background(), me.ID, &users.AccountUpdates{Role: &adminRole}); err != nil {
+		t.Fatalf("unexpected error promoting user: %v", err)
+	}
+	for i := 0; i < n; i++ {
+		u := &users.User{Email: fmt.Sprintf("agent%d@matrix.net", i), UserName: fmt.Sprintf("agent%d", i)}
+		if err := u.SetPassword("redPill1!"); err != nil {
+			t.Fatalf("unexpected error setting password: %v", err)
+		}
+		if _, err := tt.ctx.UserStore.Insert(context.Background(), u); err != nil {
+			t.Fatalf("unexpected error inserting user: %v", err)
+		}
+	}
+	return tt
+}
+
+func TestRequireAdmin(t *testing.T) {
+	tt := newHandlerTest(t)
+	admin := tt.ctx.RequireAdmin(tt.ctx.AdminUsersHandler)
+
+	if status := tt.serve(t, admin, http.MethodGet, "/v1/admin/users", "", nil); status != http.StatusForbidden {
+		t.Errorf("wrong status code for a user who isn't an admin - got %v but expected %v", status, http.StatusForbidden)
+	}
+	request, _ := http.NewRequest(http.MethodGet, "/v1/admin/users", nil)
+	responseWriter := httptest.NewRecorder()
+	admin.ServeHTTP(responseWriter, request)
+	if responseWriter.Code != http.StatusUnauthorized {
+		t.Errorf("wrong status code without a session - got %v but expected %v", responseWriter.Code, http.StatusUnauthorized)
+	}
+
+	//the role is checked against the stored user, not the session
+	me, _ := tt.ctx.UserStore.GetByEmail(context.Background(), "neo@matrix.net")
+	tt.ctx.UserStore.UpdateAccount(context.Background(), me.ID, &users.AccountUpdates{Role: &adminRole})
+	if status := tt.serve(t, admin, http.MethodGet, "/v1/admin/users", "", nil); status != http.StatusOK {
+		t.Errorf("wrong status code for an admin - got %v but expected %v", status, http.StatusOK)
+	}
+}
+
+func TestAdminListUsers(t *testing.T) {
+	tt := newAdminTest(t, 4)
+	admin := tt.ctx.RequireAdmin(tt.ctx.AdminUsersHandler)
+
+	page := &adminUsersPage{}
+	if status := tt.serve(t, admin, http.MethodGet, "/v1/admin/users?limit=2", "", page); status != http.StatusOK {
+		t.Fatalf("wrong status code listing users - got %v but expected %v", status, http.StatusOK)
+	}
+	if len(page.Users) != 2 || page.Users[0].Email != "neo@matrix.net" || page.Users[0].Role != users.RoleAdmin || page.Next != page.Users[1].ID {
+		t.Fatalf("incorrect first page: %+v", page)
+	}
+
+	var listed []string
+	for after := page.Next; after != 0; after = page.Next {
+		page = &adminUsersPage{}
+		if status := tt.serve(t, admin, http.MethodGet, fmt.Sprintf("/v1/admin/users?limit=2&after=%d", after), "", page); status != http.StatusOK {
+			t.Fatalf("wrong status code listing users - got %v but expected %v", status, http.StatusOK)
+		}
+		for _, u := range page.Users {
+			listed = append(listed, u.UserName)
+		}
+	}
+	if fmt.Sprint(listed) != "[agent1 agent2 agent3]" {
+		t.Errorf("incorrect users on later pages: %v", listed)
+	}
+
+	for _, query := range []string{"limit=0", "limit=101", "limit=x", "after=x"} {
+		if status := tt.serve(t, admin, http.MethodGet, "/v1/admin/users?"+query, "", nil); status != http.StatusBadRequest {
+			t.Errorf("wrong status code for %s - got %v but expected %v", query, status, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestAdminUpdateUser(t *testing.T) {
+	tt := newAdminTest(t, 1)
+	admin := tt.ctx.RequireAdmin(tt.ctx.AdminUsersHandler)
+	me, _ := tt.ctx.UserStore.GetByEmail(context.Background(), "neo@matrix.net")
+	agent, _ := tt.ctx.UserStore.GetByEmail(context.Background(), "agent0@matrix.net")
+	path := fmt.Sprintf("/v1/admin/users/%d", agent.ID)
+
+	cases := []struct {
+		name   string
+		path   string
+		body   string
+		status int
+	}{
+		{"Unknown Role", path, `{"role": "root"}`, http.StatusUnprocessableEntity},
+		{"Bad Body", path, `{`, http.StatusBadRequest},
+		{"Unknown User", "/v1/admin/users/999", `{"disabled": true}`, http.StatusNotFound},
+		{"Demote Self", fmt.Sprintf("/v1/admin/users/%d", me.ID), `{"role": "user"}`, http.StatusConflict},
+		{"Disable Self", fmt.Sprintf("/v1/admin/users/%d", me.ID), `{"disabled": true}`, http.StatusConflict},
+		{"Bad ID", "/v1/admin/users/agent0", `{"disabled": true}`, http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		if status := tt.serve(t, admin, http.MethodPatch, c.path, c.body, nil); status != c.status {
+			t.Errorf("case %s: wrong status code - got %v but expected %v", c.name, status, c.status)
+		}
+	}
+
+	updated := &adminUser{}
+	if status := tt.serve(t, admin, http.MethodPatch, path, `{"role": "admin", "disabled": true}`, updated); status != http.StatusOK {
+		t.Fatalf("wrong status code updating user - got %v but expected %v", status, http.StatusOK)
+	}
+	if updated.Role != users.RoleAdmin || !updated.Disabled || updated.Email != agent.Email {
+		t.Errorf("incorrect updated user: %+v", updated)
+	}
+
+	//disabled users can't sign in
+	status := tt.serve(t, tt.ctx.SessionsHandler, http.MethodPost, "/v1/sessions", `{"email": "agent0@matrix.net", "password": "redPill1!"}`, nil)
+	if status != http.StatusForbidden {
+		t.Errorf("wrong status code signing in while disabled - got %v but expected %v", status, http.StatusForbidden)
+	}
+	tt.serve(t, admin, http.MethodPatch, path, `{"disabled": false}`, nil)
+	status = tt.serve(t, tt.ctx.SessionsHandler, http.MethodPost, "/v1/sessions", `{"email": "agent0@matrix.net", "password": "redPill1!"}`, nil)
+	if status != http.StatusCreated {
+		t.Errorf("wrong status code signing in after being enabled - got %v but expected %v", status, http.StatusCreated)
+	}
+}
+
+func TestAdminSignOutAndSignIns(t *testing.T) {
+	tt := newAdminTest(t, 1)
+	admin := tt.ctx.RequireAdmin(tt.ctx.AdminUsersHandler)
+	me, _ := tt.ctx.UserStore.GetByEmail(context.Background(), "neo@matrix.net")
+
+	for i := 0; i < 3; i++ {
+		if status, _ := tt.signIn(t); status != http.StatusCreated {
+			t.Fatalf("wrong status code signing in - got %v but expected %v", status, http.StatusCreated)
+		}
+	}
+	page := &signInsPage{}
+	path := fmt.Sprintf("/v1/admin/users/%d/signins?limit=2", me.ID)
+	if status := tt.serve(t, admin, http.MethodGet, path, "", page); status != http.StatusOK {
+		t.Fatalf("wrong status code listing sign-ins - got %v but expected %v", status, http.StatusOK)
+	}
+	if len(page.SignIns) != 2 || page.Next != page.SignIns[1].ID || page.SignIns[0].ID < page.SignIns[1].ID {
+		t.Fatalf("incorrect first page of sign-ins: %+v", page)
+	}
+	next := page.Next
+	page = &signInsPage{}
+	tt.serve(t, admin, http.MethodGet, fmt.Sprintf("%s&before=%d", path, next), "", page)
+	if len(page.SignIns) != 1 || page.Next != 0 || page.SignIns[0].ID >= next {
+		t.Errorf("incorrect last page of sign-ins: %+v", page)
+	}
+	if status := tt.serve(t, admin, http.MethodGet, "/v1/admin/users/999/signins", "", nil); status != http.StatusNotFound {
+		t.Errorf("wrong status code listing an unknown user's sign-ins - got %v but expected %v", status, http.StatusNotFound)
+	}
+
+	//signing out everywhere ends the session making the request,
+	//and deletes it from the session store
+	if status := tt.serve(t, admin, http.MethodPost, fmt.Sprintf("/v1/admin/users/%d/signout", me.ID), "", nil); status != http.StatusOK {
+		t.Fatalf("wrong status code signing out - got %v but expected %v", status, http.StatusOK)
+	}
+	if err := tt.ctx.SessionStore.Get(context.Background(), tt.sid, &SessionState{}); !errors.Is(err, sessions.ErrStateNotFound) {
+		t.Errorf("incorrect error getting a signed out session: expected %v but got %v", sessions.ErrStateNotFound, err)
+	}
+	if status := tt.serve(t, admin, http.MethodGet, "/v1/admin/users", "", nil); status != http.StatusUnauthorized {
+		t.Errorf("wrong status code with an ended session - got %v but expected %v", status, http.StatusUnauthorized)
+	}
+	//the deleted session is no longer forwarded to services
+	handler := tt.ctx.Authorize("applications", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if u := RequestUser(r); u != nil {
+			t.Errorf("an ended session was forwarded as user %d", u.ID)
+		}
+	}))
+	tt.serve(t, handler.ServeHTTP, http.MethodGet, "/v1/applications", "", nil)
+}
+
+func TestDisabledSessionRefused(t *testing.T) {
+	tt := newAdminTest(t, 1)
+	agent, _ := tt.ctx.UserStore.GetByEmail(context.Background(), "agent0@matrix.net")
+	agentTest := tt.as(t, agent)
+	disabled := true
+	if _, err := tt.ctx.UserStore.UpdateAccount(context.Background(), agent.ID, &users.AccountUpdates{Disabled: &disabled}); err != nil {
+		t.Fatalf("unexpected error disabling user: %v", err)
+	}
+
+	//every handler with a session checks the stored user
+	handlers := []struct {
+		name    string
+		handler http.HandlerFunc
+		method  string
+		path    string
+	}{
+		{"User", tt.ctx.SpecificUserHandler, http.MethodGet, "/v1/users/me"},
+		{"Password", tt.ctx.PasswordHandler, http.MethodPut, "/v1/users/me/password"},
+		{"Avatar", tt.ctx.AvatarHandler, http.MethodDelete, "/v1/users/me/avatar"},
+	}
+	for _, h := range handlers {
+		if status := agentTest.serve(t, h.handler, h.method, h.path, "{}", nil); status != http.StatusForbidden {
+			t.Errorf("case %s: wrong status code for a disabled user - got %v but expected %v", h.name, status, http.StatusForbidden)
+		}
+	}
+}
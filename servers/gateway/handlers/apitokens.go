@@ -0,0 +1,252 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"JobTracker/servers/gateway/models/apitokens"
+	"JobTracker/servers/gateway/models/users"
+	"JobTracker/servers/problem"
+)
+
+//maxAPITokens is the most API tokens a user can have at once
+const maxAPITokens = 20
+
+//touchInterval is how often a token's last use is recorded,
+//so busy scripts don't write to the store on every request
+const touchInterval = time.Minute
+
+//newAPITokenRequest is the body of a request to create an API token
+type newAPITokenRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	//ExpiresInDays defaults to apitokens.DefaultDuration
+	ExpiresInDays int `json:"expiresInDays"`
+}
+
+//newAPITokenResponse is the body of the response when an API
+//token is created. The token is only shown this once.
+type newAPITokenResponse struct {
+	*apitokens.Token
+	Secret string `json:"token"`
+}
+
+//requestUserKey is the context key for the user making a request
+type requestUserKey struct{}
+
+//RequestUser returns the user that Authorize authenticated the
+//request as, or nil if it wasn't authenticated
+func RequestUser(r *http.Request) *users.User {
+	u, _ := r.Context().Value(requestUserKey{}).(*users.User)
+	return u
+}
+
+//apiTokenStoreError logs an error from the API token store and
+//responds that it is unavailable
+func apiTokenStoreError(w http.ResponseWriter, r *http.Request, err error) {
+	problem.Internal(w, r, fmt.Errorf("API token store error: %w", err), "API tokens are unavailable, please try again later", http.StatusServiceUnavailable)
+}
+
+//validate returns ValidationErrors listing every invalid
+//field, or nil if the request is valid
+func (req *newAPITokenRequest) validate() error {
+	errs := users.ValidationErrors{}
+	if name := strings.TrimSpace(req.Name); len(name) == 0 || utf8.RuneCountInString(name) > apitokens.MaxNameLength {
+		errs = append(errs, &users.FieldError{Field: "name", Message: fmt.Sprintf("must be 1 to %d characters", apitokens.MaxNameLength)})
+	}
+	if err := apitokens.ValidateScopes(req.Scopes); err != nil {
+		errs = append(errs, &users.FieldError{Field: "scopes", Message: err.Error()})
+	}
+	if maxDays := int(apitokens.MaxDuration / (24 * time.Hour)); req.ExpiresInDays < 0 || req.ExpiresInDays > maxDays {
+		errs = append(errs, &users.FieldError{Field: "expiresInDays", Message: fmt.Sprintf("must be 1 to %d days", maxDays)})
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+//APITokensHandler handles requests to manage the current user's API
+//tokens. GET /v1/users/me/tokens lists them, POST creates one and
+//DELETE /v1/users/me/tokens/{id} revokes one. Managing tokens needs
+//a session, so a leaked token can't be used to make more.
+func (ctx *HandlerContext) APITokensHandler(w http.ResponseWriter, r *http.Request) {
+	if ctx.APITokenStore == nil {
+		problem.Error(w, r, "API tokens are not available", http.StatusNotImplemented)
+		return
+	}
+	sessionState := &SessionState{}
+	if _, err := ctx.getState(r, sessionState); err != nil {
+		stateError(w, r, err)
+		return
+	}
+	userID := sessionState.User.ID
+
+	//The path is /v1/users/{user}/tokens or /v1/users/{user}/tokens/{id}
+	tokensPath := r.URL.Path
+	tokenID := int64(0)
+	if path.Base(tokensPath) != "tokens" {
+		id, err := strconv.ParseInt(path.Base(tokensPath), 10, 64)
+		if err != nil {
+			problem.Error(w, r, "invalid resource path", http.StatusBadRequest)
+			return
+		}
+		tokenID = id
+		tokensPath = path.Dir(tokensPath)
+	}
+	if userPath := path.Base(path.Dir(tokensPath)); userPath != "me" && userPath != strconv.FormatInt(userID, 10) {
+		problem.Error(w, r, "you are not authorized to take this action", http.StatusForbidden)
+		return
+	}
+
+	switch {
+	case tokenID == 0 && r.Method == http.MethodGet:
+		tokens, err := ctx.APITokenStore.GetByUserID(r.Context(), userID)
+		if err != nil {
+			apiTokenStoreError(w, r, err)
+			return
+		}
+		respondWithJSON(w, r, http.StatusOK, tokens)
+
+	case tokenID == 0 && r.Method == http.MethodPost:
+		if !strings.HasPrefix(r.Header.Get(headerContentType), contentTypeJson) {
+			problem.Error(w, r, "request body must be in JSON", http.StatusUnsupportedMediaType)
+			return
+		}
+		defer r.Body.Close()
+		req := &newAPITokenRequest{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			problem.Error(w, r, "error decoding API token", http.StatusBadRequest)
+			return
+		}
+		if err := req.validate(); err != nil {
+			validationError(w, r, err)
+			return
+		}
+		existing, err := ctx.APITokenStore.GetByUserID(r.Context(), userID)
+		if err != nil {
+			apiTokenStoreError(w, r, err)
+			return
+		}
+		if len(existing) >= maxAPITokens {
+			problem.Error(w, r, fmt.Sprintf("you can have at most %d API tokens, please revoke one first", maxAPITokens), http.StatusConflict)
+			return
+		}
+
+		token, hash, err := apitokens.NewToken()
+		if err != nil {
+			problem.Internal(w, r, err, "unexpected error generating API token", http.StatusInternalServerError)
+			return
+		}
+		duration := apitokens.DefaultDuration
+		if req.ExpiresInDays > 0 {
+			duration = time.Duration(req.ExpiresInDays) * 24 * time.Hour
+		}
+		now := time.Now()
+		inserted, err := ctx.APITokenStore.Insert(r.Context(), &apitokens.Token{
+			UserID:    userID,
+			Name:      strings.TrimSpace(req.Name),
+			Hash:      hash,
+			Scopes:    req.Scopes,
+			CreatedAt: now,
+			ExpiresAt: now.Add(duration),
+		})
+		if err != nil {
+			apiTokenStoreError(w, r, err)
+			return
+		}
+		respondWithJSON(w, r, http.StatusCreated, &newAPITokenResponse{Token: inserted, Secret: token})
+
+	case tokenID != 0 && r.Method == http.MethodDelete:
+		err := ctx.APITokenStore.Delete(r.Context(), userID, tokenID)
+		if errors.Is(err, apitokens.ErrTokenNotFound) {
+			problem.Error(w, r, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			apiTokenStoreError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("API token revoked"))
+
+	default:
+		problem.Error(w, r, "request method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+//Authorize authenticates requests to `resource`, such as
+//"applications", before they are passed to `next`. Requests can
+//be authenticated with a session ID, or with an API token that has
+//the scope for the resource and method. Requests with an invalid API
+//token or without the scope, or from a disabled or signed out user, are
+//refused; requests without either are passed on unauthenticated, for
+//the service to decide. RequestUser returns the authenticated user.
+func (ctx *HandlerContext) Authorize(resource string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sessionState := &SessionState{}
+		_, user, err := ctx.getSessionUser(r, sessionState, false)
+		if err == nil {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestUserKey{}, user)))
+			return
+		}
+		if sessionRejected(err) {
+			sessionError(w, r, err)
+			return
+		}
+		raw, found := apitokens.FromRequest(r)
+		if !found {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if ctx.APITokenStore == nil {
+			problem.Error(w, r, "API tokens are not available", http.StatusUnauthorized)
+			return
+		}
+
+		now := time.Now()
+		token, err := ctx.APITokenStore.Get(r.Context(), apitokens.HashToken(raw))
+		if errors.Is(err, apitokens.ErrTokenNotFound) || (err == nil && token.Expired(now)) {
+			problem.Error(w, r, "this API token is invalid, expired or revoked", http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			apiTokenStoreError(w, r, err)
+			return
+		}
+		if scope := apitokens.RequiredScope(resource, r.Method); !token.Allows(scope) {
+			problem.Error(w, r, fmt.Sprintf("this API token does not have the %s scope", scope), http.StatusForbidden)
+			return
+		}
+		LogUser(r, token.UserID)
+		//The token outlives profile changes, so forward the current profile
+		user, err = ctx.UserStore.GetByID(r.Context(), token.UserID)
+		if errors.Is(err, users.ErrUserNotFound) {
+			problem.Error(w, r, "this API token is invalid, expired or revoked", http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			userStoreError(w, r, err)
+			return
+		}
+		if err := checkUser(user); err != nil {
+			sessionError(w, r, err)
+			return
+		}
+		if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) >= touchInterval {
+			if err := ctx.APITokenStore.Touch(r.Context(), token.ID, now); err != nil {
+				log.Printf("error recording the use of API token %d: %v", token.ID, err)
+			}
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestUserKey{}, user)))
+	})
+}
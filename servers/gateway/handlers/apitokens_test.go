@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"JobTracker/servers/gateway/models/apitokens"
+)
+
+//newAPITokenTest returns a handler context with a user, a session
+//for them and an API token store
+func newAPITokenTest(t *testing.T) *handlerTest {
+	tt := newHandlerTest(t)
+	tt.ctx.APITokenStore = apitokens.NewMemStore()
+	return tt
+}
+
+func TestAPITokensHandler(t *testing.T) {
+	tt := newAPITokenTest(t)
+	specificUser := http.HandlerFunc(tt.ctx.SpecificUserHandler)
+
+	cases := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"No Name", `{"scopes": ["applications:read"]}`, http.StatusUnprocessableEntity},
+		{"No Scopes", `{"name": "import"}`, http.StatusUnprocessableEntity},
+		{"Unknown Scope", `{"name": "import", "scopes": ["users:write"]}`, http.StatusUnprocessableEntity},
+		{"Too Long", `{"name": "import", "scopes": ["applications:read"], "expiresInDays": 366}`, http.StatusUnprocessableEntity},
+		{"Bad Body", `{`, http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		if status := tt.serve(t, specificUser, http.MethodPost, "/v1/users/me/tokens", c.body, nil); status != c.status {
+			t.Errorf("case %s: wrong status code - got %v but expected %v", c.name, status, c.status)
+		}
+	}
+
+	created := &newAPITokenResponse{}
+	body := `{"name": "import", "scopes": ["applications:read", "applications:write"], "expiresInDays": 7}`
+	if status := tt.serve(t, specificUser, http.MethodPost, "/v1/users/me/tokens", body, created); status != http.StatusCreated {
+		t.Fatalf("wrong status code creating token - got %v but expected %v", status, http.StatusCreated)
+	}
+	if created.Token == nil || created.Name != "import" || len(created.Secret) == 0 {
+		t.Fatalf("incorrect created token: %+v", created)
+	}
+	if expected := created.CreatedAt.Add(7 * 24 * time.Hour); !created.ExpiresAt.Equal(expected) {
+		t.Errorf("incorrect expiry: expected %v but got %v", expected, created.ExpiresAt)
+	}
+
+	//the token itself is never listed
+	listResponse := httptest.NewRecorder()
+	request, _ := http.NewRequest(http.MethodGet, "/v1/users/me/tokens", nil)
+	request.Header.Set("Authorization", "Bearer "+tt.sid.String())
+	specificUser.ServeHTTP(listResponse, request)
+	listed := []map[string]interface{}{}
+	if err := json.Unmarshal(listResponse.Body.Bytes(), &listed); err != nil || len(listed) != 1 {
+		t.Fatalf("expected one listed token but got %s", listResponse.Body.String())
+	}
+	if _, found := listed[0]["token"]; found {
+		t.Errorf("listed tokens should not include the token: %v", listed[0])
+	}
+
+	path := fmt.Sprintf("/v1/users/me/tokens/%d", created.ID)
+	if status := tt.serve(t, specificUser, http.MethodDelete, path, "", nil); status != http.StatusOK {
+		t.Errorf("wrong status code revoking token - got %v but expected %v", status, http.StatusOK)
+	}
+	if status := tt.serve(t, specificUser, http.MethodDelete, path, "", nil); status != http.StatusNotFound {
+		t.Errorf("wrong status code revoking a revoked token - got %v but expected %v", status, http.StatusNotFound)
+	}
+	if status := tt.serve(t, specificUser, http.MethodDelete, "/v1/users/2/tokens/1", "", nil); status != http.StatusForbidden {
+		t.Errorf("wrong status code revoking another user's token - got %v but expected %v", status, http.StatusForbidden)
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	tt := newAPITokenTest(t)
+	me, _ := tt.ctx.UserStore.GetByEmail(context.Background(), "neo@matrix.net")
+	now := time.Now()
+	insertToken := func(raw string, expiresAt time.Time, scopes ...string) {
+		_, err := tt.ctx.APITokenStore.Insert(context.Background(), &apitokens.Token{
+			UserID: me.ID, Name: raw, Hash: apitokens.HashToken(raw), Scopes: scopes, CreatedAt: now, ExpiresAt: expiresAt,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error inserting token: %v", err)
+		}
+	}
+	insertToken("jt_reader", now.Add(time.Hour), apitokens.ScopeApplicationsRead)
+	insertToken("jt_expired", now.Add(-time.Hour), apitokens.ScopeApplicationsRead)
+
+	//next records the user the request was authorized as
+	var authorized int64
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorized = 0
+		if u := RequestUser(r); u != nil {
+			authorized = u.ID
+		}
+	})
+	handler := tt.ctx.Authorize("applications", next)
+
+	cases := []struct {
+		name   string
+		method string
+		auth   string
+		status int
+		userID int64
+	}{
+		{"Session", http.MethodPost, tt.sid.String(), http.StatusOK, me.ID},
+		{"Read Scope", http.MethodGet, "jt_reader", http.StatusOK, me.ID},
+		{"Missing Write Scope", http.MethodPost, "jt_reader", http.StatusForbidden, 0},
+		{"Expired", http.MethodGet, "jt_expired", http.StatusUnauthorized, 0},
+		{"Unknown", http.MethodGet, "jt_unknown", http.StatusUnauthorized, 0},
+		{"Unauthenticated", http.MethodGet, "", http.StatusOK, 0},
+	}
+	for _, c := range cases {
+		authorized = 0
+		request, _ := http.NewRequest(c.method, "/v1/applications", nil)
+		if len(c.auth) != 0 {
+			request.Header.Set("Authorization", "Bearer "+c.auth)
+		}
+		responseWriter := httptest.NewRecorder()
+		handler.ServeHTTP(responseWriter, request)
+		if responseWriter.Code != c.status || authorized != c.userID {
+			t.Errorf("case %s: expected %v as user %d but got %v as user %d", c.name, c.status, c.userID, responseWriter.Code, authorized)
+		}
+	}
+
+	//tokens in the URL aren't accepted
+	authorized = 0
+	request, _ := http.NewRequest(http.MethodGet, "/v1/applications?auth=Bearer%20jt_reader", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+	if authorized != 0 {
+		t.Errorf("a token in the auth query parameter authorized the request as user %d", authorized)
+	}
+
+	token, _ := tt.ctx.APITokenStore.Get(context.Background(), apitokens.HashToken("jt_reader"))
+	if token.LastUsedAt == nil {
+		t.Errorf("the token's use should have been recorded")
+	}
+	//API tokens can't manage API tokens
+	if status := tt.serve(t, http.HandlerFunc(tt.ctx.SpecificUserHandler), http.MethodGet, "/v1/users/me/tokens", "", nil); status != http.StatusOK {
+		t.Errorf("wrong status code listing tokens with a session - got %v but expected %v", status, http.StatusOK)
+	}
+	request, _ = http.NewRequest(http.MethodGet, "/v1/users/me/tokens", nil)
+	request.Header.Set("Authorization", "Bearer jt_reader")
+	responseWriter := httptest.NewRecorder()
+	tt.ctx.SpecificUserHandler(responseWriter, request)
+	if responseWriter.Code != http.StatusUnauthorized {
+		t.Errorf("wrong status code listing tokens with an API token - got %v but expected %v", responseWriter.Code, http.StatusUnauthorized)
+	}
+}
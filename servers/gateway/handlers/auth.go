@@ -2,15 +2,19 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"path"
 	"strconv"
 	"strings"
 	"time"
 
+	"JobTracker/servers/gateway/models/twofactor"
 	"JobTracker/servers/gateway/models/users"
 	"JobTracker/servers/gateway/sessions"
+	"JobTracker/servers/problem"
 )
 
 //TODO: define HTTP handler functions as described in the
@@ -21,17 +25,100 @@ import (
 const headerContentType = "Content-Type"
 const contentTypeJson = "application/json"
 
+//Codes of the problems the user handlers respond with,
+//besides the problem package's codes for each status
+const (
+	codeEmailTaken         = "email_taken"
+	codeUserNameTaken      = "username_taken"
+	codeInvalidCredentials = "invalid_credentials"
+	codeAccountDisabled    = "account_disabled"
+	codeSessionEnded       = "session_ended"
+)
+
+//conflict is the field and problem code of a duplicate error
+type conflict struct {
+	field string
+	code  string
+}
+
+//conflicts maps the user store's duplicate errors
+//to the NewUser field that caused the conflict
+var conflicts = map[error]conflict{
+	users.ErrDuplicateEmail:    {"email", codeEmailTaken},
+	users.ErrDuplicateUserName: {"userName", codeUserNameTaken},
+}
+
+//userStoreError responds to the client with the problem
+//that matches an error returned from the user store. Errors
+//other than the store's sentinel errors mean the store itself
+//failed, so their details are logged rather than sent to the client.
+func userStoreError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, users.ErrUserNotFound) {
+		problem.Error(w, r, "this user does not exist", http.StatusNotFound)
+		return
+	}
+	for dupErr, c := range conflicts {
+		if errors.Is(err, dupErr) {
+			p := problem.New(http.StatusConflict, c.code, dupErr.Error())
+			p.Errors = []*problem.FieldError{{Field: c.field, Message: dupErr.Error()}}
+			problem.Write(w, r, p)
+			return
+		}
+	}
+	problem.Internal(w, r, fmt.Errorf("user store error: %w", err),
+		"the user store is unavailable, please try again later", http.StatusServiceUnavailable)
+}
+
+//validationError responds to the client with the fields that failed validation
+func validationError(w http.ResponseWriter, r *http.Request, err error) {
+	var validationErrs users.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		problem.Error(w, r, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	fieldErrs := make([]*problem.FieldError, len(validationErrs))
+	for i, fe := range validationErrs {
+		fieldErrs[i] = &problem.FieldError{Field: fe.Field, Message: fe.Message}
+	}
+	problem.Validation(w, r, fieldErrs)
+}
+
+//respondWithJSON responds to the client with `v` encoded as JSON
+func respondWithJSON(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	response, err := json.Marshal(v)
+	if err != nil {
+		problem.Internal(w, r, err, "unexpected error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set(headerContentType, contentTypeJson)
+	w.WriteHeader(status)
+	w.Write(response)
+}
+
+//refreshSession replaces the user in the session state with `u`,
+//since it is what the gateway forwards to the other services in X-User,
+//and forgets the user's cached copy so sessions are checked against `u`.
+//Stateless sessions can't be changed, so they keep the old profile
+//until the user signs in again.
+func (ctx *HandlerContext) refreshSession(r *http.Request, sid sessions.SessionID, sessionState *SessionState, u *users.User) {
+	sessionState.User = u
+	ctx.SessionUsers.forget(u.ID)
+	if err := ctx.SessionStore.Save(r.Context(), sid, sessionState); err != nil && !errors.Is(err, sessions.ErrStatelessSave) {
+		log.Printf("error refreshing the session of user %d: %v", u.ID, err)
+	}
+}
+
 //UsersHandler handles requests for the "users" resource.
 func (ctx *HandlerContext) UsersHandler(w http.ResponseWriter, r *http.Request) {
 	//Validate that request is using POST method
 	if r.Method != http.MethodPost {
-		http.Error(w, "only POST method is allowed", http.StatusMethodNotAllowed)
+		problem.Error(w, r, "only POST method is allowed", http.StatusMethodNotAllowed)
 		return
 	}
 	//Validate that request content type is JSON
 	contentType := r.Header.Get(headerContentType)
 	if !strings.HasPrefix(contentType, contentTypeJson) {
-		http.Error(w, "request body must be in JSON", http.StatusUnsupportedMediaType)
+		problem.Error(w, r, "request body must be in JSON", http.StatusUnsupportedMediaType)
 		return
 	}
 	//Read request body and decode JSON into NewUser
@@ -42,30 +129,25 @@ func (ctx *HandlerContext) UsersHandler(w http.ResponseWriter, r *http.Request)
 	jsonDecoder := json.NewDecoder(requestBody)
 	err := jsonDecoder.Decode(nu)
 	if err != nil {
-		http.Error(w, "error decoding user data", http.StatusBadRequest)
+		problem.Error(w, r, "error decoding user data", http.StatusBadRequest)
 		return
 	}
 	//Validate user
-	u, err := nu.ToUser()
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
-	//Check if user already exists
-	existingUser, _ := ctx.UserStore.GetByEmail(u.Email)
-	if existingUser != nil {
-		http.Error(w, "this email address has already been used", http.StatusBadRequest)
+	u, err := nu.ToUser(ctx.PasswordPolicy, ctx.PasswordHasher)
+	if errors.Is(err, users.ErrPasswordCheckFailed) {
+		problem.Internal(w, r, err, "unable to check your password, please try again later", http.StatusServiceUnavailable)
 		return
 	}
-	existingUser, _ = ctx.UserStore.GetByUserName(u.UserName)
-	if existingUser != nil {
-		http.Error(w, "this username has already been used", http.StatusBadRequest)
+	if err != nil {
+		validationError(w, r, err)
 		return
 	}
-	//Create new record in user store
-	u, err = ctx.UserStore.Insert(u)
+	//Create new record in user store. The store enforces unique
+	//emails and usernames, so checking for existing users first
+	//would only race with concurrent signups.
+	u, err = ctx.UserStore.Insert(r.Context(), u)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("there was an error creating your account: %s", err.Error()), http.StatusInternalServerError)
+		userStoreError(w, r, err)
 		return
 	}
 	//Start new session
@@ -73,15 +155,15 @@ func (ctx *HandlerContext) UsersHandler(w http.ResponseWriter, r *http.Request)
 		StartTime: time.Now(),
 		User:      u,
 	}
-	_, err = sessions.BeginSession(ctx.SigningKey, ctx.SessionStore, sessionState, w)
+	_, err = sessions.BeginSession(r.Context(), ctx.SigningKey, ctx.SessionStore, sessionState, w)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("sorry, there was an error beginning your session: %s", err.Error()), http.StatusInternalServerError)
+		problem.Internal(w, r, err, "sorry, there was an error beginning your session", http.StatusInternalServerError)
 		return
 	}
 	//Respond to client
 	response, err := json.Marshal(u)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("sorry, there was an unknown error: %s", err.Error()), http.StatusInternalServerError)
+		problem.Internal(w, r, err, "sorry, there was an unknown error", http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set(headerContentType, contentTypeJson)
@@ -91,11 +173,40 @@ func (ctx *HandlerContext) UsersHandler(w http.ResponseWriter, r *http.Request)
 
 //SpecificUserHandler handles requests for a specific user.
 func (ctx *HandlerContext) SpecificUserHandler(w http.ResponseWriter, r *http.Request) {
+	//Avatars are served without authentication, so they can be shown
+	//in <img> tags. They, passwords, two-factor sign in, API tokens
+	//and connections have their own handlers.
+	switch path.Base(path.Dir(r.URL.Path)) {
+	case "tokens":
+		ctx.APITokensHandler(w, r)
+		return
+	case "connections":
+		ctx.ConnectionsHandler(w, r)
+		return
+	}
+	switch path.Base(r.URL.Path) {
+	case "avatar":
+		ctx.AvatarHandler(w, r)
+		return
+	case "password":
+		ctx.PasswordHandler(w, r)
+		return
+	case "2fa":
+		ctx.TwoFactorHandler(w, r)
+		return
+	case "tokens":
+		ctx.APITokensHandler(w, r)
+		return
+	case "connections":
+		ctx.ConnectionsHandler(w, r)
+		return
+	}
+
 	//Check if user is authenticated by checking if a session is active
 	sessionState := &SessionState{}
-	_, err := sessions.GetState(r, ctx.SigningKey, ctx.SessionStore, sessionState)
+	sid, err := ctx.getState(r, sessionState)
 	if err != nil {
-		http.Error(w, "not authorized", http.StatusUnauthorized)
+		stateError(w, r, err)
 		return
 	}
 	currentUser := sessionState.User
@@ -110,24 +221,33 @@ func (ctx *HandlerContext) SpecificUserHandler(w http.ResponseWriter, r *http.Re
 	} else {
 		requestedUserID, err = strconv.ParseInt(userPath, 10, 64)
 		if err != nil {
-			http.Error(w, "invalid resource path", http.StatusBadRequest)
+			problem.Error(w, r, "invalid resource path", http.StatusBadRequest)
 			return
 		}
 	}
 
 	//Handle GET requests
 	if r.Method == http.MethodGet {
-		requestedUser, err := ctx.UserStore.GetByID(requestedUserID)
+		requestedUser, err := ctx.UserStore.GetByID(r.Context(), requestedUserID)
 		if err != nil {
-			//TODO: need more specific error checking to handle UserNotExist vs DB error
-			http.Error(w, "this user does not exist", http.StatusNotFound)
+			userStoreError(w, r, err)
 			return
 		}
 
+		//Other users only see as much of the profile as the user allows
+		var profile interface{} = requestedUser
+		if requestedUser.ID != currentUser.ID {
+			profile, err = ctx.publicProfile(r.Context(), requestedUser, currentUser.ID)
+			if err != nil {
+				connectionStoreError(w, r, err)
+				return
+			}
+		}
+
 		//Respond to client
-		response, err := json.Marshal(requestedUser)
+		response, err := json.Marshal(profile)
 		if err != nil {
-			http.Error(w, "unexpected error", http.StatusInternalServerError)
+			problem.Internal(w, r, err, "unexpected error", http.StatusInternalServerError)
 			return
 		}
 		w.Header().Set(headerContentType, contentTypeJson)
@@ -138,14 +258,14 @@ func (ctx *HandlerContext) SpecificUserHandler(w http.ResponseWriter, r *http.Re
 	} else if r.Method == http.MethodPatch {
 		//Check if user is authorized
 		if userPath != "me" && requestedUserID != currentUser.ID {
-			http.Error(w, "you are not authorized to take this action", http.StatusForbidden)
+			problem.Error(w, r, "you are not authorized to take this action", http.StatusForbidden)
 			return
 		}
 
 		//Validate that request content type is JSON
 		contentType := r.Header.Get(headerContentType)
 		if !strings.HasPrefix(contentType, contentTypeJson) {
-			http.Error(w, "request body must be in JSON", http.StatusUnsupportedMediaType)
+			problem.Error(w, r, "request body must be in JSON", http.StatusUnsupportedMediaType)
 			return
 		}
 
@@ -154,19 +274,28 @@ func (ctx *HandlerContext) SpecificUserHandler(w http.ResponseWriter, r *http.Re
 		defer requestBody.Close()
 		updates := &users.Updates{}
 		jsonDecoder := json.NewDecoder(requestBody)
-		jsonDecoder.Decode(updates)
+		if err := jsonDecoder.Decode(updates); err != nil {
+			problem.Error(w, r, "error decoding profile updates", http.StatusBadRequest)
+			return
+		}
+		if err := updates.Validate(); err != nil {
+			validationError(w, r, err)
+			return
+		}
 
 		//Update user store with requested updates
-		currentUser, err := ctx.UserStore.Update(requestedUserID, updates)
+		currentUser, err := ctx.UserStore.Update(r.Context(), requestedUserID, updates)
 		if err != nil {
-			http.Error(w, "error updating the user profile", http.StatusBadRequest)
+			userStoreError(w, r, err)
 			return
 		}
 
+		ctx.refreshSession(r, sid, sessionState, currentUser)
+
 		//Respond to client
 		response, err := json.Marshal(currentUser)
 		if err != nil {
-			http.Error(w, "unexpected error", http.StatusInternalServerError)
+			problem.Internal(w, r, err, "unexpected error", http.StatusInternalServerError)
 			return
 		}
 		w.Header().Set(headerContentType, contentTypeJson)
@@ -175,7 +304,7 @@ func (ctx *HandlerContext) SpecificUserHandler(w http.ResponseWriter, r *http.Re
 
 		// Return error for other request types
 	} else {
-		http.Error(w, "request method not allowed", http.StatusMethodNotAllowed)
+		problem.Error(w, r, "request method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 }
@@ -185,7 +314,7 @@ func (ctx *HandlerContext) SessionsHandler(w http.ResponseWriter, r *http.Reques
 	if r.Method == http.MethodPost {
 		contentType := r.Header.Get(headerContentType)
 		if contentType != contentTypeJson {
-			http.Error(w, fmt.Sprintf("%v must be %v", headerContentType, contentTypeJson), http.StatusUnsupportedMediaType)
+			problem.Error(w, r, fmt.Sprintf("%v must be %v", headerContentType, contentTypeJson), http.StatusUnsupportedMediaType)
 			return
 		}
 
@@ -193,84 +322,143 @@ func (ctx *HandlerContext) SessionsHandler(w http.ResponseWriter, r *http.Reques
 		decoder := json.NewDecoder(r.Body)
 		cred := &users.Credentials{}
 		if err := decoder.Decode(cred); err != nil {
-			http.Error(w, fmt.Sprintf("error decoding credentials: %v", err), http.StatusBadRequest)
+			problem.Error(w, r, "error decoding credentials", http.StatusBadRequest)
 			return
 		}
 
 		// Get the user that matches with the given email
-		user, err := ctx.UserStore.GetByEmail(cred.Email)
+		user, err := ctx.UserStore.GetByEmail(r.Context(), cred.Email)
+		if errors.Is(err, users.ErrUserNotFound) {
+			// Check the password to take as long as authenticating a user
+			// would, so response times don't reveal which emails have accounts
+			ctx.padTiming(cred.Password)
+			signIns.WithLabelValues(signInPassword, signInFailure).Inc()
+			problem.ErrorCode(w, r, codeInvalidCredentials, "invalid credentials", http.StatusUnauthorized)
+			return
+		}
 		if err != nil {
-			// Sleep for 800 ms to match bcrypt authentication delay
-			time.Sleep(800 * time.Millisecond)
-			http.Error(w, "invalid credentials", http.StatusUnauthorized)
+			userStoreError(w, r, err)
 			return
 		}
 		// Authenticate user with the given password
 		err = user.Authenticate(cred.Password)
 		if err != nil {
-			http.Error(w, "invalid credentials", http.StatusUnauthorized)
+			signIns.WithLabelValues(signInPassword, signInFailure).Inc()
+			problem.ErrorCode(w, r, codeInvalidCredentials, "invalid credentials", http.StatusUnauthorized)
 			return
 		}
-
-		// Create new session
-		sessionState := &SessionState{
-			StartTime: time.Now(),
-			User:      user,
+		// Upgrade the hash if it was made with an old algorithm or parameters.
+		// The password was correct, so a failure here shouldn't stop the sign in.
+		if users.NeedsRehash(ctx.PasswordHasher, user.PassHash) {
+			if err := user.SetPasswordWith(ctx.PasswordHasher, cred.Password); err != nil {
+				log.Printf("error rehashing password for user %d: %v", user.ID, err)
+			} else if err := ctx.UserStore.UpdatePassHash(r.Context(), user.ID, user.PassHash); err != nil {
+				log.Printf("error storing rehashed password for user %d: %v", user.ID, err)
+			}
 		}
 
-		_, err = sessions.BeginSession(ctx.SigningKey, ctx.SessionStore, sessionState, w)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("unexpected error beginning session: %v", err), http.StatusInternalServerError)
-			return
-		}
+		ctx.completeSignIn(w, r, user, signInPassword)
+	} else {
+		problem.Error(w, r, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+}
 
-		// Log when and how a user signs in
-		userIP := r.RemoteAddr
-		// Use first IP address in the list if X-Forwarded-For header is included
-		headerIP := r.Header.Get("X-Forwarded-For")
-		if len(headerIP) != 0 {
-			userIP = headerIP
-		}
+//padTiming takes as long with the password as authenticating
+//a user with a stored hash like ctx.TimingPadHash would
+func (ctx *HandlerContext) padTiming(password string) {
+	if ctx.TimingPadHash == nil {
+		(&users.User{}).SetPasswordWith(ctx.PasswordHasher, password)
+		return
+	}
+	users.VerifyPassword(ctx.TimingPadHash, password)
+}
 
-		signIn := users.UserSignIn{
-			ID:         int64(0),
-			UserID:     user.ID,
-			SignInTime: time.Now(),
-			IP:         userIP,
+//completeSignIn finishes signing in a user who has proven who they are.
+//Disabled users are refused, and users with two-factor sign in must
+//enter a code before getting a session. `method` is how they signed in.
+func (ctx *HandlerContext) completeSignIn(w http.ResponseWriter, r *http.Request, user *users.User, method string) {
+	if err := checkUser(user); err != nil {
+		signIns.WithLabelValues(method, signInFailure).Inc()
+		sessionError(w, r, err)
+		return
+	}
+	if ctx.TwoFactorStore != nil {
+		enrollment, err := ctx.TwoFactorStore.Get(r.Context(), user.ID)
+		if err != nil && !errors.Is(err, twofactor.ErrNotEnrolled) {
+			twoFactorStoreError(w, r, err)
+			return
 		}
-		ctx.UserStore.LogSignIn(&signIn)
-
-		// Respond with copy of user profile
-		w.Header().Set(headerContentType, contentTypeJson)
-
-		w.WriteHeader(http.StatusCreated)
-		if err := json.NewEncoder(w).Encode(user); err != nil {
-			http.Error(w, fmt.Sprintf("unexpected error encoding response to JSON: %v", err), http.StatusInternalServerError)
+		if err == nil && enrollment.Confirmed {
+			signIns.WithLabelValues(method, signInChallenge).Inc()
+			ctx.beginChallenge(w, r, user)
 			return
 		}
-		// Return status code 201 to indicate a new response was created
-	} else {
-		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+	}
+	ctx.beginUserSession(w, r, user, method)
+}
+
+//beginUserSession begins a session for the user who has just signed in,
+//logs the sign in and responds with the user's profile. `method` is
+//how they signed in.
+func (ctx *HandlerContext) beginUserSession(w http.ResponseWriter, r *http.Request, user *users.User, method string) {
+	// Create new session
+	sessionState := &SessionState{
+		StartTime: time.Now(),
+		User:      user,
+	}
+
+	_, err := sessions.BeginSession(r.Context(), ctx.SigningKey, ctx.SessionStore, sessionState, w)
+	if err != nil {
+		problem.Internal(w, r, err, "unexpected error beginning session", http.StatusInternalServerError)
 		return
 	}
+	LogUser(r, user.ID)
+	signIns.WithLabelValues(method, signInSuccess).Inc()
+
+	// Log when and how a user signs in
+	userIP := r.RemoteAddr
+	// Use first IP address in the list if X-Forwarded-For header is included
+	headerIP := r.Header.Get("X-Forwarded-For")
+	if len(headerIP) != 0 {
+		userIP = headerIP
+	}
+
+	signIn := users.UserSignIn{
+		ID:         int64(0),
+		UserID:     user.ID,
+		SignInTime: time.Now(),
+		IP:         userIP,
+	}
+	ctx.UserStore.LogSignIn(r.Context(), &signIn)
+
+	// Respond with copy of user profile
+	w.Header().Set(headerContentType, contentTypeJson)
+
+	// Return status code 201 to indicate a new response was created
+	w.WriteHeader(http.StatusCreated)
+	//the status has been sent, so an error can only be logged
+	if err := json.NewEncoder(w).Encode(user); err != nil {
+		log.Printf("error encoding the profile of user %d: %v", user.ID, err)
+	}
 }
 
 //SpecificSessionHandler handles requests related to a specific user's authenticated session
 func (ctx *HandlerContext) SpecificSessionHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodDelete {
 		if path.Base(r.URL.Path) != "mine" {
-			http.Error(w, "unauthorized to delete current session", http.StatusForbidden)
+			problem.Error(w, r, "unauthorized to delete current session", http.StatusForbidden)
 			return
 		}
 		_, err := sessions.EndSession(r, ctx.SigningKey, ctx.SessionStore)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("unexpected error ending session: %v", err), http.StatusInternalServerError)
+			problem.Internal(w, r, err, "unexpected error ending session", http.StatusInternalServerError)
 			return
 		}
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("signed out"))
 	} else {
-		http.Error(w, "Only DELETE method is allowed", http.StatusMethodNotAllowed)
+		problem.Error(w, r, "Only DELETE method is allowed", http.StatusMethodNotAllowed)
 		return
 	}
 }
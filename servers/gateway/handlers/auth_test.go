@@ -3,18 +3,25 @@ package handlers
 import (
 	"JobTracker/servers/gateway/models/users"
 	"JobTracker/servers/gateway/sessions"
+	"JobTracker/servers/problem"
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
 	"encoding/json"
 )
 
+func stringPtr(s string) *string {
+	return &s
+}
+
 func createTestUser() *users.User {
 	user := &users.User{ID: 1}
 	return user
@@ -205,25 +212,25 @@ func TestUserHandler(t *testing.T) {
 			"NewUser fails validation",
 			createInvalidNewUser(),
 			users.NewMockStore(false, nil, nil),
-			http.StatusBadRequest,
+			http.StatusUnprocessableEntity,
 		},
 		{
 			"Email already exists",
 			createValidNewUser(),
 			users.NewMockStore(false, &users.User{Email: "test@test.com"}, nil),
-			http.StatusBadRequest,
+			http.StatusConflict,
 		},
 		{
 			"UserName already exists",
 			createValidNewUser(),
-			users.NewMockStore(false, &users.User{Email: "test"}, nil),
-			http.StatusBadRequest,
+			users.NewMockStore(false, &users.User{Email: "other@test.com", UserName: "test"}, nil),
+			http.StatusConflict,
 		},
 		{
-			"UserStore insert fails",
+			"UserStore unavailable",
 			createValidNewUser(),
 			users.NewMockStore(true, nil, nil),
-			http.StatusInternalServerError,
+			http.StatusServiceUnavailable,
 		},
 	}
 	for _, uc := range userCreationCases {
@@ -282,6 +289,21 @@ func newSpecificUserHandlerCase() SpecificUserHandlerCase {
 	}
 }
 
+//sessionUserStore finds the session's user by ID, since every
+//session is checked against the store, and otherwise behaves
+//like the mock store, which ignores IDs
+type sessionUserStore struct {
+	*users.MockStore
+	me *users.User
+}
+
+func (s *sessionUserStore) GetByID(ctx context.Context, id int64) (*users.User, error) {
+	if id == s.me.ID {
+		return s.me, nil
+	}
+	return s.MockStore.GetByID(ctx, id)
+}
+
 func callSpecificUserHandler(c SpecificUserHandlerCase, t *testing.T) {
 	me := &users.User{ID: 1}
 	signingKey := "testKey"
@@ -314,7 +336,7 @@ func callSpecificUserHandler(c SpecificUserHandlerCase, t *testing.T) {
 		if err != nil {
 			t.Fatalf("unexpected error creating session ID")
 		}
-		err = sessionStore.Save(sid, sessionState)
+		err = sessionStore.Save(context.Background(), sid, sessionState)
 		if err != nil {
 			t.Fatalf("unexpected error saving to session store")
 		}
@@ -329,14 +351,14 @@ func callSpecificUserHandler(c SpecificUserHandlerCase, t *testing.T) {
 	} else if c.requestedUserExists {
 		userStore = users.NewMockStore(false, c.requestedUser, nil)
 	} else {
-		userStore = users.NewMockStore(true, nil, nil)
+		userStore = users.NewMockStore(false, nil, nil)
 	}
 
 	// Create handler and serve HTTP requests
 	ctx := HandlerContext{
 		SigningKey:   signingKey,
 		SessionStore: sessionStore,
-		UserStore:    userStore,
+		UserStore:    &sessionUserStore{MockStore: userStore, me: me},
 	}
 	handler := http.HandlerFunc(ctx.SpecificUserHandler)
 
@@ -533,20 +555,20 @@ func TestSpecificUserHandler(t *testing.T) {
 		{
 			"Valid PATCH request",
 			contentTypeJson,
-			&users.Updates{FirstName: "Hello", LastName: "World"},
+			&users.Updates{FirstName: stringPtr("Hello"), LastName: stringPtr("World")},
 			http.StatusOK,
 		},
 		{
 			"PATCH payload Content-Type not JSON",
 			"text/html",
-			&users.Updates{FirstName: "Hello", LastName: "World"},
+			&users.Updates{FirstName: stringPtr("Hello"), LastName: stringPtr("World")},
 			http.StatusUnsupportedMediaType,
 		},
 		{
 			"PATCH payload invalid updates",
 			contentTypeJson,
-			&users.Updates{FirstName: "$$$", LastName: "$$$"},
-			http.StatusBadRequest,
+			&users.Updates{FirstName: stringPtr("$$$"), LastName: stringPtr("$$$")},
+			http.StatusUnprocessableEntity,
 		},
 	}
 	for _, ppc := range patchPayloadCases {
@@ -646,12 +668,24 @@ func TestSessionsHandler(t *testing.T) {
 			`{"email": "wrongemail@uw.edu", "password": "testPassword"}`,
 			"testKey",
 			sessions.NewMemStore(time.Hour, time.Minute),
-			users.NewMockStore(true, createTestUserWithCredentials(), nil),
+			users.NewMockStore(false, nil, nil),
 			createTestUser(),
 			true,
 			http.StatusUnauthorized,
 			contentTypeJson,
 		},
+		{
+			"UserStore unavailable",
+			"POST",
+			`{"email": "test@test.com", "password": "testPassword"}`,
+			"testKey",
+			sessions.NewMemStore(time.Hour, time.Minute),
+			users.NewMockStore(true, createTestUserWithCredentials(), nil),
+			createTestUser(),
+			true,
+			http.StatusServiceUnavailable,
+			contentTypeJson,
+		},
 		{
 			"Malformed Credentials",
 			"POST",
@@ -726,6 +760,62 @@ func TestSessionsHandler(t *testing.T) {
 
 }
 
+func TestSessionsHandlerRehash(t *testing.T) {
+	userStore := users.NewMemStore()
+	ctx := HandlerContext{
+		SigningKey:   "testKey",
+		SessionStore: sessions.NewMemStore(time.Hour, time.Minute),
+		UserStore:    userStore,
+	}
+	//hash the password with an older algorithm than the hasher's
+	passHash, err := (&users.BcryptHasher{Cost: 4}).Hash("testPassword")
+	if err != nil {
+		t.Fatalf("unexpected error hashing password: %v", err)
+	}
+	u, err := userStore.Insert(context.Background(), &users.User{Email: "test@uw.edu", UserName: "test", PassHash: passHash})
+	if err != nil {
+		t.Fatalf("unexpected error inserting user: %v", err)
+	}
+
+	signIn := func(password string) int {
+		body := fmt.Sprintf(`{"email": "test@uw.edu", "password": %q}`, password)
+		request, _ := http.NewRequest(http.MethodPost, "/v1/sessions", strings.NewReader(body))
+		request.Header.Set(headerContentType, contentTypeJson)
+		responseWriter := httptest.NewRecorder()
+		http.HandlerFunc(ctx.SessionsHandler).ServeHTTP(responseWriter, request)
+		return responseWriter.Code
+	}
+	storedHash := func() []byte {
+		stored, err := userStore.GetByID(context.Background(), u.ID)
+		if err != nil {
+			t.Fatalf("unexpected error getting user: %v", err)
+		}
+		return stored.PassHash
+	}
+
+	//a failed sign in leaves the hash alone
+	if status := signIn("wrongPassword"); status != http.StatusUnauthorized {
+		t.Fatalf("wrong status code - got %v but expected %v", status, http.StatusUnauthorized)
+	}
+	if !bytes.Equal(storedHash(), passHash) {
+		t.Errorf("the hash was changed by a failed sign in")
+	}
+
+	if status := signIn("testPassword"); status != http.StatusCreated {
+		t.Fatalf("wrong status code - got %v but expected %v", status, http.StatusCreated)
+	}
+	rehashed := storedHash()
+	if users.NeedsRehash(ctx.PasswordHasher, rehashed) {
+		t.Errorf("the outdated hash was not upgraded on sign in: %s", rehashed)
+	}
+	if err := users.VerifyPassword(rehashed, "testPassword"); err != nil {
+		t.Errorf("the upgraded hash doesn't match the password: %v", err)
+	}
+	if status := signIn("testPassword"); status != http.StatusCreated {
+		t.Errorf("wrong status code signing in with the upgraded hash - got %v but expected %v", status, http.StatusCreated)
+	}
+}
+
 func TestSpecificSessionHandler(t *testing.T) {
 	// Check that only DELETE is allowed
 	methodCases := []struct {
@@ -810,7 +900,7 @@ func TestSpecificSessionHandler(t *testing.T) {
 			if err != nil {
 				t.Errorf("unexpected error setting up authentication for test case: %v", err)
 			}
-			err = ctx.SessionStore.Save(sid, testUser)
+			err = ctx.SessionStore.Save(context.Background(), sid, testUser)
 			if err != nil {
 				t.Errorf("unexpected error setting up authentication for test case: %v", err)
 			}
@@ -869,7 +959,7 @@ func TestSpecificSessionHandler(t *testing.T) {
 		if err != nil {
 			t.Errorf("unexpected error setting up authentication for test case: %v", err)
 		}
-		err = ctx.SessionStore.Save(sid, testUser)
+		err = ctx.SessionStore.Save(context.Background(), sid, testUser)
 		if err != nil {
 			t.Errorf("unexpected error setting up authentication for test case: %v", err)
 		}
@@ -883,3 +973,338 @@ func TestSpecificSessionHandler(t *testing.T) {
 		}
 	}
 }
+
+func TestUserHandlerWithMemStore(t *testing.T) {
+	// Sign up once, then try again with the same email or username
+	userStore := users.NewMemStore()
+	c := newUsersHandlerCase()
+	c.name = "First signup"
+	callUsersHandlerWithStore(c, userStore, t)
+
+	duplicateCases := []struct {
+		name          string
+		newUser       *users.NewUser
+		expectedCode  int
+		expectedField string
+	}{
+		{
+			"Email already used",
+			&users.NewUser{Email: "test@test.com", Password: "password123", PasswordConf: "password123", UserName: "other"},
+			http.StatusConflict,
+			"email",
+		},
+		{
+			"UserName already used",
+			&users.NewUser{Email: "other@test.com", Password: "password123", PasswordConf: "password123", UserName: "test"},
+			http.StatusConflict,
+			"userName",
+		},
+		{
+			"Different email and username",
+			&users.NewUser{Email: "other@test.com", Password: "password123", PasswordConf: "password123", UserName: "other"},
+			http.StatusCreated,
+			"",
+		},
+	}
+	for _, dc := range duplicateCases {
+		c := newUsersHandlerCase()
+		c.name = dc.name
+		c.body = dc.newUser
+		c.expectedCode = dc.expectedCode
+		responseWriter := callUsersHandlerWithStore(c, userStore, t)
+		if dc.expectedCode == http.StatusConflict {
+			checkConflictResponse(t, dc.name, responseWriter, dc.expectedField)
+		}
+	}
+
+	// The new users can be found by their assigned IDs
+	for _, email := range []string{"test@test.com", "other@test.com"} {
+		u, err := userStore.GetByEmail(context.Background(), email)
+		if err != nil {
+			t.Fatalf("expected user %s to be stored but got %v", email, err)
+		}
+		if found, err := userStore.GetByID(context.Background(), u.ID); err != nil || found.Email != email {
+			t.Errorf("user %s was not stored under its ID %d", email, u.ID)
+		}
+	}
+}
+
+func callUsersHandlerWithStore(c UsersHandlerCase, userStore users.Store, t *testing.T) *httptest.ResponseRecorder {
+	body, err := json.Marshal(c.body)
+	if err != nil {
+		t.Fatalf("unexpected error marshaling new user to JSON")
+	}
+	request, err := http.NewRequest(c.method, "/v1/users", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatalf("unexpected error sending requests")
+	}
+	request.Header.Set(headerContentType, c.contentType)
+	ctx := HandlerContext{
+		SigningKey:   c.signingKey,
+		SessionStore: sessions.NewMemStore(time.Hour, time.Minute),
+		UserStore:    userStore,
+	}
+	responseWriter := httptest.NewRecorder()
+	http.HandlerFunc(ctx.UsersHandler).ServeHTTP(responseWriter, request)
+	if status := responseWriter.Code; status != c.expectedCode {
+		t.Errorf("case %s: wrong status code - got %v but expected %v", c.name, status, c.expectedCode)
+	}
+	return responseWriter
+}
+
+func checkConflictResponse(t *testing.T, name string, responseWriter *httptest.ResponseRecorder, expectedField string) {
+	t.Helper()
+	if contentType := responseWriter.Header().Get(headerContentType); contentType != problem.ContentType {
+		t.Errorf("case %s: wrong content type - got %v but expected %v", name, contentType, problem.ContentType)
+	}
+	conflict := &problem.Problem{}
+	if err := json.Unmarshal(responseWriter.Body.Bytes(), conflict); err != nil {
+		t.Errorf("case %s: unexpected error unmarshaling conflict response: %v", name, err)
+		return
+	}
+	if conflict.Status != http.StatusConflict || len(conflict.Errors) != 1 || conflict.Errors[0].Field != expectedField || len(conflict.Errors[0].Message) == 0 {
+		t.Errorf("case %s: wrong conflict response - got %+v but expected field %v", name, conflict, expectedField)
+	}
+	if expectedCode := map[string]string{"email": codeEmailTaken, "userName": codeUserNameTaken}[expectedField]; conflict.Code != expectedCode {
+		t.Errorf("case %s: wrong conflict code - got %v but expected %v", name, conflict.Code, expectedCode)
+	}
+}
+
+func TestConcurrentSignups(t *testing.T) {
+	// Every signup races for the same email, so exactly one should win
+	const numSignups = 8
+	userStore := users.NewMemStore()
+	ctx := HandlerContext{
+		SigningKey:   "testKey",
+		SessionStore: sessions.NewMemStore(time.Hour, time.Minute),
+		UserStore:    userStore,
+	}
+
+	responses := make(chan *httptest.ResponseRecorder, numSignups)
+	for i := 0; i < numSignups; i++ {
+		nu := createValidNewUser()
+		nu.UserName = fmt.Sprintf("test%d", i)
+		body, err := json.Marshal(nu)
+		if err != nil {
+			t.Fatalf("unexpected error marshaling new user to JSON")
+		}
+		go func() {
+			request := httptest.NewRequest(http.MethodPost, "/v1/users", bytes.NewBuffer(body))
+			request.Header.Set(headerContentType, contentTypeJson)
+			responseWriter := httptest.NewRecorder()
+			http.HandlerFunc(ctx.UsersHandler).ServeHTTP(responseWriter, request)
+			responses <- responseWriter
+		}()
+	}
+
+	created := 0
+	for i := 0; i < numSignups; i++ {
+		responseWriter := <-responses
+		switch responseWriter.Code {
+		case http.StatusCreated:
+			created++
+		case http.StatusConflict:
+			checkConflictResponse(t, "Concurrent signup", responseWriter, "email")
+		default:
+			t.Errorf("wrong status code - got %v but expected %v or %v", responseWriter.Code, http.StatusCreated, http.StatusConflict)
+		}
+	}
+	if created != 1 {
+		t.Errorf("expected exactly one signup to succeed but %d did", created)
+	}
+	if _, err := userStore.GetByEmail(context.Background(), createValidNewUser().Email); err != nil {
+		t.Errorf("expected the winning signup to be stored but got %v", err)
+	}
+}
+
+func TestSpecificUserHandlerWithMemStore(t *testing.T) {
+	signingKey := "testKey"
+	sessionStore := sessions.NewMemStore(time.Hour, time.Minute)
+	userStore := users.NewMemStore()
+	me, err := userStore.Insert(context.Background(), &users.User{Email: "me@test.com", UserName: "me", FirstName: "Me"})
+	if err != nil {
+		t.Fatalf("unexpected error inserting user: %v", err)
+	}
+	other, err := userStore.Insert(context.Background(), &users.User{Email: "other@test.com", UserName: "other", FirstName: "Other"})
+	if err != nil {
+		t.Fatalf("unexpected error inserting user: %v", err)
+	}
+	sid, err := sessions.NewSessionID(signingKey)
+	if err != nil {
+		t.Fatalf("unexpected error creating session ID")
+	}
+	if err := sessionStore.Save(context.Background(), sid, &SessionState{User: me}); err != nil {
+		t.Fatalf("unexpected error saving to session store")
+	}
+	ctx := HandlerContext{
+		SigningKey:   signingKey,
+		SessionStore: sessionStore,
+		UserStore:    userStore,
+	}
+
+	cases := []struct {
+		name              string
+		path              string
+		expectedCode      int
+		expectedFirstName string
+	}{
+		{"GET me", "me", http.StatusOK, "Me"},
+		{"GET another existing user", fmt.Sprint(other.ID), http.StatusOK, "Other"},
+		{"GET user that was never created", "999", http.StatusNotFound, ""},
+	}
+	for _, c := range cases {
+		request, _ := http.NewRequest(http.MethodGet, "/v1/users/"+c.path, nil)
+		request.Header.Set("Authorization", "Bearer "+sid.String())
+		responseWriter := httptest.NewRecorder()
+		http.HandlerFunc(ctx.SpecificUserHandler).ServeHTTP(responseWriter, request)
+		if status := responseWriter.Code; status != c.expectedCode {
+			t.Errorf("case %s: wrong status code - got %v but expected %v", c.name, status, c.expectedCode)
+		}
+		if c.expectedCode == http.StatusOK {
+			responseUser := &users.User{}
+			if err := json.Unmarshal(responseWriter.Body.Bytes(), responseUser); err != nil {
+				t.Fatalf("case %s: unexpected error unmarshaling response user", c.name)
+			}
+			if responseUser.FirstName != c.expectedFirstName {
+				t.Errorf("case %s: wrong user - got %v but expected %v", c.name, responseUser.FirstName, c.expectedFirstName)
+			}
+		}
+	}
+}
+
+func TestSpecificUserHandlerStoreUnavailable(t *testing.T) {
+	signingKey := "testKey"
+	sessionStore := sessions.NewMemStore(time.Hour, time.Minute)
+	sid, err := sessions.NewSessionID(signingKey)
+	if err != nil {
+		t.Fatalf("unexpected error creating session ID")
+	}
+	if err := sessionStore.Save(context.Background(), sid, &SessionState{User: &users.User{ID: 1}}); err != nil {
+		t.Fatalf("unexpected error saving to session store")
+	}
+	ctx := HandlerContext{
+		SigningKey:   signingKey,
+		SessionStore: sessionStore,
+		UserStore:    users.NewMockStore(true, nil, nil),
+	}
+
+	cases := []struct {
+		name   string
+		method string
+		body   string
+	}{
+		{"GET", http.MethodGet, ""},
+		{"PATCH", http.MethodPatch, `{"firstName": "Test"}`},
+	}
+	for _, c := range cases {
+		request, _ := http.NewRequest(c.method, "/v1/users/me", bytes.NewBufferString(c.body))
+		request.Header.Set("Authorization", "Bearer "+sid.String())
+		request.Header.Set(headerContentType, contentTypeJson)
+		responseWriter := httptest.NewRecorder()
+		http.HandlerFunc(ctx.SpecificUserHandler).ServeHTTP(responseWriter, request)
+		if status := responseWriter.Code; status != http.StatusServiceUnavailable {
+			t.Errorf("case %s: wrong status code - got %v but expected %v", c.name, status, http.StatusServiceUnavailable)
+		}
+		if strings.Contains(responseWriter.Body.String(), "got error") {
+			t.Errorf("case %s: response leaked the store error: %s", c.name, responseWriter.Body.String())
+		}
+	}
+}
+
+func TestSpecificUserHandlerPatchWithMemStore(t *testing.T) {
+	signingKey := "testKey"
+	sessionStore := sessions.NewMemStore(time.Hour, time.Minute)
+	userStore := users.NewMemStore()
+	me, err := userStore.Insert(context.Background(), &users.User{Email: "me@test.com", UserName: "me", FirstName: "Me", LastName: "Myself"})
+	if err != nil {
+		t.Fatalf("unexpected error inserting user: %v", err)
+	}
+	if _, err := userStore.Insert(context.Background(), &users.User{Email: "other@test.com", UserName: "other"}); err != nil {
+		t.Fatalf("unexpected error inserting user: %v", err)
+	}
+	sid, err := sessions.NewSessionID(signingKey)
+	if err != nil {
+		t.Fatalf("unexpected error creating session ID")
+	}
+	if err := sessionStore.Save(context.Background(), sid, &SessionState{User: me}); err != nil {
+		t.Fatalf("unexpected error saving to session store")
+	}
+	ctx := HandlerContext{
+		SigningKey:   signingKey,
+		SessionStore: sessionStore,
+		UserStore:    userStore,
+	}
+
+	cases := []struct {
+		name           string
+		body           string
+		expectedCode   int
+		expectedFields []string
+	}{
+		{"Only last name", `{"lastName": "Updated"}`, http.StatusOK, nil},
+		{"Profile fields", `{"bio": "Hi", "targetRoles": ["SWE"], "school": "UW"}`, http.StatusOK, nil},
+		{"Student fields", `{"degree": "bachelor", "majors": ["Informatics"], "expectedGraduation": "2024-06", ` +
+			`"targetJobTypes": ["internship"], "targetSeasons": ["Summer 2024"]}`, http.StatusOK, nil},
+		{"Malformed JSON", `{"lastName": `, http.StatusBadRequest, nil},
+		{"Invalid fields", `{"firstName": "L33t", "expectedGraduation": "2024"}`, http.StatusUnprocessableEntity, []string{"firstName", "expectedGraduation"}},
+		{"Username in use", `{"userName": "other"}`, http.StatusConflict, nil},
+	}
+	for _, c := range cases {
+		request, _ := http.NewRequest(http.MethodPatch, "/v1/users/me", strings.NewReader(c.body))
+		request.Header.Set("Authorization", "Bearer "+sid.String())
+		request.Header.Set(headerContentType, contentTypeJson)
+		responseWriter := httptest.NewRecorder()
+		http.HandlerFunc(ctx.SpecificUserHandler).ServeHTTP(responseWriter, request)
+		if status := responseWriter.Code; status != c.expectedCode {
+			t.Errorf("case %s: wrong status code - got %v but expected %v", c.name, status, c.expectedCode)
+		}
+		if c.expectedFields != nil {
+			response := &problem.Problem{}
+			if err := json.Unmarshal(responseWriter.Body.Bytes(), response); err != nil {
+				t.Fatalf("case %s: unexpected error unmarshaling validation errors: %v", c.name, err)
+			}
+			fields := []string{}
+			for _, fe := range response.Errors {
+				fields = append(fields, fe.Field)
+			}
+			if !reflect.DeepEqual(fields, c.expectedFields) {
+				t.Errorf("case %s: wrong invalid fields - got %v but expected %v", c.name, fields, c.expectedFields)
+			}
+		}
+	}
+
+	// Fields that weren't in any PATCH keep their values
+	expected := &users.User{
+		ID:                 me.ID,
+		UserName:           "me",
+		FirstName:          "Me",
+		LastName:           "Updated",
+		Bio:                "Hi",
+		TargetRoles:        []string{"SWE"},
+		School:             "UW",
+		Degree:             users.DegreeBachelor,
+		Majors:             []string{"Informatics"},
+		ExpectedGraduation: "2024-06",
+		TargetJobTypes:     []string{users.JobTypeInternship},
+		TargetSeasons:      []string{"Summer 2024"},
+		Role:               users.RoleUser,
+		Visibility:         users.VisibilityConnections,
+	}
+	stored, err := userStore.GetByID(context.Background(), me.ID)
+	if err != nil {
+		t.Fatalf("unexpected error getting user: %v", err)
+	}
+	stored.Email = ""
+	if !reflect.DeepEqual(stored, expected) {
+		t.Errorf("wrong profile after updates - got %+v but expected %+v", stored, expected)
+	}
+
+	// The session holds the updated profile, so it's forwarded to the other services
+	state := &SessionState{}
+	if err := sessionStore.Get(context.Background(), sid, state); err != nil {
+		t.Fatalf("unexpected error getting session state: %v", err)
+	}
+	if !reflect.DeepEqual(state.User, expected) {
+		t.Errorf("wrong profile in the session after updates - got %+v but expected %+v", state.User, expected)
+	}
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"JobTracker/servers/gateway/models/users"
+	"JobTracker/servers/gateway/sessions"
+	"JobTracker/servers/problem"
+)
+
+//errAccountDisabled is returned when a disabled user signs in or
+//uses a session or API token
+var errAccountDisabled = errors.New("this account has been disabled")
+
+//errSignedOut is returned when a session was ended by signing
+//its user out everywhere
+var errSignedOut = errors.New("this session has ended, please sign in again")
+
+//errCheckingSession is returned when a session can't be
+//checked against the stored user, since the store failed
+var errCheckingSession = errors.New("error checking the session's user")
+
+//checkUser returns errAccountDisabled if the stored user is disabled
+func checkUser(u *users.User) error {
+	if u.Disabled {
+		return errAccountDisabled
+	}
+	return nil
+}
+
+//checkSession checks the session against the stored user, since the
+//session only holds a copy of their profile. It returns the stored
+//user, or an error if they were disabled or signed out everywhere
+//after the session began. Unless `fresh` is true, the user may come
+//from ctx.SessionUsers; see SessionUserCache for the trade-off.
+func (ctx *HandlerContext) checkSession(c context.Context, sessionState *SessionState, fresh bool) (*users.User, error) {
+	u, cached := ctx.SessionUsers.get(sessionState.User.ID)
+	if fresh || !cached {
+		var err error
+		u, err = ctx.UserStore.GetByID(c, sessionState.User.ID)
+		if errors.Is(err, users.ErrUserNotFound) {
+			return nil, errSignedOut
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errCheckingSession, err)
+		}
+		ctx.SessionUsers.set(u)
+	}
+	if err := checkUser(u); err != nil {
+		return nil, err
+	}
+	if !u.SessionValid(sessionState.StartTime) {
+		return nil, errSignedOut
+	}
+	return u, nil
+}
+
+//getState gets the session state of the request from the session
+//store, like sessions.GetState, and records its user in the access log.
+//The session only holds a copy of the user, so it is checked against
+//the stored user with checkSession, and getState fails if they were
+//disabled or signed out everywhere since the session began.
+func (ctx *HandlerContext) getState(r *http.Request, sessionState *SessionState) (sessions.SessionID, error) {
+	sid, _, err := ctx.getSessionUser(r, sessionState, false)
+	return sid, err
+}
+
+//getSessionUser is getState, also returning the stored user,
+//which is looked up in the user store if `fresh` is true
+func (ctx *HandlerContext) getSessionUser(r *http.Request, sessionState *SessionState, fresh bool) (sessions.SessionID, *users.User, error) {
+	sid, err := sessions.GetState(r, ctx.SigningKey, ctx.SessionStore, sessionState)
+	if err != nil {
+		return sid, nil, err
+	}
+	if sessionState.User == nil {
+		return sid, nil, sessions.ErrStateNotFound
+	}
+	LogUser(r, sessionState.User.ID)
+	u, err := ctx.checkSession(r.Context(), sessionState, fresh)
+	if err != nil {
+		return sid, nil, err
+	}
+	return sid, u, nil
+}
+
+//sessionRejected reports whether an error from getState means the
+//request has a session, but it can't be used
+func sessionRejected(err error) bool {
+	return errors.Is(err, errAccountDisabled) || errors.Is(err, errSignedOut) || errors.Is(err, errCheckingSession)
+}
+
+//stateError responds to an error from getState: like sessionError
+//if the session can't be used, and 401 if there is no session
+func stateError(w http.ResponseWriter, r *http.Request, err error) {
+	if sessionRejected(err) {
+		sessionError(w, r, err)
+		return
+	}
+	problem.Error(w, r, "not authorized", http.StatusUnauthorized)
+}
+
+//sessionError responds to the client with the status code that
+//matches an error from checkSession or checkUser
+func sessionError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, errAccountDisabled):
+		problem.ErrorCode(w, r, codeAccountDisabled, err.Error(), http.StatusForbidden)
+	case errors.Is(err, errSignedOut):
+		problem.ErrorCode(w, r, codeSessionEnded, err.Error(), http.StatusUnauthorized)
+	default:
+		userStoreError(w, r, err)
+	}
+}
+
+//RequireAdmin authorizes requests to `handler` for admins. The request
+//must have a session of an admin who is still an admin, which
+//RequestUser returns to the handler. Admins can change other accounts,
+//so the role is always checked against the user store.
+func (ctx *HandlerContext) RequireAdmin(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sessionState := &SessionState{}
+		_, u, err := ctx.getSessionUser(r, sessionState, true)
+		if err != nil {
+			stateError(w, r, err)
+			return
+		}
+		if u.Role != users.RoleAdmin {
+			problem.Error(w, r, "only admins can take this action", http.StatusForbidden)
+			return
+		}
+		handler(w, r.WithContext(context.WithValue(r.Context(), requestUserKey{}, u)))
+	}
+}
@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"JobTracker/servers/gateway/avatars"
+	"JobTracker/servers/gateway/blobs"
+	"JobTracker/servers/gateway/models/users"
+	"JobTracker/servers/gateway/sessions"
+	"JobTracker/servers/problem"
+)
+
+//avatarCacheControl lets browsers cache avatars for a day. Each upload
+//gets a new URL, so a changed avatar is never shown stale. Who can see
+//an avatar depends on the session, so shared caches can't keep it.
+const avatarCacheControl = "private, max-age=86400"
+
+//placeholderCacheControl lets the placeholder be cached briefly, since
+//the unversioned URL it's served at shows the upload once there is one
+const placeholderCacheControl = "private, max-age=300"
+
+//avatarKey returns the avatar store key of the user's uploaded avatar
+func avatarKey(userID int64) string {
+	return fmt.Sprintf("avatars/%d.jpg", userID)
+}
+
+//avatarURL returns the URL the gateway serves the user's uploaded
+//avatar at. The version changes with every upload, so caches
+//holding an older avatar aren't used for the new one.
+func avatarURL(userID int64, version int64) string {
+	return fmt.Sprintf("/v1/users/%d/avatar?v=%d", userID, version)
+}
+
+//AvatarHandler handles requests for a user's avatar, at /v1/users/{UserID}/avatar.
+//GET serves the uploaded avatar, or a placeholder if they haven't uploaded
+//one, so their email's gravatar hash isn't revealed to anyone who asks.
+//Other users' avatars are only served to signed-in users who can see
+//their photo in their PublicProfile. PUT uploads a new avatar for the
+//current user, and DELETE removes it, so their gravatar is used again
+//for their own photo URL.
+func (ctx *HandlerContext) AvatarHandler(w http.ResponseWriter, r *http.Request) {
+	userPath := path.Base(path.Dir(r.URL.Path))
+
+	sessionState := &SessionState{}
+	sid, err := ctx.getState(r, sessionState)
+	if err != nil {
+		stateError(w, r, err)
+		return
+	}
+
+	var userID int64
+	if userPath == "me" {
+		userID = sessionState.User.ID
+	} else {
+		var err error
+		userID, err = strconv.ParseInt(userPath, 10, 64)
+		if err != nil {
+			problem.Error(w, r, "invalid resource path", http.StatusBadRequest)
+			return
+		}
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if ctx.canSeeAvatar(w, r, userID, sessionState.User.ID) {
+			ctx.serveAvatar(w, r, userID)
+		}
+	case http.MethodPut, http.MethodDelete:
+		if userID != sessionState.User.ID {
+			problem.Error(w, r, "you are not authorized to take this action", http.StatusForbidden)
+			return
+		}
+		if r.Method == http.MethodPut {
+			ctx.uploadAvatar(w, r, sid, sessionState)
+		} else {
+			ctx.deleteAvatar(w, r, sid, sessionState)
+		}
+	default:
+		problem.Error(w, r, "only GET, PUT and DELETE methods are allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+//canSeeAvatar checks that the user with `viewerID` can see the photo
+//of the user with `userID`, as in the PublicProfile publicProfile
+//returns. Avatar URLs are built from sequential user IDs, so users
+//whose photo is hidden get the same 404 as users that don't exist, and
+//their avatars can't be found by guessing. If the photo can't be seen,
+//it responds to the client and returns false.
+func (ctx *HandlerContext) canSeeAvatar(w http.ResponseWriter, r *http.Request, userID int64, viewerID int64) bool {
+	if userID == viewerID {
+		return true
+	}
+	u, err := ctx.UserStore.GetByID(r.Context(), userID)
+	if err != nil {
+		userStoreError(w, r, err)
+		return false
+	}
+	profile, err := ctx.publicProfile(r.Context(), u, viewerID)
+	if err != nil {
+		connectionStoreError(w, r, err)
+		return false
+	}
+	if profile.Limited {
+		userStoreError(w, r, users.ErrUserNotFound)
+		return false
+	}
+	return true
+}
+
+//serveAvatar responds with the user's uploaded avatar,
+//or the placeholder avatar if they have none
+func (ctx *HandlerContext) serveAvatar(w http.ResponseWriter, r *http.Request, userID int64) {
+	avatar, err := ctx.AvatarStore.Get(r.Context(), avatarKey(userID))
+	if errors.Is(err, blobs.ErrBlobNotFound) {
+		w.Header().Set(headerContentType, avatars.ContentType)
+		w.Header().Set("Cache-Control", placeholderCacheControl)
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(http.StatusOK)
+		w.Write(avatars.Placeholder())
+		return
+	}
+	if err != nil {
+		avatarStoreError(w, r, err)
+		return
+	}
+	defer avatar.Close()
+
+	w.Header().Set(headerContentType, avatars.ContentType)
+	w.Header().Set("Cache-Control", avatarCacheControl)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, avatar)
+}
+
+//uploadAvatar stores the image in the request body as the current
+//user's avatar, after checking and resizing it, and responds with
+//the user's updated profile
+func (ctx *HandlerContext) uploadAvatar(w http.ResponseWriter, r *http.Request, sid sessions.SessionID, sessionState *SessionState) {
+	//Validate that request content type is an accepted image type.
+	//The image's actual type is checked again when it's decoded.
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get(headerContentType))
+	if err != nil || !avatars.ContentTypes[mediaType] {
+		problem.Error(w, r, avatars.ErrUnsupportedType.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+	if r.ContentLength > avatars.MaxUploadBytes {
+		problem.Error(w, r, fmt.Sprintf("avatar must be at most %d bytes", avatars.MaxUploadBytes), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	//Read one byte past the limit, to tell if the body was too large
+	defer r.Body.Close()
+	upload, err := io.ReadAll(io.LimitReader(r.Body, avatars.MaxUploadBytes+1))
+	if err != nil {
+		problem.Error(w, r, "error reading avatar", http.StatusBadRequest)
+		return
+	}
+	if len(upload) > avatars.MaxUploadBytes {
+		problem.Error(w, r, fmt.Sprintf("avatar must be at most %d bytes", avatars.MaxUploadBytes), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	avatar, err := avatars.Process(upload)
+	switch {
+	case errors.Is(err, avatars.ErrUnsupportedType):
+		problem.Error(w, r, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	case errors.Is(err, avatars.ErrInvalidImage), errors.Is(err, avatars.ErrTooManyPixels):
+		problem.Error(w, r, err.Error(), http.StatusUnprocessableEntity)
+		return
+	case err != nil:
+		problem.Internal(w, r, err, "unexpected error processing avatar", http.StatusInternalServerError)
+		return
+	}
+
+	userID := sessionState.User.ID
+	if err := ctx.AvatarStore.Put(r.Context(), avatarKey(userID), bytes.NewReader(avatar)); err != nil {
+		avatarStoreError(w, r, err)
+		return
+	}
+	u, err := ctx.UserStore.UpdatePhotoURL(r.Context(), userID, avatarURL(userID, time.Now().UnixNano()))
+	if err != nil {
+		userStoreError(w, r, err)
+		return
+	}
+	ctx.refreshSession(r, sid, sessionState, u)
+	respondWithUser(w, r, u)
+}
+
+//deleteAvatar deletes the current user's uploaded avatar, switching
+//their photo back to their gravatar, and responds with the user's
+//updated profile
+func (ctx *HandlerContext) deleteAvatar(w http.ResponseWriter, r *http.Request, sid sessions.SessionID, sessionState *SessionState) {
+	userID := sessionState.User.ID
+	//The email isn't kept in the session, so look it up for the gravatar
+	u, err := ctx.UserStore.GetByID(r.Context(), userID)
+	if err != nil {
+		userStoreError(w, r, err)
+		return
+	}
+	gravatarURL, err := users.GravatarURL(u.Email)
+	if err != nil {
+		problem.Internal(w, r, err, "unexpected error creating gravatar URL", http.StatusInternalServerError)
+		return
+	}
+	if err := ctx.AvatarStore.Delete(r.Context(), avatarKey(userID)); err != nil {
+		avatarStoreError(w, r, err)
+		return
+	}
+	u, err = ctx.UserStore.UpdatePhotoURL(r.Context(), userID, gravatarURL)
+	if err != nil {
+		userStoreError(w, r, err)
+		return
+	}
+	ctx.refreshSession(r, sid, sessionState, u)
+	respondWithUser(w, r, u)
+}
+
+//avatarStoreError logs an error from the avatar store,
+//and tells the client to try again later
+func avatarStoreError(w http.ResponseWriter, r *http.Request, err error) {
+	problem.Internal(w, r, fmt.Errorf("avatar store error: %w", err), "the avatar store is unavailable, please try again later", http.StatusServiceUnavailable)
+}
+
+//respondWithUser responds to the client with the user's profile
+func respondWithUser(w http.ResponseWriter, r *http.Request, u *users.User) {
+	respondWithJSON(w, r, http.StatusOK, u)
+}
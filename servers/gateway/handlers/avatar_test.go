@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"JobTracker/servers/gateway/avatars"
+	"JobTracker/servers/gateway/blobs"
+	"JobTracker/servers/gateway/models/connections"
+	"JobTracker/servers/gateway/models/users"
+	"JobTracker/servers/gateway/sessions"
+	"JobTracker/servers/problem"
+)
+
+//avatarTest holds a handler context with two users,
+//and a session for the first of them, `me`
+type avatarTest struct {
+	ctx *HandlerContext
+	sid sessions.SessionID
+	me  *users.User
+}
+
+func newAvatarTest(t *testing.T) *avatarTest {
+	signingKey := "testKey"
+	sessionStore := sessions.NewMemStore(time.Hour, time.Minute)
+	userStore := users.NewMemStore()
+	avatarStore, err := blobs.NewFSStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("unexpected error creating avatar store: %v", err)
+	}
+	insert := func(email string, userName string) *users.User {
+		u := &users.User{Email: email, UserName: userName}
+		if err := u.SetPhotoURL(email); err != nil {
+			t.Fatalf("unexpected error setting photo URL: %v", err)
+		}
+		u, err := userStore.Insert(context.Background(), u)
+		if err != nil {
+			t.Fatalf("unexpected error inserting user: %v", err)
+		}
+		return u
+	}
+	me := insert("me@test.com", "me")
+	insert("other@test.com", "other")
+	sid, err := sessions.NewSessionID(signingKey)
+	if err != nil {
+		t.Fatalf("unexpected error creating session ID")
+	}
+	if err := sessionStore.Save(context.Background(), sid, &SessionState{User: me}); err != nil {
+		t.Fatalf("unexpected error saving to session store")
+	}
+	return &avatarTest{
+		ctx: &HandlerContext{
+			SigningKey:   signingKey,
+			SessionStore: sessionStore,
+			UserStore:    userStore,
+			AvatarStore:  avatarStore,
+		},
+		sid: sid,
+		me:  me,
+	}
+}
+
+//serve sends a request for `path` through SpecificUserHandler,
+//authenticated as the first user unless `anonymous` is set
+func (at *avatarTest) serve(method string, path string, contentType string, body []byte, anonymous bool) *httptest.ResponseRecorder {
+	request, _ := http.NewRequest(method, path, bytes.NewReader(body))
+	if !anonymous {
+		request.Header.Set("Authorization", "Bearer "+at.sid.String())
+	}
+	if len(contentType) != 0 {
+		request.Header.Set(headerContentType, contentType)
+	}
+	responseWriter := httptest.NewRecorder()
+	http.HandlerFunc(at.ctx.SpecificUserHandler).ServeHTTP(responseWriter, request)
+	return responseWriter
+}
+
+func testPNG(t *testing.T) []byte {
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, image.NewRGBA(image.Rect(0, 0, 300, 200))); err != nil {
+		t.Fatalf("unexpected error encoding test image: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestAvatarHandlerUpload(t *testing.T) {
+	at := newAvatarTest(t)
+	gravatarURL, _ := users.GravatarURL("me@test.com")
+
+	//without an upload, the avatar is the placeholder, not the gravatar
+	responseWriter := at.serve(http.MethodGet, "/v1/users/1/avatar", "", nil, false)
+	if responseWriter.Code != http.StatusOK || !bytes.Equal(responseWriter.Body.Bytes(), avatars.Placeholder()) {
+		t.Errorf("expected the placeholder avatar but got %d, %s", responseWriter.Code, responseWriter.Header().Get(headerContentType))
+	}
+
+	responseWriter = at.serve(http.MethodPut, "/v1/users/me/avatar", "image/png", testPNG(t), false)
+	if responseWriter.Code != http.StatusOK {
+		t.Fatalf("wrong status code uploading avatar - got %v but expected %v: %s", responseWriter.Code, http.StatusOK, responseWriter.Body.String())
+	}
+	updated := &users.User{}
+	if err := json.Unmarshal(responseWriter.Body.Bytes(), updated); err != nil {
+		t.Fatalf("unexpected error decoding user: %v", err)
+	}
+	if !strings.HasPrefix(updated.PhotoURL, "/v1/users/1/avatar?v=") {
+		t.Errorf("photo URL was not changed to the uploaded avatar: %s", updated.PhotoURL)
+	}
+	state := &SessionState{}
+	if err := at.ctx.SessionStore.Get(context.Background(), at.sid, state); err != nil || state.User.PhotoURL != updated.PhotoURL {
+		t.Errorf("session was not refreshed with the new photo URL: %v, %v", state.User, err)
+	}
+
+	responseWriter = at.serve(http.MethodGet, updated.PhotoURL, "", nil, false)
+	if responseWriter.Code != http.StatusOK || responseWriter.Header().Get(headerContentType) != avatars.ContentType {
+		t.Fatalf("expected the uploaded avatar but got %d, %s", responseWriter.Code, responseWriter.Header().Get(headerContentType))
+	}
+	img, format, err := image.Decode(responseWriter.Body)
+	if err != nil || format != "jpeg" || img.Bounds().Dx() != avatars.Size || img.Bounds().Dy() != avatars.Size {
+		t.Errorf("served avatar was not resized to a %dx%d JPEG: %s, %v", avatars.Size, avatars.Size, format, err)
+	}
+
+	//deleting the avatar switches back to the gravatar
+	responseWriter = at.serve(http.MethodDelete, "/v1/users/me/avatar", "", nil, false)
+	if responseWriter.Code != http.StatusOK {
+		t.Fatalf("wrong status code deleting avatar - got %v but expected %v", responseWriter.Code, http.StatusOK)
+	}
+	if err := json.Unmarshal(responseWriter.Body.Bytes(), updated); err != nil || updated.PhotoURL != gravatarURL {
+		t.Errorf("photo URL was not changed back to the gravatar: %s, %v", updated.PhotoURL, err)
+	}
+	responseWriter = at.serve(http.MethodGet, "/v1/users/me/avatar", "", nil, false)
+	if responseWriter.Code != http.StatusOK || !bytes.Equal(responseWriter.Body.Bytes(), avatars.Placeholder()) {
+		t.Errorf("expected the placeholder for a deleted avatar but got %d", responseWriter.Code)
+	}
+}
+
+func TestAvatarHandlerErrors(t *testing.T) {
+	at := newAvatarTest(t)
+	cases := []struct {
+		name         string
+		method       string
+		path         string
+		contentType  string
+		body         []byte
+		anonymous    bool
+		expectedCode int
+	}{
+		{"Unauthenticated Upload", http.MethodPut, "/v1/users/me/avatar", "image/png", testPNG(t), true, http.StatusUnauthorized},
+		{"Unauthenticated Me", http.MethodGet, "/v1/users/me/avatar", "", nil, true, http.StatusUnauthorized},
+		{"Unauthenticated Get", http.MethodGet, "/v1/users/1/avatar", "", nil, true, http.StatusUnauthorized},
+		{"Another User's Avatar", http.MethodPut, "/v1/users/2/avatar", "image/png", testPNG(t), false, http.StatusForbidden},
+		{"Unsupported Content Type", http.MethodPut, "/v1/users/me/avatar", "image/svg+xml", []byte("<svg/>"), false, http.StatusUnsupportedMediaType},
+		{"Content Not An Image", http.MethodPut, "/v1/users/me/avatar", "image/png", []byte("<svg/>"), false, http.StatusUnsupportedMediaType},
+		{"Corrupt Image", http.MethodPut, "/v1/users/me/avatar", "image/png", testPNG(t)[:40], false, http.StatusUnprocessableEntity},
+		{"Too Large", http.MethodPut, "/v1/users/me/avatar", "image/png", make([]byte, avatars.MaxUploadBytes+1), false, http.StatusRequestEntityTooLarge},
+		{"Invalid User ID", http.MethodGet, "/v1/users/abc/avatar", "", nil, false, http.StatusBadRequest},
+		{"Unknown User", http.MethodGet, "/v1/users/99/avatar", "", nil, false, http.StatusNotFound},
+		{"Invalid Method", http.MethodPost, "/v1/users/me/avatar", "image/png", testPNG(t), false, http.StatusMethodNotAllowed},
+	}
+	for _, c := range cases {
+		responseWriter := at.serve(c.method, c.path, c.contentType, c.body, c.anonymous)
+		if responseWriter.Code != c.expectedCode {
+			t.Errorf("case %s: wrong status code - got %v but expected %v", c.name, responseWriter.Code, c.expectedCode)
+		}
+	}
+	//nothing was stored by the failed uploads
+	if _, err := at.ctx.AvatarStore.Get(context.Background(), avatarKey(at.me.ID)); err != blobs.ErrBlobNotFound {
+		t.Errorf("incorrect error getting avatar after failed uploads: expected %v but got %v", blobs.ErrBlobNotFound, err)
+	}
+}
+
+func TestAvatarHandlerVisibility(t *testing.T) {
+	at := newAvatarTest(t)
+	at.ctx.ConnectionStore = connections.NewMemStore()
+	other, _ := at.ctx.UserStore.GetByUserName(context.Background(), "other")
+	if err := at.ctx.AvatarStore.Put(context.Background(), avatarKey(other.ID), bytes.NewReader([]byte("avatar"))); err != nil {
+		t.Fatalf("unexpected error storing avatar: %v", err)
+	}
+	setVisibility := func(visibility string) {
+		if _, err := at.ctx.UserStore.Update(context.Background(), other.ID, &users.Updates{Visibility: &visibility}); err != nil {
+			t.Fatalf("unexpected error setting visibility: %v", err)
+		}
+	}
+	path := fmt.Sprintf("/v1/users/%d/avatar", other.ID)
+	unknown := at.serve(http.MethodGet, "/v1/users/99/avatar", "", nil, false)
+
+	cases := []struct {
+		name         string
+		visibility   string
+		connected    bool
+		expectedCode int
+	}{
+		{"Private", users.VisibilityPrivate, false, http.StatusNotFound},
+		{"Connections Only", users.VisibilityConnections, false, http.StatusNotFound},
+		{"Connected", users.VisibilityConnections, true, http.StatusOK},
+		{"Public", users.VisibilityPublic, false, http.StatusOK},
+	}
+	for _, c := range cases {
+		setVisibility(c.visibility)
+		if c.connected {
+			at.ctx.ConnectionStore.Request(context.Background(), at.me.ID, other.ID, time.Now())
+			at.ctx.ConnectionStore.Request(context.Background(), other.ID, at.me.ID, time.Now())
+		}
+		responseWriter := at.serve(http.MethodGet, path, "", nil, false)
+		if responseWriter.Code != c.expectedCode {
+			t.Errorf("case %s: wrong status code - got %v but expected %v", c.name, responseWriter.Code, c.expectedCode)
+		}
+		//hidden avatars can't be told apart from users that don't exist
+		if c.expectedCode == http.StatusNotFound {
+			hidden, notFound := &problem.Problem{}, &problem.Problem{}
+			json.Unmarshal(responseWriter.Body.Bytes(), hidden)
+			json.Unmarshal(unknown.Body.Bytes(), notFound)
+			if hidden.Code != notFound.Code || hidden.Detail != notFound.Detail {
+				t.Errorf("case %s: a hidden avatar should get the same problem as an unknown user, but got %+v", c.name, hidden)
+			}
+		}
+	}
+}
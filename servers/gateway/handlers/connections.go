@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"JobTracker/servers/gateway/models/connections"
+	"JobTracker/servers/gateway/models/users"
+	"JobTracker/servers/problem"
+)
+
+//connectionResponse is a connection as the current user sees
+//it, with the profile of the user they are connecting with
+type connectionResponse struct {
+	*connections.Connection
+	User *users.PublicProfile `json:"user"`
+}
+
+//connectionStoreError logs an error from the connection store and
+//responds that it is unavailable
+func connectionStoreError(w http.ResponseWriter, r *http.Request, err error) {
+	problem.Internal(w, r, fmt.Errorf("connection store error: %w", err), "connections are unavailable, please try again later", http.StatusServiceUnavailable)
+}
+
+//publicProfile returns the profile of `u` that the user with
+//`viewerID` can see, based on whether they are connected
+func (ctx *HandlerContext) publicProfile(c context.Context, u *users.User, viewerID int64) (*users.PublicProfile, error) {
+	connected := false
+	//only look up the connection when it matters
+	if u.Visibility == users.VisibilityConnections && ctx.ConnectionStore != nil {
+		var err error
+		connected, err = connections.Connected(c, ctx.ConnectionStore, u.ID, viewerID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return u.PublicProfile(connected), nil
+}
+
+//ConnectionsHandler handles requests to manage the current user's
+//connections. GET /v1/users/me/connections lists their connections
+//and requests to connect, PUT /v1/users/me/connections/{UserID} asks
+//to connect with the user or accepts their request, and DELETE
+//disconnects from them or declines or cancels a request.
+func (ctx *HandlerContext) ConnectionsHandler(w http.ResponseWriter, r *http.Request) {
+	if ctx.ConnectionStore == nil {
+		problem.Error(w, r, "connections are not available", http.StatusNotImplemented)
+		return
+	}
+	sessionState := &SessionState{}
+	if _, err := ctx.getState(r, sessionState); err != nil {
+		stateError(w, r, err)
+		return
+	}
+	userID := sessionState.User.ID
+
+	//The path is /v1/users/{user}/connections or /v1/users/{user}/connections/{id}
+	connectionsPath := r.URL.Path
+	otherID := int64(0)
+	if path.Base(connectionsPath) != "connections" {
+		id, err := strconv.ParseInt(path.Base(connectionsPath), 10, 64)
+		if err != nil {
+			problem.Error(w, r, "invalid resource path", http.StatusBadRequest)
+			return
+		}
+		otherID = id
+		connectionsPath = path.Dir(connectionsPath)
+	}
+	if userPath := path.Base(path.Dir(connectionsPath)); userPath != "me" && userPath != strconv.FormatInt(userID, 10) {
+		problem.Error(w, r, "you are not authorized to take this action", http.StatusForbidden)
+		return
+	}
+
+	switch {
+	case otherID == 0 && r.Method == http.MethodGet:
+		found, err := ctx.ConnectionStore.GetByUserID(r.Context(), userID)
+		if err != nil {
+			connectionStoreError(w, r, err)
+			return
+		}
+		responses := []*connectionResponse{}
+		for _, c := range found {
+			other, err := ctx.UserStore.GetByID(r.Context(), c.Other(userID))
+			if err != nil {
+				userStoreError(w, r, err)
+				return
+			}
+			responses = append(responses, &connectionResponse{Connection: c, User: other.PublicProfile(c.Accepted)})
+		}
+		respondWithJSON(w, r, http.StatusOK, responses)
+
+	case otherID != 0 && r.Method == http.MethodPut:
+		if otherID == userID {
+			problem.Error(w, r, "you can't connect with yourself", http.StatusBadRequest)
+			return
+		}
+		other, err := ctx.UserStore.GetByID(r.Context(), otherID)
+		if err != nil {
+			userStoreError(w, r, err)
+			return
+		}
+		c, err := ctx.ConnectionStore.Request(r.Context(), userID, otherID, time.Now())
+		if err != nil {
+			connectionStoreError(w, r, err)
+			return
+		}
+		respondWithJSON(w, r, http.StatusOK, &connectionResponse{Connection: c, User: other.PublicProfile(c.Accepted)})
+
+	case otherID != 0 && r.Method == http.MethodDelete:
+		err := ctx.ConnectionStore.Delete(r.Context(), userID, otherID)
+		if errors.Is(err, connections.ErrConnectionNotFound) {
+			problem.Error(w, r, "you are not connected with this user", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			connectionStoreError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("connection removed"))
+
+	default:
+		problem.Error(w, r, "request method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"JobTracker/servers/gateway/models/connections"
+	"JobTracker/servers/gateway/models/users"
+)
+
+//newConnectionTest returns a handlerTest with a connection store,
+//another for a second user sharing its context, and that user
+func newConnectionTest(t *testing.T) (*handlerTest, *handlerTest, *users.User) {
+	tt := newHandlerTest(t)
+	tt.ctx.ConnectionStore = connections.NewMemStore()
+	other := &users.User{
+		Email:    "trinity@matrix.net",
+		UserName: "trinity",
+		Bio:      "Hacker",
+		School:   "Zion Tech",
+	}
+	other, err := tt.ctx.UserStore.Insert(context.Background(), other)
+	if err != nil {
+		t.Fatalf("unexpected error inserting user: %v", err)
+	}
+	return tt, tt.as(t, other), other
+}
+
+func TestProfileVisibility(t *testing.T) {
+	tt, otherTest, other := newConnectionTest(t)
+	specificUser := http.HandlerFunc(tt.ctx.SpecificUserHandler)
+	profilePath := fmt.Sprintf("/v1/users/%d", other.ID)
+
+	cases := []struct {
+		name       string
+		visibility string
+		connect    bool
+		limited    bool
+	}{
+		{"Connections Only", users.VisibilityConnections, false, true},
+		{"Public", users.VisibilityPublic, false, false},
+		{"Connected", users.VisibilityConnections, true, false},
+		{"Private", users.VisibilityPrivate, true, true},
+	}
+	for _, c := range cases {
+		body := fmt.Sprintf(`{"visibility": %q}`, c.visibility)
+		if status := otherTest.serve(t, specificUser, http.MethodPatch, "/v1/users/me", body, nil); status != http.StatusOK {
+			t.Fatalf("case %s: wrong status code setting visibility - got %v but expected %v", c.name, status, http.StatusOK)
+		}
+		if c.connect {
+			tt.serve(t, specificUser, http.MethodPut, fmt.Sprintf("/v1/users/me/connections/%d", other.ID), "", nil)
+			otherTest.serve(t, specificUser, http.MethodPut, "/v1/users/me/connections/1", "", nil)
+		}
+		profile := &users.PublicProfile{}
+		if status := tt.serve(t, specificUser, http.MethodGet, profilePath, "", profile); status != http.StatusOK {
+			t.Fatalf("case %s: wrong status code - got %v but expected %v", c.name, status, http.StatusOK)
+		}
+		if profile.Limited != c.limited || profile.UserName != "trinity" || (len(profile.Bio) == 0) != c.limited {
+			t.Errorf("case %s: incorrect profile: %+v", c.name, profile)
+		}
+	}
+
+	//users always see their own whole profile
+	me := &users.User{}
+	if status := otherTest.serve(t, specificUser, http.MethodGet, "/v1/users/me", "", me); status != http.StatusOK || me.Bio != "Hacker" || me.Visibility != users.VisibilityPrivate {
+		t.Errorf("incorrect own profile: %v %+v", status, me)
+	}
+	if status := otherTest.serve(t, specificUser, http.MethodPatch, "/v1/users/me", `{"visibility": "friends"}`, nil); status != http.StatusUnprocessableEntity {
+		t.Errorf("wrong status code for an unknown visibility - got %v but expected %v", status, http.StatusUnprocessableEntity)
+	}
+}
+
+func TestConnectionsHandler(t *testing.T) {
+	tt, otherTest, other := newConnectionTest(t)
+	specificUser := http.HandlerFunc(tt.ctx.SpecificUserHandler)
+	otherPath := fmt.Sprintf("/v1/users/me/connections/%d", other.ID)
+
+	cases := []struct {
+		name   string
+		method string
+		path   string
+		status int
+	}{
+		{"Self", http.MethodPut, "/v1/users/me/connections/1", http.StatusBadRequest},
+		{"Unknown User", http.MethodPut, "/v1/users/me/connections/999", http.StatusNotFound},
+		{"Bad ID", http.MethodPut, "/v1/users/me/connections/trinity", http.StatusBadRequest},
+		{"Another User's", http.MethodGet, fmt.Sprintf("/v1/users/%d/connections", other.ID), http.StatusForbidden},
+		{"Not Connected", http.MethodDelete, otherPath, http.StatusNotFound},
+		{"Method", http.MethodPost, otherPath, http.StatusMethodNotAllowed},
+	}
+	for _, c := range cases {
+		if status := tt.serve(t, specificUser, c.method, c.path, "", nil); status != c.status {
+			t.Errorf("case %s: wrong status code - got %v but expected %v", c.name, status, c.status)
+		}
+	}
+
+	requested := &connectionResponse{}
+	if status := tt.serve(t, specificUser, http.MethodPut, otherPath, "", requested); status != http.StatusOK {
+		t.Fatalf("wrong status code asking to connect - got %v but expected %v", status, http.StatusOK)
+	}
+	if requested.Connection == nil || requested.Accepted || requested.User.ID != other.ID || !requested.User.Limited {
+		t.Fatalf("incorrect requested connection: %+v", requested)
+	}
+
+	//the other user sees the request, and accepts it by asking back
+	listed := []*connectionResponse{}
+	if status := otherTest.serve(t, specificUser, http.MethodGet, "/v1/users/me/connections", "", &listed); status != http.StatusOK {
+		t.Fatalf("wrong status code listing connections - got %v but expected %v", status, http.StatusOK)
+	}
+	if len(listed) != 1 || listed[0].RequesterID != 1 || listed[0].User.UserName != "neo" {
+		t.Fatalf("incorrect connections: %+v", listed)
+	}
+	accepted := &connectionResponse{}
+	otherTest.serve(t, specificUser, http.MethodPut, "/v1/users/me/connections/1", "", accepted)
+	if !accepted.Accepted || accepted.AcceptedAt == nil {
+		t.Errorf("asking back should accept the request: %+v", accepted)
+	}
+
+	if status := tt.serve(t, specificUser, http.MethodDelete, otherPath, "", nil); status != http.StatusOK {
+		t.Errorf("wrong status code disconnecting - got %v but expected %v", status, http.StatusOK)
+	}
+	listed = []*connectionResponse{}
+	if otherTest.serve(t, specificUser, http.MethodGet, "/v1/users/me/connections", "", &listed); len(listed) != 0 {
+		t.Errorf("expected no connections after disconnecting but got %+v", listed)
+	}
+}
@@ -1,7 +1,14 @@
 package handlers
 
 import (
+	"JobTracker/servers/gateway/blobs"
+	"JobTracker/servers/gateway/models/apitokens"
+	"JobTracker/servers/gateway/models/connections"
+	"JobTracker/servers/gateway/models/identities"
+	"JobTracker/servers/gateway/models/passwordresets"
+	"JobTracker/servers/gateway/models/twofactor"
 	"JobTracker/servers/gateway/models/users"
+	"JobTracker/servers/gateway/oidc"
 	"JobTracker/servers/gateway/sessions"
 )
 
@@ -9,11 +16,50 @@ import (
 //will be a receiver on any of your HTTP
 //handler functions that need access to
 //globals, such as the key used for signing
-//and verifying SessionIDs, the session store
-//and the user store
+//and verifying SessionIDs, the session store,
+//the user store, the store for uploaded avatars,
+//the policy for users' passwords, the store
+//for two-factor sign in, the OpenID Connect
+//providers users can sign in with, the
+//store of users' API tokens, the store
+//of connections between users and the store
+//of password resets admins issued
 
 type HandlerContext struct {
 	SigningKey   string
 	SessionStore sessions.Store
 	UserStore    users.Store
+	AvatarStore  blobs.Store
+	//PasswordPolicy is checked when users choose a password.
+	//If nil, users.DefaultPasswordPolicy is used.
+	PasswordPolicy *users.PasswordPolicy
+	//PasswordHasher hashes new passwords, and stored hashes it didn't
+	//make are upgraded on sign in. If nil, users.DefaultHasher is used.
+	PasswordHasher users.PasswordHasher
+	//TimingPadHash is verified against the password of sign ins with
+	//emails that have no account, so they take as long as wrong
+	//passwords. It should be made like most stored hashes, with
+	//users.NewTimingPadHash. If nil, a hash is made with PasswordHasher.
+	TimingPadHash []byte
+	//TwoFactorStore holds users' two-factor sign in settings.
+	//If nil, two-factor sign in is turned off.
+	TwoFactorStore twofactor.Store
+	//OIDCProviders are the OpenID Connect providers users can
+	//sign in with, by name. Identities links users to them.
+	OIDCProviders map[string]*oidc.Provider
+	IdentityStore identities.Store
+	//APITokenStore holds users' API tokens.
+	//If nil, API tokens are turned off.
+	APITokenStore apitokens.Store
+	//ConnectionStore holds the connections between users. If
+	//nil, connections are turned off, and profiles visible
+	//to connections are only shown limited.
+	ConnectionStore connections.Store
+	//SessionUsers caches the stored users sessions are checked
+	//against for a short time. If nil, each request with a session
+	//looks its user up in UserStore.
+	SessionUsers *SessionUserCache
+	//PasswordResetStore holds the password resets admins issued.
+	//If nil, password resets are turned off.
+	PasswordResetStore passwordresets.Store
 }
@@ -19,7 +19,7 @@ type HandlerCORS struct {
 func (hc *HandlerCORS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add(originCORS, "*")
 	w.Header().Add(allowMethodsCORS, "GET, PUT, POST, PATCH, DELETE")
-	w.Header().Add(exposeHeadersCORS, "Authorization")
+	w.Header().Add(exposeHeadersCORS, "Authorization, X-Request-ID")
 	w.Header().Add(allowHeadersCORS, "Content-Type, Authorization")
 	w.Header().Add(maxAgeCORS, "600")
 	// Handle preflighr requests for cross-origin requests that aren't "simple" requests
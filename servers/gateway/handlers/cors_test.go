@@ -27,7 +27,7 @@ func TestCORS(t *testing.T) {
 	if header := response.Header().Get(allowHeadersCORS); header != "Content-Type, Authorization" {
 		t.Errorf("%v set incorrectly: %v", allowHeadersCORS, header)
 	}
-	if header := response.Header().Get(exposeHeadersCORS); header != "Authorization" {
+	if header := response.Header().Get(exposeHeadersCORS); header != "Authorization, X-Request-ID" {
 		t.Errorf("%v set incorrectly: %v", exposeHeadersCORS, header)
 	}
 	if header := response.Header().Get(maxAgeCORS); header != "600" {
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"JobTracker/servers/gateway/models/users"
+	"JobTracker/servers/gateway/sessions"
+)
+
+//handlerTest holds a handler context with in-memory stores, and a
+//session for one of its users that requests are authenticated with
+type handlerTest struct {
+	ctx *HandlerContext
+	sid sessions.SessionID
+}
+
+//newHandlerTest returns a handlerTest whose context has one user,
+//neo@matrix.net with the password "redPill1!", signed in
+func newHandlerTest(t *testing.T) *handlerTest {
+	ctx := &HandlerContext{
+		SigningKey:   "testKey",
+		SessionStore: sessions.NewMemStore(time.Hour, time.Minute),
+		UserStore:    users.NewMemStore(),
+	}
+	me := &users.User{Email: "neo@matrix.net", UserName: "neo"}
+	if err := me.SetPassword("redPill1!"); err != nil {
+		t.Fatalf("unexpected error setting password: %v", err)
+	}
+	me, err := ctx.UserStore.Insert(context.Background(), me)
+	if err != nil {
+		t.Fatalf("unexpected error inserting user: %v", err)
+	}
+	return (&handlerTest{ctx: ctx}).as(t, me)
+}
+
+//as returns a handlerTest sharing the context whose requests
+//are authenticated with a new session for `u`
+func (ht *handlerTest) as(t *testing.T, u *users.User) *handlerTest {
+	sid, err := sessions.NewSessionID(ht.ctx.SigningKey)
+	if err != nil {
+		t.Fatalf("unexpected error creating session ID")
+	}
+	if err := ht.ctx.SessionStore.Save(context.Background(), sid, &SessionState{User: u}); err != nil {
+		t.Fatalf("unexpected error saving to session store")
+	}
+	return &handlerTest{ctx: ht.ctx, sid: sid}
+}
+
+//serve sends a JSON request to `handler`, authenticated with the
+//user's session, and decodes a JSON response into `response`
+func (ht *handlerTest) serve(t *testing.T, handler http.HandlerFunc, method string, path string, body string, response interface{}) int {
+	request, _ := http.NewRequest(method, path, bytes.NewReader([]byte(body)))
+	request.Header.Set("Authorization", "Bearer "+ht.sid.String())
+	request.Header.Set(headerContentType, contentTypeJson)
+	responseWriter := httptest.NewRecorder()
+	handler.ServeHTTP(responseWriter, request)
+	if response != nil && responseWriter.Header().Get(headerContentType) == contentTypeJson {
+		if err := json.Unmarshal(responseWriter.Body.Bytes(), response); err != nil {
+			t.Fatalf("unexpected error decoding response to %s %s: %v", method, path, err)
+		}
+	}
+	return responseWriter.Code
+}
+
+//signIn signs in with neo's password and returns the status code
+//and, if two-factor sign in is on, the challenge token
+func (ht *handlerTest) signIn(t *testing.T) (int, string) {
+	challenge := &challengeResponse{}
+	status := ht.serve(t, ht.ctx.SessionsHandler, http.MethodPost, "/v1/sessions",
+		`{"email": "neo@matrix.net", "password": "redPill1!"}`, challenge)
+	return status, challenge.Challenge
+}
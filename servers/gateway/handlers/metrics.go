@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+//How users signed in, for signIns
+const (
+	signInPassword  = "password"
+	signInOIDC      = "oidc"
+	signInTwoFactor = "two_factor"
+)
+
+//Results of signing in, for signIns. A correct password from a
+//user with two-factor sign in enabled leads to a challenge.
+const (
+	signInSuccess   = "success"
+	signInFailure   = "failure"
+	signInChallenge = "challenge"
+)
+
+//signIns counts attempts to sign in, by how and their result
+var signIns = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "gateway_sign_ins_total",
+	Help: "How many times users tried to sign in, by method and result.",
+}, []string{"method", "result"})
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+//signInCount returns how many sign ins have been counted with the
+//method and result. Counters are shared by every test, so tests
+//compare counts before and after signing in.
+func signInCount(t *testing.T, method string, result string) float64 {
+	return testutil.ToFloat64(signIns.WithLabelValues(method, result))
+}
+
+func TestSignInMetrics(t *testing.T) {
+	tt := newHandlerTest(t)
+	failures := signInCount(t, signInPassword, signInFailure)
+	successes := signInCount(t, signInPassword, signInSuccess)
+
+	status := tt.serve(t, tt.ctx.SessionsHandler, http.MethodPost, "/v1/sessions",
+		`{"email": "neo@matrix.net", "password": "bluePill1!"}`, nil)
+	if status != http.StatusUnauthorized {
+		t.Fatalf("wrong status code signing in with the wrong password - got %v but expected %v", status, http.StatusUnauthorized)
+	}
+	if status, _ := tt.signIn(t); status != http.StatusCreated {
+		t.Fatalf("wrong status code signing in - got %v but expected %v", status, http.StatusCreated)
+	}
+
+	if count := signInCount(t, signInPassword, signInFailure); count != failures+1 {
+		t.Errorf("incorrect failed sign ins: expected %v but got %v", failures+1, count)
+	}
+	if count := signInCount(t, signInPassword, signInSuccess); count != successes+1 {
+		t.Errorf("incorrect successful sign ins: expected %v but got %v", successes+1, count)
+	}
+}
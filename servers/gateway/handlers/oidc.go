@@ -0,0 +1,260 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"JobTracker/servers/gateway/models/identities"
+	"JobTracker/servers/gateway/models/users"
+	"JobTracker/servers/gateway/oidc"
+	"JobTracker/servers/problem"
+)
+
+//oidcPathPrefix is the path the OpenID Connect endpoints are under
+const oidcPathPrefix = "/v1/sessions/oidc/"
+
+//maxUserNameAttempts is how many usernames are tried for a new user
+//before giving up, if the one from their email is taken
+const maxUserNameAttempts = 5
+
+//errNoEmail is returned when a provider doesn't share the user's email
+var errNoEmail = errors.New("the provider did not share an email address")
+
+//errUnverifiedEmail is returned when the provider hasn't verified that the
+//user owns their email, so it can't be trusted to link or create an account
+var errUnverifiedEmail = errors.New("the provider has not verified your email address; " +
+	"verify it with the provider, or sign up with a password")
+
+//oidcBeginResponse is the body of the response when beginning to sign in
+//with a provider. The client sends the user to AuthURL, and must check
+//that the provider redirects back with the same State. The client keeps
+//the Verifier to itself until it finishes signing in.
+type oidcBeginResponse struct {
+	AuthURL  string `json:"authURL"`
+	State    string `json:"state"`
+	Verifier string `json:"verifier"`
+}
+
+//oidcCallbackRequest is the body of a request to finish signing in, with
+//the code and state the provider redirected with and the verifier
+//from beginning to sign in
+type oidcCallbackRequest struct {
+	Code     string `json:"code"`
+	State    string `json:"state"`
+	Verifier string `json:"verifier"`
+}
+
+//OIDCHandler handles signing in with OpenID Connect providers.
+//POST /v1/sessions/oidc/{provider} begins signing in, responding with
+//the provider's URL to send the user to. The provider redirects back to
+//the client, which posts the code, state and verifier to
+///v1/sessions/oidc/{provider}/callback to get a session, like /v1/sessions.
+//Each state can only be used once.
+func (ctx *HandlerContext) OIDCHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		problem.Error(w, r, "only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, oidcPathPrefix), "/")
+	provider, found := ctx.OIDCProviders[parts[0]]
+	if !found || len(parts) > 2 || (len(parts) == 2 && parts[1] != "callback") {
+		problem.Error(w, r, "no such sign in provider", http.StatusNotFound)
+		return
+	}
+
+	if len(parts) == 1 {
+		signIn, err := oidc.NewSignIn()
+		if err != nil {
+			problem.Internal(w, r, err, "unexpected error beginning sign in", http.StatusInternalServerError)
+			return
+		}
+		err = ctx.IdentityStore.BeginSignIn(r.Context(), oidc.HashState(signIn.State), &identities.SignIn{
+			Provider:  provider.Name,
+			Nonce:     signIn.Nonce,
+			Challenge: oidc.CodeChallenge(signIn.Verifier),
+			ExpiresAt: time.Now().Add(oidc.StateDuration),
+		})
+		if err != nil {
+			problem.Internal(w, r, err, "unable to begin signing in, please try again later", http.StatusServiceUnavailable)
+			return
+		}
+		respondWithJSON(w, r, http.StatusOK, &oidcBeginResponse{
+			AuthURL:  provider.AuthCodeURL(signIn.State, signIn.Nonce, signIn.Verifier),
+			State:    signIn.State,
+			Verifier: signIn.Verifier,
+		})
+		return
+	}
+
+	if !strings.HasPrefix(r.Header.Get(headerContentType), contentTypeJson) {
+		problem.Error(w, r, "request body must be in JSON", http.StatusUnsupportedMediaType)
+		return
+	}
+	defer r.Body.Close()
+	req := &oidcCallbackRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		problem.Error(w, r, "error decoding callback", http.StatusBadRequest)
+		return
+	}
+	signIn, err := ctx.IdentityStore.FinishSignIn(r.Context(), oidc.HashState(req.State), time.Now())
+	if errors.Is(err, identities.ErrSignInNotFound) {
+		problem.Error(w, r, "this sign in has expired, please sign in again", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		problem.Internal(w, r, err, "unable to sign you in, please try again later", http.StatusServiceUnavailable)
+		return
+	}
+	//the verifier is only known to the client that began signing in,
+	//so a state and code taken from the redirect can't be used elsewhere
+	challenge := oidc.CodeChallenge(req.Verifier)
+	if signIn.Provider != provider.Name || subtle.ConstantTimeCompare([]byte(challenge), []byte(signIn.Challenge)) != 1 {
+		problem.Error(w, r, "this sign in has expired, please sign in again", http.StatusUnauthorized)
+		return
+	}
+	claims, err := provider.Exchange(r.Context(), req.Code, req.Verifier, signIn.Nonce)
+	if errors.Is(err, oidc.ErrExchangeFailed) {
+		signIns.WithLabelValues(signInOIDC, signInFailure).Inc()
+		problem.Internal(w, r, fmt.Errorf("error signing in with %s: %w", provider.Name, err),
+			fmt.Sprintf("signing in with %s failed, please try again", provider.Name), http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		problem.Internal(w, r, fmt.Errorf("error signing in with %s: %w", provider.Name, err),
+			fmt.Sprintf("%s is unavailable, please try again later", provider.Name), http.StatusBadGateway)
+		return
+	}
+
+	user, err := ctx.oidcUser(r.Context(), provider, claims)
+	switch {
+	case errors.Is(err, errNoEmail), errors.Is(err, errUnverifiedEmail):
+		problem.Error(w, r, err.Error(), http.StatusUnprocessableEntity)
+		return
+	case errors.Is(err, users.ErrUserNotFound), errors.Is(err, users.ErrDuplicateEmail), errors.Is(err, users.ErrDuplicateUserName):
+		userStoreError(w, r, err)
+		return
+	case err != nil:
+		problem.Internal(w, r, fmt.Errorf("error finding the user for a %s identity: %w", provider.Name, err),
+			"unable to sign you in, please try again later", http.StatusServiceUnavailable)
+		return
+	}
+	ctx.completeSignIn(w, r, user, signInOIDC)
+}
+
+//oidcUser returns the user linked to the identity in `claims`. If no user
+//is linked yet and the provider has verified the email, the identity is
+//linked to the user with the same email, or to a new user if no user has it.
+func (ctx *HandlerContext) oidcUser(c context.Context, provider *oidc.Provider, claims *oidc.Claims) (*users.User, error) {
+	identity, err := ctx.IdentityStore.Get(c, provider.Issuer, claims.Subject)
+	if err == nil {
+		return ctx.UserStore.GetByID(c, identity.UserID)
+	}
+	if !errors.Is(err, identities.ErrIdentityNotFound) {
+		return nil, err
+	}
+
+	email := strings.TrimSpace(claims.Email)
+	if len(email) == 0 {
+		return nil, errNoEmail
+	}
+	if !claims.EmailVerified {
+		return nil, errUnverifiedEmail
+	}
+	user, err := ctx.UserStore.GetByEmail(c, email)
+	switch {
+	case errors.Is(err, users.ErrUserNotFound):
+		user, err = ctx.insertOIDCUser(c, email, claims)
+		if err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	}
+
+	_, err = ctx.IdentityStore.Insert(c, &identities.Identity{
+		UserID:    user.ID,
+		Issuer:    provider.Issuer,
+		Subject:   claims.Subject,
+		Email:     email,
+		CreatedAt: time.Now(),
+	})
+	if errors.Is(err, identities.ErrDuplicateIdentity) {
+		//linked by a concurrent sign in
+		return ctx.oidcUser(c, provider, claims)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+//insertOIDCUser creates a user for someone signing in with a provider
+//for the first time. They have no password, so they can only sign in with
+//the provider. Their username comes from their email, with random digits
+//added if it is taken.
+func (ctx *HandlerContext) insertOIDCUser(c context.Context, email string, claims *oidc.Claims) (*users.User, error) {
+	base := userNameFromEmail(email)
+	for attempt := 0; attempt < maxUserNameAttempts; attempt++ {
+		userName := base
+		if attempt > 0 {
+			suffix, err := rand.Int(rand.Reader, big.NewInt(10000))
+			if err != nil {
+				return nil, err
+			}
+			userName = fmt.Sprintf("%s%04d", base, suffix)
+		}
+		u := &users.User{
+			Email:     email,
+			PassHash:  []byte{},
+			UserName:  userName,
+			FirstName: truncateRunes(claims.GivenName, 32),
+			LastName:  truncateRunes(claims.FamilyName, 32),
+		}
+		if err := u.SetPhotoURL(email); err != nil {
+			return nil, errNoEmail
+		}
+		u, err := ctx.UserStore.Insert(c, u)
+		if errors.Is(err, users.ErrDuplicateUserName) {
+			continue
+		}
+		return u, err
+	}
+	return nil, users.ErrDuplicateUserName
+}
+
+//userNameFromEmail returns the name part of the email,
+//keeping only the characters usernames usually have
+func userNameFromEmail(email string) string {
+	name := email
+	if at := strings.LastIndex(email, "@"); at >= 0 {
+		name = email[:at]
+	}
+	name = strings.Map(func(r rune) rune {
+		if r < utf8.RuneSelf && (r == '.' || r == '_' || r == '-' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9')) {
+			return r
+		}
+		return -1
+	}, name)
+	if len(name) == 0 {
+		return "user"
+	}
+	return truncateRunes(name, 32)
+}
+
+//truncateRunes returns the first `n` characters of `s`
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) > n {
+		return string(runes[:n])
+	}
+	return s
+}
@@ -0,0 +1,267 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"JobTracker/servers/gateway/models/identities"
+	"JobTracker/servers/gateway/models/twofactor"
+	"JobTracker/servers/gateway/models/users"
+	"JobTracker/servers/gateway/oidc"
+	"JobTracker/servers/gateway/oidc/oidctest"
+	"JobTracker/servers/gateway/sessions"
+)
+
+//newOIDCTest returns a handler context that can sign in with a fake
+//provider named "school", and a user with a password
+func newOIDCTest(t *testing.T) (*HandlerContext, *oidctest.Provider, *users.User) {
+	fake := oidctest.NewProvider(t, "jobtracker", "secret")
+	provider, err := oidc.NewProvider(context.Background(), &oidc.Config{
+		Name:         "school",
+		Issuer:       fake.Issuer(),
+		ClientID:     fake.ClientID,
+		ClientSecret: fake.ClientSecret,
+		RedirectURL:  "https://jobtracker.fyi/signin/school",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating provider: %v", err)
+	}
+	userStore := users.NewMemStore()
+	trinity := &users.User{Email: "trinity@uw.edu", UserName: "trinity"}
+	if err := trinity.SetPassword("redPill1!"); err != nil {
+		t.Fatalf("unexpected error setting password: %v", err)
+	}
+	trinity, err = userStore.Insert(context.Background(), trinity)
+	if err != nil {
+		t.Fatalf("unexpected error inserting user: %v", err)
+	}
+	ctx := &HandlerContext{
+		SigningKey:     "testKey",
+		SessionStore:   sessions.NewMemStore(time.Hour, time.Minute),
+		UserStore:      userStore,
+		TwoFactorStore: twofactor.NewMemStore(),
+		OIDCProviders:  map[string]*oidc.Provider{"school": provider},
+		IdentityStore:  identities.NewMemStore(),
+	}
+	return ctx, fake, trinity
+}
+
+//postOIDC posts `body` to the OIDC handler and returns the response
+func postOIDC(ctx *HandlerContext, path string, body string) *httptest.ResponseRecorder {
+	request, _ := http.NewRequest(http.MethodPost, path, bytes.NewReader([]byte(body)))
+	request.Header.Set(headerContentType, contentTypeJson)
+	responseWriter := httptest.NewRecorder()
+	http.HandlerFunc(ctx.OIDCHandler).ServeHTTP(responseWriter, request)
+	return responseWriter
+}
+
+//beginOIDC begins signing in with the fake provider
+func beginOIDC(t *testing.T, ctx *HandlerContext) *oidcBeginResponse {
+	begin := postOIDC(ctx, "/v1/sessions/oidc/school", "")
+	if begin.Code != http.StatusOK {
+		t.Fatalf("wrong status code beginning sign in - got %v but expected %v", begin.Code, http.StatusOK)
+	}
+	started := &oidcBeginResponse{}
+	if err := json.Unmarshal(begin.Body.Bytes(), started); err != nil {
+		t.Fatalf("unexpected error decoding response: %v", err)
+	}
+	return started
+}
+
+//finishOIDC posts the callback for the sign in `started`
+//with the code and verifier, and returns the response
+func finishOIDC(ctx *HandlerContext, started *oidcBeginResponse, code string, verifier string) *httptest.ResponseRecorder {
+	return postOIDC(ctx, "/v1/sessions/oidc/school/callback",
+		fmt.Sprintf(`{"code": %q, "state": %q, "verifier": %q}`, code, started.State, verifier))
+}
+
+//oidcSignIn signs in with the fake provider as the account
+//described by `claims` and returns the callback's response
+func oidcSignIn(t *testing.T, ctx *HandlerContext, fake *oidctest.Provider, claims oidctest.Claims) *httptest.ResponseRecorder {
+	started := beginOIDC(t, ctx)
+	code, state := fake.Authorize(t, started.AuthURL, claims)
+	if state != started.State {
+		t.Fatalf("the provider redirected with state %q but %q was returned", state, started.State)
+	}
+	return finishOIDC(ctx, started, code, started.Verifier)
+}
+
+func TestOIDCHandlerNewUser(t *testing.T) {
+	ctx, fake, _ := newOIDCTest(t)
+	claims := oidctest.Claims{"sub": "1", "email": "neo@uw.edu", "email_verified": true, "given_name": "Thomas", "family_name": "Anderson"}
+
+	response := oidcSignIn(t, ctx, fake, claims)
+	if response.Code != http.StatusCreated {
+		t.Fatalf("wrong status code signing in - got %v but expected %v: %s", response.Code, http.StatusCreated, response.Body.String())
+	}
+	if len(response.Header().Get("Authorization")) == 0 {
+		t.Errorf("no session was begun")
+	}
+	user := &users.User{}
+	if err := json.Unmarshal(response.Body.Bytes(), user); err != nil {
+		t.Fatalf("unexpected error decoding user: %v", err)
+	}
+	if user.UserName != "neo" || user.FirstName != "Thomas" || user.LastName != "Anderson" {
+		t.Errorf("incorrect new user: %+v", user)
+	}
+	stored, err := ctx.UserStore.GetByID(context.Background(), user.ID)
+	if err != nil {
+		t.Fatalf("unexpected error getting user: %v", err)
+	}
+	if stored.Authenticate("") == nil {
+		t.Errorf("a user created by signing in with a provider shouldn't have a password")
+	}
+
+	//signing in again finds the same user
+	response = oidcSignIn(t, ctx, fake, claims)
+	again := &users.User{}
+	json.Unmarshal(response.Body.Bytes(), again)
+	if response.Code != http.StatusCreated || again.ID != user.ID {
+		t.Errorf("expected to sign in as user %d but got %v: %s", user.ID, response.Code, response.Body.String())
+	}
+
+	//another account with a taken username gets another username
+	response = oidcSignIn(t, ctx, fake, oidctest.Claims{"sub": "2", "email": "neo@gmail.com", "email_verified": true})
+	other := &users.User{}
+	json.Unmarshal(response.Body.Bytes(), other)
+	if response.Code != http.StatusCreated || other.ID == user.ID || other.UserName == "neo" {
+		t.Errorf("expected a second user but got %v: %s", response.Code, response.Body.String())
+	}
+}
+
+func TestOIDCHandlerLinking(t *testing.T) {
+	ctx, fake, trinity := newOIDCTest(t)
+
+	//an unverified email can't take over an account or make a new one
+	response := oidcSignIn(t, ctx, fake, oidctest.Claims{"sub": "3", "email": "trinity@uw.edu", "email_verified": false})
+	if response.Code != http.StatusUnprocessableEntity {
+		t.Errorf("wrong status code with an unverified email - got %v but expected %v", response.Code, http.StatusUnprocessableEntity)
+	}
+	response = oidcSignIn(t, ctx, fake, oidctest.Claims{"sub": "4", "email": "morpheus@uw.edu"})
+	if response.Code != http.StatusUnprocessableEntity {
+		t.Errorf("wrong status code creating a user with an unverified email - got %v but expected %v", response.Code, http.StatusUnprocessableEntity)
+	}
+	if _, err := ctx.UserStore.GetByEmail(context.Background(), "morpheus@uw.edu"); err == nil {
+		t.Errorf("a user was created with an unverified email")
+	}
+	response = oidcSignIn(t, ctx, fake, oidctest.Claims{"sub": "3"})
+	if response.Code != http.StatusUnprocessableEntity {
+		t.Errorf("wrong status code without an email - got %v but expected %v", response.Code, http.StatusUnprocessableEntity)
+	}
+
+	response = oidcSignIn(t, ctx, fake, oidctest.Claims{"sub": "3", "email": "trinity@uw.edu", "email_verified": true})
+	user := &users.User{}
+	json.Unmarshal(response.Body.Bytes(), user)
+	if response.Code != http.StatusCreated || user.ID != trinity.ID {
+		t.Fatalf("expected to sign in as user %d but got %v: %s", trinity.ID, response.Code, response.Body.String())
+	}
+	linked, err := ctx.IdentityStore.GetByUserID(context.Background(), trinity.ID)
+	if err != nil || len(linked) != 1 || linked[0].Issuer != fake.Issuer() {
+		t.Errorf("expected the identity to be linked but got %+v, %v", linked, err)
+	}
+
+	//two-factor sign in still applies
+	if err := ctx.TwoFactorStore.Begin(context.Background(), trinity.ID, "JBSWY3DPEHPK3PXP"); err != nil {
+		t.Fatalf("unexpected error beginning enrollment: %v", err)
+	}
+	if err := ctx.TwoFactorStore.Confirm(context.Background(), trinity.ID, 1, nil); err != nil {
+		t.Fatalf("unexpected error confirming enrollment: %v", err)
+	}
+	response = oidcSignIn(t, ctx, fake, oidctest.Claims{"sub": "3", "email": "trinity@uw.edu", "email_verified": true})
+	if response.Code != http.StatusAccepted {
+		t.Errorf("wrong status code signing in with two-factor sign in - got %v but expected %v", response.Code, http.StatusAccepted)
+	}
+}
+
+func TestOIDCHandlerErrors(t *testing.T) {
+	ctx, fake, _ := newOIDCTest(t)
+	cases := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"Wrong Method", http.MethodGet, "/v1/sessions/oidc/school", "", http.StatusMethodNotAllowed},
+		{"Unknown Provider", http.MethodPost, "/v1/sessions/oidc/myspace", "", http.StatusNotFound},
+		{"Unknown Path", http.MethodPost, "/v1/sessions/oidc/school/other", "", http.StatusNotFound},
+		{"Bad Body", http.MethodPost, "/v1/sessions/oidc/school/callback", "{", http.StatusBadRequest},
+		{"Unknown State", http.MethodPost, "/v1/sessions/oidc/school/callback", `{"code": "a", "state": "forged", "verifier": "b"}`, http.StatusUnauthorized},
+	}
+	for _, c := range cases {
+		request, _ := http.NewRequest(c.method, c.path, bytes.NewReader([]byte(c.body)))
+		request.Header.Set(headerContentType, contentTypeJson)
+		responseWriter := httptest.NewRecorder()
+		http.HandlerFunc(ctx.OIDCHandler).ServeHTTP(responseWriter, request)
+		if responseWriter.Code != c.status {
+			t.Errorf("case %s: wrong status code - got %v but expected %v", c.name, responseWriter.Code, c.status)
+		}
+	}
+
+	account := oidctest.Claims{"sub": "1", "email": "neo@uw.edu", "email_verified": true}
+	started := beginOIDC(t, ctx)
+	code, _ := fake.Authorize(t, started.AuthURL, account)
+	if response := finishOIDC(ctx, started, "unknown", started.Verifier); response.Code != http.StatusUnauthorized {
+		t.Errorf("wrong status code with an unknown code - got %v but expected %v", response.Code, http.StatusUnauthorized)
+	}
+	//the state was used by the failed attempt
+	if response := finishOIDC(ctx, started, code, started.Verifier); response.Code != http.StatusUnauthorized {
+		t.Errorf("wrong status code reusing a state - got %v but expected %v", response.Code, http.StatusUnauthorized)
+	}
+
+	//a code and state taken from the redirect can't be used without the verifier
+	started = beginOIDC(t, ctx)
+	code, _ = fake.Authorize(t, started.AuthURL, account)
+	if response := finishOIDC(ctx, started, code, "stolen"); response.Code != http.StatusUnauthorized {
+		t.Errorf("wrong status code with the wrong verifier - got %v but expected %v", response.Code, http.StatusUnauthorized)
+	}
+
+	expired := &oidcBeginResponse{State: "expired", Verifier: "verifier"}
+	err := ctx.IdentityStore.BeginSignIn(context.Background(), oidc.HashState(expired.State), &identities.SignIn{
+		Provider:  "school",
+		Challenge: oidc.CodeChallenge(expired.Verifier),
+		ExpiresAt: time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error beginning sign in: %v", err)
+	}
+	if response := finishOIDC(ctx, expired, "a", expired.Verifier); response.Code != http.StatusUnauthorized {
+		t.Errorf("wrong status code with an expired state - got %v but expected %v", response.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestOIDCUserWithoutPassword(t *testing.T) {
+	ctx, fake, _ := newOIDCTest(t)
+	response := oidcSignIn(t, ctx, fake, oidctest.Claims{"sub": "1", "email": "neo@uw.edu", "email_verified": true})
+	if response.Code != http.StatusCreated {
+		t.Fatalf("wrong status code signing in - got %v but expected %v", response.Code, http.StatusCreated)
+	}
+	sid, err := sessions.GetSessionID(&http.Request{Header: http.Header{"Authorization": {response.Header().Get("Authorization")}}}, ctx.SigningKey)
+	if err != nil {
+		t.Fatalf("unexpected error getting the session: %v", err)
+	}
+	ht := &handlerTest{ctx: ctx, sid: sid}
+
+	//there is no current password to give
+	status := ht.serve(t, ctx.TwoFactorHandler, http.MethodPost, "/v1/users/me/2fa", `{}`, nil)
+	if status != http.StatusCreated {
+		t.Errorf("wrong status code enrolling without a password - got %v but expected %v", status, http.StatusCreated)
+	}
+	status = ht.serve(t, ctx.PasswordHandler, http.MethodPut, "/v1/users/me/password",
+		`{"password": "bluePill1!", "passwordConf": "bluePill1!"}`, nil)
+	if status != http.StatusOK {
+		t.Fatalf("wrong status code setting a first password - got %v but expected %v", status, http.StatusOK)
+	}
+	//once set, the password is needed
+	status = ht.serve(t, ctx.PasswordHandler, http.MethodPut, "/v1/users/me/password",
+		`{"password": "greenPill1!", "passwordConf": "greenPill1!"}`, nil)
+	if status != http.StatusForbidden {
+		t.Errorf("wrong status code changing the password without the current one - got %v but expected %v", status, http.StatusForbidden)
+	}
+}
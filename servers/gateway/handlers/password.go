@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"JobTracker/servers/gateway/models/passwordresets"
+	"JobTracker/servers/gateway/models/users"
+	"JobTracker/servers/gateway/sessions"
+	"JobTracker/servers/problem"
+)
+
+//PasswordHandler handles requests to change the current user's
+//password, at /v1/users/me/password. The user must give their
+//current password, unless they have none because they signed up with
+//a provider, and the new one must follow the password policy.
+func (ctx *HandlerContext) PasswordHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		problem.Error(w, r, "only PUT method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	sessionState := &SessionState{}
+	if _, err := ctx.getState(r, sessionState); err != nil {
+		stateError(w, r, err)
+		return
+	}
+	userID := sessionState.User.ID
+	if userPath := path.Base(path.Dir(r.URL.Path)); userPath != "me" && userPath != strconv.FormatInt(userID, 10) {
+		problem.Error(w, r, "you are not authorized to take this action", http.StatusForbidden)
+		return
+	}
+
+	//Validate that request content type is JSON
+	if !strings.HasPrefix(r.Header.Get(headerContentType), contentTypeJson) {
+		problem.Error(w, r, "request body must be in JSON", http.StatusUnsupportedMediaType)
+		return
+	}
+	defer r.Body.Close()
+	change := &users.PasswordChange{}
+	if err := json.NewDecoder(r.Body).Decode(change); err != nil {
+		problem.Error(w, r, "error decoding password change", http.StatusBadRequest)
+		return
+	}
+
+	//The session doesn't hold the password hash or email, so get the stored user
+	u, err := ctx.UserStore.GetByID(r.Context(), userID)
+	if err != nil {
+		userStoreError(w, r, err)
+		return
+	}
+	if !checkCurrentPassword(u, change.CurrentPassword) {
+		problem.Error(w, r, "your current password is incorrect", http.StatusForbidden)
+		return
+	}
+	if !ctx.checkNewPassword(w, r, u, change.Password, change.PasswordConf) {
+		return
+	}
+	if !ctx.setPassword(w, r, u, change.Password) {
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("password changed"))
+}
+
+//PasswordResetHandler handles requests to redeem a password reset
+//token, at /v1/passwordresets, which admins issue to users who can't
+//sign in. The new password must follow the password policy, and
+//every session of the user is ended, since someone else may have
+//signed in with the old one. Each token can only be used once.
+func (ctx *HandlerContext) PasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		problem.Error(w, r, "only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if ctx.PasswordResetStore == nil {
+		problem.Error(w, r, "password resets are not available", http.StatusNotImplemented)
+		return
+	}
+
+	//Validate that request content type is JSON
+	if !strings.HasPrefix(r.Header.Get(headerContentType), contentTypeJson) {
+		problem.Error(w, r, "request body must be in JSON", http.StatusUnsupportedMediaType)
+		return
+	}
+	defer r.Body.Close()
+	reset := &users.PasswordReset{}
+	if err := json.NewDecoder(r.Body).Decode(reset); err != nil {
+		problem.Error(w, r, "error decoding password reset", http.StatusBadRequest)
+		return
+	}
+
+	//The token is only redeemed once the new password is valid,
+	//so a password the policy refuses doesn't use it up
+	hash := passwordresets.HashToken(reset.Token)
+	pending, err := ctx.PasswordResetStore.Get(r.Context(), hash, time.Now())
+	if err != nil {
+		passwordResetError(w, r, err)
+		return
+	}
+	u, err := ctx.UserStore.GetByID(r.Context(), pending.UserID)
+	if err != nil {
+		userStoreError(w, r, err)
+		return
+	}
+	if !ctx.checkNewPassword(w, r, u, reset.Password, reset.PasswordConf) {
+		return
+	}
+	if _, err := ctx.PasswordResetStore.Finish(r.Context(), hash, time.Now()); err != nil {
+		passwordResetError(w, r, err)
+		return
+	}
+	if !ctx.setPassword(w, r, u, reset.Password) {
+		return
+	}
+
+	if err := ctx.UserStore.SignOut(r.Context(), u.ID, time.Now()); err != nil {
+		userStoreError(w, r, err)
+		return
+	}
+	ctx.SessionUsers.forget(u.ID)
+	//the sessions are already refused by checkSession, so failing
+	//to delete them only leaves them in the store until they expire
+	if _, err := sessions.DeleteUserSessions(r.Context(), ctx.SessionStore, u.ID); err != nil {
+		log.Printf("error deleting the sessions of user %d: %v", u.ID, err)
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("password reset"))
+}
+
+//passwordResetError responds to an error from the password reset store
+func passwordResetError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, passwordresets.ErrResetNotFound) {
+		problem.Error(w, r, err.Error(), http.StatusNotFound)
+		return
+	}
+	problem.Internal(w, r, err, "unexpected error getting password reset", http.StatusInternalServerError)
+}
+
+//checkNewPassword checks that `password` matches its confirmation
+//and follows the password policy for the user. If it doesn't, it
+//responds to the client and returns false.
+func (ctx *HandlerContext) checkNewPassword(w http.ResponseWriter, r *http.Request, u *users.User, password string, passwordConf string) bool {
+	if password != passwordConf {
+		validationError(w, r, users.ValidationErrors{{Field: "passwordConf", Message: "must match the new password"}})
+		return false
+	}
+	err := ctx.PasswordPolicy.Check(password, u.UserName, u.Email)
+	if errors.Is(err, users.ErrPasswordCheckFailed) {
+		problem.Internal(w, r, err, "unable to check your password, please try again later", http.StatusServiceUnavailable)
+		return false
+	}
+	if err != nil {
+		validationError(w, r, err)
+		return false
+	}
+	return true
+}
+
+//setPassword hashes `password` and stores it as the user's
+//password. If it can't, it responds to the client and returns false.
+func (ctx *HandlerContext) setPassword(w http.ResponseWriter, r *http.Request, u *users.User, password string) bool {
+	if err := u.SetPasswordWith(ctx.PasswordHasher, password); err != nil {
+		problem.Internal(w, r, err, "unexpected error hashing password", http.StatusInternalServerError)
+		return false
+	}
+	if err := ctx.UserStore.UpdatePassHash(r.Context(), u.ID, u.PassHash); err != nil {
+		userStoreError(w, r, err)
+		return false
+	}
+	return true
+}
+
+//checkCurrentPassword returns whether `password` is the user's current
+//password. Users who signed up with a provider have no password until
+//they set one, so for them their session is the only check.
+func checkCurrentPassword(u *users.User, password string) bool {
+	return !u.HasPassword() || u.Authenticate(password) == nil
+}
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"JobTracker/servers/gateway/models/passwordresets"
+	"JobTracker/servers/gateway/models/users"
+	"JobTracker/servers/gateway/sessions"
+	"JobTracker/servers/problem"
+)
+
+func TestPasswordHandler(t *testing.T) {
+	signingKey := "testKey"
+	sessionStore := sessions.NewMemStore(time.Hour, time.Minute)
+	userStore := users.NewMemStore()
+	me := &users.User{Email: "neo@matrix.net", UserName: "neo"}
+	if err := me.SetPassword("oldPassword1"); err != nil {
+		t.Fatalf("unexpected error setting password: %v", err)
+	}
+	me, err := userStore.Insert(context.Background(), me)
+	if err != nil {
+		t.Fatalf("unexpected error inserting user: %v", err)
+	}
+	sid, err := sessions.NewSessionID(signingKey)
+	if err != nil {
+		t.Fatalf("unexpected error creating session ID")
+	}
+	if err := sessionStore.Save(context.Background(), sid, &SessionState{User: me}); err != nil {
+		t.Fatalf("unexpected error saving to session store")
+	}
+	ctx := HandlerContext{
+		SigningKey:     signingKey,
+		SessionStore:   sessionStore,
+		UserStore:      userStore,
+		PasswordPolicy: &users.PasswordPolicy{MinLength: 10, RequiredClasses: 3},
+	}
+
+	cases := []struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		expectedCode   int
+		expectedFields []string
+	}{
+		{"Invalid Method", http.MethodPost, "/v1/users/me/password", `{}`, http.StatusMethodNotAllowed, nil},
+		{"Another User", http.MethodPut, "/v1/users/2/password",
+			`{"currentPassword": "oldPassword1", "password": "newPassword1!", "passwordConf": "newPassword1!"}`, http.StatusForbidden, nil},
+		{"Malformed JSON", http.MethodPut, "/v1/users/me/password", `{"password": `, http.StatusBadRequest, nil},
+		{"Wrong Current Password", http.MethodPut, "/v1/users/me/password",
+			`{"currentPassword": "guess", "password": "newPassword1!", "passwordConf": "newPassword1!"}`, http.StatusForbidden, nil},
+		{"Mismatched Confirmation", http.MethodPut, "/v1/users/me/password",
+			`{"currentPassword": "oldPassword1", "password": "newPassword1!", "passwordConf": "newPassword2!"}`,
+			http.StatusUnprocessableEntity, []string{"passwordConf"}},
+		{"Breaks Policy", http.MethodPut, "/v1/users/me/password",
+			`{"currentPassword": "oldPassword1", "password": "neo", "passwordConf": "neo"}`,
+			http.StatusUnprocessableEntity, []string{"password", "password", "password", "password"}},
+		{"Valid", http.MethodPut, "/v1/users/me/password",
+			`{"currentPassword": "oldPassword1", "password": "newPassword1!", "passwordConf": "newPassword1!"}`, http.StatusOK, nil},
+	}
+	for _, c := range cases {
+		request, _ := http.NewRequest(c.method, c.path, strings.NewReader(c.body))
+		request.Header.Set("Authorization", "Bearer "+sid.String())
+		request.Header.Set(headerContentType, contentTypeJson)
+		responseWriter := httptest.NewRecorder()
+		http.HandlerFunc(ctx.SpecificUserHandler).ServeHTTP(responseWriter, request)
+		if status := responseWriter.Code; status != c.expectedCode {
+			t.Errorf("case %s: wrong status code - got %v but expected %v: %s", c.name, status, c.expectedCode, responseWriter.Body.String())
+		}
+		if c.expectedFields != nil {
+			response := &problem.Problem{}
+			if err := json.Unmarshal(responseWriter.Body.Bytes(), response); err != nil {
+				t.Fatalf("case %s: unexpected error unmarshaling validation errors: %v", c.name, err)
+			}
+			fields := []string{}
+			for _, fe := range response.Errors {
+				fields = append(fields, fe.Field)
+			}
+			if !reflect.DeepEqual(fields, c.expectedFields) {
+				t.Errorf("case %s: wrong invalid fields - got %v but expected %v", c.name, fields, c.expectedFields)
+			}
+		}
+	}
+
+	stored, err := userStore.GetByID(context.Background(), me.ID)
+	if err != nil {
+		t.Fatalf("unexpected error getting user: %v", err)
+	}
+	if err := stored.Authenticate("newPassword1!"); err != nil {
+		t.Errorf("the new password was not stored: %v", err)
+	}
+}
+
+func TestUsersHandlerPasswordPolicy(t *testing.T) {
+	ctx := HandlerContext{
+		SigningKey:     "testKey",
+		SessionStore:   sessions.NewMemStore(time.Hour, time.Minute),
+		UserStore:      users.NewMemStore(),
+		PasswordPolicy: &users.PasswordPolicy{MinLength: 8, Breached: breachedEverything{}},
+	}
+	body := `{"email": "neo@matrix.net", "password": "whatever123", "passwordConf": "whatever123", "userName": "neo"}`
+	request, _ := http.NewRequest(http.MethodPost, "/v1/users", strings.NewReader(body))
+	request.Header.Set(headerContentType, contentTypeJson)
+	responseWriter := httptest.NewRecorder()
+	http.HandlerFunc(ctx.UsersHandler).ServeHTTP(responseWriter, request)
+	if status := responseWriter.Code; status != http.StatusUnprocessableEntity {
+		t.Errorf("wrong status code for a breached password - got %v but expected %v", status, http.StatusUnprocessableEntity)
+	}
+	p := &problem.Problem{}
+	if err := json.Unmarshal(responseWriter.Body.Bytes(), p); err != nil || len(p.Errors) != 1 || p.Errors[0].Field != "password" {
+		t.Fatalf("response did not list the password as invalid: %s", responseWriter.Body.String())
+	}
+	if !strings.Contains(p.Errors[0].Message, "data breach") {
+		t.Errorf("response did not explain why the password was rejected: %s", responseWriter.Body.String())
+	}
+}
+
+//breachedEverything reports every password as breached
+type breachedEverything struct{}
+
+func (breachedEverything) IsBreached(password string) (bool, error) {
+	return true, nil
+}
+
+func TestPasswordReset(t *testing.T) {
+	tt := newAdminTest(t, 1)
+	tt.ctx.PasswordResetStore = passwordresets.NewMemStore()
+	tt.ctx.PasswordPolicy = &users.PasswordPolicy{MinLength: 10, RequiredClasses: 3}
+	admin := tt.ctx.RequireAdmin(tt.ctx.AdminUsersHandler)
+	agent, _ := tt.ctx.UserStore.GetByEmail(context.Background(), "agent0@matrix.net")
+	agentTest := tt.as(t, agent)
+
+	issued := &issuedPasswordReset{}
+	path := fmt.Sprintf("/v1/admin/users/%d/passwordreset", agent.ID)
+	if status := tt.serve(t, admin, http.MethodPost, path, "", issued); status != http.StatusCreated {
+		t.Fatalf("wrong status code issuing a password reset - got %v but expected %v", status, http.StatusCreated)
+	}
+	if len(issued.Token) == 0 || issued.UserID != agent.ID || issued.ExpiresAt.Before(time.Now()) {
+		t.Fatalf("incorrect issued password reset: %+v", issued)
+	}
+	if status := tt.serve(t, admin, http.MethodPost, "/v1/admin/users/999/passwordreset", "", nil); status != http.StatusNotFound {
+		t.Errorf("wrong status code issuing a reset for an unknown user - got %v but expected %v", status, http.StatusNotFound)
+	}
+
+	reset := func(token string, password string, passwordConf string) int {
+		body := fmt.Sprintf(`{"token": %q, "password": %q, "passwordConf": %q}`, token, password, passwordConf)
+		request, _ := http.NewRequest(http.MethodPost, "/v1/passwordresets", strings.NewReader(body))
+		request.Header.Set(headerContentType, contentTypeJson)
+		responseWriter := httptest.NewRecorder()
+		tt.ctx.PasswordResetHandler(responseWriter, request)
+		return responseWriter.Code
+	}
+	cases := []struct {
+		name         string
+		token        string
+		password     string
+		passwordConf string
+		expectedCode int
+	}{
+		{"Unknown Token", "guess", "newPassword1!", "newPassword1!", http.StatusNotFound},
+		{"Mismatched Confirmation", issued.Token, "newPassword1!", "newPassword2!", http.StatusUnprocessableEntity},
+		{"Breaks Policy", issued.Token, "short", "short", http.StatusUnprocessableEntity},
+	}
+	for _, c := range cases {
+		if status := reset(c.token, c.password, c.passwordConf); status != c.expectedCode {
+			t.Errorf("case %s: wrong status code - got %v but expected %v", c.name, status, c.expectedCode)
+		}
+	}
+
+	//invalid passwords don't use the token up
+	if status := reset(issued.Token, "newPassword1!", "newPassword1!"); status != http.StatusOK {
+		t.Fatalf("wrong status code resetting password - got %v but expected %v", status, http.StatusOK)
+	}
+	if status := reset(issued.Token, "newPassword2!", "newPassword2!"); status != http.StatusNotFound {
+		t.Errorf("wrong status code reusing a reset token - got %v but expected %v", status, http.StatusNotFound)
+	}
+	stored, _ := tt.ctx.UserStore.GetByID(context.Background(), agent.ID)
+	if stored.Authenticate("newPassword1!") != nil {
+		t.Errorf("the new password should be stored")
+	}
+	//the user's sessions are ended
+	if status := agentTest.serve(t, tt.ctx.SpecificUserHandler, http.MethodGet, "/v1/users/me", "", nil); status != http.StatusUnauthorized {
+		t.Errorf("wrong status code with a session begun before the reset - got %v but expected %v", status, http.StatusUnauthorized)
+	}
+
+	tt.ctx.PasswordResetStore = nil
+	if status := tt.serve(t, admin, http.MethodPost, path, "", nil); status != http.StatusNotImplemented {
+		t.Errorf("wrong status code without a password reset store - got %v but expected %v", status, http.StatusNotImplemented)
+	}
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"JobTracker/servers/logging"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+//requestLogKey is the context key for the access log entry of a request
+type requestLogKey struct{}
+
+//requestLogEntry holds what handlers learn about a request while
+//serving it, such as who made it, for its access log record
+type requestLogEntry struct {
+	userID   int64
+	upstream string
+}
+
+//HandlerRequestLog is a middleware handler that gives each request
+//an ID and logs a structured access log record for it
+type HandlerRequestLog struct {
+	handler http.Handler
+	logger  *slog.Logger
+}
+
+//ServeHTTP assigns the request an ID, unless it already has a valid
+//one in the X-Request-ID header, passes it on in the request and
+//response headers, and logs the request once it has been served
+func (hl *HandlerRequestLog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	requestID := r.Header.Get(logging.RequestIDHeader)
+	if !logging.ValidRequestID(requestID) {
+		requestID = logging.NewRequestID()
+		r.Header.Set(logging.RequestIDHeader, requestID)
+	}
+	w.Header().Set(logging.RequestIDHeader, requestID)
+
+	entry := &requestLogEntry{}
+	recorder := logging.NewStatusRecorder(w)
+	hl.handler.ServeHTTP(recorder, r.WithContext(context.WithValue(r.Context(), requestLogKey{}, entry)))
+
+	args := []interface{}{
+		"requestID", requestID,
+		"method", r.Method,
+		"path", r.URL.Path,
+		"status", recorder.Status(),
+		"latencyMs", float64(time.Since(start).Microseconds()) / 1000,
+		"bytes", recorder.Bytes(),
+		"remoteAddr", r.RemoteAddr,
+	}
+	if entry.userID != 0 {
+		args = append(args, "userID", entry.userID)
+	}
+	if len(entry.upstream) != 0 {
+		args = append(args, "upstream", entry.upstream)
+	}
+	if sc := trace.SpanContextFromContext(r.Context()); sc.IsValid() {
+		args = append(args, "traceID", sc.TraceID().String())
+	}
+	hl.logger.Info("request", args...)
+}
+
+//NewHandlerRequestLog creates a new request logging middleware
+//handler that logs to `logger`
+func NewHandlerRequestLog(handlerToWrap http.Handler, logger *slog.Logger) *HandlerRequestLog {
+	return &HandlerRequestLog{handler: handlerToWrap, logger: logger}
+}
+
+//logEntry returns the access log entry of the request, or
+//nil if the request isn't being logged
+func logEntry(r *http.Request) *requestLogEntry {
+	entry, _ := r.Context().Value(requestLogKey{}).(*requestLogEntry)
+	return entry
+}
+
+//LogUser records the ID of the user making the request in its access log
+func LogUser(r *http.Request, userID int64) {
+	if entry := logEntry(r); entry != nil {
+		entry.userID = userID
+	}
+}
+
+//LogUpstream records the upstream the request was
+//proxied to, such as "http://applications:80", in
+//its access log
+func LogUpstream(r *http.Request, upstream string) {
+	if entry := logEntry(r); entry != nil {
+		entry.upstream = upstream
+	}
+}
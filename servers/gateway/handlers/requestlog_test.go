@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"JobTracker/servers/logging"
+	"JobTracker/servers/problem"
+)
+
+//serveLogged serves `request` with `handler` wrapped in the request log
+//middleware and returns the response and the decoded access log record
+func serveLogged(t *testing.T, handler http.Handler, request *http.Request) (*httptest.ResponseRecorder, map[string]interface{}) {
+	logs := &bytes.Buffer{}
+	response := httptest.NewRecorder()
+	NewHandlerRequestLog(handler, logging.New(logs)).ServeHTTP(response, request)
+	record := map[string]interface{}{}
+	if err := json.Unmarshal(logs.Bytes(), &record); err != nil {
+		t.Fatalf("error decoding access log record %q: %v", logs.String(), err)
+	}
+	return response, record
+}
+
+func TestRequestLogRequestID(t *testing.T) {
+	forwarded := ""
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r.Header.Get(logging.RequestIDHeader)
+	})
+
+	cases := []struct {
+		name     string
+		received string
+		keep     bool
+	}{
+		{"Assigned", "", false},
+		{"Propagated", "lb-1234:abcd.ef_01", true},
+		{"Invalid", "bad id\n", false},
+		{"Too Long", strings.Repeat("a", logging.MaxRequestIDLength+1), false},
+	}
+	for _, c := range cases {
+		request := httptest.NewRequest(http.MethodGet, "/v1/users/me", nil)
+		if len(c.received) != 0 {
+			request.Header.Set(logging.RequestIDHeader, c.received)
+		}
+		response, record := serveLogged(t, handler, request)
+
+		requestID := response.Header().Get(logging.RequestIDHeader)
+		if c.keep && requestID != c.received {
+			t.Errorf("case %s: the request ID should be kept but got %q", c.name, requestID)
+		}
+		if !c.keep && (requestID == c.received || !logging.ValidRequestID(requestID)) {
+			t.Errorf("case %s: a new request ID should be assigned but got %q", c.name, requestID)
+		}
+		if forwarded != requestID {
+			t.Errorf("case %s: the request ID should be passed on in the request but got %q", c.name, forwarded)
+		}
+		if record["requestID"] != requestID {
+			t.Errorf("case %s: the request ID should be logged but got %v", c.name, record["requestID"])
+		}
+	}
+}
+
+func TestRequestLogRecord(t *testing.T) {
+	tt := newHandlerTest(t)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := tt.ctx.getState(r, &SessionState{}); err != nil {
+			t.Errorf("unexpected error getting session state: %v", err)
+		}
+		LogUpstream(r, "http://applications:80")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("created"))
+	})
+
+	request := httptest.NewRequest(http.MethodPost, "/v1/applications", nil)
+	request.Header.Set("Authorization", "Bearer "+tt.sid.String())
+	_, record := serveLogged(t, handler, request)
+
+	expected := map[string]interface{}{
+		"level":    slog.LevelInfo.String(),
+		"msg":      "request",
+		"method":   http.MethodPost,
+		"path":     "/v1/applications",
+		"status":   float64(http.StatusCreated),
+		"bytes":    float64(len("created")),
+		"userID":   float64(1),
+		"upstream": "http://applications:80",
+	}
+	for key, value := range expected {
+		if record[key] != value {
+			t.Errorf("incorrect %s: expected %v but got %v", key, value, record[key])
+		}
+	}
+	if _, found := record["latencyMs"]; !found {
+		t.Errorf("the latency should be logged: %v", record)
+	}
+	if _, found := record["Authorization"]; found {
+		t.Errorf("the Authorization header should not be logged: %v", record)
+	}
+}
+
+func TestRequestLogProblem(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		problem.Error(w, r, "this user does not exist", http.StatusNotFound)
+	})
+	request := httptest.NewRequest(http.MethodGet, "/v1/users/42", nil)
+	response, record := serveLogged(t, handler, request)
+
+	p := &problem.Problem{}
+	if err := json.NewDecoder(response.Body).Decode(p); err != nil {
+		t.Fatalf("error decoding problem: %v", err)
+	}
+	if p.RequestID != response.Header().Get(logging.RequestIDHeader) {
+		t.Errorf("the problem should include the request ID %q but got %q", response.Header().Get(logging.RequestIDHeader), p.RequestID)
+	}
+	if record["status"] != float64(http.StatusNotFound) {
+		t.Errorf("incorrect status: expected %d but got %v", http.StatusNotFound, record["status"])
+	}
+	if _, found := record["userID"]; found {
+		t.Errorf("anonymous requests should not log a user: %v", record)
+	}
+}
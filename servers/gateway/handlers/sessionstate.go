@@ -9,3 +9,12 @@ type SessionState struct {
 	StartTime time.Time   `json:"startTime"`
 	User      *users.User `json:"user"`
 }
+
+//SessionOwner returns the ID of the session's user, so
+//the session store can delete all of a user's sessions
+func (s *SessionState) SessionOwner() (int64, bool) {
+	if s.User == nil {
+		return 0, false
+	}
+	return s.User.ID, true
+}
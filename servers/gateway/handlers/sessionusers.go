@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"strconv"
+	"time"
+
+	"JobTracker/servers/gateway/models/users"
+
+	"github.com/patrickmn/go-cache"
+)
+
+//SessionUserCache keeps the stored users sessions were checked
+//against for a short time, so each request with a session doesn't
+//query the user store, which stateless session tokens avoid for the
+//session itself.
+//
+//The trade-off is that a user disabled, demoted or signed out
+//everywhere through another gateway can keep using their sessions
+//until their entry expires. Changes made through this gateway forget
+//the user right away, and RequireAdmin always checks the store.
+type SessionUserCache struct {
+	entries *cache.Cache
+}
+
+//NewSessionUserCache returns a SessionUserCache that keeps each
+//user for `ttl`, or nil, which caches nothing, if `ttl` isn't positive
+func NewSessionUserCache(ttl time.Duration) *SessionUserCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &SessionUserCache{
+		entries: cache.New(ttl, 10*ttl),
+	}
+}
+
+//get returns a copy of the cached user with the given ID, if any
+func (sc *SessionUserCache) get(id int64) (*users.User, bool) {
+	if sc == nil {
+		return nil, false
+	}
+	u, found := sc.entries.Get(strconv.FormatInt(id, 10))
+	if !found {
+		return nil, false
+	}
+	copied := *u.(*users.User)
+	return &copied, true
+}
+
+//set caches a copy of the user
+func (sc *SessionUserCache) set(u *users.User) {
+	if sc == nil {
+		return
+	}
+	copied := *u
+	sc.entries.SetDefault(strconv.FormatInt(u.ID, 10), &copied)
+}
+
+//forget removes the user with the given ID, after they changed,
+//so their next request checks the store
+func (sc *SessionUserCache) forget(id int64) {
+	if sc == nil {
+		return
+	}
+	sc.entries.Delete(strconv.FormatInt(id, 10))
+}
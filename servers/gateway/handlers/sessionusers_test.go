@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"JobTracker/servers/gateway/models/users"
+)
+
+func TestSessionUserCache(t *testing.T) {
+	if NewSessionUserCache(0) != nil {
+		t.Errorf("a TTL of 0 should cache nothing")
+	}
+
+	tt := newAdminTest(t, 1)
+	tt.ctx.SessionUsers = NewSessionUserCache(time.Hour)
+	admin := tt.ctx.RequireAdmin(tt.ctx.AdminUsersHandler)
+	agent, _ := tt.ctx.UserStore.GetByEmail(context.Background(), "agent0@matrix.net")
+	agentTest := tt.as(t, agent)
+	getMe := func() int {
+		return agentTest.serve(t, tt.ctx.SpecificUserHandler, http.MethodGet, "/v1/users/me", "", nil)
+	}
+	if status := getMe(); status != http.StatusOK {
+		t.Fatalf("wrong status code getting the current user - got %v but expected %v", status, http.StatusOK)
+	}
+
+	//changes made elsewhere, such as through another
+	//gateway, are only seen once the user expires
+	disabled, enabled := true, false
+	tt.ctx.UserStore.UpdateAccount(context.Background(), agent.ID, &users.AccountUpdates{Disabled: &disabled})
+	if status := getMe(); status != http.StatusOK {
+		t.Errorf("wrong status code with a cached user - got %v but expected %v", status, http.StatusOK)
+	}
+	tt.ctx.UserStore.UpdateAccount(context.Background(), agent.ID, &users.AccountUpdates{Disabled: &enabled})
+
+	//changes made through this gateway are seen right away
+	path := fmt.Sprintf("/v1/admin/users/%d", agent.ID)
+	if status := tt.serve(t, admin, http.MethodPatch, path, `{"disabled": true}`, nil); status != http.StatusOK {
+		t.Fatalf("wrong status code disabling user - got %v but expected %v", status, http.StatusOK)
+	}
+	if status := getMe(); status != http.StatusForbidden {
+		t.Errorf("wrong status code after being disabled - got %v but expected %v", status, http.StatusForbidden)
+	}
+
+	//admins are always checked against the store
+	me, _ := tt.ctx.UserStore.GetByEmail(context.Background(), "neo@matrix.net")
+	userRole := users.RoleUser
+	tt.ctx.UserStore.UpdateAccount(context.Background(), me.ID, &users.AccountUpdates{Role: &userRole})
+	if status := tt.serve(t, admin, http.MethodGet, "/v1/admin/users", "", nil); status != http.StatusForbidden {
+		t.Errorf("wrong status code for a demoted admin - got %v but expected %v", status, http.StatusForbidden)
+	}
+}
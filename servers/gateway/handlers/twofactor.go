@@ -0,0 +1,312 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"JobTracker/servers/gateway/models/twofactor"
+	"JobTracker/servers/gateway/models/users"
+	"JobTracker/servers/problem"
+)
+
+//twoFactorIssuer names the service in users' authenticator apps
+const twoFactorIssuer = "JobTracker"
+
+//twoFactorRequest is the body of requests to the two-factor endpoints.
+//Each endpoint uses the fields it needs.
+type twoFactorRequest struct {
+	CurrentPassword string `json:"currentPassword"`
+	Code            string `json:"code"`
+}
+
+//twoFactorStatus is the body of a response to GET /v1/users/me/2fa
+type twoFactorStatus struct {
+	Enabled bool `json:"enabled"`
+}
+
+//twoFactorEnrollment is the body of the response when enrolling,
+//with the secret to add to an authenticator app by hand or by
+//scanning a QR code of the URI
+type twoFactorEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+//recoveryCodesResponse is the body of the response when
+//enrollment is confirmed. The codes are only shown this once.
+type recoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+//challengeRequest is the body of a request to finish signing in
+//with a code from an authenticator app or a recovery code
+type challengeRequest struct {
+	Challenge    string `json:"challenge"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recoveryCode"`
+}
+
+//challengeResponse is the body of the response to signing in
+//with a password when the user has two-factor sign in enabled
+type challengeResponse struct {
+	Challenge string    `json:"challenge"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+//twoFactorStoreError logs an error from the two-factor store and
+//responds that it is unavailable
+func twoFactorStoreError(w http.ResponseWriter, r *http.Request, err error) {
+	problem.Internal(w, r, fmt.Errorf("two-factor store error: %w", err), "two-factor sign in is unavailable, please try again later", http.StatusServiceUnavailable)
+}
+
+//TwoFactorHandler handles requests to manage the current user's
+//two-factor sign in, at /v1/users/me/2fa. GET reports whether it is
+//enabled, POST starts enrolling with a new secret, PUT confirms the
+//enrollment with a code from the authenticator app and DELETE turns
+//it off. POST and DELETE need the user's current password, if they have one.
+func (ctx *HandlerContext) TwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	if ctx.TwoFactorStore == nil {
+		problem.Error(w, r, "two-factor sign in is not available", http.StatusNotImplemented)
+		return
+	}
+	sessionState := &SessionState{}
+	if _, err := ctx.getState(r, sessionState); err != nil {
+		stateError(w, r, err)
+		return
+	}
+	userID := sessionState.User.ID
+	if userPath := path.Base(path.Dir(r.URL.Path)); userPath != "me" && userPath != strconv.FormatInt(userID, 10) {
+		problem.Error(w, r, "you are not authorized to take this action", http.StatusForbidden)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		enrollment, err := ctx.TwoFactorStore.Get(r.Context(), userID)
+		if err != nil && !errors.Is(err, twofactor.ErrNotEnrolled) {
+			twoFactorStoreError(w, r, err)
+			return
+		}
+		respondWithJSON(w, r, http.StatusOK, &twoFactorStatus{Enabled: err == nil && enrollment.Confirmed})
+		return
+	}
+	if r.Method != http.MethodPost && r.Method != http.MethodPut && r.Method != http.MethodDelete {
+		problem.Error(w, r, "only GET, POST, PUT and DELETE methods are allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	//Validate that request content type is JSON
+	if !strings.HasPrefix(r.Header.Get(headerContentType), contentTypeJson) {
+		problem.Error(w, r, "request body must be in JSON", http.StatusUnsupportedMediaType)
+		return
+	}
+	defer r.Body.Close()
+	req := &twoFactorRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		problem.Error(w, r, "error decoding request", http.StatusBadRequest)
+		return
+	}
+
+	//The session doesn't hold the password hash or email, so get the stored user
+	u, err := ctx.UserStore.GetByID(r.Context(), userID)
+	if err != nil {
+		userStoreError(w, r, err)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		if !checkCurrentPassword(u, req.CurrentPassword) {
+			problem.Error(w, r, "your current password is incorrect", http.StatusForbidden)
+			return
+		}
+		secret, err := twofactor.GenerateSecret()
+		if err != nil {
+			problem.Internal(w, r, err, "unexpected error generating secret", http.StatusInternalServerError)
+			return
+		}
+		err = ctx.TwoFactorStore.Begin(r.Context(), userID, secret)
+		if errors.Is(err, twofactor.ErrAlreadyEnrolled) {
+			problem.Error(w, r, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			twoFactorStoreError(w, r, err)
+			return
+		}
+		respondWithJSON(w, r, http.StatusCreated, &twoFactorEnrollment{
+			Secret: secret,
+			URI:    twofactor.KeyURI(twoFactorIssuer, u.Email, secret),
+		})
+
+	case http.MethodPut:
+		enrollment, err := ctx.TwoFactorStore.Get(r.Context(), userID)
+		if errors.Is(err, twofactor.ErrNotEnrolled) {
+			problem.Error(w, r, "start enrolling with POST first", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			twoFactorStoreError(w, r, err)
+			return
+		}
+		if enrollment.Confirmed {
+			problem.Error(w, r, twofactor.ErrAlreadyEnrolled.Error(), http.StatusConflict)
+			return
+		}
+		step, err := twofactor.Validate(enrollment.Secret, req.Code, time.Now(), enrollment.LastStep)
+		if err != nil {
+			validationError(w, r, users.ValidationErrors{{Field: "code", Message: "is incorrect or has expired"}})
+			return
+		}
+		codes, hashes, err := twofactor.GenerateRecoveryCodes()
+		if err != nil {
+			problem.Internal(w, r, err, "unexpected error generating recovery codes", http.StatusInternalServerError)
+			return
+		}
+		err = ctx.TwoFactorStore.Confirm(r.Context(), userID, step, hashes)
+		if errors.Is(err, twofactor.ErrNotEnrolled) {
+			//confirmed by a concurrent request
+			problem.Error(w, r, twofactor.ErrAlreadyEnrolled.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			twoFactorStoreError(w, r, err)
+			return
+		}
+		respondWithJSON(w, r, http.StatusOK, &recoveryCodesResponse{RecoveryCodes: codes})
+
+	case http.MethodDelete:
+		if !checkCurrentPassword(u, req.CurrentPassword) {
+			problem.Error(w, r, "your current password is incorrect", http.StatusForbidden)
+			return
+		}
+		if err := ctx.TwoFactorStore.Delete(r.Context(), userID); err != nil {
+			twoFactorStoreError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("two-factor sign in turned off"))
+	}
+}
+
+//beginChallenge responds to a correct password from a user with
+//two-factor sign in enabled with a challenge token, which must be
+//exchanged with a code for a session at /v1/sessions/challenge
+func (ctx *HandlerContext) beginChallenge(w http.ResponseWriter, r *http.Request, user *users.User) {
+	token, tokenHash, err := twofactor.NewChallengeToken()
+	if err != nil {
+		problem.Internal(w, r, err, "unexpected error creating challenge", http.StatusInternalServerError)
+		return
+	}
+	challenge := &twofactor.Challenge{
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(twofactor.ChallengeDuration),
+	}
+	if err := ctx.TwoFactorStore.CreateChallenge(r.Context(), tokenHash, challenge); err != nil {
+		twoFactorStoreError(w, r, err)
+		return
+	}
+	respondWithJSON(w, r, http.StatusAccepted, &challengeResponse{Challenge: token, ExpiresAt: challenge.ExpiresAt})
+}
+
+//SessionChallengeHandler handles requests to finish signing in with
+//two-factor sign in, exchanging the challenge token from /v1/sessions
+//and a code from the user's authenticator app, or one of their recovery
+//codes, for a session
+func (ctx *HandlerContext) SessionChallengeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		problem.Error(w, r, "only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if ctx.TwoFactorStore == nil {
+		problem.Error(w, r, "two-factor sign in is not available", http.StatusNotImplemented)
+		return
+	}
+	if !strings.HasPrefix(r.Header.Get(headerContentType), contentTypeJson) {
+		problem.Error(w, r, "request body must be in JSON", http.StatusUnsupportedMediaType)
+		return
+	}
+	defer r.Body.Close()
+	req := &challengeRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		problem.Error(w, r, "error decoding challenge", http.StatusBadRequest)
+		return
+	}
+	if len(req.Code) == 0 && len(req.RecoveryCode) == 0 {
+		problem.Error(w, r, "a code or recovery code is required", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	tokenHash := twofactor.HashChallengeToken(req.Challenge)
+	challenge, err := ctx.TwoFactorStore.AttemptChallenge(r.Context(), tokenHash, now)
+	if errors.Is(err, twofactor.ErrChallengeNotFound) {
+		problem.Error(w, r, "this sign in has expired, please sign in again", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		twoFactorStoreError(w, r, err)
+		return
+	}
+	if challenge.Attempts > twofactor.MaxChallengeAttempts {
+		if err := ctx.TwoFactorStore.DeleteChallenge(r.Context(), tokenHash); err != nil {
+			log.Printf("error deleting challenge for user %d: %v", challenge.UserID, err)
+		}
+		signIns.WithLabelValues(signInTwoFactor, signInFailure).Inc()
+		problem.Error(w, r, "too many incorrect codes, please sign in again", http.StatusUnauthorized)
+		return
+	}
+
+	enrollment, err := ctx.TwoFactorStore.Get(r.Context(), challenge.UserID)
+	if errors.Is(err, twofactor.ErrNotEnrolled) {
+		//turned off since the challenge was made
+		problem.Error(w, r, "this sign in has expired, please sign in again", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		twoFactorStoreError(w, r, err)
+		return
+	}
+	if len(req.Code) != 0 {
+		var step int64
+		step, err = twofactor.Validate(enrollment.Secret, req.Code, now, enrollment.LastStep)
+		if err == nil {
+			err = ctx.TwoFactorStore.UseStep(r.Context(), challenge.UserID, step)
+		}
+	} else {
+		err = ctx.TwoFactorStore.UseRecoveryCode(r.Context(), challenge.UserID, twofactor.HashRecoveryCode(req.RecoveryCode))
+	}
+	if errors.Is(err, twofactor.ErrInvalidCode) {
+		signIns.WithLabelValues(signInTwoFactor, signInFailure).Inc()
+		problem.Error(w, r, "the code is incorrect or has expired", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		twoFactorStoreError(w, r, err)
+		return
+	}
+
+	//a challenge can only be used for one session
+	if err := ctx.TwoFactorStore.DeleteChallenge(r.Context(), tokenHash); err != nil {
+		twoFactorStoreError(w, r, err)
+		return
+	}
+	user, err := ctx.UserStore.GetByID(r.Context(), challenge.UserID)
+	if err != nil {
+		userStoreError(w, r, err)
+		return
+	}
+	//the user may have been disabled since the challenge was made
+	if err := checkUser(user); err != nil {
+		signIns.WithLabelValues(signInTwoFactor, signInFailure).Inc()
+		sessionError(w, r, err)
+		return
+	}
+	ctx.beginUserSession(w, r, user, signInTwoFactor)
+}
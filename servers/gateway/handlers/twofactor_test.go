@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"JobTracker/servers/gateway/models/twofactor"
+)
+
+//newTwoFactorTest returns a handlerTest with a two-factor store
+func newTwoFactorTest(t *testing.T) *handlerTest {
+	ht := newHandlerTest(t)
+	ht.ctx.TwoFactorStore = twofactor.NewMemStore()
+	return ht
+}
+
+//answer answers the challenge and returns the status code
+func (ht *handlerTest) answer(t *testing.T, challenge string, field string, code string) int {
+	body := fmt.Sprintf(`{"challenge": %q, %q: %q}`, challenge, field, code)
+	return ht.serve(t, ht.ctx.SessionChallengeHandler, http.MethodPost, "/v1/sessions/challenge", body, nil)
+}
+
+func TestTwoFactorSignIn(t *testing.T) {
+	tt := newTwoFactorTest(t)
+	specificUser := http.HandlerFunc(tt.ctx.SpecificUserHandler)
+
+	//without two-factor sign in, a password is enough
+	if status, _ := tt.signIn(t); status != http.StatusCreated {
+		t.Fatalf("wrong status code signing in without two-factor - got %v but expected %v", status, http.StatusCreated)
+	}
+
+	if status := tt.serve(t, specificUser, http.MethodPost, "/v1/users/me/2fa", `{"currentPassword": "bluePill"}`, nil); status != http.StatusForbidden {
+		t.Errorf("wrong status code enrolling with the wrong password - got %v but expected %v", status, http.StatusForbidden)
+	}
+	enrollment := &twoFactorEnrollment{}
+	if status := tt.serve(t, specificUser, http.MethodPost, "/v1/users/me/2fa", `{"currentPassword": "redPill1!"}`, enrollment); status != http.StatusCreated {
+		t.Fatalf("wrong status code enrolling - got %v but expected %v", status, http.StatusCreated)
+	}
+	if enrollment.URI != twofactor.KeyURI(twoFactorIssuer, "neo@matrix.net", enrollment.Secret) {
+		t.Errorf("incorrect key URI for the secret: %s", enrollment.URI)
+	}
+	//an unconfirmed enrollment doesn't change signing in
+	if status, _ := tt.signIn(t); status != http.StatusCreated {
+		t.Errorf("wrong status code signing in before confirming - got %v but expected %v", status, http.StatusCreated)
+	}
+
+	if status := tt.serve(t, specificUser, http.MethodPut, "/v1/users/me/2fa", `{"code": "000000"}`, nil); status != http.StatusUnprocessableEntity {
+		t.Errorf("wrong status code confirming with a wrong code - got %v but expected %v", status, http.StatusUnprocessableEntity)
+	}
+	now := time.Now()
+	code, _ := twofactor.Code(enrollment.Secret, now)
+	recovery := &recoveryCodesResponse{}
+	if status := tt.serve(t, specificUser, http.MethodPut, "/v1/users/me/2fa", fmt.Sprintf(`{"code": %q}`, code), recovery); status != http.StatusOK {
+		t.Fatalf("wrong status code confirming - got %v but expected %v", status, http.StatusOK)
+	}
+	if len(recovery.RecoveryCodes) != twofactor.RecoveryCodeCount {
+		t.Errorf("expected %d recovery codes but got %v", twofactor.RecoveryCodeCount, recovery.RecoveryCodes)
+	}
+	status := &twoFactorStatus{}
+	if tt.serve(t, specificUser, http.MethodGet, "/v1/users/me/2fa", "", status); !status.Enabled {
+		t.Errorf("two-factor sign in is not reported as enabled after confirming")
+	}
+
+	//a password alone now only gets a challenge
+	signInStatus, challenge := tt.signIn(t)
+	if signInStatus != http.StatusAccepted || len(challenge) == 0 {
+		t.Fatalf("expected a challenge for the password but got %v, %q", signInStatus, challenge)
+	}
+	if status := tt.answer(t, "wrong-token", "code", code); status != http.StatusUnauthorized {
+		t.Errorf("wrong status code answering an unknown challenge - got %v but expected %v", status, http.StatusUnauthorized)
+	}
+	//the code used to confirm can't be used again
+	if status := tt.answer(t, challenge, "code", code); status != http.StatusUnauthorized {
+		t.Errorf("wrong status code reusing a code - got %v but expected %v", status, http.StatusUnauthorized)
+	}
+	nextCode, _ := twofactor.Code(enrollment.Secret, now.Add(twofactor.Period))
+	if status := tt.answer(t, challenge, "code", nextCode); status != http.StatusCreated {
+		t.Fatalf("wrong status code answering with a valid code - got %v but expected %v", status, http.StatusCreated)
+	}
+	if status := tt.answer(t, challenge, "recoveryCode", recovery.RecoveryCodes[0]); status != http.StatusUnauthorized {
+		t.Errorf("wrong status code reusing a challenge - got %v but expected %v", status, http.StatusUnauthorized)
+	}
+
+	//recovery codes work once each
+	_, challenge = tt.signIn(t)
+	if status := tt.answer(t, challenge, "recoveryCode", recovery.RecoveryCodes[0]); status != http.StatusCreated {
+		t.Errorf("wrong status code answering with a recovery code - got %v but expected %v", status, http.StatusCreated)
+	}
+	_, challenge = tt.signIn(t)
+	if status := tt.answer(t, challenge, "recoveryCode", recovery.RecoveryCodes[0]); status != http.StatusUnauthorized {
+		t.Errorf("wrong status code reusing a recovery code - got %v but expected %v", status, http.StatusUnauthorized)
+	}
+
+	//turning it off goes back to signing in with a password alone
+	if status := tt.serve(t, specificUser, http.MethodDelete, "/v1/users/me/2fa", `{"currentPassword": "redPill1!"}`, nil); status != http.StatusOK {
+		t.Fatalf("wrong status code turning off two-factor - got %v but expected %v", status, http.StatusOK)
+	}
+	if status, _ := tt.signIn(t); status != http.StatusCreated {
+		t.Errorf("wrong status code signing in after turning off two-factor - got %v but expected %v", status, http.StatusCreated)
+	}
+}
+
+func TestSessionChallengeAttempts(t *testing.T) {
+	tt := newTwoFactorTest(t)
+	ctx := context.Background()
+	secret, _ := twofactor.GenerateSecret()
+	if err := tt.ctx.TwoFactorStore.Begin(ctx, 1, secret); err != nil {
+		t.Fatalf("unexpected error enrolling: %v", err)
+	}
+	if err := tt.ctx.TwoFactorStore.Confirm(ctx, 1, 0, nil); err != nil {
+		t.Fatalf("unexpected error confirming: %v", err)
+	}
+
+	_, challenge := tt.signIn(t)
+	for i := 0; i < twofactor.MaxChallengeAttempts; i++ {
+		tt.answer(t, challenge, "code", "000000")
+	}
+	//even a valid code is refused once the attempts are used up
+	code, _ := twofactor.Code(secret, time.Now())
+	if status := tt.answer(t, challenge, "code", code); status != http.StatusUnauthorized {
+		t.Errorf("wrong status code after too many attempts - got %v but expected %v", status, http.StatusUnauthorized)
+	}
+
+	_, challenge = tt.signIn(t)
+	if status := tt.answer(t, challenge, "", ""); status != http.StatusBadRequest {
+		t.Errorf("wrong status code without a code - got %v but expected %v", status, http.StatusBadRequest)
+	}
+	if status := tt.answer(t, challenge, "code", code); status != http.StatusCreated {
+		t.Errorf("wrong status code with a new challenge - got %v but expected %v", status, http.StatusCreated)
+	}
+}
@@ -1,32 +1,51 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"database/sql"
 	"encoding/json"
+	"expvar"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
-	"net/http/httputil"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"JobTracker/servers/gateway/blobs"
 	"JobTracker/servers/gateway/handlers"
+	"JobTracker/servers/gateway/models/apitokens"
+	"JobTracker/servers/gateway/models/connections"
+	"JobTracker/servers/gateway/models/identities"
+	"JobTracker/servers/gateway/models/passwordresets"
+	"JobTracker/servers/gateway/models/twofactor"
 	"JobTracker/servers/gateway/models/users"
+	"JobTracker/servers/gateway/oidc"
 	"JobTracker/servers/gateway/sessions"
+	"JobTracker/servers/graceful"
+	"JobTracker/servers/logging"
+	"JobTracker/servers/metrics"
+	"JobTracker/servers/tracing"
 
-	"github.com/go-redis/redis/v8"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/crypto/bcrypt"
 )
 
 // Director is the director used for routing to microservices
 type Director func(r *http.Request)
 
-// CustomDirector forwards to the microservice and passes it the current user.
+// CustomDirector forwards to the microservice and passes it the user that
+// Authorize loaded, which has already been checked against the user store.
 // Returns a Director function required by httputil.ReverseProxy
-func CustomDirector(targets []*url.URL, ctx *handlers.HandlerContext) Director {
+func CustomDirector(targets []*url.URL) Director {
 	// Create variables used across ReverseProxy requests for a given microservice
 	// counter keeps track of which target host to send traffic to next
 	// mutex manages mutually exclusive locks for data structures
@@ -43,16 +62,20 @@ func CustomDirector(targets []*url.URL, ctx *handlers.HandlerContext) Director {
 		// from being passed to the target host
 		r.Header.Del("X-User")
 
-		// Authenticate user based on handler context
-		sessionState := &handlers.SessionState{}
-		_, err := sessions.GetState(r, ctx.SigningKey, ctx.SessionStore, sessionState)
+		// Time the Director in its own span, apart from the round trip
+		_, span := tracing.Start(r.Context(), "proxy.Director", tracing.KindInternal)
+		defer span.End()
+
+		// Use the user the request was authorized as, with a session or
+		// an API token. Requests without one are forwarded unauthenticated,
+		// for the microservice to deal with.
+		user := handlers.RequestUser(r)
 
 		// Pass the authenticated user info to the microservice
-		// If there is an error, forward it to the API to deal with it.
-		if err != nil {
+		if user == nil {
 			r.Header.Add("X-User", "{}")
 		} else {
-			user := sessionState.User
+			handlers.LogUser(r, user.ID)
 			userJSON, err := json.Marshal(user)
 			if err != nil {
 				r.Header.Add("X-User", "{}")
@@ -67,6 +90,10 @@ func CustomDirector(targets []*url.URL, ctx *handlers.HandlerContext) Director {
 
 		// Add X-Forwarded-Host to identify original host requested by client
 		r.Header.Add("X-Forwarded-Host", r.Host)
+		// The X-Request-ID header the request log middleware set is
+		// forwarded as is, so the microservice can log the same ID
+		handlers.LogUpstream(r, targ.String())
+		span.SetAttributes(attribute.String("upstream", targ.String()))
 
 		// Replace original request's Host/URL info with target host info
 		r.Host = targ.Host
@@ -89,20 +116,298 @@ func getURLs(addrString string) []*url.URL {
 	return URLs
 }
 
+// getRedisConfig builds the session store's redis connection settings.
+// REDISADDR is a comma-delimited list of addresses; the other settings
+// come from optional environment variables:
+//
+//	REDISMASTER    name of the Sentinel master, when REDISADDR lists sentinels
+//	REDISCLUSTER   "true" when REDISADDR lists Cluster nodes
+//	REDISUSERNAME  ACL username
+//	REDISPASSWORD  password for the ACL user or the default user
+//	REDISTLS       "true" to connect over TLS
+func getRedisConfig(addrString string) *sessions.RedisConfig {
+	cfg := &sessions.RedisConfig{
+		Addrs:      strings.Split(addrString, ","),
+		MasterName: os.Getenv("REDISMASTER"),
+		Cluster:    os.Getenv("REDISCLUSTER") == "true",
+		Username:   os.Getenv("REDISUSERNAME"),
+		Password:   os.Getenv("REDISPASSWORD"),
+	}
+	if os.Getenv("REDISTLS") == "true" {
+		cfg.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	return cfg
+}
+
+// newSessionStore creates the session store selected by the optional
+// SESSIONMODE environment variable:
+//
+//	redis     (default) session state is kept in Redis at REDISADDR
+//	token     signed, stateless session tokens are verified locally,
+//	          keeping only revocations in Redis at REDISADDR
+//	postgres  session state is kept in the Postgres database, so no
+//	          Redis is needed; expired sessions are swept periodically
+//
+// SESSIONTIMEOUT optionally bounds each call to the store (default 1s),
+// and REDISKEYPREFIX optionally namespaces the gateway's Redis keys.
+func newSessionStore(signingKey string, db *sql.DB) sessions.Store {
+	sessionDuration := time.Duration(30) * time.Minute
+	sessionTimeout := getEnvDuration("SESSIONTIMEOUT", time.Second)
+
+	mode := os.Getenv("SESSIONMODE")
+	if mode == "postgres" {
+		if db == nil {
+			log.Fatalf("SESSIONMODE postgres requires a Postgres user store")
+		}
+		postgresStore := sessions.NewPostgresStore(db, sessionDuration)
+		postgresStore.Timeouts = sessions.NewTimeouts(sessionTimeout)
+		go postgresStore.RunSweeper(context.Background(), time.Duration(5)*time.Minute)
+		return postgresStore
+	}
+
+	redisAddr := os.Getenv("REDISADDR")
+	if len(redisAddr) == 0 {
+		log.Fatalf("Environment variable REDISADDR is empty")
+	}
+	redisClient, err := sessions.NewRedisClient(getRedisConfig(redisAddr))
+	if err != nil {
+		log.Fatalf("unexpected error creating redis client: %v", err)
+	}
+	redisKeyPrefix := os.Getenv("REDISKEYPREFIX")
+	switch mode {
+	case "", "redis":
+		redisStore := sessions.NewRedisStore(redisClient, sessionDuration)
+		redisStore.KeyPrefix = redisKeyPrefix + redisStore.KeyPrefix
+		redisStore.Timeouts = sessions.NewTimeouts(sessionTimeout)
+		return redisStore
+	case "token":
+		revocationList := sessions.NewRedisRevocationList(redisClient)
+		revocationList.KeyPrefix = redisKeyPrefix + revocationList.KeyPrefix
+		tokenStore := sessions.NewTokenStore(signingKey, sessionDuration, revocationList)
+		tokenStore.Timeouts = sessions.NewTimeouts(sessionTimeout)
+		return tokenStore
+	default:
+		log.Fatalf("unknown SESSIONMODE %q", mode)
+		return nil
+	}
+}
+
+// newPasswordPolicy creates the policy for users' passwords from
+// optional environment variables:
+//
+//	PASSWORDMINLENGTH     fewest characters in a password (default 8)
+//	PASSWORDCLASSES       how many of lowercase, uppercase, digits and
+//	                      symbols a password must use (default 2)
+//	BREACHEDPASSWORDSDIR  directory of a k-anonymized breached password
+//	                      list, one <PREFIX>.txt file per SHA-1 hash prefix
+//	                      as downloaded from Pwned Passwords
+func newPasswordPolicy() *users.PasswordPolicy {
+	policy := &users.PasswordPolicy{
+		MinLength:       getEnvInt("PASSWORDMINLENGTH", users.DefaultPasswordPolicy.MinLength),
+		MaxLength:       users.DefaultPasswordPolicy.MaxLength,
+		RequiredClasses: getEnvInt("PASSWORDCLASSES", users.DefaultPasswordPolicy.RequiredClasses),
+	}
+	if dir := os.Getenv("BREACHEDPASSWORDSDIR"); len(dir) != 0 {
+		breached, err := users.NewBreachedPasswordList(dir)
+		if err != nil {
+			log.Fatalf("unexpected error opening breached password list: %v", err)
+		}
+		policy.Breached = breached
+	}
+	return policy
+}
+
+// legacyBcryptCost is the bcrypt cost passwords were hashed with
+// before Argon2id, which accounts whose users haven't signed in since
+// still have
+const legacyBcryptCost = 13
+
+// newPasswordHasher creates the hasher for new passwords from
+// optional environment variables:
+//
+//	PASSWORDHASH   argon2id or bcrypt (default argon2id)
+//	BCRYPTCOST     bcrypt cost (default 13)
+//	ARGON2TIME     Argon2id passes over the memory (default 2)
+//	ARGON2MEMORY   Argon2id memory in KiB (default 19456)
+//	ARGON2THREADS  Argon2id parallelism (default 1)
+//
+// Stored hashes made with another algorithm or other parameters
+// are upgraded when their users sign in.
+func newPasswordHasher() users.PasswordHasher {
+	switch algorithm := os.Getenv("PASSWORDHASH"); algorithm {
+	case "", "argon2id":
+		defaults := users.DefaultHasher.(*users.Argon2idHasher)
+		passes := getEnvInt("ARGON2TIME", int(defaults.Time))
+		memory := getEnvInt("ARGON2MEMORY", int(defaults.Memory))
+		threads := getEnvInt("ARGON2THREADS", int(defaults.Threads))
+		if passes < 1 || threads < 1 || threads > 255 || memory < 8*threads {
+			log.Fatalf("invalid Argon2id parameters: time %d, memory %d KiB, threads %d", passes, memory, threads)
+		}
+		return &users.Argon2idHasher{
+			Time:       uint32(passes),
+			Memory:     uint32(memory),
+			Threads:    uint8(threads),
+			KeyLength:  defaults.KeyLength,
+			SaltLength: defaults.SaltLength,
+		}
+	case "bcrypt":
+		cost := getEnvInt("BCRYPTCOST", legacyBcryptCost)
+		if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+			log.Fatalf("invalid BCRYPTCOST: %d", cost)
+		}
+		return &users.BcryptHasher{Cost: cost}
+	default:
+		log.Fatalf("invalid PASSWORDHASH: %q", algorithm)
+		return nil
+	}
+}
+
+// newTimingPadHash creates the hash that sign ins with unknown emails
+// are checked against, so they take as long as sign ins with wrong
+// passwords. It should be made like most stored hashes, which the
+// optional PASSWORDPADHASH environment variable selects:
+//
+//	legacy   (default) bcrypt with cost 13, like every password
+//	         hashed before Argon2id
+//	current  the PASSWORDHASH hasher, once most users have signed
+//	         in since, upgrading their hashes
+func newTimingPadHash(hasher users.PasswordHasher) []byte {
+	switch mode := os.Getenv("PASSWORDPADHASH"); mode {
+	case "", "legacy":
+		hasher = &users.BcryptHasher{Cost: legacyBcryptCost}
+	case "current":
+	default:
+		log.Fatalf("invalid PASSWORDPADHASH: %q", mode)
+	}
+	padHash, err := users.NewTimingPadHash(hasher)
+	if err != nil {
+		log.Fatalf("unexpected error creating timing pad hash: %v", err)
+	}
+	return padHash
+}
+
+// newOIDCProviders creates the OpenID Connect providers users can sign
+// in with from optional environment variables. OIDCPROVIDERS is a
+// comma-delimited list of provider names, such as "google,uw", and each
+// provider is configured by variables named after it:
+//
+//	OIDC_<NAME>_ISSUER        issuer URL, such as https://accounts.google.com
+//	OIDC_<NAME>_CLIENTID      client ID registered with the provider
+//	OIDC_<NAME>_CLIENTSECRET  client secret registered with the provider
+//	OIDC_<NAME>_REDIRECTURL   page of the web client the provider redirects
+//	                          to, which posts the code to the callback
+func newOIDCProviders() map[string]*oidc.Provider {
+	providers := map[string]*oidc.Provider{}
+	names := os.Getenv("OIDCPROVIDERS")
+	if len(names) == 0 {
+		return providers
+	}
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		provider, err := oidc.NewProvider(context.Background(), &oidc.Config{
+			Name:         name,
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENTID"),
+			ClientSecret: os.Getenv(prefix + "CLIENTSECRET"),
+			RedirectURL:  os.Getenv(prefix + "REDIRECTURL"),
+		})
+		if err != nil {
+			log.Fatalf("unexpected error creating sign in provider %q: %v", name, err)
+		}
+		providers[name] = provider
+	}
+	return providers
+}
+
+// getEnvInt returns the integer in the environment variable `name`,
+// or `def` if it is not set
+func getEnvInt(name string, def int) int {
+	v := os.Getenv(name)
+	if len(v) == 0 {
+		return def
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil || i < 0 {
+		log.Fatalf("invalid %s: %q", name, v)
+	}
+	return i
+}
+
+// getEnvDuration returns the duration in the environment variable `name`,
+// or `def` if it is not set
+func getEnvDuration(name string, def time.Duration) time.Duration {
+	v := os.Getenv(name)
+	if len(v) == 0 {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Fatalf("invalid %s: %v", name, err)
+	}
+	return d
+}
+
+// openDB opens the Postgres database described by the DSN (data source
+// name to pass to SQL connection) and POSTGRES_PASSWORD environment variables.
+// The connection pool can be tuned with optional environment variables:
+//
+//	DBMAXOPENCONNS     most connections open at once, 0 for no limit (default 25)
+//	DBMAXIDLECONNS     most idle connections kept open (default 25)
+//	DBCONNMAXLIFETIME  how long a connection is reused, 0 for forever (default 5m)
+func openDB() *sql.DB {
+	dsn, password := os.Getenv("DSN"), os.Getenv("POSTGRES_PASSWORD")
+	if len(dsn) == 0 || len(password) == 0 {
+		log.Fatalf("Environment variables DSN and POSTGRES_PASSWORD are required")
+	}
+	db, err := sql.Open("postgres", fmt.Sprintf(dsn, password))
+	if err != nil {
+		log.Fatalf("unexpected error opening database connection: %v", err)
+	}
+	db.SetMaxOpenConns(getEnvInt("DBMAXOPENCONNS", 25))
+	db.SetMaxIdleConns(getEnvInt("DBMAXIDLECONNS", 25))
+	db.SetConnMaxLifetime(getEnvDuration("DBCONNMAXLIFETIME", time.Duration(5)*time.Minute))
+	return db
+}
+
 // main is the main entry point for the server
 func main() {
+	// "gateway migrate ..." migrates the database instead of serving
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	// "gateway promote EMAIL" makes the user an admin instead of serving
+	if len(os.Args) > 1 && os.Args[1] == "promote" {
+		if err := runPromote(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	// Serve TLS traffic at port :443
 	const addr = ":443"
 
+	// Log as JSON lines, so logs can be searched by request ID. The
+	// log package's output goes to the same logger.
+	logger := logging.New(os.Stderr)
+	slog.SetDefault(logger)
+
+	// Trace requests when OTEL_TRACES_EXPORTER is set. The provider is
+	// shut down once the server stops, to export the spans it holds.
+	tracerProvider, err := tracing.FromEnv(context.Background(), "gateway")
+	if err != nil {
+		log.Fatalf("unexpected error setting up tracing: %v", err)
+	}
+
 	// Define map of enviroment variable names to values
 	env := map[string]string{}
 	envVars := []string{
-		"TLSCERT",           // Path of TLS certificate
-		"TLSKEY",            // Path of TLS certificate
-		"REDISADDR",         // Address for Redis session store
-		"SESSIONKEY",        // Key for signing and validating session IDs
-		"DSN",               // Data source name to pass to SQL connection
-		"POSTGRES_PASSWORD", // Password for Postgres user store
+		"TLSCERT",    // Path of TLS certificate
+		"TLSKEY",     // Path of TLS certificate
+		"SESSIONKEY", // Key for signing and validating session IDs
 		//	"MESSAGESADDR",      // Comma-delimited list of network addresses where the messaging microservice instances are listening
 		//	"SUMMARYADDR",       // Comma-delimited list of network addresses where the page summary microservice instances are listening
 		"APPLICATIONADDR", // Comma-delimited list of network addresses where the applications microservice instances are listening
@@ -117,29 +422,99 @@ func main() {
 	}
 
 	// Create user store
-	db, err := sql.Open("postgres", fmt.Sprintf(env["DSN"], env["POSTGRES_PASSWORD"]))
-	if err != nil {
-		log.Fatalf("unexpected error opening database connection: %v", err)
+	// USERSTORE is optional: "memory" keeps users in process memory, so the
+	// gateway can be developed locally without Postgres. Otherwise DSN (data
+	// source name to pass to SQL connection) and POSTGRES_PASSWORD are required,
+	// and the database must have been migrated with "gateway migrate up".
+	var db *sql.DB
+	var usersStore users.Store
+	var twoFactorStore twofactor.Store
+	var identityStore identities.Store
+	var apiTokenStore apitokens.Store
+	var connectionStore connections.Store
+	var passwordResetStore passwordresets.Store
+	if os.Getenv("USERSTORE") == "memory" {
+		usersStore = users.NewMemStore()
+		twoFactorStore = twofactor.NewMemStore()
+		identityStore = identities.NewMemStore()
+		apiTokenStore = apitokens.NewMemStore()
+		connectionStore = connections.NewMemStore()
+		passwordResetStore = passwordresets.NewMemStore()
+	} else {
+		db = openDB()
+		defer db.Close()
+		postgresStore, err := users.NewPostgresStore(db)
+		if err != nil {
+			log.Fatalf("unexpected error creating new user store: %v", err)
+		}
+		defer postgresStore.Close()
+		expvar.Publish("userstore.db", expvar.Func(func() interface{} { return postgresStore.Stats() }))
+		prometheus.MustRegister(collectors.NewDBStatsCollector(db, "gateway"))
+		usersStore = postgresStore
+		twoFactorStore = twofactor.NewPostgresStore(db)
+		identityStore = identities.NewPostgresStore(db)
+		apiTokenStore = apitokens.NewPostgresStore(db)
+		connectionStore = connections.NewPostgresStore(db)
+		passwordResetStore = passwordresets.NewPostgresStore(db)
 	}
-	defer db.Close()
-	usersStore, err := users.NewPostgresStore(db)
+
+	// ADMINADDR is optional: when set, monitoring endpoints such as the
+	// database pool stats at /debug/vars and Prometheus metrics at /metrics
+	// are served there without TLS, so it should only be reachable from
+	// inside the deployment
+	if adminAddr := os.Getenv("ADMINADDR"); len(adminAddr) != 0 {
+		adminMux := http.NewServeMux()
+		adminMux.Handle("/debug/vars", expvar.Handler())
+		adminMux.Handle("/metrics", metrics.Handler())
+		go func() {
+			log.Printf("admin server is listening at %s", adminAddr)
+			log.Fatal(http.ListenAndServe(adminAddr, adminMux))
+		}()
+	}
+
+	// Trace calls to the user store
+	usersStore = users.NewTracedStore(usersStore)
+
+	// Create session store, timing its operations
+	sessionStore := sessions.NewMeteredStore(newSessionStore(env["SESSIONKEY"], db))
+
+	// Create avatar store
+	// AVATARDIR is optional: the directory uploaded avatars are kept in
+	// (default "avatars"). It should be on a volume shared by every gateway.
+	avatarDir := os.Getenv("AVATARDIR")
+	if len(avatarDir) == 0 {
+		avatarDir = "avatars"
+	}
+	avatarStore, err := blobs.NewFSStore(avatarDir)
 	if err != nil {
-		log.Fatalf("unexpected error creating new user store: %v", err)
+		log.Fatalf("unexpected error creating avatar store: %v", err)
 	}
 
-	// Create session store
-	redisClient := redis.NewClient(&redis.Options{
-		Addr:     env["REDISADDR"],
-		Password: "", // Use no password
-		DB:       0,  // Use default DB
-	})
-	sessionStore := sessions.NewRedisStore(redisClient, time.Duration(30)*time.Minute)
+	// Cache the users sessions are checked against
+	// SESSIONCHECKTTL is optional: how long each user is cached (default
+	// 10s). A user disabled or signed out through another gateway can
+	// keep using their sessions that long. "0" checks the user store on
+	// every request.
+	sessionUsers := handlers.NewSessionUserCache(getEnvDuration("SESSIONCHECKTTL", 10*time.Second))
 
-	// Create handler context
+	// Create handler context, hashing new passwords with the
+	// configured algorithm
+	passwordHasher := newPasswordHasher()
 	ctx := &handlers.HandlerContext{
-		SigningKey:   env["SESSIONKEY"],
-		SessionStore: sessionStore,
-		UserStore:    usersStore,
+		SigningKey:         env["SESSIONKEY"],
+		SessionStore:       sessionStore,
+		UserStore:          usersStore,
+		AvatarStore:        avatarStore,
+		PasswordPolicy:     newPasswordPolicy(),
+		PasswordHasher:     passwordHasher,
+		TimingPadHash:      newTimingPadHash(passwordHasher),
+		TwoFactorStore:     twoFactorStore,
+		OIDCProviders:      newOIDCProviders(),
+		IdentityStore:      identityStore,
+		APITokenStore:      apiTokenStore,
+		ConnectionStore:    connectionStore,
+		PasswordResetStore: passwordResetStore,
+		SessionUsers:       sessionUsers,
 	}
 
 	// Create URLs for proxies
@@ -148,9 +523,9 @@ func main() {
 	// summaryURLs := getURLs(env["SUMMARYADDR"])
 
 	// Create reverse proxies
-	applicationsProxy := &httputil.ReverseProxy{Director: CustomDirector(applicationsURLs, ctx)}
-	// messagesProxy := &httputil.ReverseProxy{Director: CustomDirector(messagesURLs, ctx)}
-	// summaryProxy := &httputil.ReverseProxy{Director: CustomDirector(summaryURLs, ctx)}
+	applicationsProxy := newReverseProxy("applications", applicationsURLs)
+	// messagesProxy := newReverseProxy("messages", messagesURLs)
+	// summaryProxy := newReverseProxy("summary", summaryURLs)
 
 	// Create mux and handle various endpoints
 	mux := http.NewServeMux()
@@ -158,19 +533,41 @@ func main() {
 	mux.HandleFunc("/v1/users/", ctx.SpecificUserHandler)
 	mux.HandleFunc("/v1/sessions", ctx.SessionsHandler)
 	mux.HandleFunc("/v1/sessions/", ctx.SpecificSessionHandler)
-	mux.Handle("/v1/applications", applicationsProxy)
-	mux.Handle("/v1/applications/", applicationsProxy)
-	mux.Handle("/v1/stages", applicationsProxy)
-	mux.Handle("/v1/stages/", applicationsProxy)
+	mux.HandleFunc("/v1/sessions/challenge", ctx.SessionChallengeHandler)
+	mux.HandleFunc("/v1/sessions/oidc/", ctx.OIDCHandler)
+	mux.HandleFunc("/v1/passwordresets", ctx.PasswordResetHandler)
+	mux.HandleFunc("/v1/admin/users", ctx.RequireAdmin(ctx.AdminUsersHandler))
+	mux.HandleFunc("/v1/admin/users/", ctx.RequireAdmin(ctx.AdminUsersHandler))
+	// Proxied routes accept API tokens with the scope for the resource
+	mux.Handle("/v1/applications", ctx.Authorize("applications", applicationsProxy))
+	mux.Handle("/v1/applications/", ctx.Authorize("applications", applicationsProxy))
+	mux.Handle("/v1/stages", ctx.Authorize("stages", applicationsProxy))
+	mux.Handle("/v1/stages/", ctx.Authorize("stages", applicationsProxy))
 	// mux.Handle("/v1/channels", messagesProxy)
 	// mux.Handle("/v1/channels/", messagesProxy)
 	// mux.Handle("/v1/messages/", messagesProxy)
 	// mux.Handle("/v1/summary", summaryProxy)
 
-	// Add CORS middleware
-	corsMux := handlers.NewHandlerCORS(mux)
+	// Add CORS middleware, timing requests by route
+	corsMux := handlers.NewHandlerCORS(metrics.InstrumentMux(mux))
+	// Add request ID and access log middleware, within a span for
+	// each request so access logs can include its trace ID
+	loggedMux := tracing.Handler(handlers.NewHandlerRequestLog(corsMux, logger))
 
-	// Listen and serve TLS traffic
+	// Listen and serve TLS traffic until the server fails or is asked
+	// to stop, then export the spans still held. log.Fatal exits
+	// without running deferred calls, so this can't be deferred.
+	server := &http.Server{Addr: addr, Handler: loggedMux}
 	log.Printf("server is listening at %s", addr)
-	log.Fatal(http.ListenAndServeTLS(addr, env["TLSCERT"], env["TLSKEY"], corsMux))
+	err = graceful.Serve(server, func() error { return server.ListenAndServeTLS(env["TLSCERT"], env["TLSKEY"]) })
+	if tracerProvider != nil {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), graceful.Timeout)
+		if err := tracerProvider.Shutdown(shutdownCtx); err != nil {
+			log.Printf("error exporting the remaining spans: %v", err)
+		}
+		cancel()
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
 }
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"JobTracker/servers/gateway/handlers"
+	"JobTracker/servers/gateway/models/users"
+	"JobTracker/servers/gateway/sessions"
+)
+
+func TestCustomDirector(t *testing.T) {
+	ctx := &handlers.HandlerContext{
+		SigningKey:   "testKey",
+		SessionStore: sessions.NewMemStore(time.Hour, time.Minute),
+		UserStore:    users.NewMemStore(),
+	}
+	me, err := ctx.UserStore.Insert(context.Background(), &users.User{Email: "neo@matrix.net", UserName: "neo"})
+	if err != nil {
+		t.Fatalf("unexpected error inserting user: %v", err)
+	}
+	sid, _ := sessions.NewSessionID(ctx.SigningKey)
+	if err := ctx.SessionStore.Save(context.Background(), sid, &handlers.SessionState{User: me, StartTime: time.Now()}); err != nil {
+		t.Fatalf("unexpected error saving session: %v", err)
+	}
+	director := CustomDirector([]*url.URL{{Scheme: "http", Host: "applications:80"}})
+	newRequest := func() *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/v1/applications", nil)
+		r.Header.Set("Authorization", "Bearer "+sid.String())
+		r.Header.Set("X-User", `{"id": 1, "role": "admin"}`)
+		return r
+	}
+
+	//the user Authorize loaded is forwarded
+	var forwarded string
+	authorized := ctx.Authorize("applications", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		director(r)
+		forwarded = r.Header.Get("X-User")
+	}))
+	authorized.ServeHTTP(httptest.NewRecorder(), newRequest())
+	u := &users.User{}
+	if err := json.Unmarshal([]byte(forwarded), u); err != nil || u.ID != me.ID {
+		t.Errorf("expected user %d to be forwarded but got %s", me.ID, forwarded)
+	}
+
+	//the Director doesn't look up sessions itself, and
+	//replaces the X-User header clients send
+	r := newRequest()
+	director(r)
+	if forwarded := r.Header.Get("X-User"); forwarded != "{}" {
+		t.Errorf("a request that wasn't authorized should be forwarded without a user but got %s", forwarded)
+	}
+	if r.URL.Host != "applications:80" {
+		t.Errorf("incorrect upstream: %s", r.URL.Host)
+	}
+}
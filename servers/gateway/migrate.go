@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"JobTracker/servers/gateway/migrations"
+)
+
+// migrateUsage describes the migrate subcommand
+const migrateUsage = `usage: gateway migrate [command]
+
+Migrates the Postgres database at DSN, using POSTGRES_PASSWORD.
+
+commands:
+  up         apply every pending migration (default)
+  down [N]   revert the N most recently applied migrations (default 1)
+  version    print the newest applied migration's version`
+
+// runMigrate runs the migrate subcommand with the given arguments.
+// It returns errors rather than exiting, so the database is closed.
+func runMigrate(args []string) error {
+	command, steps := "up", 1
+	if len(args) > 0 {
+		command = args[0]
+	}
+	valid := len(args) <= 1
+	if command == "down" && len(args) == 2 {
+		var err error
+		steps, err = strconv.Atoi(args[1])
+		valid = err == nil && steps > 0
+	}
+	if !valid || (command != "up" && command != "down" && command != "version") {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		os.Exit(2)
+	}
+
+	db := openDB()
+	defer db.Close()
+	migrator, err := migrations.NewMigrator(db)
+	if err != nil {
+		return fmt.Errorf("unexpected error creating migrator: %w", err)
+	}
+
+	ctx := context.Background()
+	switch command {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, m := range applied {
+			log.Printf("applied migration %d_%s", m.Version, m.Name)
+		}
+		if err != nil {
+			return fmt.Errorf("error migrating up: %w", err)
+		}
+		if len(applied) == 0 {
+			log.Printf("database is up to date")
+		}
+	case "down":
+		reverted, err := migrator.Down(ctx, steps)
+		for _, m := range reverted {
+			log.Printf("reverted migration %d_%s", m.Version, m.Name)
+		}
+		if err != nil {
+			return fmt.Errorf("error migrating down: %w", err)
+		}
+	case "version":
+		version, err := migrator.Version(ctx)
+		if err != nil {
+			return fmt.Errorf("error getting the database version: %w", err)
+		}
+		fmt.Println(version)
+	}
+	return nil
+}
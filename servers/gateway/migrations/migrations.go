@@ -0,0 +1,246 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+//files holds the gateway's migrations. Each one is a pair of
+//files named <version>_<name>.up.sql and <version>_<name>.down.sql,
+//where version is a positive integer that orders the migrations.
+//go:embed sql/*.sql
+var files embed.FS
+
+//lockID identifies the postgres advisory lock held while
+//migrating, so only one gateway migrates a database at a time
+const lockID int64 = 0x6a6f62747261636b
+
+//fileNamePattern matches migration file names
+var fileNamePattern = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+//ErrUnknownVersion is returned when the database has applied
+//a migration that is needed to migrate down but isn't known
+var ErrUnknownVersion = errors.New("database has a migration applied that is not known")
+
+//Migration represents one versioned change to the schema
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+//Load reads the migrations in the `dir` directory of `fsys`,
+//sorted by version. Every migration must have both an up and
+//a down file, and no two migrations may share a version.
+func Load(fsys fs.FS, dir string) ([]*Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		match := fileNamePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %q", entry.Name())
+		}
+		version, err := strconv.Atoi(match[1])
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration version in %q", entry.Name())
+		}
+		m, found := byVersion[version]
+		if !found {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migrations %q and %q share version %d", m.Name, match[2], version)
+		}
+		contents, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if match[3] == "up" {
+			m.Up = string(contents)
+		} else {
+			m.Down = string(contents)
+		}
+	}
+
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if len(m.Up) == 0 || len(m.Down) == 0 {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+//Migrator applies migrations to a postgres database, recording
+//the applied versions in the "schema_migrations" table
+type Migrator struct {
+	DB         *sql.DB
+	Migrations []*Migration
+}
+
+//NewMigrator constructs a new Migrator for the gateway's migrations
+func NewMigrator(db *sql.DB) (*Migrator, error) {
+	if db == nil {
+		panic("missing database connection")
+	}
+	migrations, err := Load(files, "sql")
+	if err != nil {
+		return nil, fmt.Errorf("error loading migrations: %v", err)
+	}
+	return &Migrator{
+		DB:         db,
+		Migrations: migrations,
+	}, nil
+}
+
+//Up applies every migration that hasn't been applied yet,
+//in order, and returns the ones it applied
+func (mg *Migrator) Up(ctx context.Context) ([]*Migration, error) {
+	applied := []*Migration{}
+	err := mg.withLock(ctx, func(conn *sql.Conn, versions map[int]bool) error {
+		for _, m := range mg.Migrations {
+			if versions[m.Version] {
+				continue
+			}
+			insq := "insert into schema_migrations(version, name, appliedat) values ($1, $2, $3)"
+			if err := inTx(ctx, conn, m.Up, insq, m.Version, m.Name, time.Now()); err != nil {
+				return fmt.Errorf("error applying migration %d_%s: %w", m.Version, m.Name, err)
+			}
+			applied = append(applied, m)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+//Down reverts the `steps` most recently applied migrations,
+//newest first, and returns the ones it reverted
+func (mg *Migrator) Down(ctx context.Context, steps int) ([]*Migration, error) {
+	reverted := []*Migration{}
+	err := mg.withLock(ctx, func(conn *sql.Conn, versions map[int]bool) error {
+		known := map[int]*Migration{}
+		for _, m := range mg.Migrations {
+			known[m.Version] = m
+		}
+		for _, version := range newestFirst(versions) {
+			if len(reverted) == steps {
+				break
+			}
+			m, found := known[version]
+			if !found {
+				return fmt.Errorf("%w: version %d", ErrUnknownVersion, version)
+			}
+			delq := "delete from schema_migrations where version = $1"
+			if err := inTx(ctx, conn, m.Down, delq, m.Version); err != nil {
+				return fmt.Errorf("error reverting migration %d_%s: %w", m.Version, m.Name, err)
+			}
+			reverted = append(reverted, m)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+//Version returns the newest applied migration's version,
+//or 0 if no migrations have been applied
+func (mg *Migrator) Version(ctx context.Context) (int, error) {
+	version := 0
+	err := mg.withLock(ctx, func(conn *sql.Conn, versions map[int]bool) error {
+		if sorted := newestFirst(versions); len(sorted) != 0 {
+			version = sorted[0]
+		}
+		return nil
+	})
+	return version, err
+}
+
+//withLock calls `fn` on a connection holding the migration lock,
+//passing it the set of versions that have been applied
+func (mg *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn, versions map[int]bool) error) error {
+	//advisory locks belong to a session, so everything
+	//has to happen on the same connection
+	conn, err := mg.DB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("error connecting to the database: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "select pg_advisory_lock($1)", lockID); err != nil {
+		return fmt.Errorf("error acquiring the migration lock: %w", err)
+	}
+	//unlock even if `ctx` is done, so the connection returns to the pool unlocked
+	defer conn.ExecContext(context.Background(), "select pg_advisory_unlock($1)", lockID)
+
+	createq := "create table if not exists schema_migrations (" +
+		"version int primary key, name varchar(255) not null, appliedat timestamptz not null)"
+	if _, err := conn.ExecContext(ctx, createq); err != nil {
+		return fmt.Errorf("error creating the schema_migrations table: %w", err)
+	}
+
+	versions, err := appliedVersions(ctx, conn)
+	if err != nil {
+		return fmt.Errorf("error querying applied migrations: %w", err)
+	}
+	return fn(conn, versions)
+}
+
+//appliedVersions returns the set of versions recorded in schema_migrations
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int]bool, error) {
+	rows, err := conn.QueryContext(ctx, "select version from schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	versions := map[int]bool{}
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		versions[version] = true
+	}
+	return versions, rows.Err()
+}
+
+//inTx runs the migration's `script` and the statement
+//recording it in schema_migrations in one transaction
+func inTx(ctx context.Context, conn *sql.Conn, script string, record string, args ...interface{}) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+//newestFirst returns the versions in the set in descending order
+func newestFirst(versions map[int]bool) []int {
+	sorted := make([]int, 0, len(versions))
+	for version := range versions {
+		sorted = append(sorted, version)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(sorted)))
+	return sorted
+}
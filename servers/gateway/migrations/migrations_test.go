@@ -0,0 +1,246 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	_ "github.com/lib/pq"
+)
+
+const (
+	lockq     = "select pg_advisory_lock($1)"
+	unlockq   = "select pg_advisory_unlock($1)"
+	createq   = "create table if not exists schema_migrations (version int primary key, name varchar(255) not null, appliedat timestamptz not null)"
+	versionsq = "select version from schema_migrations"
+	insq      = "insert into schema_migrations(version, name, appliedat) values ($1, $2, $3)"
+	delq      = "delete from schema_migrations where version = $1"
+)
+
+func TestLoad(t *testing.T) {
+	migrations, err := Load(files, "sql")
+	if err != nil {
+		t.Fatalf("error loading the embedded migrations: %v", err)
+	}
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Errorf("migration %s has version %d but expected %d", m.Name, m.Version, i+1)
+		}
+	}
+
+	cases := []struct {
+		name        string
+		fsys        fstest.MapFS
+		expectError bool
+	}{
+		{
+			"Valid Migrations Out Of Order",
+			fstest.MapFS{
+				"sql/0010_second.up.sql":   {Data: []byte("up")},
+				"sql/0010_second.down.sql": {Data: []byte("down")},
+				"sql/0002_first.up.sql":    {Data: []byte("up")},
+				"sql/0002_first.down.sql":  {Data: []byte("down")},
+			},
+			false,
+		},
+		{
+			"Invalid File Name",
+			fstest.MapFS{
+				"sql/first.up.sql": {Data: []byte("up")},
+			},
+			true,
+		},
+		{
+			"Missing Down File",
+			fstest.MapFS{
+				"sql/0001_first.up.sql": {Data: []byte("up")},
+			},
+			true,
+		},
+		{
+			"Shared Version",
+			fstest.MapFS{
+				"sql/0001_first.up.sql":    {Data: []byte("up")},
+				"sql/0001_first.down.sql":  {Data: []byte("down")},
+				"sql/0001_second.up.sql":   {Data: []byte("up")},
+				"sql/0001_second.down.sql": {Data: []byte("down")},
+			},
+			true,
+		},
+	}
+	for _, c := range cases {
+		migrations, err := Load(c.fsys, "sql")
+		if c.expectError {
+			if err == nil {
+				t.Errorf("case %s: expected an error but got none", c.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %s: unexpected error: %v", c.name, err)
+			continue
+		}
+		if len(migrations) != 2 || migrations[0].Name != "first" || migrations[1].Name != "second" {
+			t.Errorf("case %s: migrations were not sorted by version: %+v", c.name, migrations)
+		}
+	}
+}
+
+//newMockMigrator returns a Migrator with two migrations
+//whose queries are matched exactly
+func newMockMigrator(t *testing.T) (*Migrator, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("There was a problem opening a database connection: [%v]", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return &Migrator{
+		DB: db,
+		Migrations: []*Migration{
+			{Version: 1, Name: "first", Up: "create table first", Down: "drop table first"},
+			{Version: 2, Name: "second", Up: "create table second", Down: "drop table second"},
+		},
+	}, mock
+}
+
+//expectLock sets up the queries run before every
+//operation, reporting `applied` as the applied versions
+func expectLock(mock sqlmock.Sqlmock, applied ...int) {
+	mock.ExpectExec(lockq).WithArgs(lockID).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(createq).WillReturnResult(sqlmock.NewResult(0, 0))
+	rows := sqlmock.NewRows([]string{"version"})
+	for _, version := range applied {
+		rows.AddRow(version)
+	}
+	mock.ExpectQuery(versionsq).WillReturnRows(rows)
+}
+
+func TestMigratorUp(t *testing.T) {
+	ctx := context.Background()
+	mg, mock := newMockMigrator(t)
+
+	expectLock(mock, 1)
+	mock.ExpectBegin()
+	mock.ExpectExec("create table second").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(insq).WithArgs(2, "second", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectExec(unlockq).WithArgs(lockID).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	applied, err := mg.Up(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error migrating up: %v", err)
+	}
+	if len(applied) != 1 || applied[0].Version != 2 {
+		t.Errorf("incorrect migrations applied: expected only version 2 but got %+v", applied)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestMigratorUpFailure(t *testing.T) {
+	ctx := context.Background()
+	mg, mock := newMockMigrator(t)
+
+	dbErr := errors.New("syntax error")
+	expectLock(mock)
+	mock.ExpectBegin()
+	mock.ExpectExec("create table first").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(insq).WithArgs(1, "first", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec("create table second").WillReturnError(dbErr)
+	mock.ExpectRollback()
+	mock.ExpectExec(unlockq).WithArgs(lockID).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	applied, err := mg.Up(ctx)
+	if !errors.Is(err, dbErr) {
+		t.Errorf("incorrect error when a migration fails: expected %v but got %v", dbErr, err)
+	}
+	if len(applied) != 1 || applied[0].Version != 1 {
+		t.Errorf("incorrect migrations applied: expected only version 1 but got %+v", applied)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestMigratorDown(t *testing.T) {
+	ctx := context.Background()
+	mg, mock := newMockMigrator(t)
+
+	expectLock(mock, 1, 2)
+	mock.ExpectBegin()
+	mock.ExpectExec("drop table second").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(delq).WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectExec(unlockq).WithArgs(lockID).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	reverted, err := mg.Down(ctx, 1)
+	if err != nil {
+		t.Fatalf("unexpected error migrating down: %v", err)
+	}
+	if len(reverted) != 1 || reverted[0].Version != 2 {
+		t.Errorf("incorrect migrations reverted: expected only version 2 but got %+v", reverted)
+	}
+
+	//a version this gateway doesn't know can't be reverted
+	expectLock(mock, 1, 2, 3)
+	mock.ExpectExec(unlockq).WithArgs(lockID).WillReturnResult(sqlmock.NewResult(0, 0))
+	if _, err := mg.Down(ctx, 1); !errors.Is(err, ErrUnknownVersion) {
+		t.Errorf("incorrect error reverting an unknown version: expected %v but got %v", ErrUnknownVersion, err)
+	}
+
+	expectLock(mock, 1, 2)
+	mock.ExpectExec(unlockq).WithArgs(lockID).WillReturnResult(sqlmock.NewResult(0, 0))
+	if version, err := mg.Version(ctx); err != nil || version != 2 {
+		t.Errorf("incorrect version: expected 2 but got %d, %v", version, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+/*
+TestMigratorPostgres migrates a real postgres database all the
+way down and back up. Set the POSTGRESDSN environment variable
+to a data source name to run it; it is skipped otherwise.
+*/
+func TestMigratorPostgres(t *testing.T) {
+	dsn := os.Getenv("POSTGRESDSN")
+	if len(dsn) == 0 {
+		t.Skip("set POSTGRESDSN to run against a postgres database")
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("There was a problem opening a database connection: [%v]", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	mg, err := NewMigrator(db)
+	if err != nil {
+		t.Fatalf("error creating migrator: %v", err)
+	}
+	latest := mg.Migrations[len(mg.Migrations)-1].Version
+	if _, err := mg.Up(ctx); err != nil {
+		t.Fatalf("error migrating up: %v", err)
+	}
+	if version, err := mg.Version(ctx); err != nil || version != latest {
+		t.Fatalf("incorrect version after migrating up: expected %d but got %d, %v", latest, version, err)
+	}
+	if _, err := mg.Down(ctx, len(mg.Migrations)); err != nil {
+		t.Fatalf("error migrating down: %v", err)
+	}
+	if version, err := mg.Version(ctx); err != nil || version != 0 {
+		t.Fatalf("incorrect version after migrating down: expected 0 but got %d, %v", version, err)
+	}
+	if applied, err := mg.Up(ctx); err != nil || len(applied) != len(mg.Migrations) {
+		t.Fatalf("error migrating back up: applied %d migrations, %v", len(applied), err)
+	}
+}
@@ -0,0 +1,16 @@
+/* Table to contain User records
+   Note: varchar limits were selected to be a practical limit.
+   These limits are not enforced in user.go
+
+   "if not exists" lets databases created from the old
+   servers/db/schema.sql adopt this migration unchanged.
+*/
+create table if not exists users (
+    id         serial       primary key,
+    email      varchar(320) unique       not null, /* https://tools.ietf.org/html/rfc3696 */
+    passhash   bytea                     not null,
+    username   varchar(255) unique       not null,
+    firstname  varchar(32),
+    lastname   varchar(32),
+    photourl   varchar(68)               not null  -- TODO: remove
+);
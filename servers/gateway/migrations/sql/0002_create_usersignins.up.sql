@@ -0,0 +1,6 @@
+create table if not exists usersignins (
+    id          serial primary key,
+    userid      int not null,
+    signintime  timestamp not null,
+    IP          varchar(45) not null
+);
@@ -0,0 +1,10 @@
+/* Session state for gateways running with SESSIONMODE=postgres.
+   Rows past expiresat are ignored and periodically swept.
+*/
+create table if not exists sessions (
+    sid        varchar(128) primary key,
+    state      jsonb        not null,
+    expiresat  timestamptz  not null
+);
+
+create index if not exists sessions_expiresat_idx on sessions (expiresat);
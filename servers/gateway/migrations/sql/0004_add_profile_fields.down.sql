@@ -0,0 +1,9 @@
+alter table users
+    drop column if exists bio,
+    drop column if exists school,
+    drop column if exists degree,
+    drop column if exists majors,
+    drop column if exists expectedgraduation,
+    drop column if exists targetroles,
+    drop column if exists targetjobtypes,
+    drop column if exists targetseasons;
@@ -0,0 +1,9 @@
+alter table users
+    add column if not exists bio                 varchar(4096)  not null default '',
+    add column if not exists school              varchar(128)   not null default '',
+    add column if not exists degree              varchar(32)    not null default '',
+    add column if not exists majors              varchar(128)[] not null default '{}',
+    add column if not exists expectedgraduation  varchar(7)     not null default '',  -- YYYY-MM, '' if not set
+    add column if not exists targetroles         varchar(128)[] not null default '{}',
+    add column if not exists targetjobtypes      varchar(32)[]  not null default '{}',
+    add column if not exists targetseasons       varchar(32)[]  not null default '{}';
@@ -0,0 +1 @@
+alter table users alter column photourl type varchar(68) using left(photourl, 68);
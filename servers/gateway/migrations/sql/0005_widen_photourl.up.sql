@@ -0,0 +1,4 @@
+/* Photo URLs are either a gravatar URL or the gateway's URL
+   for an uploaded avatar, which don't always fit in 68 characters
+*/
+alter table users alter column photourl type varchar(255);
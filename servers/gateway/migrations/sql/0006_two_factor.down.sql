@@ -0,0 +1,3 @@
+drop table if exists twofactorchallenges;
+drop table if exists recoverycodes;
+drop table if exists twofactor;
@@ -0,0 +1,24 @@
+/* Two-factor sign in with TOTP codes. Recovery codes and
+   challenge tokens are only stored as SHA-256 hashes; the
+   TOTP secret itself is needed to check codes.
+*/
+create table if not exists twofactor (
+    userid     int          primary key references users(id) on delete cascade,
+    secret     varchar(64)  not null,
+    confirmed  boolean      not null default false,
+    laststep   bigint       not null default 0
+);
+
+create table if not exists recoverycodes (
+    userid    int    not null references twofactor(userid) on delete cascade,
+    codehash  bytea  not null,
+    primary key (userid, codehash)
+);
+
+/* Sign ins waiting for a TOTP code. Rows past expiresat are ignored. */
+create table if not exists twofactorchallenges (
+    tokenhash  bytea        primary key,
+    userid     int          not null references users(id) on delete cascade,
+    expiresat  timestamptz  not null,
+    attempts   int          not null default 0
+);
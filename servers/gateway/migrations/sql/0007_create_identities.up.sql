@@ -0,0 +1,15 @@
+/* Accounts with OpenID Connect providers linked to users,
+   identified by the provider's issuer URL and its subject
+   identifier for the account
+*/
+create table if not exists identities (
+    id         serial        primary key,
+    userid     int           not null references users(id) on delete cascade,
+    issuer     varchar(255)  not null,
+    subject    varchar(255)  not null,
+    email      varchar(320)  not null,
+    createdat  timestamptz   not null,
+    unique (issuer, subject)
+);
+
+create index if not exists identities_userid_idx on identities (userid);
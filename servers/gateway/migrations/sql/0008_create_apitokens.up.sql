@@ -0,0 +1,15 @@
+/* Personal API tokens. Only the SHA-256 hash of each token is
+   stored, so a leaked database can't be used to call the API.
+*/
+create table if not exists apitokens (
+    id          serial        primary key,
+    userid      int           not null references users(id) on delete cascade,
+    name        varchar(64)   not null,
+    tokenhash   bytea         not null unique,
+    scopes      text[]        not null,
+    createdat   timestamptz   not null,
+    expiresat   timestamptz   not null,
+    lastusedat  timestamptz
+);
+
+create index if not exists apitokens_userid_idx on apitokens (userid);
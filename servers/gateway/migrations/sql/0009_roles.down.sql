@@ -0,0 +1,6 @@
+drop index if exists usersignins_userid_id_idx;
+
+alter table users
+    drop column if exists role,
+    drop column if exists disabled,
+    drop column if exists signedoutat;
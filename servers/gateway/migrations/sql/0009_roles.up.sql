@@ -0,0 +1,10 @@
+/* Roles, disabled accounts and signing users out everywhere.
+   Sessions a user began before signedoutat are ended.
+*/
+alter table users
+    add column if not exists role         varchar(16)  not null default 'user',
+    add column if not exists disabled     boolean      not null default false,
+    add column if not exists signedoutat  timestamptz;
+
+/* Admins page through a user's sign-ins, newest first */
+create index if not exists usersignins_userid_id_idx on usersignins (userid, id);
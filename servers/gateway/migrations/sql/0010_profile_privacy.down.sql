@@ -0,0 +1,4 @@
+drop table if exists connections;
+
+alter table users
+    drop column if exists visibility;
@@ -0,0 +1,23 @@
+/* Who can see a user's whole profile: everyone ('public'),
+   their connections ('connections') or only them ('private')
+*/
+alter table users
+    add column if not exists visibility  varchar(16)  not null default 'connections';
+
+/* Requests to connect, from requesterid to addresseeid. Once
+   accepted, the two users are connected. There is at most
+   one row for each pair of users, whichever asked.
+*/
+create table if not exists connections (
+    requesterid  int          not null references users(id) on delete cascade,
+    addresseeid  int          not null references users(id) on delete cascade,
+    accepted     boolean      not null default false,
+    createdat    timestamptz  not null,
+    acceptedat   timestamptz,
+    primary key (requesterid, addresseeid),
+    check (requesterid <> addresseeid)
+);
+
+create unique index if not exists connections_pair_idx
+    on connections (least(requesterid, addresseeid), greatest(requesterid, addresseeid));
+create index if not exists connections_addresseeid_idx on connections (addresseeid);
@@ -0,0 +1,12 @@
+/* Sign ins with OpenID Connect providers waiting for the user to
+   come back from the provider, under the SHA-256 hash of their state.
+   Each row is deleted when the sign in finishes, so a state can only
+   be used once. Rows past expiresat are ignored.
+*/
+create table if not exists oidcsignins (
+    statehash  bytea         primary key,
+    provider   varchar(255)  not null,
+    nonce      varchar(64)   not null,
+    challenge  varchar(64)   not null,
+    expiresat  timestamptz   not null
+);
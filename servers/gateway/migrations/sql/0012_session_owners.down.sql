@@ -0,0 +1,2 @@
+drop index if exists sessions_userid_idx;
+alter table sessions drop column if exists userid;
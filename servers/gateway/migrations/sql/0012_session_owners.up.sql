@@ -0,0 +1,7 @@
+/* The user each session belongs to, so signing a user
+   out can delete their sessions. Null for states
+   that don't belong to a user.
+*/
+alter table sessions add column if not exists userid bigint;
+
+create index if not exists sessions_userid_idx on sessions (userid);
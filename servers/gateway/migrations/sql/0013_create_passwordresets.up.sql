@@ -0,0 +1,10 @@
+/* Password resets admins issued, waiting for their users to
+   choose a new password. Only the SHA-256 hash of each token is
+   stored, each user has at most one, and each row is deleted when
+   it is redeemed. Rows past expiresat are ignored.
+*/
+create table if not exists passwordresets (
+    tokenhash  bytea        primary key,
+    userid     int          not null unique references users(id) on delete cascade,
+    expiresat  timestamptz  not null
+);
@@ -0,0 +1,112 @@
+package apitokens
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+//MemStore represents an apitokens.Store kept in process memory,
+//for tests and for developing the gateway locally. Like the
+//database, it fails calls whose context is already done.
+//Data is lost when the process exits.
+type MemStore struct {
+	mx     sync.RWMutex
+	tokens map[int64]*Token
+	lastID int64
+}
+
+//NewMemStore constructs and returns a new, empty MemStore
+func NewMemStore() *MemStore {
+	return &MemStore{
+		tokens: map[int64]*Token{},
+	}
+}
+
+//copyToken returns a copy of the token that shares nothing with it
+func copyToken(t *Token) *Token {
+	copied := *t
+	copied.Hash = append([]byte{}, t.Hash...)
+	copied.Scopes = append([]string{}, t.Scopes...)
+	if t.LastUsedAt != nil {
+		lastUsedAt := *t.LastUsedAt
+		copied.LastUsedAt = &lastUsedAt
+	}
+	return &copied
+}
+
+//apitokens.Store implementation
+
+//Get returns the token with the given hash
+func (ms *MemStore) Get(ctx context.Context, hash []byte) (*Token, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	ms.mx.RLock()
+	defer ms.mx.RUnlock()
+	for _, t := range ms.tokens {
+		if bytes.Equal(t.Hash, hash) {
+			return copyToken(t), nil
+		}
+	}
+	return nil, ErrTokenNotFound
+}
+
+//GetByUserID returns the user's tokens, oldest first
+func (ms *MemStore) GetByUserID(ctx context.Context, userID int64) ([]*Token, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	ms.mx.RLock()
+	defer ms.mx.RUnlock()
+	tokens := []*Token{}
+	for _, t := range ms.tokens {
+		if t.UserID == userID {
+			tokens = append(tokens, copyToken(t))
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].ID < tokens[j].ID })
+	return tokens, nil
+}
+
+//Insert inserts the token and returns it with its assigned ID
+func (ms *MemStore) Insert(ctx context.Context, token *Token) (*Token, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	ms.lastID++
+	token.ID = ms.lastID
+	ms.tokens[token.ID] = copyToken(token)
+	return token, nil
+}
+
+//Touch records that the token with the given ID was used at `at`
+func (ms *MemStore) Touch(ctx context.Context, id int64, at time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	if t, found := ms.tokens[id]; found {
+		t.LastUsedAt = &at
+	}
+	return nil
+}
+
+//Delete revokes the user's token with the given ID
+func (ms *MemStore) Delete(ctx context.Context, userID int64, id int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	if t, found := ms.tokens[id]; !found || t.UserID != userID {
+		return ErrTokenNotFound
+	}
+	delete(ms.tokens, id)
+	return nil
+}
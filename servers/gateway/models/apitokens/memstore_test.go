@@ -0,0 +1,53 @@
+package apitokens
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMemStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemStore()
+
+	if _, err := store.Get(ctx, HashToken("jt_missing")); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("incorrect error getting a missing token: expected %v but got %v", ErrTokenNotFound, err)
+	}
+	now := time.Now()
+	first, err := store.Insert(ctx, &Token{UserID: 1, Name: "import", Hash: HashToken("jt_first"), Scopes: []string{ScopeApplicationsWrite}, CreatedAt: now, ExpiresAt: now.Add(time.Hour)})
+	if err != nil || first.ID == 0 {
+		t.Fatalf("expected a token with an ID but got %+v, %v", first, err)
+	}
+	second, err := store.Insert(ctx, &Token{UserID: 1, Name: "report", Hash: HashToken("jt_second"), Scopes: []string{ScopeStagesRead}, CreatedAt: now, ExpiresAt: now.Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("unexpected error inserting token: %v", err)
+	}
+
+	got, err := store.Get(ctx, HashToken("jt_second"))
+	if err != nil || got.ID != second.ID || got.LastUsedAt != nil {
+		t.Fatalf("expected the second token but got %+v, %v", got, err)
+	}
+	//returned tokens are copies
+	got.Scopes[0] = ScopeStagesWrite
+	if err := store.Touch(ctx, second.ID, now); err != nil {
+		t.Errorf("unexpected error touching token: %v", err)
+	}
+	if got, _ := store.Get(ctx, HashToken("jt_second")); got.Scopes[0] != ScopeStagesRead || got.LastUsedAt == nil || !got.LastUsedAt.Equal(now) {
+		t.Errorf("expected an unchanged token used at %v but got %+v", now, got)
+	}
+
+	tokens, err := store.GetByUserID(ctx, 1)
+	if err != nil || len(tokens) != 2 || tokens[0].ID != first.ID {
+		t.Errorf("expected both tokens oldest first but got %+v, %v", tokens, err)
+	}
+	if err := store.Delete(ctx, 2, first.ID); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("incorrect error deleting another user's token: expected %v but got %v", ErrTokenNotFound, err)
+	}
+	if err := store.Delete(ctx, 1, first.ID); err != nil {
+		t.Errorf("unexpected error deleting token: %v", err)
+	}
+	if _, err := store.Get(ctx, HashToken("jt_first")); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("incorrect error getting a revoked token: expected %v but got %v", ErrTokenNotFound, err)
+	}
+}
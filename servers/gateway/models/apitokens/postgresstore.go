@@ -0,0 +1,110 @@
+package apitokens
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+//tokenColumns lists the apitokens table's columns in the
+//order they are scanned into a Token
+const tokenColumns = "id, userid, name, tokenhash, scopes, createdat, expiresat, lastusedat"
+
+//PostgresStore represents an apitokens.Store backed by postgres
+type PostgresStore struct {
+	DB *sql.DB
+}
+
+//NewPostgresStore returns a new PostgresStore
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	if db == nil {
+		panic("missing database connection")
+	}
+	return &PostgresStore{DB: db}
+}
+
+//scanToken scans a row of tokenColumns into a new Token
+func scanToken(row interface{ Scan(...interface{}) error }) (*Token, error) {
+	t := &Token{}
+	var lastUsedAt sql.NullTime
+	if err := row.Scan(&t.ID, &t.UserID, &t.Name, &t.Hash, pq.Array(&t.Scopes), &t.CreatedAt, &t.ExpiresAt, &lastUsedAt); err != nil {
+		return nil, err
+	}
+	if lastUsedAt.Valid {
+		t.LastUsedAt = &lastUsedAt.Time
+	}
+	return t, nil
+}
+
+//apitokens.Store implementation
+
+//Get returns the token with the given hash
+func (ps *PostgresStore) Get(ctx context.Context, hash []byte) (*Token, error) {
+	row := ps.DB.QueryRowContext(ctx, "select "+tokenColumns+" from apitokens where tokenhash = $1", hash)
+	t, err := scanToken(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrTokenNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error querying API token: %w", err)
+	}
+	return t, nil
+}
+
+//GetByUserID returns the user's tokens, oldest first
+func (ps *PostgresStore) GetByUserID(ctx context.Context, userID int64) ([]*Token, error) {
+	rows, err := ps.DB.QueryContext(ctx, "select "+tokenColumns+" from apitokens where userid = $1 order by id", userID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying the API tokens of the user with id %v: %w", userID, err)
+	}
+	defer rows.Close()
+	tokens := []*Token{}
+	for rows.Next() {
+		t, err := scanToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning an API token of the user with id %v: %w", userID, err)
+		}
+		tokens = append(tokens, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error querying the API tokens of the user with id %v: %w", userID, err)
+	}
+	return tokens, nil
+}
+
+//Insert inserts the token and returns it with its assigned ID
+func (ps *PostgresStore) Insert(ctx context.Context, token *Token) (*Token, error) {
+	insq := "insert into apitokens(userid, name, tokenhash, scopes, createdat, expiresat) values ($1, $2, $3, $4, $5, $6) returning id"
+	var id int64
+	err := ps.DB.QueryRowContext(ctx, insq, token.UserID, token.Name, token.Hash, pq.Array(token.Scopes), token.CreatedAt, token.ExpiresAt).Scan(&id)
+	if err != nil {
+		return nil, fmt.Errorf("error inserting an API token for the user with id %v: %w", token.UserID, err)
+	}
+	token.ID = id
+	return token, nil
+}
+
+//Touch records that the token with the given ID was used at `at`
+func (ps *PostgresStore) Touch(ctx context.Context, id int64, at time.Time) error {
+	if _, err := ps.DB.ExecContext(ctx, "update apitokens set lastusedat = $1 where id = $2", at, id); err != nil {
+		return fmt.Errorf("error updating the API token with id %v: %w", id, err)
+	}
+	return nil
+}
+
+//Delete revokes the user's token with the given ID
+func (ps *PostgresStore) Delete(ctx context.Context, userID int64, id int64) error {
+	res, err := ps.DB.ExecContext(ctx, "delete from apitokens where id = $1 and userid = $2", id, userID)
+	if err != nil {
+		return fmt.Errorf("error deleting the API token with id %v: %w", id, err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("error deleting the API token with id %v: %w", id, err)
+	} else if n == 0 {
+		return ErrTokenNotFound
+	}
+	return nil
+}
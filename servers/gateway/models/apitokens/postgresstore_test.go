@@ -0,0 +1,88 @@
+package apitokens
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+)
+
+var columns = []string{"id", "userid", "name", "tokenhash", "scopes", "createdat", "expiresat", "lastusedat"}
+
+func TestPostgresStoreGet(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("There was a problem opening a database connection: [%v]", err)
+	}
+	defer db.Close()
+	store := NewPostgresStore(db)
+
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	hash := HashToken("jt_abc")
+	query := regexp.QuoteMeta("select " + tokenColumns + " from apitokens where tokenhash = $1")
+	rows := sqlmock.NewRows(columns).AddRow(1, 2, "import", hash, "{applications:read,stages:read}", now, now.Add(time.Hour), nil)
+	mock.ExpectQuery(query).WithArgs(hash).WillReturnRows(rows)
+	token, err := store.Get(context.Background(), hash)
+	if err != nil {
+		t.Fatalf("Unexpected error getting token: %v", err)
+	}
+	if token.ID != 1 || token.UserID != 2 || len(token.Scopes) != 2 || token.Scopes[1] != ScopeStagesRead || token.LastUsedAt != nil {
+		t.Errorf("Unexpected token: %+v", token)
+	}
+	mock.ExpectQuery(query).WithArgs(hash).WillReturnRows(sqlmock.NewRows(columns))
+	if _, err := store.Get(context.Background(), hash); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("Expected error [%v] but got [%v] instead", ErrTokenNotFound, err)
+	}
+
+	query = regexp.QuoteMeta("select " + tokenColumns + " from apitokens where userid = $1 order by id")
+	rows = sqlmock.NewRows(columns).AddRow(1, 2, "import", hash, "{applications:write}", now, now.Add(time.Hour), now)
+	mock.ExpectQuery(query).WithArgs(2).WillReturnRows(rows)
+	tokens, err := store.GetByUserID(context.Background(), 2)
+	if err != nil || len(tokens) != 1 || tokens[0].LastUsedAt == nil || !tokens[0].LastUsedAt.Equal(now) {
+		t.Errorf("Unexpected tokens: %+v, %v", tokens, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestPostgresStoreInsertDelete(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("There was a problem opening a database connection: [%v]", err)
+	}
+	defer db.Close()
+	store := NewPostgresStore(db)
+
+	now := time.Now()
+	token := &Token{UserID: 2, Name: "import", Hash: HashToken("jt_abc"), Scopes: []string{ScopeApplicationsWrite}, CreatedAt: now, ExpiresAt: now.Add(time.Hour)}
+	query := regexp.QuoteMeta("insert into apitokens(userid, name, tokenhash, scopes, createdat, expiresat) values ($1, $2, $3, $4, $5, $6) returning id")
+	mock.ExpectQuery(query).WithArgs(2, "import", token.Hash, pq.Array(token.Scopes), now, token.ExpiresAt).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	if inserted, err := store.Insert(context.Background(), token); err != nil || inserted.ID != 7 {
+		t.Errorf("Unexpected token: %+v, %v", inserted, err)
+	}
+
+	mock.ExpectExec(regexp.QuoteMeta("update apitokens set lastusedat = $1 where id = $2")).WithArgs(now, 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := store.Touch(context.Background(), 7, now); err != nil {
+		t.Errorf("Unexpected error touching token: %v", err)
+	}
+
+	deleteq := regexp.QuoteMeta("delete from apitokens where id = $1 and userid = $2")
+	mock.ExpectExec(deleteq).WithArgs(7, 2).WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := store.Delete(context.Background(), 2, 7); err != nil {
+		t.Errorf("Unexpected error deleting token: %v", err)
+	}
+	mock.ExpectExec(deleteq).WithArgs(7, 3).WillReturnResult(sqlmock.NewResult(0, 0))
+	if err := store.Delete(context.Background(), 3, 7); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("Expected error [%v] but got [%v] instead", ErrTokenNotFound, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,30 @@
+package apitokens
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+//ErrTokenNotFound is returned when a token can't be found
+var ErrTokenNotFound = errors.New("API token not found")
+
+//Store represents a store of API tokens
+type Store interface {
+	//Get returns the token with the given hash, or ErrTokenNotFound.
+	//Expired tokens are returned; callers must check Expired.
+	Get(ctx context.Context, hash []byte) (*Token, error)
+
+	//GetByUserID returns the user's tokens, oldest first
+	GetByUserID(ctx context.Context, userID int64) ([]*Token, error)
+
+	//Insert inserts the token and returns it with its assigned ID
+	Insert(ctx context.Context, token *Token) (*Token, error)
+
+	//Touch records that the token with the given ID was used at `at`
+	Touch(ctx context.Context, id int64, at time.Time) error
+
+	//Delete revokes the user's token with the given ID,
+	//or returns ErrTokenNotFound
+	Delete(ctx context.Context, userID int64, id int64) error
+}
@@ -0,0 +1,131 @@
+//Package apitokens stores personal API tokens, which let users' scripts
+//and integrations call the API without signing in. Tokens are named,
+//limited to scopes and expire. Only their SHA-256 hashes are stored.
+package apitokens
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+//Prefix starts every API token, so they can be told apart from
+//session IDs and found by secret scanners
+const Prefix = "jt_"
+
+//tokenBytes is how many random bytes are in a token
+const tokenBytes = 32
+
+//MaxNameLength is the most characters in a token's name
+const MaxNameLength = 64
+
+//DefaultDuration is how long a token lasts if no expiry is given,
+//and MaxDuration is the longest a token can last
+const (
+	DefaultDuration = 30 * 24 * time.Hour
+	MaxDuration     = 365 * 24 * time.Hour
+)
+
+//Scopes a token can be given. Read scopes allow GET, HEAD and OPTIONS
+//requests to a resource, and write scopes allow the other methods.
+const (
+	ScopeApplicationsRead  = "applications:read"
+	ScopeApplicationsWrite = "applications:write"
+	ScopeStagesRead        = "stages:read"
+	ScopeStagesWrite       = "stages:write"
+)
+
+//Scopes lists every scope a token can be given
+var Scopes = []string{ScopeApplicationsRead, ScopeApplicationsWrite, ScopeStagesRead, ScopeStagesWrite}
+
+//Token represents a user's API token. The token itself is
+//only known when it is created; Hash is what is stored.
+type Token struct {
+	ID         int64      `json:"id"`
+	UserID     int64      `json:"userID"`
+	Name       string     `json:"name"`
+	Hash       []byte     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  time.Time  `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+}
+
+//Allows returns true if the token has the scope
+func (t *Token) Allows(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+//Expired returns true if the token has expired at `now`
+func (t *Token) Expired(now time.Time) bool {
+	return !now.Before(t.ExpiresAt)
+}
+
+//RequiredScope returns the scope a token needs to make a
+//request with `method` to `resource`, such as "applications"
+func RequiredScope(resource string, method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return resource + ":read"
+	default:
+		return resource + ":write"
+	}
+}
+
+//ValidateScopes returns an error if `scopes` is empty
+//or has a scope that isn't in Scopes
+func ValidateScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return fmt.Errorf("must have at least one scope")
+	}
+	for _, scope := range scopes {
+		known := false
+		for _, s := range Scopes {
+			known = known || s == scope
+		}
+		if !known {
+			return fmt.Errorf("unknown scope %q, must be one of %s", scope, strings.Join(Scopes, ", "))
+		}
+	}
+	return nil
+}
+
+//NewToken generates a new API token, and returns
+//it and the hash of it to store
+func NewToken() (string, []byte, error) {
+	random := make([]byte, tokenBytes)
+	if _, err := rand.Read(random); err != nil {
+		return "", nil, fmt.Errorf("error generating API token: %v", err)
+	}
+	token := Prefix + base64.RawURLEncoding.EncodeToString(random)
+	return token, HashToken(token), nil
+}
+
+//HashToken returns the SHA-256 hash of the token, which is how it is stored
+func HashToken(token string) []byte {
+	hash := sha256.Sum256([]byte(token))
+	return hash[:]
+}
+
+//FromRequest returns the API token in the request's Authorization
+//header, as "Bearer jt_...". It returns false if the request has no
+//API token. Unlike session IDs, tokens aren't taken from the "auth"
+//query string parameter, since URLs end up in logs and browser history
+//and tokens last much longer than sessions.
+func FromRequest(r *http.Request) (string, bool) {
+	auth := r.Header.Get("Authorization")
+	token := strings.TrimPrefix(auth, "Bearer ")
+	if len(token) == len(auth) || !strings.HasPrefix(token, Prefix) {
+		return "", false
+	}
+	return token, true
+}
@@ -0,0 +1,81 @@
+package apitokens
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewToken(t *testing.T) {
+	token, hash, err := NewToken()
+	if err != nil {
+		t.Fatalf("unexpected error generating token: %v", err)
+	}
+	if !strings.HasPrefix(token, Prefix) {
+		t.Errorf("token %q should start with %q", token, Prefix)
+	}
+	if !bytes.Equal(hash, HashToken(token)) {
+		t.Errorf("the returned hash doesn't match the token")
+	}
+	if other, _, _ := NewToken(); other == token {
+		t.Errorf("tokens should be random")
+	}
+}
+
+func TestTokenScopes(t *testing.T) {
+	token := &Token{Scopes: []string{ScopeApplicationsRead}, ExpiresAt: time.Now().Add(time.Hour)}
+	cases := []struct {
+		resource string
+		method   string
+		allowed  bool
+	}{
+		{"applications", http.MethodGet, true},
+		{"applications", http.MethodHead, true},
+		{"applications", http.MethodPost, false},
+		{"applications", http.MethodDelete, false},
+		{"stages", http.MethodGet, false},
+	}
+	for _, c := range cases {
+		if allowed := token.Allows(RequiredScope(c.resource, c.method)); allowed != c.allowed {
+			t.Errorf("%s %s: expected allowed to be %v but got %v", c.method, c.resource, c.allowed, allowed)
+		}
+	}
+	if token.Expired(time.Now()) || !token.Expired(token.ExpiresAt) {
+		t.Errorf("incorrect expiry for a token expiring at %v", token.ExpiresAt)
+	}
+
+	if err := ValidateScopes([]string{ScopeApplicationsRead, ScopeStagesWrite}); err != nil {
+		t.Errorf("unexpected error validating known scopes: %v", err)
+	}
+	if err := ValidateScopes(nil); err == nil {
+		t.Errorf("expected an error validating no scopes")
+	}
+	if err := ValidateScopes([]string{ScopeApplicationsRead, "users:write"}); err == nil {
+		t.Errorf("expected an error validating an unknown scope")
+	}
+}
+
+func TestFromRequest(t *testing.T) {
+	cases := []struct {
+		name   string
+		header string
+		query  string
+		token  string
+		found  bool
+	}{
+		{"Header", "Bearer jt_abc", "", "jt_abc", true},
+		{"Query", "", "Bearer%20jt_abc", "", false},
+		{"Session ID", "Bearer abc", "", "", false},
+		{"Wrong Scheme", "Basic jt_abc", "", "", false},
+		{"Missing", "", "", "", false},
+	}
+	for _, c := range cases {
+		r, _ := http.NewRequest(http.MethodGet, "/v1/applications?auth="+c.query, nil)
+		r.Header.Set("Authorization", c.header)
+		if token, found := FromRequest(r); token != c.token || found != c.found {
+			t.Errorf("case %s: expected %q, %v but got %q, %v", c.name, c.token, c.found, token, found)
+		}
+	}
+}
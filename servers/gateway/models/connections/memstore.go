@@ -0,0 +1,122 @@
+package connections
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+//pair identifies the connection between two users, whichever asked
+type pair [2]int64
+
+//pairOf returns the pair of the two users
+func pairOf(userID int64, otherID int64) pair {
+	if userID < otherID {
+		return pair{userID, otherID}
+	}
+	return pair{otherID, userID}
+}
+
+//MemStore represents a connections.Store kept in process memory,
+//for tests and for developing the gateway locally. Like the
+//database, it fails calls whose context is already done.
+//Data is lost when the process exits.
+type MemStore struct {
+	mx          sync.RWMutex
+	connections map[pair]*Connection
+}
+
+//NewMemStore constructs and returns a new, empty MemStore
+func NewMemStore() *MemStore {
+	return &MemStore{
+		connections: map[pair]*Connection{},
+	}
+}
+
+//copyConnection returns a copy of `c` that shares no memory with it
+func copyConnection(c *Connection) *Connection {
+	copied := *c
+	if c.AcceptedAt != nil {
+		acceptedAt := *c.AcceptedAt
+		copied.AcceptedAt = &acceptedAt
+	}
+	return &copied
+}
+
+//connections.Store implementation
+
+//Get returns the connection between the two users
+func (ms *MemStore) Get(ctx context.Context, userID int64, otherID int64) (*Connection, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	ms.mx.RLock()
+	defer ms.mx.RUnlock()
+	c, found := ms.connections[pairOf(userID, otherID)]
+	if !found {
+		return nil, ErrConnectionNotFound
+	}
+	return copyConnection(c), nil
+}
+
+//GetByUserID returns the user's connections and requests, oldest first
+func (ms *MemStore) GetByUserID(ctx context.Context, userID int64) ([]*Connection, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	ms.mx.RLock()
+	defer ms.mx.RUnlock()
+	found := []*Connection{}
+	for _, c := range ms.connections {
+		if c.RequesterID == userID || c.AddresseeID == userID {
+			found = append(found, copyConnection(c))
+		}
+	}
+	sort.Slice(found, func(i, j int) bool {
+		if !found[i].CreatedAt.Equal(found[j].CreatedAt) {
+			return found[i].CreatedAt.Before(found[j].CreatedAt)
+		}
+		if found[i].RequesterID != found[j].RequesterID {
+			return found[i].RequesterID < found[j].RequesterID
+		}
+		return found[i].AddresseeID < found[j].AddresseeID
+	})
+	return found, nil
+}
+
+//Request asks to connect `fromID` with `toID`, or accepts
+//the request from `toID`, and returns the connection
+func (ms *MemStore) Request(ctx context.Context, fromID int64, toID int64, at time.Time) (*Connection, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	key := pairOf(fromID, toID)
+	c, found := ms.connections[key]
+	if !found {
+		c = &Connection{RequesterID: fromID, AddresseeID: toID, CreatedAt: at}
+		ms.connections[key] = c
+	} else if !c.Accepted && c.RequesterID == toID {
+		acceptedAt := at
+		c.Accepted = true
+		c.AcceptedAt = &acceptedAt
+	}
+	return copyConnection(c), nil
+}
+
+//Delete disconnects the two users, or declines or cancels a request
+func (ms *MemStore) Delete(ctx context.Context, userID int64, otherID int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	key := pairOf(userID, otherID)
+	if _, found := ms.connections[key]; !found {
+		return ErrConnectionNotFound
+	}
+	delete(ms.connections, key)
+	return nil
+}
@@ -0,0 +1,63 @@
+package connections
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMemStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemStore()
+	now := time.Now()
+
+	if _, err := store.Get(ctx, 1, 2); !errors.Is(err, ErrConnectionNotFound) {
+		t.Errorf("incorrect error getting a missing connection: expected %v but got %v", ErrConnectionNotFound, err)
+	}
+	requested, err := store.Request(ctx, 1, 2, now)
+	if err != nil || requested.RequesterID != 1 || requested.AddresseeID != 2 || requested.Accepted {
+		t.Fatalf("expected a pending request from 1 to 2 but got %+v, %v", requested, err)
+	}
+	//asking again changes nothing
+	if again, err := store.Request(ctx, 1, 2, now.Add(time.Minute)); err != nil || again.Accepted || !again.CreatedAt.Equal(now) {
+		t.Errorf("expected the same pending request but got %+v, %v", again, err)
+	}
+	if connected, err := Connected(ctx, store, 2, 1); err != nil || connected {
+		t.Errorf("a pending request should not connect the users: %v, %v", connected, err)
+	}
+
+	//asking back accepts the request
+	accepted, err := store.Request(ctx, 2, 1, now.Add(time.Hour))
+	if err != nil || !accepted.Accepted || accepted.RequesterID != 1 || accepted.AcceptedAt == nil || !accepted.AcceptedAt.Equal(now.Add(time.Hour)) {
+		t.Fatalf("expected an accepted connection but got %+v, %v", accepted, err)
+	}
+	if connected, err := Connected(ctx, store, 1, 2); err != nil || !connected {
+		t.Errorf("the users should be connected: %v, %v", connected, err)
+	}
+	//changing the returned connection doesn't change the stored one
+	*accepted.AcceptedAt = now
+	if got, _ := store.Get(ctx, 2, 1); !got.AcceptedAt.Equal(now.Add(time.Hour)) {
+		t.Errorf("the stored connection should not share memory: %+v", got)
+	}
+
+	store.Request(ctx, 3, 1, now.Add(time.Second))
+	store.Request(ctx, 2, 3, now.Add(time.Second))
+	found, err := store.GetByUserID(ctx, 1)
+	if err != nil || len(found) != 2 || found[0].Other(1) != 2 || found[1].Other(1) != 3 {
+		t.Errorf("expected both of user 1's connections oldest first but got %+v, %v", found, err)
+	}
+
+	if err := store.Delete(ctx, 2, 1); err != nil {
+		t.Errorf("unexpected error deleting connection: %v", err)
+	}
+	if err := store.Delete(ctx, 1, 2); !errors.Is(err, ErrConnectionNotFound) {
+		t.Errorf("incorrect error deleting a deleted connection: expected %v but got %v", ErrConnectionNotFound, err)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := store.Request(cancelled, 1, 2, now); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected %v with a cancelled context but got %v", context.Canceled, err)
+	}
+}
@@ -0,0 +1,132 @@
+package connections
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+//maxRequestAttempts is how many times Request tries again when both
+//users ask to connect with each other at the same time
+const maxRequestAttempts = 2
+
+//connectionColumns lists the connections table's columns in the
+//order they are scanned into a Connection
+const connectionColumns = "requesterid, addresseeid, accepted, createdat, acceptedat"
+
+//PostgresStore represents a connections.Store backed by postgres
+type PostgresStore struct {
+	DB *sql.DB
+}
+
+//NewPostgresStore returns a new PostgresStore
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	if db == nil {
+		panic("missing database connection")
+	}
+	return &PostgresStore{DB: db}
+}
+
+//connections.Store implementation
+
+//Get returns the connection between the two users
+func (ps *PostgresStore) Get(ctx context.Context, userID int64, otherID int64) (*Connection, error) {
+	c := &Connection{}
+	getq := "select " + connectionColumns + " from connections " +
+		"where (requesterid = $1 and addresseeid = $2) or (requesterid = $2 and addresseeid = $1)"
+	err := ps.DB.QueryRowContext(ctx, getq, userID, otherID).Scan(connectionFields(c)...)
+	if err == sql.ErrNoRows {
+		return nil, ErrConnectionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error querying the connection between users %v and %v: %w", userID, otherID, err)
+	}
+	return c, nil
+}
+
+//GetByUserID returns the user's connections and requests, oldest first
+func (ps *PostgresStore) GetByUserID(ctx context.Context, userID int64) ([]*Connection, error) {
+	getq := "select " + connectionColumns + " from connections " +
+		"where requesterid = $1 or addresseeid = $1 order by createdat, requesterid, addresseeid"
+	rows, err := ps.DB.QueryContext(ctx, getq, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying the connections of the user with id %v: %w", userID, err)
+	}
+	defer rows.Close()
+	found := []*Connection{}
+	for rows.Next() {
+		c := &Connection{}
+		if err := rows.Scan(connectionFields(c)...); err != nil {
+			return nil, fmt.Errorf("error scanning a connection of the user with id %v: %w", userID, err)
+		}
+		found = append(found, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error querying the connections of the user with id %v: %w", userID, err)
+	}
+	return found, nil
+}
+
+//Request asks to connect `fromID` with `toID`, or accepts
+//the request from `toID`, and returns the connection
+func (ps *PostgresStore) Request(ctx context.Context, fromID int64, toID int64, at time.Time) (*Connection, error) {
+	acceptq := "update connections set accepted = true, acceptedat = $3 " +
+		"where requesterid = $2 and addresseeid = $1 and not accepted returning " + connectionColumns
+	//the unique index on the pair of users makes this do nothing
+	//when either user has already asked
+	insq := "insert into connections(requesterid, addresseeid, createdat) values ($1, $2, $3) " +
+		"on conflict do nothing returning " + connectionColumns
+	for attempt := 0; ; attempt++ {
+		c := &Connection{}
+		err := ps.DB.QueryRowContext(ctx, acceptq, fromID, toID, at).Scan(connectionFields(c)...)
+		if err == nil {
+			return c, nil
+		}
+		if err != sql.ErrNoRows {
+			return nil, fmt.Errorf("error accepting the request from user %v to user %v: %w", toID, fromID, err)
+		}
+		err = ps.DB.QueryRowContext(ctx, insq, fromID, toID, at).Scan(connectionFields(c)...)
+		if err == nil {
+			return c, nil
+		}
+		if err != sql.ErrNoRows {
+			return nil, fmt.Errorf("error requesting to connect user %v with user %v: %w", fromID, toID, err)
+		}
+		existing, err := ps.Get(ctx, fromID, toID)
+		if err == ErrConnectionNotFound && attempt+1 < maxRequestAttempts {
+			//deleted since the insert
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		//the other user asked at the same time, so accept their request
+		if !existing.Accepted && existing.RequesterID == toID && attempt+1 < maxRequestAttempts {
+			continue
+		}
+		return existing, nil
+	}
+}
+
+//Delete disconnects the two users, or declines or cancels a request
+func (ps *PostgresStore) Delete(ctx context.Context, userID int64, otherID int64) error {
+	delq := "delete from connections where (requesterid = $1 and addresseeid = $2) or (requesterid = $2 and addresseeid = $1)"
+	result, err := ps.DB.ExecContext(ctx, delq, userID, otherID)
+	if err != nil {
+		return fmt.Errorf("error deleting the connection between users %v and %v: %w", userID, otherID, err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error deleting the connection between users %v and %v: %w", userID, otherID, err)
+	}
+	if deleted == 0 {
+		return ErrConnectionNotFound
+	}
+	return nil
+}
+
+//connectionFields returns the destinations to scan a row of connectionColumns into
+func connectionFields(c *Connection) []interface{} {
+	return []interface{}{&c.RequesterID, &c.AddresseeID, &c.Accepted, &c.CreatedAt, &c.AcceptedAt}
+}
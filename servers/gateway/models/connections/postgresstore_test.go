@@ -0,0 +1,118 @@
+package connections
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+var columns = []string{"requesterid", "addresseeid", "accepted", "createdat", "acceptedat"}
+
+func TestPostgresStoreGet(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("There was a problem opening a database connection: [%v]", err)
+	}
+	defer db.Close()
+	store := NewPostgresStore(db)
+
+	createdAt := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	query := regexp.QuoteMeta("select " + connectionColumns + " from connections " +
+		"where (requesterid = $1 and addresseeid = $2) or (requesterid = $2 and addresseeid = $1)")
+	mock.ExpectQuery(query).WithArgs(2, 1).WillReturnRows(sqlmock.NewRows(columns).AddRow(1, 2, false, createdAt, nil))
+	c, err := store.Get(context.Background(), 2, 1)
+	if err != nil || c.RequesterID != 1 || c.AddresseeID != 2 || c.Accepted || c.AcceptedAt != nil {
+		t.Errorf("Unexpected connection: %+v, %v", c, err)
+	}
+	mock.ExpectQuery(query).WithArgs(1, 3).WillReturnRows(sqlmock.NewRows(columns))
+	if _, err := store.Get(context.Background(), 1, 3); !errors.Is(err, ErrConnectionNotFound) {
+		t.Errorf("Expected error [%v] but got [%v] instead", ErrConnectionNotFound, err)
+	}
+
+	query = regexp.QuoteMeta("select " + connectionColumns + " from connections " +
+		"where requesterid = $1 or addresseeid = $1 order by createdat, requesterid, addresseeid")
+	rows := sqlmock.NewRows(columns).
+		AddRow(1, 2, true, createdAt, createdAt).
+		AddRow(3, 1, false, createdAt, nil)
+	mock.ExpectQuery(query).WithArgs(1).WillReturnRows(rows)
+	found, err := store.GetByUserID(context.Background(), 1)
+	if err != nil || len(found) != 2 || !found[0].AcceptedAt.Equal(createdAt) || found[1].Other(1) != 3 {
+		t.Errorf("Unexpected connections: %+v, %v", found, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestPostgresStoreRequest(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("There was a problem opening a database connection: [%v]", err)
+	}
+	defer db.Close()
+	store := NewPostgresStore(db)
+
+	now := time.Now()
+	acceptq := regexp.QuoteMeta("update connections set accepted = true, acceptedat = $3 " +
+		"where requesterid = $2 and addresseeid = $1 and not accepted returning " + connectionColumns)
+	insq := regexp.QuoteMeta("insert into connections(requesterid, addresseeid, createdat) values ($1, $2, $3) " +
+		"on conflict do nothing returning " + connectionColumns)
+	getq := regexp.QuoteMeta("select " + connectionColumns + " from connections where")
+
+	//a new request
+	mock.ExpectQuery(acceptq).WithArgs(1, 2, now).WillReturnRows(sqlmock.NewRows(columns))
+	mock.ExpectQuery(insq).WithArgs(1, 2, now).WillReturnRows(sqlmock.NewRows(columns).AddRow(1, 2, false, now, nil))
+	if c, err := store.Request(context.Background(), 1, 2, now); err != nil || c.Accepted || c.RequesterID != 1 {
+		t.Errorf("Unexpected connection: %+v, %v", c, err)
+	}
+
+	//accepting a request
+	mock.ExpectQuery(acceptq).WithArgs(2, 1, now).WillReturnRows(sqlmock.NewRows(columns).AddRow(1, 2, true, now, now))
+	if c, err := store.Request(context.Background(), 2, 1, now); err != nil || !c.Accepted {
+		t.Errorf("Unexpected connection: %+v, %v", c, err)
+	}
+
+	//the other user asked at the same time, so their request is accepted
+	mock.ExpectQuery(acceptq).WithArgs(1, 3, now).WillReturnRows(sqlmock.NewRows(columns))
+	mock.ExpectQuery(insq).WithArgs(1, 3, now).WillReturnRows(sqlmock.NewRows(columns))
+	mock.ExpectQuery(getq).WithArgs(1, 3).WillReturnRows(sqlmock.NewRows(columns).AddRow(3, 1, false, now, nil))
+	mock.ExpectQuery(acceptq).WithArgs(1, 3, now).WillReturnRows(sqlmock.NewRows(columns).AddRow(3, 1, true, now, now))
+	if c, err := store.Request(context.Background(), 1, 3, now); err != nil || !c.Accepted || c.RequesterID != 3 {
+		t.Errorf("Unexpected connection: %+v, %v", c, err)
+	}
+
+	dbErr := errors.New("connection refused")
+	mock.ExpectQuery(acceptq).WithArgs(1, 4, now).WillReturnError(dbErr)
+	if _, err := store.Request(context.Background(), 1, 4, now); !errors.Is(err, dbErr) {
+		t.Errorf("Expected error [%v] but got [%v] instead", dbErr, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestPostgresStoreDelete(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("There was a problem opening a database connection: [%v]", err)
+	}
+	defer db.Close()
+	store := NewPostgresStore(db)
+
+	query := regexp.QuoteMeta("delete from connections where (requesterid = $1 and addresseeid = $2) or (requesterid = $2 and addresseeid = $1)")
+	mock.ExpectExec(query).WithArgs(1, 2).WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := store.Delete(context.Background(), 1, 2); err != nil {
+		t.Errorf("Unexpected error deleting connection: %v", err)
+	}
+	mock.ExpectExec(query).WithArgs(1, 2).WillReturnResult(sqlmock.NewResult(0, 0))
+	if err := store.Delete(context.Background(), 1, 2); !errors.Is(err, ErrConnectionNotFound) {
+		t.Errorf("Expected error [%v] but got [%v] instead", ErrConnectionNotFound, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,67 @@
+//Package connections keeps track of which users are connected, such as
+//classmates or a student and their mentor. Connected users can see each
+//other's profiles when they are only visible to connections.
+package connections
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+//ErrConnectionNotFound is returned when two users are not
+//connected and neither has asked to connect
+var ErrConnectionNotFound = errors.New("connection not found")
+
+//Connection represents a request from one user to connect with another.
+//Once the other user accepts, the two users are connected.
+type Connection struct {
+	RequesterID int64      `json:"requesterID"`
+	AddresseeID int64      `json:"addresseeID"`
+	Accepted    bool       `json:"accepted"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	AcceptedAt  *time.Time `json:"acceptedAt,omitempty"`
+}
+
+//Other returns the ID of the user `userID` is connecting with
+func (c *Connection) Other(userID int64) int64 {
+	if c.RequesterID == userID {
+		return c.AddresseeID
+	}
+	return c.RequesterID
+}
+
+//Store represents a store of connections between users
+type Store interface {
+	//Get returns the connection between the two users, whichever
+	//asked to connect, or ErrConnectionNotFound
+	Get(ctx context.Context, userID int64, otherID int64) (*Connection, error)
+
+	//GetByUserID returns the user's connections and requests
+	//to connect, both sent and received, oldest first
+	GetByUserID(ctx context.Context, userID int64) ([]*Connection, error)
+
+	//Request asks to connect `fromID` with `toID` and returns the
+	//connection. If `toID` had already asked to connect with `fromID`,
+	//their request is accepted. If `fromID` had already asked, or the
+	//users are connected, the connection is returned unchanged.
+	Request(ctx context.Context, fromID int64, toID int64, at time.Time) (*Connection, error)
+
+	//Delete disconnects the two users, or declines or cancels a
+	//request to connect. It returns ErrConnectionNotFound if there
+	//is no connection or request between them.
+	Delete(ctx context.Context, userID int64, otherID int64) error
+}
+
+//Connected returns true if the two users are connected.
+//A pending request to connect doesn't count.
+func Connected(ctx context.Context, store Store, userID int64, otherID int64) (bool, error) {
+	c, err := store.Get(ctx, userID, otherID)
+	if errors.Is(err, ErrConnectionNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return c.Accepted, nil
+}
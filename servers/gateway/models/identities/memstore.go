@@ -0,0 +1,122 @@
+package identities
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+//MemStore represents an identities.Store kept in process memory,
+//for tests and for developing the gateway locally. Like the
+//database, it fails calls whose context is already done.
+//Data is lost when the process exits.
+type MemStore struct {
+	mx         sync.RWMutex
+	identities map[int64]*Identity
+	lastID     int64
+	signIns    map[string]*SignIn
+}
+
+//NewMemStore constructs and returns a new, empty MemStore
+func NewMemStore() *MemStore {
+	return &MemStore{
+		identities: map[int64]*Identity{},
+		signIns:    map[string]*SignIn{},
+	}
+}
+
+//identities.Store implementation
+
+//Get returns the identity with the given issuer and subject
+func (ms *MemStore) Get(ctx context.Context, issuer string, subject string) (*Identity, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	ms.mx.RLock()
+	defer ms.mx.RUnlock()
+	for _, identity := range ms.identities {
+		if identity.Issuer == issuer && identity.Subject == subject {
+			copied := *identity
+			return &copied, nil
+		}
+	}
+	return nil, ErrIdentityNotFound
+}
+
+//GetByUserID returns the identities linked to the user, oldest first
+func (ms *MemStore) GetByUserID(ctx context.Context, userID int64) ([]*Identity, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	ms.mx.RLock()
+	defer ms.mx.RUnlock()
+	linked := []*Identity{}
+	for _, identity := range ms.identities {
+		if identity.UserID == userID {
+			copied := *identity
+			linked = append(linked, &copied)
+		}
+	}
+	sort.Slice(linked, func(i, j int) bool { return linked[i].ID < linked[j].ID })
+	return linked, nil
+}
+
+//Insert links the identity to its user and returns it with its assigned ID
+func (ms *MemStore) Insert(ctx context.Context, identity *Identity) (*Identity, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	for _, existing := range ms.identities {
+		if existing.Issuer == identity.Issuer && existing.Subject == identity.Subject {
+			return nil, ErrDuplicateIdentity
+		}
+	}
+	ms.lastID++
+	identity.ID = ms.lastID
+	copied := *identity
+	ms.identities[identity.ID] = &copied
+	return identity, nil
+}
+
+//Delete unlinks the user's identity with the given ID
+func (ms *MemStore) Delete(ctx context.Context, userID int64, id int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	if identity, found := ms.identities[id]; found && identity.UserID == userID {
+		delete(ms.identities, id)
+	}
+	return nil
+}
+
+//BeginSignIn stores the sign in under the hash of its state
+func (ms *MemStore) BeginSignIn(ctx context.Context, stateHash []byte, signIn *SignIn) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	copied := *signIn
+	ms.signIns[string(stateHash)] = &copied
+	return nil
+}
+
+//FinishSignIn deletes and returns the sign in with the given state hash
+func (ms *MemStore) FinishSignIn(ctx context.Context, stateHash []byte, now time.Time) (*SignIn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	signIn, found := ms.signIns[string(stateHash)]
+	delete(ms.signIns, string(stateHash))
+	if !found || !now.Before(signIn.ExpiresAt) {
+		return nil, ErrSignInNotFound
+	}
+	return signIn, nil
+}
@@ -0,0 +1,75 @@
+package identities
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMemStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemStore()
+
+	if _, err := store.Get(ctx, "https://accounts.google.com", "1234"); !errors.Is(err, ErrIdentityNotFound) {
+		t.Errorf("incorrect error getting a missing identity: expected %v but got %v", ErrIdentityNotFound, err)
+	}
+	google, err := store.Insert(ctx, &Identity{UserID: 1, Issuer: "https://accounts.google.com", Subject: "1234", Email: "neo@uw.edu", CreatedAt: time.Now()})
+	if err != nil || google.ID == 0 {
+		t.Fatalf("expected an identity with an ID but got %+v, %v", google, err)
+	}
+	if _, err := store.Insert(ctx, &Identity{UserID: 2, Issuer: "https://accounts.google.com", Subject: "1234"}); !errors.Is(err, ErrDuplicateIdentity) {
+		t.Errorf("incorrect error linking an identity twice: expected %v but got %v", ErrDuplicateIdentity, err)
+	}
+	//the same subject from another issuer is another identity
+	school, err := store.Insert(ctx, &Identity{UserID: 1, Issuer: "https://idp.uw.edu", Subject: "1234", Email: "neo@uw.edu", CreatedAt: time.Now()})
+	if err != nil {
+		t.Fatalf("unexpected error linking a second identity: %v", err)
+	}
+
+	if got, err := store.Get(ctx, "https://idp.uw.edu", "1234"); err != nil || got.ID != school.ID || got.UserID != 1 {
+		t.Errorf("expected the school identity but got %+v, %v", got, err)
+	}
+	linked, err := store.GetByUserID(ctx, 1)
+	if err != nil || len(linked) != 2 || linked[0].ID != google.ID || linked[1].ID != school.ID {
+		t.Errorf("expected both identities oldest first but got %+v, %v", linked, err)
+	}
+
+	//users can only unlink their own identities
+	if err := store.Delete(ctx, 2, google.ID); err != nil {
+		t.Errorf("unexpected error deleting another user's identity: %v", err)
+	}
+	if _, err := store.Get(ctx, "https://accounts.google.com", "1234"); err != nil {
+		t.Errorf("another user unlinked the identity: %v", err)
+	}
+	if err := store.Delete(ctx, 1, google.ID); err != nil {
+		t.Errorf("unexpected error deleting identity: %v", err)
+	}
+	if _, err := store.Get(ctx, "https://accounts.google.com", "1234"); !errors.Is(err, ErrIdentityNotFound) {
+		t.Errorf("incorrect error getting a deleted identity: expected %v but got %v", ErrIdentityNotFound, err)
+	}
+}
+
+func TestMemStoreSignIns(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemStore()
+	now := time.Now()
+
+	signIn := &SignIn{Provider: "school", Nonce: "nonce", Challenge: "challenge", ExpiresAt: now.Add(time.Minute)}
+	if err := store.BeginSignIn(ctx, []byte("state"), signIn); err != nil {
+		t.Fatalf("unexpected error beginning sign in: %v", err)
+	}
+	if err := store.BeginSignIn(ctx, []byte("expired"), &SignIn{Provider: "school", ExpiresAt: now}); err != nil {
+		t.Fatalf("unexpected error beginning sign in: %v", err)
+	}
+	if got, err := store.FinishSignIn(ctx, []byte("state"), now); err != nil || *got != *signIn {
+		t.Errorf("expected %+v but got %+v, %v", signIn, got, err)
+	}
+	//each state can only be used once
+	if _, err := store.FinishSignIn(ctx, []byte("state"), now); !errors.Is(err, ErrSignInNotFound) {
+		t.Errorf("incorrect error finishing a sign in twice: expected %v but got %v", ErrSignInNotFound, err)
+	}
+	if _, err := store.FinishSignIn(ctx, []byte("expired"), now); !errors.Is(err, ErrSignInNotFound) {
+		t.Errorf("incorrect error finishing an expired sign in: expected %v but got %v", ErrSignInNotFound, err)
+	}
+}
@@ -0,0 +1,129 @@
+package identities
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+//pqUniqueViolation is the postgres error code for a unique constraint violation
+const pqUniqueViolation = "23505"
+
+//identityColumns lists the identities table's columns in the
+//order they are scanned into an Identity
+const identityColumns = "id, userid, issuer, subject, email, createdat"
+
+//PostgresStore represents an identities.Store backed by postgres
+type PostgresStore struct {
+	DB *sql.DB
+}
+
+//NewPostgresStore returns a new PostgresStore
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	if db == nil {
+		panic("missing database connection")
+	}
+	return &PostgresStore{DB: db}
+}
+
+//identities.Store implementation
+
+//Get returns the identity with the given issuer and subject
+func (ps *PostgresStore) Get(ctx context.Context, issuer string, subject string) (*Identity, error) {
+	identity := &Identity{}
+	getq := "select " + identityColumns + " from identities where issuer = $1 and subject = $2"
+	err := ps.DB.QueryRowContext(ctx, getq, issuer, subject).Scan(identityFields(identity)...)
+	if err == sql.ErrNoRows {
+		return nil, ErrIdentityNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error querying the identity from %s: %w", issuer, err)
+	}
+	return identity, nil
+}
+
+//GetByUserID returns the identities linked to the user, oldest first
+func (ps *PostgresStore) GetByUserID(ctx context.Context, userID int64) ([]*Identity, error) {
+	rows, err := ps.DB.QueryContext(ctx, "select "+identityColumns+" from identities where userid = $1 order by id", userID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying the identities of the user with id %v: %w", userID, err)
+	}
+	defer rows.Close()
+	linked := []*Identity{}
+	for rows.Next() {
+		identity := &Identity{}
+		if err := rows.Scan(identityFields(identity)...); err != nil {
+			return nil, fmt.Errorf("error scanning an identity of the user with id %v: %w", userID, err)
+		}
+		linked = append(linked, identity)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error querying the identities of the user with id %v: %w", userID, err)
+	}
+	return linked, nil
+}
+
+//Insert links the identity to its user and returns it with its assigned ID
+func (ps *PostgresStore) Insert(ctx context.Context, identity *Identity) (*Identity, error) {
+	insq := "insert into identities(userid, issuer, subject, email, createdat) values ($1, $2, $3, $4, $5) returning id"
+	var id int64
+	err := ps.DB.QueryRowContext(ctx, insq, identity.UserID, identity.Issuer, identity.Subject, identity.Email, identity.CreatedAt).Scan(&id)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == pqUniqueViolation {
+		return nil, ErrDuplicateIdentity
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error linking an identity to the user with id %v: %w", identity.UserID, err)
+	}
+	identity.ID = id
+	return identity, nil
+}
+
+//Delete unlinks the user's identity with the given ID
+func (ps *PostgresStore) Delete(ctx context.Context, userID int64, id int64) error {
+	if _, err := ps.DB.ExecContext(ctx, "delete from identities where id = $1 and userid = $2", id, userID); err != nil {
+		return fmt.Errorf("error unlinking the identity with id %v: %w", id, err)
+	}
+	return nil
+}
+
+//BeginSignIn stores the sign in under the hash of its state
+func (ps *PostgresStore) BeginSignIn(ctx context.Context, stateHash []byte, signIn *SignIn) error {
+	//drop expired sign ins as new ones begin, so abandoned ones don't pile up
+	if _, err := ps.DB.ExecContext(ctx, "delete from oidcsignins where expiresat <= $1", time.Now()); err != nil {
+		return fmt.Errorf("error deleting expired sign ins: %w", err)
+	}
+	insq := "insert into oidcsignins(statehash, provider, nonce, challenge, expiresat) values ($1, $2, $3, $4, $5)"
+	if _, err := ps.DB.ExecContext(ctx, insq, stateHash, signIn.Provider, signIn.Nonce, signIn.Challenge, signIn.ExpiresAt); err != nil {
+		return fmt.Errorf("error beginning a sign in with %s: %w", signIn.Provider, err)
+	}
+	return nil
+}
+
+//FinishSignIn deletes and returns the sign in with the given state hash
+func (ps *PostgresStore) FinishSignIn(ctx context.Context, stateHash []byte, now time.Time) (*SignIn, error) {
+	finishq := "delete from oidcsignins where statehash = $1 returning provider, nonce, challenge, expiresat"
+	signIn := &SignIn{}
+	err := ps.DB.QueryRowContext(ctx, finishq, stateHash).Scan(&signIn.Provider, &signIn.Nonce, &signIn.Challenge, &signIn.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrSignInNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error finishing a sign in: %w", err)
+	}
+	if !now.Before(signIn.ExpiresAt) {
+		return nil, ErrSignInNotFound
+	}
+	return signIn, nil
+}
+
+//identityFields returns the destinations to scan a row of identityColumns into
+func identityFields(identity *Identity) []interface{} {
+	return []interface{}{
+		&identity.ID, &identity.UserID, &identity.Issuer, &identity.Subject, &identity.Email, &identity.CreatedAt,
+	}
+}
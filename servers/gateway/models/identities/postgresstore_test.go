@@ -0,0 +1,122 @@
+package identities
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+)
+
+var columns = []string{"id", "userid", "issuer", "subject", "email", "createdat"}
+
+func TestPostgresStoreGet(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("There was a problem opening a database connection: [%v]", err)
+	}
+	defer db.Close()
+	store := NewPostgresStore(db)
+
+	createdAt := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	query := regexp.QuoteMeta("select " + identityColumns + " from identities where issuer = $1 and subject = $2")
+	rows := sqlmock.NewRows(columns).AddRow(1, 2, "https://idp.uw.edu", "1234", "neo@uw.edu", createdAt)
+	mock.ExpectQuery(query).WithArgs("https://idp.uw.edu", "1234").WillReturnRows(rows)
+	identity, err := store.Get(context.Background(), "https://idp.uw.edu", "1234")
+	expected := Identity{ID: 1, UserID: 2, Issuer: "https://idp.uw.edu", Subject: "1234", Email: "neo@uw.edu", CreatedAt: createdAt}
+	if err != nil || *identity != expected {
+		t.Errorf("Unexpected identity: %+v, %v", identity, err)
+	}
+	mock.ExpectQuery(query).WithArgs("https://idp.uw.edu", "5678").WillReturnRows(sqlmock.NewRows(columns))
+	if _, err := store.Get(context.Background(), "https://idp.uw.edu", "5678"); !errors.Is(err, ErrIdentityNotFound) {
+		t.Errorf("Expected error [%v] but got [%v] instead", ErrIdentityNotFound, err)
+	}
+
+	query = regexp.QuoteMeta("select " + identityColumns + " from identities where userid = $1 order by id")
+	rows = sqlmock.NewRows(columns).
+		AddRow(1, 2, "https://idp.uw.edu", "1234", "neo@uw.edu", createdAt).
+		AddRow(3, 2, "https://accounts.google.com", "9876", "neo@gmail.com", createdAt)
+	mock.ExpectQuery(query).WithArgs(2).WillReturnRows(rows)
+	linked, err := store.GetByUserID(context.Background(), 2)
+	if err != nil || len(linked) != 2 || linked[1].Email != "neo@gmail.com" {
+		t.Errorf("Unexpected identities: %+v, %v", linked, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestPostgresStoreInsert(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("There was a problem opening a database connection: [%v]", err)
+	}
+	defer db.Close()
+	store := NewPostgresStore(db)
+
+	createdAt := time.Now()
+	identity := &Identity{UserID: 2, Issuer: "https://idp.uw.edu", Subject: "1234", Email: "neo@uw.edu", CreatedAt: createdAt}
+	query := regexp.QuoteMeta("insert into identities(userid, issuer, subject, email, createdat) values ($1, $2, $3, $4, $5) returning id")
+	mock.ExpectQuery(query).WithArgs(2, "https://idp.uw.edu", "1234", "neo@uw.edu", createdAt).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	if inserted, err := store.Insert(context.Background(), identity); err != nil || inserted.ID != 7 {
+		t.Errorf("Unexpected identity: %+v, %v", inserted, err)
+	}
+	mock.ExpectQuery(query).WithArgs(3, "https://idp.uw.edu", "1234", "", createdAt).
+		WillReturnError(&pq.Error{Code: pqUniqueViolation})
+	if _, err := store.Insert(context.Background(), &Identity{UserID: 3, Issuer: "https://idp.uw.edu", Subject: "1234", CreatedAt: createdAt}); !errors.Is(err, ErrDuplicateIdentity) {
+		t.Errorf("Expected error [%v] but got [%v] instead", ErrDuplicateIdentity, err)
+	}
+
+	mock.ExpectExec(regexp.QuoteMeta("delete from identities where id = $1 and userid = $2")).WithArgs(7, 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := store.Delete(context.Background(), 2, 7); err != nil {
+		t.Errorf("Unexpected error deleting identity: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestPostgresStoreSignIns(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("There was a problem opening a database connection: [%v]", err)
+	}
+	defer db.Close()
+	store := NewPostgresStore(db)
+
+	now := time.Now()
+	signIn := &SignIn{Provider: "school", Nonce: "nonce", Challenge: "challenge", ExpiresAt: now.Add(time.Minute)}
+	mock.ExpectExec(regexp.QuoteMeta("delete from oidcsignins where expiresat <= $1")).WithArgs(sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("insert into oidcsignins(statehash, provider, nonce, challenge, expiresat) values ($1, $2, $3, $4, $5)")).
+		WithArgs([]byte("state"), "school", "nonce", "challenge", signIn.ExpiresAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := store.BeginSignIn(context.Background(), []byte("state"), signIn); err != nil {
+		t.Errorf("Unexpected error beginning sign in: %v", err)
+	}
+
+	query := regexp.QuoteMeta("delete from oidcsignins where statehash = $1 returning provider, nonce, challenge, expiresat")
+	signInColumns := []string{"provider", "nonce", "challenge", "expiresat"}
+	mock.ExpectQuery(query).WithArgs([]byte("state")).
+		WillReturnRows(sqlmock.NewRows(signInColumns).AddRow("school", "nonce", "challenge", signIn.ExpiresAt))
+	if got, err := store.FinishSignIn(context.Background(), []byte("state"), now); err != nil || *got != *signIn {
+		t.Errorf("Unexpected sign in: %+v, %v", got, err)
+	}
+	mock.ExpectQuery(query).WithArgs([]byte("state")).WillReturnRows(sqlmock.NewRows(signInColumns))
+	if _, err := store.FinishSignIn(context.Background(), []byte("state"), now); !errors.Is(err, ErrSignInNotFound) {
+		t.Errorf("Expected error [%v] but got [%v] instead", ErrSignInNotFound, err)
+	}
+	mock.ExpectQuery(query).WithArgs([]byte("expired")).
+		WillReturnRows(sqlmock.NewRows(signInColumns).AddRow("school", "nonce", "challenge", now))
+	if _, err := store.FinishSignIn(context.Background(), []byte("expired"), now); !errors.Is(err, ErrSignInNotFound) {
+		t.Errorf("Expected error [%v] but got [%v] instead", ErrSignInNotFound, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
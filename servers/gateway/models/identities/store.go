@@ -0,0 +1,69 @@
+//Package identities links users to their accounts with external
+//OpenID Connect providers, such as their school's Google account
+package identities
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+//ErrIdentityNotFound is returned when no user is linked to an identity
+var ErrIdentityNotFound = errors.New("no user is linked to this identity")
+
+//ErrDuplicateIdentity is returned when linking an identity
+//that is already linked to a user
+var ErrDuplicateIdentity = errors.New("this identity is already linked to a user")
+
+//ErrSignInNotFound is returned when finishing a sign in that was
+//never begun, has already finished or has expired
+var ErrSignInNotFound = errors.New("the sign in was not found or has expired")
+
+//Identity represents a user's account with an OpenID Connect provider.
+//The provider's issuer URL and its subject identifier for the account
+//identify it; the email may change.
+type Identity struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"userID"`
+	Issuer    string    `json:"issuer"`
+	Subject   string    `json:"-"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+//SignIn is a sign in with a provider that has begun, kept under the
+//hash of its state until the user comes back from the provider. It
+//holds the ID token's nonce and the PKCE code challenge of the
+//verifier the client keeps.
+type SignIn struct {
+	Provider  string
+	Nonce     string
+	Challenge string
+	ExpiresAt time.Time
+}
+
+//Store represents a store of linked identities,
+//and of sign ins with providers that have begun
+type Store interface {
+	//Get returns the identity with the given issuer and subject,
+	//or ErrIdentityNotFound
+	Get(ctx context.Context, issuer string, subject string) (*Identity, error)
+
+	//GetByUserID returns the identities linked to the user
+	GetByUserID(ctx context.Context, userID int64) ([]*Identity, error)
+
+	//Insert links the identity to its user and returns it with its
+	//assigned ID, or ErrDuplicateIdentity if it is already linked
+	Insert(ctx context.Context, identity *Identity) (*Identity, error)
+
+	//Delete unlinks the user's identity with the given ID
+	Delete(ctx context.Context, userID int64, id int64) error
+
+	//BeginSignIn stores the sign in under the hash of its state
+	BeginSignIn(ctx context.Context, stateHash []byte, signIn *SignIn) error
+
+	//FinishSignIn deletes and returns the sign in with the given state
+	//hash, so each state can only be used once. It returns
+	//ErrSignInNotFound if there is none or it expired before `now`.
+	FinishSignIn(ctx context.Context, stateHash []byte, now time.Time) (*SignIn, error)
+}
@@ -0,0 +1,70 @@
+package passwordresets
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+//MemStore represents a passwordresets.Store kept in process memory,
+//for tests and for developing the gateway locally. Like the
+//database, it fails calls whose context is already done.
+//Data is lost when the process exits.
+type MemStore struct {
+	mx     sync.Mutex
+	resets map[string]Reset
+}
+
+//NewMemStore constructs and returns a new, empty MemStore
+func NewMemStore() *MemStore {
+	return &MemStore{
+		resets: map[string]Reset{},
+	}
+}
+
+//passwordresets.Store implementation
+
+//Begin stores the reset, replacing any reset of the same user
+func (ms *MemStore) Begin(ctx context.Context, hash []byte, reset *Reset) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	for key, r := range ms.resets {
+		if r.UserID == reset.UserID {
+			delete(ms.resets, key)
+		}
+	}
+	ms.resets[string(hash)] = *reset
+	return nil
+}
+
+//Get returns the reset with the given token hash
+func (ms *MemStore) Get(ctx context.Context, hash []byte, now time.Time) (*Reset, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	reset, found := ms.resets[string(hash)]
+	if !found || reset.Expired(now) {
+		return nil, ErrResetNotFound
+	}
+	return &reset, nil
+}
+
+//Finish deletes and returns the reset with the given token hash
+func (ms *MemStore) Finish(ctx context.Context, hash []byte, now time.Time) (*Reset, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	reset, found := ms.resets[string(hash)]
+	delete(ms.resets, string(hash))
+	if !found || reset.Expired(now) {
+		return nil, ErrResetNotFound
+	}
+	return &reset, nil
+}
@@ -0,0 +1,43 @@
+package passwordresets
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMemStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemStore()
+	now := time.Now()
+
+	if _, err := store.Get(ctx, HashToken("missing"), now); !errors.Is(err, ErrResetNotFound) {
+		t.Errorf("incorrect error getting a missing reset: expected %v but got %v", ErrResetNotFound, err)
+	}
+	if err := store.Begin(ctx, HashToken("first"), &Reset{UserID: 1, ExpiresAt: now.Add(Duration)}); err != nil {
+		t.Fatalf("unexpected error beginning reset: %v", err)
+	}
+	if reset, err := store.Get(ctx, HashToken("first"), now); err != nil || reset.UserID != 1 {
+		t.Fatalf("expected the first reset but got %+v, %v", reset, err)
+	}
+	if _, err := store.Get(ctx, HashToken("first"), now.Add(Duration)); !errors.Is(err, ErrResetNotFound) {
+		t.Errorf("incorrect error getting an expired reset: expected %v but got %v", ErrResetNotFound, err)
+	}
+
+	//a new reset replaces the user's earlier one
+	if err := store.Begin(ctx, HashToken("second"), &Reset{UserID: 1, ExpiresAt: now.Add(Duration)}); err != nil {
+		t.Fatalf("unexpected error beginning reset: %v", err)
+	}
+	if _, err := store.Finish(ctx, HashToken("first"), now); !errors.Is(err, ErrResetNotFound) {
+		t.Errorf("incorrect error finishing a replaced reset: expected %v but got %v", ErrResetNotFound, err)
+	}
+
+	//resets can only be finished once
+	if reset, err := store.Finish(ctx, HashToken("second"), now); err != nil || reset.UserID != 1 {
+		t.Fatalf("expected the second reset but got %+v, %v", reset, err)
+	}
+	if _, err := store.Finish(ctx, HashToken("second"), now); !errors.Is(err, ErrResetNotFound) {
+		t.Errorf("incorrect error finishing a reset twice: expected %v but got %v", ErrResetNotFound, err)
+	}
+}
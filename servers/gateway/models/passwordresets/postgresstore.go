@@ -0,0 +1,64 @@
+package passwordresets
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+//PostgresStore represents a passwordresets.Store backed by postgres
+type PostgresStore struct {
+	DB *sql.DB
+}
+
+//NewPostgresStore returns a new PostgresStore
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	if db == nil {
+		panic("missing database connection")
+	}
+	return &PostgresStore{DB: db}
+}
+
+//passwordresets.Store implementation
+
+//Begin stores the reset, replacing any reset of the same user
+func (ps *PostgresStore) Begin(ctx context.Context, hash []byte, reset *Reset) error {
+	insq := "insert into passwordresets(tokenhash, userid, expiresat) values ($1, $2, $3) " +
+		"on conflict (userid) do update set tokenhash = excluded.tokenhash, expiresat = excluded.expiresat"
+	if _, err := ps.DB.ExecContext(ctx, insq, hash, reset.UserID, reset.ExpiresAt); err != nil {
+		return fmt.Errorf("error beginning a password reset for the user with id %v: %w", reset.UserID, err)
+	}
+	return nil
+}
+
+//Get returns the reset with the given token hash
+func (ps *PostgresStore) Get(ctx context.Context, hash []byte, now time.Time) (*Reset, error) {
+	getq := "select userid, expiresat from passwordresets where tokenhash = $1 and expiresat > $2"
+	reset := &Reset{}
+	err := ps.DB.QueryRowContext(ctx, getq, hash, now).Scan(&reset.UserID, &reset.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrResetNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error querying password reset: %w", err)
+	}
+	return reset, nil
+}
+
+//Finish deletes and returns the reset with the given token hash
+func (ps *PostgresStore) Finish(ctx context.Context, hash []byte, now time.Time) (*Reset, error) {
+	finishq := "delete from passwordresets where tokenhash = $1 returning userid, expiresat"
+	reset := &Reset{}
+	err := ps.DB.QueryRowContext(ctx, finishq, hash).Scan(&reset.UserID, &reset.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrResetNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error finishing password reset: %w", err)
+	}
+	if reset.Expired(now) {
+		return nil, ErrResetNotFound
+	}
+	return reset, nil
+}
@@ -0,0 +1,53 @@
+package passwordresets
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestPostgresStore(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("There was a problem opening a database connection: [%v]", err)
+	}
+	defer db.Close()
+	store := NewPostgresStore(db)
+
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	hash := HashToken("abc")
+	reset := &Reset{UserID: 2, ExpiresAt: now.Add(Duration)}
+	beginq := regexp.QuoteMeta("insert into passwordresets(tokenhash, userid, expiresat) values ($1, $2, $3) on conflict (userid)")
+	mock.ExpectExec(beginq).WithArgs(hash, reset.UserID, reset.ExpiresAt).WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := store.Begin(context.Background(), hash, reset); err != nil {
+		t.Errorf("Unexpected error beginning reset: %v", err)
+	}
+
+	getq := regexp.QuoteMeta("select userid, expiresat from passwordresets where tokenhash = $1 and expiresat > $2")
+	mock.ExpectQuery(getq).WithArgs(hash, now).WillReturnRows(sqlmock.NewRows([]string{"userid", "expiresat"}).AddRow(2, reset.ExpiresAt))
+	if got, err := store.Get(context.Background(), hash, now); err != nil || got.UserID != 2 {
+		t.Errorf("Unexpected reset: %+v, %v", got, err)
+	}
+
+	finishq := regexp.QuoteMeta("delete from passwordresets where tokenhash = $1 returning userid, expiresat")
+	mock.ExpectQuery(finishq).WithArgs(hash).WillReturnRows(sqlmock.NewRows([]string{"userid", "expiresat"}).AddRow(2, reset.ExpiresAt))
+	if got, err := store.Finish(context.Background(), hash, now); err != nil || got.UserID != 2 {
+		t.Errorf("Unexpected reset: %+v, %v", got, err)
+	}
+	//an expired reset is deleted but not returned
+	mock.ExpectQuery(finishq).WithArgs(hash).WillReturnRows(sqlmock.NewRows([]string{"userid", "expiresat"}).AddRow(2, now))
+	if _, err := store.Finish(context.Background(), hash, now); !errors.Is(err, ErrResetNotFound) {
+		t.Errorf("Expected error [%v] but got [%v] instead", ErrResetNotFound, err)
+	}
+	mock.ExpectQuery(finishq).WithArgs(hash).WillReturnRows(sqlmock.NewRows([]string{"userid", "expiresat"}))
+	if _, err := store.Finish(context.Background(), hash, now); !errors.Is(err, ErrResetNotFound) {
+		t.Errorf("Expected error [%v] but got [%v] instead", ErrResetNotFound, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,47 @@
+//Package passwordresets stores password resets, which let a user who
+//can't sign in choose a new password with a single-use token an admin
+//issued them. Only the SHA-256 hashes of the tokens are stored.
+package passwordresets
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"time"
+)
+
+//tokenBytes is how many random bytes are in a token
+const tokenBytes = 32
+
+//Duration is how long a reset token can be redeemed for
+const Duration = 24 * time.Hour
+
+//Reset represents a password reset waiting to be redeemed
+//by the user it was issued for
+type Reset struct {
+	UserID    int64     `json:"userID"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+//Expired returns true if the reset has expired at `now`
+func (r *Reset) Expired(now time.Time) bool {
+	return !now.Before(r.ExpiresAt)
+}
+
+//NewToken generates a new reset token, and returns
+//it and the hash of it to store
+func NewToken() (string, []byte, error) {
+	random := make([]byte, tokenBytes)
+	if _, err := rand.Read(random); err != nil {
+		return "", nil, fmt.Errorf("error generating password reset token: %v", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(random)
+	return token, HashToken(token), nil
+}
+
+//HashToken returns the SHA-256 hash of the token, which is how it is stored
+func HashToken(token string) []byte {
+	hash := sha256.Sum256([]byte(token))
+	return hash[:]
+}
@@ -0,0 +1,29 @@
+package passwordresets
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+//ErrResetNotFound is returned when a token was never issued,
+//has already been redeemed, was replaced or has expired
+var ErrResetNotFound = errors.New("the password reset was not found or has expired")
+
+//Store represents a store of password resets, kept
+//under the hashes of their tokens
+type Store interface {
+	//Begin stores the reset under the hash of its token, replacing
+	//any reset of the same user, so only their newest token works
+	Begin(ctx context.Context, hash []byte, reset *Reset) error
+
+	//Get returns the reset with the given token hash, without
+	//redeeming it. It returns ErrResetNotFound if there is none
+	//or it expired before `now`.
+	Get(ctx context.Context, hash []byte, now time.Time) (*Reset, error)
+
+	//Finish deletes and returns the reset with the given token hash,
+	//so each token can only be redeemed once. It returns
+	//ErrResetNotFound if there is none or it expired before `now`.
+	Finish(ctx context.Context, hash []byte, now time.Time) (*Reset, error)
+}
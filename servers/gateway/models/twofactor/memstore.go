@@ -0,0 +1,169 @@
+package twofactor
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+//MemStore represents a twofactor.Store kept in process memory,
+//for tests and for developing the gateway locally. Like the
+//database, it fails calls whose context is already done.
+//Data is lost when the process exits.
+type MemStore struct {
+	mx          sync.Mutex
+	enrollments map[int64]*Enrollment
+	//recoveryCodes holds each user's recovery code hashes, as strings
+	recoveryCodes map[int64]map[string]bool
+	//challenges are keyed by their token hash, as a string
+	challenges map[string]*Challenge
+}
+
+//NewMemStore constructs and returns a new, empty MemStore
+func NewMemStore() *MemStore {
+	return &MemStore{
+		enrollments:   map[int64]*Enrollment{},
+		recoveryCodes: map[int64]map[string]bool{},
+		challenges:    map[string]*Challenge{},
+	}
+}
+
+//twofactor.Store implementation
+
+//Get returns the user's Enrollment
+func (ms *MemStore) Get(ctx context.Context, userID int64) (*Enrollment, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	e, found := ms.enrollments[userID]
+	if !found {
+		return nil, ErrNotEnrolled
+	}
+	copied := *e
+	return &copied, nil
+}
+
+//Begin starts enrolling the user with a new, unconfirmed secret
+func (ms *MemStore) Begin(ctx context.Context, userID int64, secret string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	if e, found := ms.enrollments[userID]; found && e.Confirmed {
+		return ErrAlreadyEnrolled
+	}
+	ms.enrollments[userID] = &Enrollment{UserID: userID, Secret: secret}
+	return nil
+}
+
+//Confirm confirms the user's enrollment and stores their recovery codes
+func (ms *MemStore) Confirm(ctx context.Context, userID int64, step int64, recoveryCodeHashes [][]byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	e, found := ms.enrollments[userID]
+	if !found || e.Confirmed {
+		return ErrNotEnrolled
+	}
+	e.Confirmed = true
+	e.LastStep = step
+	codes := map[string]bool{}
+	for _, hash := range recoveryCodeHashes {
+		codes[string(hash)] = true
+	}
+	ms.recoveryCodes[userID] = codes
+	return nil
+}
+
+//UseStep records that the user's code for `step` was used
+func (ms *MemStore) UseStep(ctx context.Context, userID int64, step int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	e, found := ms.enrollments[userID]
+	if !found || !e.Confirmed || e.LastStep >= step {
+		return ErrInvalidCode
+	}
+	e.LastStep = step
+	return nil
+}
+
+//UseRecoveryCode removes the user's recovery code with the given hash
+func (ms *MemStore) UseRecoveryCode(ctx context.Context, userID int64, codeHash []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	codes := ms.recoveryCodes[userID]
+	if !codes[string(codeHash)] {
+		return ErrInvalidCode
+	}
+	delete(codes, string(codeHash))
+	return nil
+}
+
+//Delete turns off two-factor sign in for the user
+func (ms *MemStore) Delete(ctx context.Context, userID int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	delete(ms.enrollments, userID)
+	delete(ms.recoveryCodes, userID)
+	return nil
+}
+
+//CreateChallenge stores the challenge under the hash of its token
+func (ms *MemStore) CreateChallenge(ctx context.Context, tokenHash []byte, challenge *Challenge) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	//drop expired challenges as new ones are made, so they don't pile up
+	now := time.Now()
+	for hash, c := range ms.challenges {
+		if !c.ExpiresAt.After(now) {
+			delete(ms.challenges, hash)
+		}
+	}
+	copied := *challenge
+	ms.challenges[string(tokenHash)] = &copied
+	return nil
+}
+
+//AttemptChallenge counts an attempt to answer the challenge and returns it
+func (ms *MemStore) AttemptChallenge(ctx context.Context, tokenHash []byte, now time.Time) (*Challenge, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	c, found := ms.challenges[string(tokenHash)]
+	if !found || !c.ExpiresAt.After(now) {
+		return nil, ErrChallengeNotFound
+	}
+	c.Attempts++
+	copied := *c
+	return &copied, nil
+}
+
+//DeleteChallenge deletes the challenge with the given token hash
+func (ms *MemStore) DeleteChallenge(ctx context.Context, tokenHash []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	delete(ms.challenges, string(tokenHash))
+	return nil
+}
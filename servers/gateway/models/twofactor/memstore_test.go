@@ -0,0 +1,107 @@
+package twofactor
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMemStoreEnrollment(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemStore()
+
+	if _, err := store.Get(ctx, 1); !errors.Is(err, ErrNotEnrolled) {
+		t.Errorf("incorrect error getting a missing enrollment: expected %v but got %v", ErrNotEnrolled, err)
+	}
+	if err := store.Confirm(ctx, 1, 10, nil); !errors.Is(err, ErrNotEnrolled) {
+		t.Errorf("incorrect error confirming a missing enrollment: expected %v but got %v", ErrNotEnrolled, err)
+	}
+
+	//beginning again replaces an unconfirmed secret
+	if err := store.Begin(ctx, 1, "FIRST"); err != nil {
+		t.Fatalf("unexpected error beginning enrollment: %v", err)
+	}
+	if err := store.Begin(ctx, 1, "SECOND"); err != nil {
+		t.Fatalf("unexpected error beginning enrollment again: %v", err)
+	}
+	e, err := store.Get(ctx, 1)
+	if err != nil || e.Secret != "SECOND" || e.Confirmed {
+		t.Fatalf("expected an unconfirmed enrollment with the second secret but got %+v, %v", e, err)
+	}
+	//codes can't be used until the enrollment is confirmed
+	if err := store.UseStep(ctx, 1, 10); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("incorrect error using a code before confirming: expected %v but got %v", ErrInvalidCode, err)
+	}
+
+	recoveryHash := HashRecoveryCode("abcde-fghij")
+	if err := store.Confirm(ctx, 1, 10, [][]byte{recoveryHash}); err != nil {
+		t.Fatalf("unexpected error confirming enrollment: %v", err)
+	}
+	if e, err := store.Get(ctx, 1); err != nil || !e.Confirmed || e.LastStep != 10 {
+		t.Errorf("expected a confirmed enrollment at step 10 but got %+v, %v", e, err)
+	}
+	if err := store.Begin(ctx, 1, "THIRD"); !errors.Is(err, ErrAlreadyEnrolled) {
+		t.Errorf("incorrect error beginning a confirmed enrollment: expected %v but got %v", ErrAlreadyEnrolled, err)
+	}
+
+	//each step and recovery code can only be used once
+	if err := store.UseStep(ctx, 1, 10); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("incorrect error reusing a step: expected %v but got %v", ErrInvalidCode, err)
+	}
+	if err := store.UseStep(ctx, 1, 11); err != nil {
+		t.Errorf("unexpected error using a later step: %v", err)
+	}
+	if err := store.UseRecoveryCode(ctx, 1, recoveryHash); err != nil {
+		t.Errorf("unexpected error using a recovery code: %v", err)
+	}
+	if err := store.UseRecoveryCode(ctx, 1, recoveryHash); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("incorrect error reusing a recovery code: expected %v but got %v", ErrInvalidCode, err)
+	}
+
+	if err := store.Delete(ctx, 1); err != nil {
+		t.Fatalf("unexpected error deleting enrollment: %v", err)
+	}
+	if _, err := store.Get(ctx, 1); !errors.Is(err, ErrNotEnrolled) {
+		t.Errorf("incorrect error getting a deleted enrollment: expected %v but got %v", ErrNotEnrolled, err)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := store.Get(cancelled, 1); !errors.Is(err, context.Canceled) {
+		t.Errorf("incorrect error with a cancelled context: expected %v but got %v", context.Canceled, err)
+	}
+}
+
+func TestMemStoreChallenges(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemStore()
+	now := time.Now()
+	_, tokenHash, err := NewChallengeToken()
+	if err != nil {
+		t.Fatalf("unexpected error creating challenge token: %v", err)
+	}
+
+	if _, err := store.AttemptChallenge(ctx, tokenHash, now); !errors.Is(err, ErrChallengeNotFound) {
+		t.Errorf("incorrect error attempting a missing challenge: expected %v but got %v", ErrChallengeNotFound, err)
+	}
+	if err := store.CreateChallenge(ctx, tokenHash, &Challenge{UserID: 1, ExpiresAt: now.Add(ChallengeDuration)}); err != nil {
+		t.Fatalf("unexpected error creating challenge: %v", err)
+	}
+	for attempt := 1; attempt <= 2; attempt++ {
+		c, err := store.AttemptChallenge(ctx, tokenHash, now)
+		if err != nil || c.UserID != 1 || c.Attempts != attempt {
+			t.Errorf("expected attempt %d at the challenge for user 1 but got %+v, %v", attempt, c, err)
+		}
+	}
+	if _, err := store.AttemptChallenge(ctx, tokenHash, now.Add(ChallengeDuration)); !errors.Is(err, ErrChallengeNotFound) {
+		t.Errorf("incorrect error attempting an expired challenge: expected %v but got %v", ErrChallengeNotFound, err)
+	}
+
+	if err := store.DeleteChallenge(ctx, tokenHash); err != nil {
+		t.Fatalf("unexpected error deleting challenge: %v", err)
+	}
+	if _, err := store.AttemptChallenge(ctx, tokenHash, now); !errors.Is(err, ErrChallengeNotFound) {
+		t.Errorf("incorrect error attempting a deleted challenge: expected %v but got %v", ErrChallengeNotFound, err)
+	}
+}
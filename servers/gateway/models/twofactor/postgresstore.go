@@ -0,0 +1,155 @@
+package twofactor
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+//PostgresStore represents a twofactor.Store backed by postgres
+type PostgresStore struct {
+	DB *sql.DB
+}
+
+//NewPostgresStore returns a new PostgresStore
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	if db == nil {
+		panic("missing database connection")
+	}
+	return &PostgresStore{DB: db}
+}
+
+//twofactor.Store implementation
+
+//Get returns the user's Enrollment
+func (ps *PostgresStore) Get(ctx context.Context, userID int64) (*Enrollment, error) {
+	e := &Enrollment{}
+	err := ps.DB.QueryRowContext(ctx, "select userid, secret, confirmed, laststep from twofactor where userid = $1", userID).Scan(
+		&e.UserID, &e.Secret, &e.Confirmed, &e.LastStep,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotEnrolled
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error querying the two-factor enrollment of the user with id %v: %w", userID, err)
+	}
+	return e, nil
+}
+
+//Begin starts enrolling the user with a new, unconfirmed secret
+func (ps *PostgresStore) Begin(ctx context.Context, userID int64, secret string) error {
+	//the update is skipped for confirmed enrollments, so no row is affected
+	beginq := "insert into twofactor(userid, secret) values ($1, $2) " +
+		"on conflict (userid) do update set secret = excluded.secret, laststep = 0 where not twofactor.confirmed"
+	result, err := ps.DB.ExecContext(ctx, beginq, userID, secret)
+	if err != nil {
+		return fmt.Errorf("error beginning two-factor enrollment for the user with id %v: %w", userID, err)
+	}
+	return requireRow(result, ErrAlreadyEnrolled)
+}
+
+//Confirm confirms the user's enrollment and stores their recovery codes
+func (ps *PostgresStore) Confirm(ctx context.Context, userID int64, step int64, recoveryCodeHashes [][]byte) error {
+	tx, err := ps.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "update twofactor set confirmed = true, laststep = $1 where userid = $2 and not confirmed", step, userID)
+	if err != nil {
+		return fmt.Errorf("error confirming two-factor enrollment for the user with id %v: %w", userID, err)
+	}
+	if err := requireRow(result, ErrNotEnrolled); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "delete from recoverycodes where userid = $1", userID); err != nil {
+		return fmt.Errorf("error deleting old recovery codes for the user with id %v: %w", userID, err)
+	}
+	for _, hash := range recoveryCodeHashes {
+		if _, err := tx.ExecContext(ctx, "insert into recoverycodes(userid, codehash) values ($1, $2)", userID, hash); err != nil {
+			return fmt.Errorf("error storing recovery codes for the user with id %v: %w", userID, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
+}
+
+//UseStep records that the user's code for `step` was used
+func (ps *PostgresStore) UseStep(ctx context.Context, userID int64, step int64) error {
+	//the laststep check makes concurrent uses of one code race for the row
+	result, err := ps.DB.ExecContext(ctx, "update twofactor set laststep = $1 where userid = $2 and confirmed and laststep < $1", step, userID)
+	if err != nil {
+		return fmt.Errorf("error recording a two-factor code for the user with id %v: %w", userID, err)
+	}
+	return requireRow(result, ErrInvalidCode)
+}
+
+//UseRecoveryCode removes the user's recovery code with the given hash
+func (ps *PostgresStore) UseRecoveryCode(ctx context.Context, userID int64, codeHash []byte) error {
+	result, err := ps.DB.ExecContext(ctx, "delete from recoverycodes where userid = $1 and codehash = $2", userID, codeHash)
+	if err != nil {
+		return fmt.Errorf("error using a recovery code for the user with id %v: %w", userID, err)
+	}
+	return requireRow(result, ErrInvalidCode)
+}
+
+//Delete turns off two-factor sign in for the user. Their
+//recovery codes are deleted with the enrollment.
+func (ps *PostgresStore) Delete(ctx context.Context, userID int64) error {
+	if _, err := ps.DB.ExecContext(ctx, "delete from twofactor where userid = $1", userID); err != nil {
+		return fmt.Errorf("error deleting the two-factor enrollment of the user with id %v: %w", userID, err)
+	}
+	return nil
+}
+
+//CreateChallenge stores the challenge under the hash of its token
+func (ps *PostgresStore) CreateChallenge(ctx context.Context, tokenHash []byte, challenge *Challenge) error {
+	//drop the user's expired challenges as new ones are made, so they don't pile up
+	if _, err := ps.DB.ExecContext(ctx, "delete from twofactorchallenges where userid = $1 and expiresat <= $2", challenge.UserID, time.Now()); err != nil {
+		return fmt.Errorf("error deleting expired challenges for the user with id %v: %w", challenge.UserID, err)
+	}
+	insq := "insert into twofactorchallenges(tokenhash, userid, expiresat, attempts) values ($1, $2, $3, $4)"
+	if _, err := ps.DB.ExecContext(ctx, insq, tokenHash, challenge.UserID, challenge.ExpiresAt, challenge.Attempts); err != nil {
+		return fmt.Errorf("error creating a challenge for the user with id %v: %w", challenge.UserID, err)
+	}
+	return nil
+}
+
+//AttemptChallenge counts an attempt to answer the challenge and returns it
+func (ps *PostgresStore) AttemptChallenge(ctx context.Context, tokenHash []byte, now time.Time) (*Challenge, error) {
+	attemptq := "update twofactorchallenges set attempts = attempts + 1 " +
+		"where tokenhash = $1 and expiresat > $2 returning userid, expiresat, attempts"
+	c := &Challenge{}
+	err := ps.DB.QueryRowContext(ctx, attemptq, tokenHash, now).Scan(&c.UserID, &c.ExpiresAt, &c.Attempts)
+	if err == sql.ErrNoRows {
+		return nil, ErrChallengeNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error attempting a challenge: %w", err)
+	}
+	return c, nil
+}
+
+//DeleteChallenge deletes the challenge with the given token hash
+func (ps *PostgresStore) DeleteChallenge(ctx context.Context, tokenHash []byte) error {
+	if _, err := ps.DB.ExecContext(ctx, "delete from twofactorchallenges where tokenhash = $1", tokenHash); err != nil {
+		return fmt.Errorf("error deleting a challenge: %w", err)
+	}
+	return nil
+}
+
+//requireRow returns `notFound` if the statement didn't affect any rows
+func requireRow(result sql.Result, notFound error) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error checking affected rows: %w", err)
+	}
+	if affected == 0 {
+		return notFound
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package twofactor
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestPostgresStoreGet(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("There was a problem opening a database connection: [%v]", err)
+	}
+	defer db.Close()
+	store := NewPostgresStore(db)
+
+	query := regexp.QuoteMeta("select userid, secret, confirmed, laststep from twofactor where userid = $1")
+	rows := sqlmock.NewRows([]string{"userid", "secret", "confirmed", "laststep"}).AddRow(1, rfcSecret, true, 10)
+	mock.ExpectQuery(query).WithArgs(1).WillReturnRows(rows)
+	e, err := store.Get(context.Background(), 1)
+	if err != nil || *e != (Enrollment{UserID: 1, Secret: rfcSecret, Confirmed: true, LastStep: 10}) {
+		t.Errorf("Unexpected enrollment: %+v, %v", e, err)
+	}
+	mock.ExpectQuery(query).WithArgs(2).WillReturnRows(sqlmock.NewRows([]string{"userid", "secret", "confirmed", "laststep"}))
+	if _, err := store.Get(context.Background(), 2); !errors.Is(err, ErrNotEnrolled) {
+		t.Errorf("Expected error [%v] but got [%v] instead", ErrNotEnrolled, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestPostgresStoreBegin(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("There was a problem opening a database connection: [%v]", err)
+	}
+	defer db.Close()
+	store := NewPostgresStore(db)
+
+	query := regexp.QuoteMeta("insert into twofactor(userid, secret) values ($1, $2) on conflict (userid) do update")
+	mock.ExpectExec(query).WithArgs(1, rfcSecret).WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := store.Begin(context.Background(), 1, rfcSecret); err != nil {
+		t.Errorf("Unexpected error beginning enrollment: %v", err)
+	}
+	//a confirmed enrollment isn't updated
+	mock.ExpectExec(query).WithArgs(2, rfcSecret).WillReturnResult(sqlmock.NewResult(0, 0))
+	if err := store.Begin(context.Background(), 2, rfcSecret); !errors.Is(err, ErrAlreadyEnrolled) {
+		t.Errorf("Expected error [%v] but got [%v] instead", ErrAlreadyEnrolled, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestPostgresStoreConfirm(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("There was a problem opening a database connection: [%v]", err)
+	}
+	defer db.Close()
+	store := NewPostgresStore(db)
+	confirmq := regexp.QuoteMeta("update twofactor set confirmed = true, laststep = $1 where userid = $2 and not confirmed")
+	hashes := [][]byte{[]byte("first"), []byte("second")}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(confirmq).WithArgs(10, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("delete from recoverycodes where userid = $1")).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
+	for _, hash := range hashes {
+		mock.ExpectExec(regexp.QuoteMeta("insert into recoverycodes(userid, codehash) values ($1, $2)")).
+			WithArgs(1, hash).WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectCommit()
+	if err := store.Confirm(context.Background(), 1, 10, hashes); err != nil {
+		t.Errorf("Unexpected error confirming enrollment: %v", err)
+	}
+
+	//nothing is stored without an unconfirmed enrollment
+	mock.ExpectBegin()
+	mock.ExpectExec(confirmq).WithArgs(10, 2).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+	if err := store.Confirm(context.Background(), 2, 10, hashes); !errors.Is(err, ErrNotEnrolled) {
+		t.Errorf("Expected error [%v] but got [%v] instead", ErrNotEnrolled, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestPostgresStoreUseCodes(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("There was a problem opening a database connection: [%v]", err)
+	}
+	defer db.Close()
+	store := NewPostgresStore(db)
+
+	stepq := regexp.QuoteMeta("update twofactor set laststep = $1 where userid = $2 and confirmed and laststep < $1")
+	mock.ExpectExec(stepq).WithArgs(11, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := store.UseStep(context.Background(), 1, 11); err != nil {
+		t.Errorf("Unexpected error using a step: %v", err)
+	}
+	mock.ExpectExec(stepq).WithArgs(11, 1).WillReturnResult(sqlmock.NewResult(0, 0))
+	if err := store.UseStep(context.Background(), 1, 11); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("Expected error [%v] but got [%v] instead", ErrInvalidCode, err)
+	}
+
+	recoveryq := regexp.QuoteMeta("delete from recoverycodes where userid = $1 and codehash = $2")
+	mock.ExpectExec(recoveryq).WithArgs(1, []byte("hash")).WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := store.UseRecoveryCode(context.Background(), 1, []byte("hash")); err != nil {
+		t.Errorf("Unexpected error using a recovery code: %v", err)
+	}
+	mock.ExpectExec(recoveryq).WithArgs(1, []byte("hash")).WillReturnResult(sqlmock.NewResult(0, 0))
+	if err := store.UseRecoveryCode(context.Background(), 1, []byte("hash")); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("Expected error [%v] but got [%v] instead", ErrInvalidCode, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestPostgresStoreAttemptChallenge(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("There was a problem opening a database connection: [%v]", err)
+	}
+	defer db.Close()
+	store := NewPostgresStore(db)
+	now := time.Now()
+	expiresAt := now.Add(ChallengeDuration)
+
+	query := regexp.QuoteMeta("update twofactorchallenges set attempts = attempts + 1 where tokenhash = $1 and expiresat > $2 returning userid, expiresat, attempts")
+	rows := sqlmock.NewRows([]string{"userid", "expiresat", "attempts"}).AddRow(1, expiresAt, 2)
+	mock.ExpectQuery(query).WithArgs([]byte("token"), now).WillReturnRows(rows)
+	c, err := store.AttemptChallenge(context.Background(), []byte("token"), now)
+	if err != nil || c.UserID != 1 || c.Attempts != 2 || !c.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("Unexpected challenge: %+v, %v", c, err)
+	}
+	mock.ExpectQuery(query).WithArgs([]byte("token"), now).WillReturnRows(sqlmock.NewRows([]string{"userid", "expiresat", "attempts"}))
+	if _, err := store.AttemptChallenge(context.Background(), []byte("token"), now); !errors.Is(err, ErrChallengeNotFound) {
+		t.Errorf("Expected error [%v] but got [%v] instead", ErrChallengeNotFound, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,49 @@
+package twofactor
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"fmt"
+	"strings"
+)
+
+//RecoveryCodeCount is how many recovery codes a user is given
+const RecoveryCodeCount = 10
+
+//recoveryCodeBytes is the randomness in each recovery code. 80 bits
+//is too many to guess, so unlike passwords the codes can be hashed
+//with a fast hash.
+const recoveryCodeBytes = 10
+
+//recoveryEncoding spells recovery codes with lowercase letters
+//and the digits 2-7, which are hard to mistake for each other
+var recoveryEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+//GenerateRecoveryCodes returns RecoveryCodeCount new recovery codes to
+//show the user, along with their hashes to store. Each code can be
+//used once in place of a TOTP code.
+func GenerateRecoveryCodes() ([]string, [][]byte, error) {
+	codes := make([]string, RecoveryCodeCount)
+	hashes := make([][]byte, RecoveryCodeCount)
+	for i := range codes {
+		random := make([]byte, recoveryCodeBytes)
+		if _, err := rand.Read(random); err != nil {
+			return nil, nil, fmt.Errorf("error generating recovery codes: %v", err)
+		}
+		encoded := recoveryEncoding.EncodeToString(random)
+		//split in two to make it easier to read and type
+		codes[i] = encoded[:len(encoded)/2] + "-" + encoded[len(encoded)/2:]
+		hashes[i] = HashRecoveryCode(codes[i])
+	}
+	return codes, hashes, nil
+}
+
+//HashRecoveryCode returns the hash a recovery code is stored as.
+//Case, spaces and dashes are ignored.
+func HashRecoveryCode(code string) []byte {
+	code = strings.ToLower(strings.Join(strings.Fields(code), ""))
+	code = strings.ReplaceAll(code, "-", "")
+	hash := sha256.Sum256([]byte(code))
+	return hash[:]
+}
@@ -0,0 +1,113 @@
+package twofactor
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+)
+
+//ChallengeDuration is how long a user has to enter their
+//code after signing in with their password
+const ChallengeDuration = 5 * time.Minute
+
+//MaxChallengeAttempts is how many codes may be tried for one challenge
+const MaxChallengeAttempts = 5
+
+//challengeTokenBytes is the randomness in a challenge token
+const challengeTokenBytes = 32
+
+//ErrNotEnrolled is returned when a user hasn't turned on two-factor sign in
+var ErrNotEnrolled = errors.New("two-factor sign in is not enabled for this user")
+
+//ErrAlreadyEnrolled is returned when enrolling a user
+//who has already turned on two-factor sign in
+var ErrAlreadyEnrolled = errors.New("two-factor sign in is already enabled for this user")
+
+//ErrChallengeNotFound is returned when a sign in
+//challenge doesn't exist or has expired
+var ErrChallengeNotFound = errors.New("the sign in challenge was not found or has expired")
+
+//Enrollment represents a user's two-factor sign in settings
+type Enrollment struct {
+	UserID int64
+	//Secret is the base32 TOTP secret shared with the user's authenticator
+	Secret string
+	//Confirmed is true once the user has entered a code from their
+	//authenticator. Until then, it isn't needed to sign in.
+	Confirmed bool
+	//LastStep is the period of the last code used, so it can't be reused
+	LastStep int64
+}
+
+//Challenge represents a sign in waiting for a two-factor code. It is
+//stored under the hash of the token given to the client, so a leaked
+//store can't be used to finish signing in.
+type Challenge struct {
+	UserID    int64
+	ExpiresAt time.Time
+	//Attempts is how many codes have been tried
+	Attempts int
+}
+
+//Store represents a store of two-factor enrollments,
+//recovery codes and sign in challenges
+type Store interface {
+	//Get returns the user's Enrollment, or ErrNotEnrolled
+	Get(ctx context.Context, userID int64) (*Enrollment, error)
+
+	//Begin starts enrolling the user with a new, unconfirmed secret,
+	//replacing any unconfirmed one. It returns ErrAlreadyEnrolled if
+	//the user's enrollment is already confirmed.
+	Begin(ctx context.Context, userID int64, secret string) error
+
+	//Confirm confirms the user's enrollment, records `step` as the
+	//last one used and stores the hashes of their recovery codes.
+	//It returns ErrNotEnrolled if there is no unconfirmed enrollment.
+	Confirm(ctx context.Context, userID int64, step int64, recoveryCodeHashes [][]byte) error
+
+	//UseStep records that the user's code for `step` was used. It
+	//returns ErrInvalidCode if a code for that step or a later one
+	//was already used, so a code can't be used twice at once.
+	UseStep(ctx context.Context, userID int64, step int64) error
+
+	//UseRecoveryCode removes the user's recovery code with the
+	//given hash, or returns ErrInvalidCode if they don't have it
+	UseRecoveryCode(ctx context.Context, userID int64, codeHash []byte) error
+
+	//Delete turns off two-factor sign in for the user,
+	//removing their secret and recovery codes
+	Delete(ctx context.Context, userID int64) error
+
+	//CreateChallenge stores the challenge under the hash of its token
+	CreateChallenge(ctx context.Context, tokenHash []byte, challenge *Challenge) error
+
+	//AttemptChallenge counts an attempt to answer the challenge with
+	//the given token hash and returns the challenge, including this
+	//attempt. It returns ErrChallengeNotFound if there is no such
+	//challenge or it expired before `now`.
+	AttemptChallenge(ctx context.Context, tokenHash []byte, now time.Time) (*Challenge, error)
+
+	//DeleteChallenge deletes the challenge with the given token hash
+	DeleteChallenge(ctx context.Context, tokenHash []byte) error
+}
+
+//NewChallengeToken returns a new random challenge token
+//to give the client, along with its hash to store
+func NewChallengeToken() (string, []byte, error) {
+	random := make([]byte, challengeTokenBytes)
+	if _, err := rand.Read(random); err != nil {
+		return "", nil, fmt.Errorf("error generating challenge token: %v", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(random)
+	return token, HashChallengeToken(token), nil
+}
+
+//HashChallengeToken returns the hash a challenge token is stored under
+func HashChallengeToken(token string) []byte {
+	hash := sha256.Sum256([]byte(token))
+	return hash[:]
+}
@@ -0,0 +1,135 @@
+//Package twofactor implements time-based one-time passwords (TOTP, RFC 6238)
+//for two-factor sign in, along with the recovery codes users fall back on
+//when they lose their authenticator, and the stores that keep both.
+package twofactor
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	//Digits is the number of digits in a code
+	Digits = 6
+	//Period is how long each code is valid for
+	Period = 30 * time.Second
+	//Skew is how many periods before or after the current one
+	//a code is still accepted for, to allow for clock drift
+	Skew = 1
+	//secretBytes is the length of a secret; RFC 4226
+	//recommends 160 bits to match HMAC-SHA1's output
+	secretBytes = 20
+)
+
+//ErrInvalidCode is returned when a code is wrong, has
+//expired or has already been used
+var ErrInvalidCode = errors.New("invalid two-factor code")
+
+//secretEncoding is how secrets are encoded for users to type in or
+//scan; authenticator apps expect base32 without padding
+var secretEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+//GenerateSecret returns a new random secret, base32 encoded
+func GenerateSecret() (string, error) {
+	secret := make([]byte, secretBytes)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("error generating secret: %v", err)
+	}
+	return secretEncoding.EncodeToString(secret), nil
+}
+
+//Code returns the code for the secret at time `t`
+func Code(secret string, t time.Time) (string, error) {
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return hotp(key, step(t)), nil
+}
+
+//Validate checks `code` against the codes for the secret within Skew
+//periods of time `t`. Codes for periods up to and including `lastStep`
+//have already been used, so they are rejected to stop replays. It returns
+//the period the code was for, which should be stored as the new lastStep,
+//or ErrInvalidCode if the code doesn't match.
+func Validate(secret string, code string, t time.Time, lastStep int64) (int64, error) {
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return 0, err
+	}
+	code = strings.Join(strings.Fields(code), "")
+	if len(code) != Digits {
+		return 0, ErrInvalidCode
+	}
+	current := step(t)
+	for s := current - Skew; s <= current+Skew; s++ {
+		if s <= lastStep {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(hotp(key, s)), []byte(code)) == 1 {
+			return s, nil
+		}
+	}
+	return 0, ErrInvalidCode
+}
+
+//KeyURI returns the otpauth:// URI for the secret, which authenticator
+//apps read from a QR code. `issuer` names the service and `account`
+//names the user's account with it.
+//See https://github.com/google/google-authenticator/wiki/Key-Uri-Format
+func KeyURI(issuer string, account string, secret string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(Digits))
+	query.Set("period", fmt.Sprint(int(Period/time.Second)))
+	u := &url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: query.Encode(),
+	}
+	return u.String()
+}
+
+//step returns the number of the period time `t` falls in
+func step(t time.Time) int64 {
+	return t.Unix() / int64(Period/time.Second)
+}
+
+//decodeSecret decodes a base32 secret, ignoring case and spaces
+func decodeSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.Join(strings.Fields(secret), ""))
+	key, err := secretEncoding.DecodeString(strings.TrimRight(secret, "="))
+	if err != nil {
+		return nil, fmt.Errorf("invalid two-factor secret: %v", err)
+	}
+	return key, nil
+}
+
+//hotp computes the HOTP value (RFC 4226) of the key for the counter `s`
+func hotp(key []byte, s int64) string {
+	counter := make([]byte, 8)
+	binary.BigEndian.PutUint64(counter, uint64(s))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter)
+	sum := mac.Sum(nil)
+	//dynamic truncation
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	modulus := uint32(1)
+	for i := 0; i < Digits; i++ {
+		modulus *= 10
+	}
+	return fmt.Sprintf("%0*d", Digits, value%modulus)
+}
@@ -0,0 +1,135 @@
+package twofactor
+
+import (
+	"bytes"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+)
+
+//rfcSecret is the SHA-1 secret from the RFC 6238 test vectors,
+//"12345678901234567890", base32 encoded
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode(t *testing.T) {
+	//the last 6 digits of the RFC 6238 appendix B test vectors
+	cases := []struct {
+		unix     int64
+		expected string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, c := range cases {
+		code, err := Code(rfcSecret, time.Unix(c.unix, 0))
+		if err != nil {
+			t.Fatalf("unexpected error generating code: %v", err)
+		}
+		if code != c.expected {
+			t.Errorf("incorrect code at %d: expected %s but got %s", c.unix, c.expected, code)
+		}
+	}
+	if _, err := Code("not base32!", time.Now()); err == nil {
+		t.Errorf("expected an error for an invalid secret")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := step(now)
+	codeAt := func(t time.Time) string {
+		code, _ := Code(rfcSecret, t)
+		return code
+	}
+
+	cases := []struct {
+		name         string
+		hint         string
+		code         string
+		lastStep     int64
+		expectedStep int64
+	}{
+		{"Current", "Accept the code for the current period", codeAt(now), 0, current},
+		{"Spaces", "Ignore spaces in the code", "050 471", 0, current},
+		{"Previous Period", "Allow for clock drift of one period", codeAt(now.Add(-Period)), 0, current - 1},
+		{"Next Period", "Allow for clock drift of one period", codeAt(now.Add(Period)), 0, current + 1},
+		{"Expired", "Reject codes from more than one period ago", codeAt(now.Add(-2 * Period)), 0, -1},
+		{"Wrong", "Reject codes that don't match", "123456", 0, -1},
+		{"Too Short", "Reject codes with the wrong number of digits", "05047", 0, -1},
+		{"Replayed", "Reject codes for periods that have already been used", codeAt(now), current, -1},
+		{"After Last Used", "Accept codes for periods after the last one used", codeAt(now.Add(Period)), current, current + 1},
+	}
+	for _, c := range cases {
+		s, err := Validate(rfcSecret, c.code, now, c.lastStep)
+		if c.expectedStep < 0 {
+			if !errors.Is(err, ErrInvalidCode) {
+				t.Errorf("case %s: expected %v but got %v\nHINT: %s", c.name, ErrInvalidCode, err, c.hint)
+			}
+			continue
+		}
+		if err != nil || s != c.expectedStep {
+			t.Errorf("case %s: expected step %d but got %d, %v\nHINT: %s", c.name, c.expectedStep, s, err, c.hint)
+		}
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("unexpected error generating secret: %v", err)
+	}
+	key, err := decodeSecret(secret)
+	if err != nil || len(key) != secretBytes {
+		t.Errorf("expected a %d byte base32 secret but got %q: %v", secretBytes, secret, err)
+	}
+	if other, _ := GenerateSecret(); other == secret {
+		t.Errorf("generated the same secret twice")
+	}
+}
+
+func TestKeyURI(t *testing.T) {
+	uri, err := url.Parse(KeyURI("JobTracker", "neo@matrix.net", rfcSecret))
+	if err != nil {
+		t.Fatalf("unexpected error parsing URI: %v", err)
+	}
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/JobTracker:neo@matrix.net" {
+		t.Errorf("incorrect URI: %s", uri)
+	}
+	query := uri.Query()
+	expected := map[string]string{"secret": rfcSecret, "issuer": "JobTracker", "algorithm": "SHA1", "digits": "6", "period": "30"}
+	for key, value := range expected {
+		if query.Get(key) != value {
+			t.Errorf("incorrect %s in URI: expected %q but got %q", key, value, query.Get(key))
+		}
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, hashes, err := GenerateRecoveryCodes()
+	if err != nil {
+		t.Fatalf("unexpected error generating recovery codes: %v", err)
+	}
+	if len(codes) != RecoveryCodeCount || len(hashes) != RecoveryCodeCount {
+		t.Fatalf("expected %d recovery codes but got %d codes and %d hashes", RecoveryCodeCount, len(codes), len(hashes))
+	}
+	seen := map[string]bool{}
+	for i, code := range codes {
+		if seen[code] {
+			t.Errorf("recovery code %s was generated twice", code)
+		}
+		seen[code] = true
+		if !bytes.Equal(HashRecoveryCode(code), hashes[i]) {
+			t.Errorf("hash of %s doesn't match its stored hash", code)
+		}
+	}
+
+	//users may type codes without the dash, in capitals or with spaces
+	if !bytes.Equal(HashRecoveryCode("abcde-fghij"), HashRecoveryCode(" ABCDE FGHIJ ")) {
+		t.Errorf("recovery code hashes should ignore case, spaces and dashes")
+	}
+}
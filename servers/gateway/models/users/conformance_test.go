@@ -0,0 +1,35 @@
+package users_test
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+
+	"JobTracker/servers/gateway/models/users"
+	"JobTracker/servers/gateway/models/users/storetest"
+)
+
+/*
+TestPostgresStoreConformance runs the storetest suite against
+a real postgres database. Set the POSTGRESDSN environment variable to
+a data source name to run it; it is skipped otherwise.
+*/
+func TestPostgresStoreConformance(t *testing.T) {
+	dsn := os.Getenv("POSTGRESDSN")
+	if len(dsn) == 0 {
+		t.Skip("set POSTGRESDSN to run against a postgres database")
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("There was a problem opening a database connection: [%v]", err)
+	}
+	defer db.Close()
+
+	storetest.Run(t, func(t *testing.T) users.Store {
+		store, err := users.NewPostgresStore(db)
+		if err != nil {
+			t.Fatalf("unexpected error creating store: %v", err)
+		}
+		return store
+	})
+}
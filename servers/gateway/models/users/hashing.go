@@ -0,0 +1,216 @@
+package users
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+//ErrPasswordMismatch is returned when a password doesn't match a hash
+var ErrPasswordMismatch = errors.New("the password does not match")
+
+//ErrUnknownHashAlgorithm is returned when a stored hash was
+//made by an algorithm that no PasswordHasher recognizes
+var ErrUnknownHashAlgorithm = errors.New("unknown password hash algorithm")
+
+//PasswordHasher hashes passwords with one algorithm and set of
+//parameters. Hashes record their algorithm and parameters, so
+//they can be verified after the parameters change.
+type PasswordHasher interface {
+	//Hash returns the encoded hash of the password
+	Hash(password string) ([]byte, error)
+	//Recognizes returns true if the hash was made by the hasher's algorithm
+	Recognizes(hash []byte) bool
+	//Verify returns nil if the password matches the hash,
+	//or ErrPasswordMismatch if it doesn't. The hash's own
+	//parameters are used, not the hasher's.
+	Verify(hash []byte, password string) error
+	//Current returns true if the hash was made with the hasher's parameters
+	Current(hash []byte) bool
+}
+
+//DefaultHasher hashes new passwords when no hasher is given.
+//Passwords hashed by any algorithm in hashers can still be verified,
+//and are rehashed when NeedsRehash reports they are outdated.
+var DefaultHasher PasswordHasher = &Argon2idHasher{
+	Time:       2,
+	Memory:     19 * 1024,
+	Threads:    1,
+	KeyLength:  32,
+	SaltLength: 16,
+}
+
+//hashers are the algorithms stored hashes are verified with
+var hashers = []PasswordHasher{&BcryptHasher{}, &Argon2idHasher{}}
+
+//VerifyPassword returns nil if the password matches the hash,
+//whichever algorithm it was made by
+func VerifyPassword(hash []byte, password string) error {
+	for _, h := range hashers {
+		if h.Recognizes(hash) {
+			return h.Verify(hash, password)
+		}
+	}
+	return ErrUnknownHashAlgorithm
+}
+
+//NeedsRehash returns true if the hash wasn't made by `hasher`'s
+//algorithm with its current parameters. A nil hasher means DefaultHasher.
+func NeedsRehash(hasher PasswordHasher, hash []byte) bool {
+	if hasher == nil {
+		hasher = DefaultHasher
+	}
+	return !hasher.Recognizes(hash) || !hasher.Current(hash)
+}
+
+//timingPadPassword is the password timing pad hashes are made of.
+//Nothing depends on it being secret, since matching it proves nothing.
+const timingPadPassword = "timing pad"
+
+//NewTimingPadHash returns a hash made by `hasher` to verify passwords
+//against when there is no stored hash to verify them against, such as
+//when signing in with an email that has no account, so that takes as
+//long as verifying a stored hash made the same way
+func NewTimingPadHash(hasher PasswordHasher) ([]byte, error) {
+	return hasher.Hash(timingPadPassword)
+}
+
+//BcryptHasher hashes passwords with bcrypt
+type BcryptHasher struct {
+	Cost int
+}
+
+//Hash returns the bcrypt hash of the password
+func (bh *BcryptHasher) Hash(password string) ([]byte, error) {
+	return bcrypt.GenerateFromPassword([]byte(password), bh.Cost)
+}
+
+//Recognizes returns true for the $2a$, $2b$ and $2y$ bcrypt variants
+func (bh *BcryptHasher) Recognizes(hash []byte) bool {
+	return bytes.HasPrefix(hash, []byte("$2a$")) ||
+		bytes.HasPrefix(hash, []byte("$2b$")) ||
+		bytes.HasPrefix(hash, []byte("$2y$"))
+}
+
+//Verify returns nil if the password matches the bcrypt hash
+func (bh *BcryptHasher) Verify(hash []byte, password string) error {
+	err := bcrypt.CompareHashAndPassword(hash, []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return ErrPasswordMismatch
+	}
+	return err
+}
+
+//Current returns true if the hash was made with the hasher's cost
+func (bh *BcryptHasher) Current(hash []byte) bool {
+	cost, err := bcrypt.Cost(hash)
+	return err == nil && cost == bh.Cost
+}
+
+//Argon2idHasher hashes passwords with Argon2id, encoding
+//them in the PHC string format used by the reference
+//implementation: $argon2id$v=19$m=<memory>,t=<time>,p=<threads>$<salt>$<key>
+type Argon2idHasher struct {
+	//Time is the number of passes over the memory
+	Time uint32
+	//Memory is the memory used, in KiB
+	Memory uint32
+	//Threads is the degree of parallelism
+	Threads uint8
+	//KeyLength is the length of the derived key, in bytes
+	KeyLength uint32
+	//SaltLength is the length of the random salt, in bytes
+	SaltLength uint32
+}
+
+//argon2idPrefix starts every Argon2id hash
+const argon2idPrefix = "$argon2id$"
+
+//argon2idHash is a decoded Argon2id hash
+type argon2idHash struct {
+	params Argon2idHasher
+	salt   []byte
+	key    []byte
+}
+
+//Hash returns the Argon2id hash of the password with a random salt
+func (ah *Argon2idHasher) Hash(password string) ([]byte, error) {
+	salt := make([]byte, ah.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("error generating salt: %v", err)
+	}
+	key := argon2.IDKey([]byte(password), salt, ah.Time, ah.Memory, ah.Threads, ah.KeyLength)
+	encoded := fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2idPrefix, argon2.Version,
+		ah.Memory, ah.Time, ah.Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+	return []byte(encoded), nil
+}
+
+//Recognizes returns true for Argon2id hashes
+func (ah *Argon2idHasher) Recognizes(hash []byte) bool {
+	return bytes.HasPrefix(hash, []byte(argon2idPrefix))
+}
+
+//Verify returns nil if the password matches the Argon2id hash
+func (ah *Argon2idHasher) Verify(hash []byte, password string) error {
+	decoded, err := decodeArgon2id(hash)
+	if err != nil {
+		return err
+	}
+	p := decoded.params
+	key := argon2.IDKey([]byte(password), decoded.salt, p.Time, p.Memory, p.Threads, p.KeyLength)
+	if subtle.ConstantTimeCompare(key, decoded.key) != 1 {
+		return ErrPasswordMismatch
+	}
+	return nil
+}
+
+//Current returns true if the hash was made with the hasher's parameters
+func (ah *Argon2idHasher) Current(hash []byte) bool {
+	decoded, err := decodeArgon2id(hash)
+	return err == nil && decoded.params == *ah
+}
+
+//decodeArgon2id decodes an Argon2id hash in the PHC string format
+func decodeArgon2id(hash []byte) (*argon2idHash, error) {
+	//the leading $ gives an empty first part
+	parts := strings.Split(string(hash), "$")
+	if len(parts) != 6 || "$"+parts[1]+"$" != argon2idPrefix {
+		return nil, fmt.Errorf("invalid argon2id hash")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return nil, fmt.Errorf("invalid argon2id hash version: %v", err)
+	}
+	if version != argon2.Version {
+		return nil, fmt.Errorf("unsupported argon2id version %d", version)
+	}
+	decoded := &argon2idHash{}
+	p := &decoded.params
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Time, &p.Threads); err != nil {
+		return nil, fmt.Errorf("invalid argon2id hash parameters: %v", err)
+	}
+	if p.Time == 0 || p.Threads == 0 {
+		return nil, fmt.Errorf("invalid argon2id hash parameters")
+	}
+	var err error
+	if decoded.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, fmt.Errorf("invalid argon2id hash salt: %v", err)
+	}
+	if decoded.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return nil, fmt.Errorf("invalid argon2id hash key: %v", err)
+	}
+	if len(decoded.key) == 0 {
+		return nil, fmt.Errorf("invalid argon2id hash key")
+	}
+	p.SaltLength = uint32(len(decoded.salt))
+	p.KeyLength = uint32(len(decoded.key))
+	return decoded, nil
+}
@@ -0,0 +1,107 @@
+package users
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+//testArgon2id is a cheap Argon2idHasher for tests
+var testArgon2id = &Argon2idHasher{Time: 1, Memory: 1024, Threads: 1, KeyLength: 32, SaltLength: 16}
+
+func TestPasswordHashers(t *testing.T) {
+	cases := []struct {
+		name   string
+		hasher PasswordHasher
+		prefix string
+	}{
+		{"Bcrypt", &BcryptHasher{Cost: bcrypt.MinCost}, "$2a$04$"},
+		{"Argon2id", testArgon2id, "$argon2id$v=19$m=1024,t=1,p=1$"},
+	}
+	for _, c := range cases {
+		hash, err := c.hasher.Hash("bingo!")
+		if err != nil {
+			t.Fatalf("case %s: unexpected error hashing: %v", c.name, err)
+		}
+		if !strings.HasPrefix(string(hash), c.prefix) {
+			t.Errorf("case %s: hash %s doesn't start with %s", c.name, hash, c.prefix)
+		}
+		if !c.hasher.Recognizes(hash) || !c.hasher.Current(hash) {
+			t.Errorf("case %s: hasher doesn't recognize its own hash as current", c.name)
+		}
+		if err := VerifyPassword(hash, "bingo!"); err != nil {
+			t.Errorf("case %s: unexpected error verifying the correct password: %v", c.name, err)
+		}
+		if err := VerifyPassword(hash, "bingo?"); !errors.Is(err, ErrPasswordMismatch) {
+			t.Errorf("case %s: incorrect error for a wrong password: expected %v but got %v", c.name, ErrPasswordMismatch, err)
+		}
+		if other, _ := c.hasher.Hash("bingo!"); string(other) == string(hash) {
+			t.Errorf("case %s: hashing the same password twice gave the same hash", c.name)
+		}
+	}
+}
+
+func TestVerifyPasswordInvalidHashes(t *testing.T) {
+	cases := []struct {
+		name string
+		hash string
+	}{
+		{"Empty", ""},
+		{"Unknown Algorithm", "$scrypt$ln=15,r=8,p=1$c2FsdA$a2V5"},
+		{"Truncated Argon2id", "$argon2id$v=19$m=1024,t=1,p=1$c2FsdHNhbHQ"},
+		{"Wrong Argon2id Version", "$argon2id$v=16$m=1024,t=1,p=1$c2FsdHNhbHQ$a2V5a2V5"},
+		{"Bad Argon2id Parameters", "$argon2id$v=19$m=1024,t=0,p=1$c2FsdHNhbHQ$a2V5a2V5"},
+		{"Bad Argon2id Salt", "$argon2id$v=19$m=1024,t=1,p=1$!!!$a2V5a2V5"},
+		{"Empty Argon2id Key", "$argon2id$v=19$m=1024,t=1,p=1$c2FsdHNhbHQ$"},
+	}
+	for _, c := range cases {
+		err := VerifyPassword([]byte(c.hash), "bingo!")
+		if err == nil || errors.Is(err, ErrPasswordMismatch) {
+			t.Errorf("case %s: expected an invalid hash error but got %v", c.name, err)
+		}
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	current, _ := testArgon2id.Hash("bingo!")
+	weaker := *testArgon2id
+	weaker.Memory = 512
+	outdated, _ := weaker.Hash("bingo!")
+	bcryptHash, _ := (&BcryptHasher{Cost: bcrypt.MinCost}).Hash("bingo!")
+
+	cases := []struct {
+		name     string
+		hash     []byte
+		expected bool
+	}{
+		{"Current", current, false},
+		{"Outdated Parameters", outdated, true},
+		{"Other Algorithm", bcryptHash, true},
+	}
+	for _, c := range cases {
+		if result := NeedsRehash(testArgon2id, c.hash); result != c.expected {
+			t.Errorf("case %s: expected NeedsRehash to be %t but got %t", c.name, c.expected, result)
+		}
+	}
+
+	//a different bcrypt cost is outdated too
+	if !NeedsRehash(&BcryptHasher{Cost: bcrypt.MinCost + 1}, bcryptHash) {
+		t.Errorf("a bcrypt hash with a different cost should need rehashing")
+	}
+}
+
+func TestNewTimingPadHash(t *testing.T) {
+	padHash, err := NewTimingPadHash(&BcryptHasher{Cost: bcrypt.MinCost})
+	if err != nil {
+		t.Fatalf("unexpected error making timing pad hash: %v", err)
+	}
+	//verifying against the pad hash costs as much as a stored hash like it
+	if cost, err := bcrypt.Cost(padHash); err != nil || cost != bcrypt.MinCost {
+		t.Errorf("the pad hash should be made by the hasher given: cost %d, %v", cost, err)
+	}
+	if err := VerifyPassword(padHash, "bingo!"); !errors.Is(err, ErrPasswordMismatch) {
+		t.Errorf("expected ErrPasswordMismatch but got %v", err)
+	}
+}
@@ -0,0 +1,270 @@
+package users
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//MemStore represents a users.Store kept in process memory.
+//It enforces the same rules as the database (unique emails and
+//usernames, assigned IDs), so it can stand in for Postgres in
+//tests and when developing the gateway locally. Like the database,
+//it fails calls whose context is already done. Data is lost
+//when the process exits.
+type MemStore struct {
+	mx      sync.RWMutex
+	users   map[int64]*User
+	signIns []*UserSignIn
+	lastID  int64
+	lastSID int64
+}
+
+//NewMemStore constructs and returns a new, empty MemStore
+func NewMemStore() *MemStore {
+	return &MemStore{
+		users: map[int64]*User{},
+	}
+}
+
+//users.Store implementation
+
+//GetByID returns the User with the given ID
+func (ms *MemStore) GetByID(ctx context.Context, id int64) (*User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	ms.mx.RLock()
+	defer ms.mx.RUnlock()
+	u, found := ms.users[id]
+	if !found {
+		return nil, ErrUserNotFound
+	}
+	return copyUser(u), nil
+}
+
+//GetByEmail returns the User with the given email
+func (ms *MemStore) GetByEmail(ctx context.Context, email string) (*User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	email = strings.TrimSpace(email)
+	return ms.find(func(u *User) bool { return u.Email == email })
+}
+
+//GetByUserName returns the User with the given Username
+func (ms *MemStore) GetByUserName(ctx context.Context, username string) (*User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return ms.find(func(u *User) bool { return u.UserName == username })
+}
+
+//Insert inserts the user into the store, and returns
+//the newly-inserted User, complete with an assigned ID
+func (ms *MemStore) Insert(ctx context.Context, user *User) (*User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	for _, u := range ms.users {
+		if u.Email == user.Email {
+			return nil, ErrDuplicateEmail
+		}
+		if u.UserName == user.UserName {
+			return nil, ErrDuplicateUserName
+		}
+	}
+	user.initDefaults()
+	ms.lastID++
+	user.ID = ms.lastID
+	ms.users[user.ID] = copyUser(user)
+	return user, nil
+}
+
+//Update applies UserUpdates to the given user ID
+//and returns the newly-updated user
+func (ms *MemStore) Update(ctx context.Context, id int64, updates *Updates) (*User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	u, found := ms.users[id]
+	if !found {
+		return nil, ErrUserNotFound
+	}
+	updated := copyUser(u)
+	if err := updated.ApplyUpdates(updates); err != nil {
+		return nil, err
+	}
+	for _, other := range ms.users {
+		if other.ID != id && other.UserName == updated.UserName {
+			return nil, ErrDuplicateUserName
+		}
+	}
+	ms.users[id] = updated
+	return copyUser(updated), nil
+}
+
+//UpdatePhotoURL sets the photo URL of the user with the given ID
+//and returns the newly-updated user
+func (ms *MemStore) UpdatePhotoURL(ctx context.Context, id int64, photoURL string) (*User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	u, found := ms.users[id]
+	if !found {
+		return nil, ErrUserNotFound
+	}
+	u.PhotoURL = photoURL
+	return copyUser(u), nil
+}
+
+//UpdatePassHash replaces the password hash of the user with the given ID
+func (ms *MemStore) UpdatePassHash(ctx context.Context, id int64, passHash []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	u, found := ms.users[id]
+	if !found {
+		return ErrUserNotFound
+	}
+	u.PassHash = append([]byte(nil), passHash...)
+	return nil
+}
+
+//Delete deletes the user with the given ID
+func (ms *MemStore) Delete(ctx context.Context, id int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	delete(ms.users, id)
+	return nil
+}
+
+//LogSignIn logs a new sign-in by a user
+func (ms *MemStore) LogSignIn(ctx context.Context, signin *UserSignIn) (*UserSignIn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	ms.lastSID++
+	si := *signin
+	si.ID = ms.lastSID
+	ms.signIns = append(ms.signIns, &si)
+	logged := si
+	return &logged, nil
+}
+
+//List returns up to `limit` users with IDs greater than `afterID`, in order of ID
+func (ms *MemStore) List(ctx context.Context, afterID int64, limit int) ([]*User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	ms.mx.RLock()
+	defer ms.mx.RUnlock()
+	listed := []*User{}
+	for _, u := range ms.users {
+		if u.ID > afterID {
+			listed = append(listed, copyUser(u))
+		}
+	}
+	sort.Slice(listed, func(i, j int) bool { return listed[i].ID < listed[j].ID })
+	if len(listed) > limit {
+		listed = listed[:limit]
+	}
+	return listed, nil
+}
+
+//UpdateAccount changes the role and disabled status of the user
+//with the given ID together, and returns the newly-updated user
+func (ms *MemStore) UpdateAccount(ctx context.Context, id int64, updates *AccountUpdates) (*User, error) {
+	return ms.modify(ctx, id, func(u *User) {
+		if updates.Role != nil {
+			u.Role = *updates.Role
+		}
+		if updates.Disabled != nil {
+			u.Disabled = *updates.Disabled
+		}
+	})
+}
+
+//SignOut ends every session the user with the given ID began before `at`
+func (ms *MemStore) SignOut(ctx context.Context, id int64, at time.Time) error {
+	_, err := ms.modify(ctx, id, func(u *User) { u.SignedOutAt = &at })
+	return err
+}
+
+//GetSignIns returns up to `limit` of the user's sign-ins, newest
+//first, with IDs less than `beforeID`, or the newest if it is 0
+func (ms *MemStore) GetSignIns(ctx context.Context, userID int64, beforeID int64, limit int) ([]*UserSignIn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	ms.mx.RLock()
+	defer ms.mx.RUnlock()
+	signIns := []*UserSignIn{}
+	for i := len(ms.signIns) - 1; i >= 0 && len(signIns) < limit; i-- {
+		si := ms.signIns[i]
+		if si.UserID == userID && (beforeID == 0 || si.ID < beforeID) {
+			copied := *si
+			signIns = append(signIns, &copied)
+		}
+	}
+	return signIns, nil
+}
+
+//modify applies `change` to the user with the given ID
+//and returns the newly-updated user
+func (ms *MemStore) modify(ctx context.Context, id int64, change func(u *User)) (*User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	u, found := ms.users[id]
+	if !found {
+		return nil, ErrUserNotFound
+	}
+	change(u)
+	return copyUser(u), nil
+}
+
+//find returns the first user matching `match`
+func (ms *MemStore) find(match func(u *User) bool) (*User, error) {
+	ms.mx.RLock()
+	defer ms.mx.RUnlock()
+	for _, u := range ms.users {
+		if match(u) {
+			return copyUser(u), nil
+		}
+	}
+	return nil, ErrUserNotFound
+}
+
+//copyUser returns a copy of `u` that shares no memory with it,
+//so callers can't modify the stored user
+func copyUser(u *User) *User {
+	c := *u
+	c.PassHash = append([]byte(nil), u.PassHash...)
+	c.TargetRoles = append([]string{}, u.TargetRoles...)
+	c.Majors = append([]string{}, u.Majors...)
+	c.TargetJobTypes = append([]string{}, u.TargetJobTypes...)
+	c.TargetSeasons = append([]string{}, u.TargetSeasons...)
+	if u.SignedOutAt != nil {
+		signedOutAt := *u.SignedOutAt
+		c.SignedOutAt = &signedOutAt
+	}
+	return &c
+}
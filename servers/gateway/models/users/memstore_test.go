@@ -0,0 +1,61 @@
+package users_test
+
+import (
+	"context"
+	"testing"
+
+	"JobTracker/servers/gateway/models/users"
+	"JobTracker/servers/gateway/models/users/storetest"
+)
+
+func TestMemStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) users.Store {
+		return users.NewMemStore()
+	})
+}
+
+func TestMemStoreUniqueness(t *testing.T) {
+	store := users.NewMemStore()
+	existing, err := store.Insert(context.Background(), &users.User{Email: "test@test.com", UserName: "test"})
+	if err != nil {
+		t.Fatalf("unexpected error inserting user: %v", err)
+	}
+
+	cases := []struct {
+		name        string
+		user        *users.User
+		expectedErr error
+	}{
+		{
+			"Duplicate email",
+			&users.User{Email: "test@test.com", UserName: "other"},
+			users.ErrDuplicateEmail,
+		},
+		{
+			"Duplicate username",
+			&users.User{Email: "other@test.com", UserName: "test"},
+			users.ErrDuplicateUserName,
+		},
+		{
+			"Unique email and username",
+			&users.User{Email: "other@test.com", UserName: "other"},
+			nil,
+		},
+	}
+	for _, c := range cases {
+		_, err := store.Insert(context.Background(), c.user)
+		if err != c.expectedErr {
+			t.Errorf("case %s: expected error %v but got %v", c.name, c.expectedErr, err)
+		}
+	}
+
+	//changing a returned user doesn't change the stored one
+	u, err := store.GetByID(context.Background(), existing.ID)
+	if err != nil {
+		t.Fatalf("unexpected error getting user: %v", err)
+	}
+	u.FirstName = "Changed"
+	if u, _ := store.GetByID(context.Background(), existing.ID); u.FirstName == "Changed" {
+		t.Error("modifying a returned user modified the stored user")
+	}
+}
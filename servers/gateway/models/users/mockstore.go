@@ -1,6 +1,10 @@
 package users
 
-import "errors"
+import (
+	"context"
+	"errors"
+	"time"
+)
 
 type MockStore struct {
 	expectedError bool
@@ -16,35 +20,50 @@ func NewMockStore(err bool, user *User, signin *UserSignIn) *MockStore {
 	}
 }
 
-func (m *MockStore) GetByID(id int64) (*User, error) {
+func (m *MockStore) GetByID(ctx context.Context, id int64) (*User, error) {
 	if m.expectedError {
 		return nil, errors.New("got error")
 	}
+	if m.User == nil {
+		return nil, ErrUserNotFound
+	}
 	return m.User, nil
 }
 
-func (m *MockStore) GetByEmail(email string) (*User, error) {
+func (m *MockStore) GetByEmail(ctx context.Context, email string) (*User, error) {
 	if m.expectedError {
 		return nil, errors.New("got error")
 	}
+	if m.User == nil {
+		return nil, ErrUserNotFound
+	}
 	return m.User, nil
 }
 
-func (m *MockStore) GetByUserName(username string) (*User, error) {
+func (m *MockStore) GetByUserName(ctx context.Context, username string) (*User, error) {
 	if m.expectedError {
 		return nil, errors.New("got error")
 	}
+	if m.User == nil {
+		return nil, ErrUserNotFound
+	}
 	return m.User, nil
 }
 
-func (m *MockStore) Insert(user *User) (*User, error) {
+func (m *MockStore) Insert(ctx context.Context, user *User) (*User, error) {
 	if m.expectedError {
 		return nil, errors.New("got error")
 	}
+	if m.User != nil && m.User.Email == user.Email {
+		return nil, ErrDuplicateEmail
+	}
+	if m.User != nil && m.User.UserName == user.UserName {
+		return nil, ErrDuplicateUserName
+	}
 	return m.User, nil
 }
 
-func (m *MockStore) Update(id int64, updates *Updates) (*User, error) {
+func (m *MockStore) Update(ctx context.Context, id int64, updates *Updates) (*User, error) {
 	if m.expectedError {
 		return nil, errors.New("got error")
 	}
@@ -55,16 +74,85 @@ func (m *MockStore) Update(id int64, updates *Updates) (*User, error) {
 	return m.User, nil
 }
 
-func (m *MockStore) Delete(id int64) error {
+func (m *MockStore) UpdatePhotoURL(ctx context.Context, id int64, photoURL string) (*User, error) {
+	if m.expectedError {
+		return nil, errors.New("got error")
+	}
+	if m.User == nil {
+		return nil, ErrUserNotFound
+	}
+	m.User.PhotoURL = photoURL
+	return m.User, nil
+}
+
+func (m *MockStore) UpdatePassHash(ctx context.Context, id int64, passHash []byte) error {
+	if m.expectedError {
+		return errors.New("got error")
+	}
+	if m.User == nil {
+		return ErrUserNotFound
+	}
+	m.User.PassHash = passHash
+	return nil
+}
+
+func (m *MockStore) Delete(ctx context.Context, id int64) error {
 	if m.expectedError {
 		return errors.New("got error")
 	}
 	return nil
 }
 
-func (m *MockStore) LogSignIn(signin *UserSignIn) (*UserSignIn, error) {
+func (m *MockStore) LogSignIn(ctx context.Context, signin *UserSignIn) (*UserSignIn, error) {
 	if m.expectedError {
 		return nil, errors.New("got error")
 	}
 	return m.UserSignIn, nil
 }
+
+func (m *MockStore) List(ctx context.Context, afterID int64, limit int) ([]*User, error) {
+	if m.expectedError {
+		return nil, errors.New("got error")
+	}
+	if m.User == nil || m.User.ID <= afterID || limit == 0 {
+		return []*User{}, nil
+	}
+	return []*User{m.User}, nil
+}
+
+func (m *MockStore) UpdateAccount(ctx context.Context, id int64, updates *AccountUpdates) (*User, error) {
+	if m.expectedError {
+		return nil, errors.New("got error")
+	}
+	if m.User == nil {
+		return nil, ErrUserNotFound
+	}
+	if updates.Role != nil {
+		m.User.Role = *updates.Role
+	}
+	if updates.Disabled != nil {
+		m.User.Disabled = *updates.Disabled
+	}
+	return m.User, nil
+}
+
+func (m *MockStore) SignOut(ctx context.Context, id int64, at time.Time) error {
+	if m.expectedError {
+		return errors.New("got error")
+	}
+	if m.User == nil {
+		return ErrUserNotFound
+	}
+	m.User.SignedOutAt = &at
+	return nil
+}
+
+func (m *MockStore) GetSignIns(ctx context.Context, userID int64, beforeID int64, limit int) ([]*UserSignIn, error) {
+	if m.expectedError {
+		return nil, errors.New("got error")
+	}
+	if m.UserSignIn == nil {
+		return []*UserSignIn{}, nil
+	}
+	return []*UserSignIn{m.UserSignIn}, nil
+}
@@ -0,0 +1,204 @@
+package users
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+//maxBcryptPasswordBytes is the most bytes of a password bcrypt uses;
+//any bytes after the first 72 are ignored
+const maxBcryptPasswordBytes = 72
+
+//minPersonalInfoLength is the shortest username or email name
+//that passwords are checked for, since very short ones would
+//rule out too many passwords by chance
+const minPersonalInfoLength = 3
+
+//ErrPasswordCheckFailed is returned when a password couldn't
+//be checked against a policy, such as when its breached
+//password list can't be read
+var ErrPasswordCheckFailed = errors.New("the password could not be checked")
+
+//PasswordPolicy describes the passwords users may choose
+type PasswordPolicy struct {
+	//MinLength is the fewest characters a password may have
+	MinLength int
+	//MaxLength is the most bytes a password may have. It can't
+	//be more than 72, since bcrypt ignores any bytes after that.
+	MaxLength int
+	//RequiredClasses is how many of the character classes (lowercase
+	//letters, uppercase letters, digits and symbols) a password must use
+	RequiredClasses int
+	//AllowPersonalInfo allows passwords containing the user's
+	//username or the name part of their email address
+	AllowPersonalInfo bool
+	//Breached optionally checks whether a password has appeared
+	//in a data breach. Breached passwords are rejected.
+	Breached BreachChecker
+}
+
+//DefaultPasswordPolicy is the policy used when none is configured
+var DefaultPasswordPolicy = &PasswordPolicy{
+	MinLength:       8,
+	MaxLength:       maxBcryptPasswordBytes,
+	RequiredClasses: 2,
+}
+
+//PasswordChange represents a signed-in user changing their password
+type PasswordChange struct {
+	CurrentPassword string `json:"currentPassword"`
+	Password        string `json:"password"`
+	PasswordConf    string `json:"passwordConf"`
+}
+
+//PasswordReset represents a user choosing a new password
+//with the reset token an admin issued them
+type PasswordReset struct {
+	Token        string `json:"token"`
+	Password     string `json:"password"`
+	PasswordConf string `json:"passwordConf"`
+}
+
+//BreachChecker checks whether a password has appeared in a data breach
+type BreachChecker interface {
+	IsBreached(password string) (bool, error)
+}
+
+//Check checks the password chosen by the user with the given username
+//and email against the policy. It returns ValidationErrors for the
+//"password" field with a reason for each rule the password breaks,
+//or nil if it follows them all, or ErrPasswordCheckFailed if the password
+//couldn't be checked. A nil policy checks against DefaultPasswordPolicy.
+func (pp *PasswordPolicy) Check(password string, userName string, email string) error {
+	if pp == nil {
+		pp = DefaultPasswordPolicy
+	}
+	errs := ValidationErrors{}
+	add := func(format string, args ...interface{}) {
+		errs = append(errs, &FieldError{Field: "password", Message: fmt.Sprintf(format, args...)})
+	}
+
+	if utf8.RuneCountInString(password) < pp.MinLength {
+		add("must be at least %d characters", pp.MinLength)
+	}
+	maxLength := pp.MaxLength
+	if maxLength <= 0 || maxLength > maxBcryptPasswordBytes {
+		maxLength = maxBcryptPasswordBytes
+	}
+	if len(password) > maxLength {
+		add("must be at most %d bytes; accented letters and emoji take more than one", maxLength)
+	}
+	if characterClasses(password) < pp.RequiredClasses {
+		add("must use at least %d of: lowercase letters, uppercase letters, digits and symbols", pp.RequiredClasses)
+	}
+	if !pp.AllowPersonalInfo {
+		lowerPassword := strings.ToLower(password)
+		if len(userName) >= minPersonalInfoLength && strings.Contains(lowerPassword, strings.ToLower(userName)) {
+			add("must not contain your username")
+		}
+		emailName := strings.ToLower(strings.TrimSpace(email))
+		if at := strings.LastIndex(emailName, "@"); at >= 0 {
+			emailName = emailName[:at]
+		}
+		if len(emailName) >= minPersonalInfoLength && strings.Contains(lowerPassword, emailName) {
+			add("must not contain your email address")
+		}
+	}
+	if pp.Breached != nil {
+		breached, err := pp.Breached.IsBreached(password)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrPasswordCheckFailed, err)
+		}
+		if breached {
+			add("has appeared in a data breach, so it's easy to guess; please choose another")
+		}
+	}
+
+	if len(errs) != 0 {
+		return errs
+	}
+	return nil
+}
+
+//characterClasses returns how many of the character classes the password uses
+func characterClasses(password string) int {
+	var lower, upper, digit, symbol int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+	return lower + upper + digit + symbol
+}
+
+//BreachedPasswordList is a BreachChecker backed by a local copy of a
+//k-anonymized breached password list, such as the Pwned Passwords list.
+//Passwords are looked up by the SHA-1 hash of the password: the directory
+//holds one file per 5 hex digit hash prefix, named <PREFIX>.txt, whose
+//lines are the rest of a hash and how often it was seen, as SUFFIX:COUNT.
+//Only the file for one prefix is read for each check.
+type BreachedPasswordList struct {
+	Dir string
+	//MinCount is how many times a password must have been
+	//seen in breaches to be rejected (default 1)
+	MinCount int
+}
+
+//NewBreachedPasswordList constructs a new BreachedPasswordList
+//for the list in `dir`, which must exist
+func NewBreachedPasswordList(dir string) (*BreachedPasswordList, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+	return &BreachedPasswordList{Dir: dir, MinCount: 1}, nil
+}
+
+//IsBreached returns true if the password's hash is in the list.
+//A missing prefix file means none of its hashes were breached.
+func (bl *BreachedPasswordList) IsBreached(password string) (bool, error) {
+	hash := strings.ToUpper(fmt.Sprintf("%x", sha1.Sum([]byte(password))))
+	prefix, suffix := hash[:5], hash[5:]
+
+	f, err := os.Open(filepath.Join(bl.Dir, prefix+".txt"))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		colon := strings.IndexByte(line, ':')
+		if colon < 0 || !strings.EqualFold(line[:colon], suffix) {
+			continue
+		}
+		count, err := strconv.Atoi(line[colon+1:])
+		if err != nil {
+			return false, fmt.Errorf("invalid count in %s.txt: %q", prefix, line)
+		}
+		return count >= bl.MinCount, nil
+	}
+	return false, scanner.Err()
+}
@@ -0,0 +1,131 @@
+package users
+
+import (
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+//writeBreachedList writes a breached password list holding
+//`passwords` with their counts to a temporary directory
+func writeBreachedList(t *testing.T, passwords map[string]int) string {
+	dir := t.TempDir()
+	files := map[string][]string{}
+	for password, count := range passwords {
+		hash := strings.ToUpper(fmt.Sprintf("%x", sha1.Sum([]byte(password))))
+		files[hash[:5]] = append(files[hash[:5]], fmt.Sprintf("%s:%d", hash[5:], count))
+	}
+	for prefix, lines := range files {
+		//other hashes sharing the prefix, like in the real list
+		lines = append([]string{strings.Repeat("0", 35) + ":7"}, lines...)
+		contents := strings.Join(lines, "\r\n") + "\r\n"
+		if err := os.WriteFile(filepath.Join(dir, prefix+".txt"), []byte(contents), 0644); err != nil {
+			t.Fatalf("error writing breached password list: %v", err)
+		}
+	}
+	return dir
+}
+
+func TestPasswordPolicyCheck(t *testing.T) {
+	breached, err := NewBreachedPasswordList(writeBreachedList(t, map[string]int{"Password1": 250000}))
+	if err != nil {
+		t.Fatalf("error creating breached password list: %v", err)
+	}
+	policy := &PasswordPolicy{
+		MinLength:       8,
+		MaxLength:       72,
+		RequiredClasses: 3,
+		Breached:        breached,
+	}
+
+	cases := []struct {
+		name            string
+		hint            string
+		password        string
+		expectedReasons int
+	}{
+		{"Valid", "Accept passwords that follow every rule", "correct-Horse-battery", 0},
+		{"Too Short", "Count characters, not bytes, for the minimum length", "Sh0rt!", 1},
+		{"Multibyte Characters", "Count characters, not bytes, for the minimum length", "ÉÉÉÉÉÉÉé1", 0},
+		{"Too Long", "Count bytes for the maximum length, since bcrypt does", "Aa1" + strings.Repeat("é", 35), 1},
+		{"Too Few Classes", "Require the configured number of character classes", "alllowercase1", 1},
+		{"Contains Username", "Reject passwords containing the username, ignoring case", "My-NEO-password", 1},
+		{"Contains Email Name", "Reject passwords containing the name part of the email", "Thomas.Anderson!99", 1},
+		{"Breached", "Reject passwords in the breached password list", "Password1", 1},
+		{"Every Rule", "Report every rule the password breaks", "neo", 3},
+	}
+	for _, c := range cases {
+		err := policy.Check(c.password, "neo", "thomas.anderson@matrix.net")
+		if c.expectedReasons == 0 {
+			if err != nil {
+				t.Errorf("case %s: unexpected error: %v\nHINT: %s", c.name, err, c.hint)
+			}
+			continue
+		}
+		var validationErrs ValidationErrors
+		if !errors.As(err, &validationErrs) {
+			t.Errorf("case %s: expected ValidationErrors but got %v\nHINT: %s", c.name, err, c.hint)
+			continue
+		}
+		if len(validationErrs) != c.expectedReasons {
+			t.Errorf("case %s: expected %d reasons but got %v\nHINT: %s", c.name, c.expectedReasons, validationErrs, c.hint)
+		}
+		for _, fe := range validationErrs {
+			if fe.Field != "password" {
+				t.Errorf("case %s: reason is for the wrong field: %s\nHINT: %s", c.name, fe.Field, c.hint)
+			}
+		}
+	}
+}
+
+func TestPasswordPolicyDefaults(t *testing.T) {
+	var policy *PasswordPolicy
+	if err := policy.Check("short", "", ""); err == nil {
+		t.Errorf("a nil policy should check against the default policy")
+	}
+	//MaxLength can't exceed bcrypt's limit
+	policy = &PasswordPolicy{MaxLength: 1000}
+	if err := policy.Check(strings.Repeat("a", maxBcryptPasswordBytes+1), "", ""); err == nil {
+		t.Errorf("passwords longer than %d bytes should be rejected", maxBcryptPasswordBytes)
+	}
+}
+
+func TestBreachedPasswordList(t *testing.T) {
+	dir := writeBreachedList(t, map[string]int{"hunter2": 17000, "rare": 1})
+	breached, err := NewBreachedPasswordList(dir)
+	if err != nil {
+		t.Fatalf("error creating breached password list: %v", err)
+	}
+	breached.MinCount = 2
+
+	checks := map[string]bool{
+		"hunter2":               true,
+		"rare":                  false,
+		"not-in-the-list-4Ever": false,
+	}
+	results := map[string]bool{}
+	for password := range checks {
+		results[password], err = breached.IsBreached(password)
+		if err != nil {
+			t.Errorf("unexpected error checking %q: %v", password, err)
+		}
+	}
+	if !reflect.DeepEqual(results, checks) {
+		t.Errorf("incorrect breach results: expected %v but got %v", checks, results)
+	}
+
+	if _, err := NewBreachedPasswordList(filepath.Join(dir, "missing")); err == nil {
+		t.Errorf("expected an error for a missing list")
+	}
+
+	//an unreadable list fails the check rather than accepting the password
+	policy := &PasswordPolicy{Breached: &BreachedPasswordList{Dir: filepath.Join(dir, "\x00")}}
+	if err := policy.Check("anything", "", ""); !errors.Is(err, ErrPasswordCheckFailed) {
+		t.Errorf("incorrect error for an unreadable list: expected %v but got %v", ErrPasswordCheckFailed, err)
+	}
+}
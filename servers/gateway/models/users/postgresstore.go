@@ -1,16 +1,41 @@
 package users
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"strings"
+	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
+//pqUniqueViolation is the postgres error code for a unique constraint violation
+const pqUniqueViolation = "23505"
+
+//uniqueConstraintErrors maps the unique constraints on the users
+//table to the errors returned when they are violated
+var uniqueConstraintErrors = map[string]error{
+	"users_email_key":    ErrDuplicateEmail,
+	"users_username_key": ErrDuplicateUserName,
+}
+
+//userColumns lists the users table's columns in the order
+//they are scanned into a User
+const userColumns = "id, email, passhash, username, firstname, lastname, photourl, bio, targetroles, school, degree, majors, expectedgraduation, targetjobtypes, targetseasons, role, disabled, signedoutat, visibility"
+
+//signInColumns lists the usersignins table's columns in the
+//order they are scanned into a UserSignIn
+const signInColumns = "id, userid, signintime, ip"
+
 //PostgresStore represents a user.Store backed by postgres.
 type PostgresStore struct {
 	DB *sql.DB
+	//Prepared statements for the lookups made on every sign-in
+	//and profile request, so they're only parsed once.
+	getByID    *sql.Stmt
+	getByEmail *sql.Stmt
 }
 
 //NewPostgresStore returns a new PostgresStore
@@ -18,54 +43,86 @@ func NewPostgresStore(db *sql.DB) (*PostgresStore, error) {
 	if db == nil {
 		panic("missing database connection")
 	}
-	return &PostgresStore{DB: db}, nil
+	getByID, err := db.Prepare("select " + userColumns + " from users where id = $1")
+	if err != nil {
+		return nil, fmt.Errorf("error preparing the GetByID statement: %w", err)
+	}
+	getByEmail, err := db.Prepare("select " + userColumns + " from users where email = $1")
+	if err != nil {
+		getByID.Close()
+		return nil, fmt.Errorf("error preparing the GetByEmail statement: %w", err)
+	}
+	return &PostgresStore{
+		DB:         db,
+		getByID:    getByID,
+		getByEmail: getByEmail,
+	}, nil
+}
+
+//Close closes the store's prepared statements. It does not close DB.
+func (ps *PostgresStore) Close() error {
+	errID, errEmail := ps.getByID.Close(), ps.getByEmail.Close()
+	if errID != nil {
+		return errID
+	}
+	return errEmail
+}
+
+//Stats returns statistics about the database connection pool
+func (ps *PostgresStore) Stats() sql.DBStats {
+	return ps.DB.Stats()
 }
 
 //user.Store implementation
 
 //GetByID returns the User with the given ID
-func (ps *PostgresStore) GetByID(id int64) (*User, error) {
+func (ps *PostgresStore) GetByID(ctx context.Context, id int64) (*User, error) {
 	u := &User{}
-	err := ps.DB.QueryRow("select * from users where id = $1", id).Scan(&u.ID, &u.Email, &u.PassHash, &u.UserName, &u.FirstName, &u.LastName, &u.PhotoURL)
+	err := ps.getByID.QueryRowContext(ctx, id).Scan(userFields(u)...)
 	if err != nil {
-		return nil, fmt.Errorf("error querying the user with the id %v: %v", id, err)
+		return nil, translateError(err, "error querying the user with the id %v", id)
 	}
 	return u, nil
 }
 
 //GetByEmail returns the User with the given email
-func (ps *PostgresStore) GetByEmail(email string) (*User, error) {
+func (ps *PostgresStore) GetByEmail(ctx context.Context, email string) (*User, error) {
 	u := &User{}
 	email = strings.TrimSpace(email)
 	//Using QueryRow since email has unique constraint
-	err := ps.DB.QueryRow("select * from users where email = $1", email).Scan(&u.ID, &u.Email, &u.PassHash, &u.UserName, &u.FirstName, &u.LastName, &u.PhotoURL)
+	err := ps.getByEmail.QueryRowContext(ctx, email).Scan(userFields(u)...)
 	if err != nil {
-		return nil, fmt.Errorf("error querying the user with the email %v: %v", email, err)
+		return nil, translateError(err, "error querying the user with the email %v", email)
 	}
 	return u, nil
 }
 
 //GetByUserName returns the User with the given Username
-func (ps *PostgresStore) GetByUserName(username string) (*User, error) {
+func (ps *PostgresStore) GetByUserName(ctx context.Context, username string) (*User, error) {
 	u := &User{}
 	//Using QueryRow since username has unique constraint
-	err := ps.DB.QueryRow("select * from users where username = $1", username).Scan(&u.ID, &u.Email, &u.PassHash, &u.UserName, &u.FirstName, &u.LastName, &u.PhotoURL)
+	err := ps.DB.QueryRowContext(ctx, "select "+userColumns+" from users where username = $1", username).Scan(userFields(u)...)
 	if err != nil {
-		return nil, fmt.Errorf("error querying the user with the username %v: %v", username, err)
+		return nil, translateError(err, "error querying the user with the username %v", username)
 	}
 	return u, nil
 }
 
 //Insert inserts the user into the database, and returns
 //the newly-inserted User, complete with the DBMS-assigned ID
-func (ps *PostgresStore) Insert(user *User) (*User, error) {
+func (ps *PostgresStore) Insert(ctx context.Context, user *User) (*User, error) {
+	user.initDefaults()
 	//structure a statement to insert a new row into the "users" table
-	insq := "insert into users(email, passhash, username, firstname, lastname, photourl) values ($1, $2, $3, $4, $5, $6) returning id"
+	insq := "insert into users(email, passhash, username, firstname, lastname, photourl, bio, targetroles, " +
+		"school, degree, majors, expectedgraduation, targetjobtypes, targetseasons, role, visibility) " +
+		"values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16) returning id"
 	//insert and get the auto-assigned ID for the new row
 	var id int64
-	err := ps.DB.QueryRow(insq, user.Email, user.PassHash, user.UserName, user.FirstName, user.LastName, user.PhotoURL).Scan(&id)
+	err := ps.DB.QueryRowContext(ctx, insq, user.Email, user.PassHash, user.UserName, user.FirstName, user.LastName, user.PhotoURL,
+		user.Bio, pq.Array(user.TargetRoles), user.School, user.Degree, pq.Array(user.Majors), user.ExpectedGraduation,
+		pq.Array(user.TargetJobTypes), pq.Array(user.TargetSeasons), user.Role, user.Visibility).Scan(&id)
 	if err != nil {
-		return nil, fmt.Errorf("error inserting new row: %v", err)
+		return nil, translateError(err, "error inserting new row")
 	}
 	//set the id field in the user and return
 	user.ID = id
@@ -74,36 +131,213 @@ func (ps *PostgresStore) Insert(user *User) (*User, error) {
 
 //Update applies UserUpdates to the given user ID
 //and returns the newly-updated user
-func (ps *PostgresStore) Update(id int64, updates *Updates) (*User, error) {
+func (ps *PostgresStore) Update(ctx context.Context, id int64, updates *Updates) (*User, error) {
+	if err := updates.Validate(); err != nil {
+		return nil, err
+	}
+	//only set the columns for fields present in the updates,
+	//so the rest of the profile is left unchanged
+	sets := []string{}
+	args := []interface{}{}
+	set := func(column string, value interface{}) {
+		args = append(args, value)
+		sets = append(sets, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+	if updates.FirstName != nil {
+		set("firstname", *updates.FirstName)
+	}
+	if updates.LastName != nil {
+		set("lastname", *updates.LastName)
+	}
+	if updates.UserName != nil {
+		set("username", *updates.UserName)
+	}
+	if updates.Bio != nil {
+		set("bio", *updates.Bio)
+	}
+	if updates.TargetRoles != nil {
+		set("targetroles", pq.Array(*updates.TargetRoles))
+	}
+	if updates.School != nil {
+		set("school", *updates.School)
+	}
+	if updates.Degree != nil {
+		set("degree", *updates.Degree)
+	}
+	if updates.Majors != nil {
+		set("majors", pq.Array(*updates.Majors))
+	}
+	if updates.ExpectedGraduation != nil {
+		set("expectedgraduation", *updates.ExpectedGraduation)
+	}
+	if updates.TargetJobTypes != nil {
+		set("targetjobtypes", pq.Array(*updates.TargetJobTypes))
+	}
+	if updates.TargetSeasons != nil {
+		set("targetseasons", pq.Array(*updates.TargetSeasons))
+	}
+	if updates.Visibility != nil {
+		set("visibility", *updates.Visibility)
+	}
+	if len(sets) == 0 {
+		return ps.GetByID(ctx, id)
+	}
+
 	u := &User{}
-	//set up update query to update the row with the first and last name from the update struct
-	//returning the updated row
-	updateq := "update users set firstname = $1, lastname = $2 where id = $3 returning *"
-	err := ps.DB.QueryRow(updateq, updates.FirstName, updates.LastName, id).Scan(&u.ID, &u.Email, &u.PassHash, &u.UserName, &u.FirstName, &u.LastName, &u.PhotoURL)
+	args = append(args, id)
+	updateq := fmt.Sprintf("update users set %s where id = $%d returning %s", strings.Join(sets, ", "), len(args), userColumns)
+	err := ps.DB.QueryRowContext(ctx, updateq, args...).Scan(userFields(u)...)
 	if err != nil {
-		return nil, fmt.Errorf("error updating the user with id %v: %v", id, err)
+		return nil, translateError(err, "error updating the user with id %v", id)
 	}
 	return u, nil
 }
 
+//UpdatePhotoURL sets the photo URL of the user with the given ID
+//and returns the newly-updated user
+func (ps *PostgresStore) UpdatePhotoURL(ctx context.Context, id int64, photoURL string) (*User, error) {
+	u := &User{}
+	updateq := "update users set photourl = $1 where id = $2 returning " + userColumns
+	err := ps.DB.QueryRowContext(ctx, updateq, photoURL, id).Scan(userFields(u)...)
+	if err != nil {
+		return nil, translateError(err, "error updating the photo URL of the user with id %v", id)
+	}
+	return u, nil
+}
+
+//UpdatePassHash replaces the password hash of the user with the given ID
+func (ps *PostgresStore) UpdatePassHash(ctx context.Context, id int64, passHash []byte) error {
+	result, err := ps.DB.ExecContext(ctx, "update users set passhash = $1 where id = $2", passHash, id)
+	if err != nil {
+		return fmt.Errorf("error updating the password of the user with id %v: %w", id, err)
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error updating the password of the user with id %v: %w", id, err)
+	}
+	if updated == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
 //Delete deletes the user with the given ID
-func (ps *PostgresStore) Delete(id int64) error {
-	_, err := ps.DB.Exec("delete from users where id = $1", id)
+func (ps *PostgresStore) Delete(ctx context.Context, id int64) error {
+	_, err := ps.DB.ExecContext(ctx, "delete from users where id = $1", id)
 	if err != nil {
-		return fmt.Errorf("error deleting the user with the id %v: %v", id, err)
+		return fmt.Errorf("error deleting the user with the id %v: %w", id, err)
 	}
 	return nil
 }
 
 //LogSignIn logs a new sign-in attempt by a user
-func (ps *PostgresStore) LogSignIn(signin *UserSignIn) (*UserSignIn, error) {
-	logq := "insert into usersignins(userid, signintime, ip) values ($1, $2, $3) returning *"
+func (ps *PostgresStore) LogSignIn(ctx context.Context, signin *UserSignIn) (*UserSignIn, error) {
+	logq := "insert into usersignins(userid, signintime, ip) values ($1, $2, $3) returning " + signInColumns
 	si := &UserSignIn{}
-	err := ps.DB.QueryRow(logq, signin.UserID, signin.SignInTime, signin.IP).Scan(
-		&si.ID, &si.IP, &si.SignInTime, &si.SignInTime,
+	err := ps.DB.QueryRowContext(ctx, logq, signin.UserID, signin.SignInTime, signin.IP).Scan(
+		&si.ID, &si.UserID, &si.SignInTime, &si.IP,
 	)
 	if err != nil {
-		return nil, fmt.Errorf("error logging a sign-in attempt for the user with the id %v: %v", signin.UserID, err)
+		return nil, fmt.Errorf("error logging a sign-in attempt for the user with the id %v: %w", signin.UserID, err)
 	}
 	return si, nil
 }
+
+//List returns up to `limit` users with IDs greater than `afterID`, in order of ID
+func (ps *PostgresStore) List(ctx context.Context, afterID int64, limit int) ([]*User, error) {
+	rows, err := ps.DB.QueryContext(ctx, "select "+userColumns+" from users where id > $1 order by id limit $2", afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error listing users: %w", err)
+	}
+	defer rows.Close()
+	listed := []*User{}
+	for rows.Next() {
+		u := &User{}
+		if err := rows.Scan(userFields(u)...); err != nil {
+			return nil, fmt.Errorf("error scanning a listed user: %w", err)
+		}
+		listed = append(listed, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error listing users: %w", err)
+	}
+	return listed, nil
+}
+
+//UpdateAccount changes the role and disabled status of the user
+//with the given ID together, and returns the newly-updated user
+func (ps *PostgresStore) UpdateAccount(ctx context.Context, id int64, updates *AccountUpdates) (*User, error) {
+	u := &User{}
+	//nil fields are passed as null, which keeps the current value
+	updateq := "update users set role = coalesce($1, role), disabled = coalesce($2, disabled) where id = $3 returning " + userColumns
+	err := ps.DB.QueryRowContext(ctx, updateq, updates.Role, updates.Disabled, id).Scan(userFields(u)...)
+	if err != nil {
+		return nil, translateError(err, "error updating the account of the user with id %v", id)
+	}
+	return u, nil
+}
+
+//SignOut ends every session the user with the given ID began before `at`
+func (ps *PostgresStore) SignOut(ctx context.Context, id int64, at time.Time) error {
+	result, err := ps.DB.ExecContext(ctx, "update users set signedoutat = $1 where id = $2", at, id)
+	if err != nil {
+		return fmt.Errorf("error signing out the user with id %v: %w", id, err)
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error signing out the user with id %v: %w", id, err)
+	}
+	if updated == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+//GetSignIns returns up to `limit` of the user's sign-ins, newest
+//first, with IDs less than `beforeID`, or the newest if it is 0
+func (ps *PostgresStore) GetSignIns(ctx context.Context, userID int64, beforeID int64, limit int) ([]*UserSignIn, error) {
+	getq := "select " + signInColumns + " from usersignins where userid = $1 and ($2 = 0 or id < $2) order by id desc limit $3"
+	rows, err := ps.DB.QueryContext(ctx, getq, userID, beforeID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying the sign-ins of the user with id %v: %w", userID, err)
+	}
+	defer rows.Close()
+	signIns := []*UserSignIn{}
+	for rows.Next() {
+		si := &UserSignIn{}
+		if err := rows.Scan(&si.ID, &si.UserID, &si.SignInTime, &si.IP); err != nil {
+			return nil, fmt.Errorf("error scanning a sign-in of the user with id %v: %w", userID, err)
+		}
+		signIns = append(signIns, si)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error querying the sign-ins of the user with id %v: %w", userID, err)
+	}
+	return signIns, nil
+}
+
+//userFields returns the destinations to scan a row of userColumns into
+func userFields(u *User) []interface{} {
+	return []interface{}{
+		&u.ID, &u.Email, &u.PassHash, &u.UserName, &u.FirstName, &u.LastName,
+		&u.PhotoURL, &u.Bio, pq.Array(&u.TargetRoles), &u.School, &u.Degree, pq.Array(&u.Majors),
+		&u.ExpectedGraduation, pq.Array(&u.TargetJobTypes), pq.Array(&u.TargetSeasons),
+		&u.Role, &u.Disabled, &u.SignedOutAt, &u.Visibility,
+	}
+}
+
+//translateError converts errors that callers need to tell apart into
+//this package's sentinel errors, so they can be checked with errors.Is.
+//Any other error is wrapped with a message built from `format` and `args`.
+func translateError(err error, format string, args ...interface{}) error {
+	if err == sql.ErrNoRows {
+		return ErrUserNotFound
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == pqUniqueViolation {
+		if dupErr, found := uniqueConstraintErrors[pqErr.Constraint]; found {
+			return dupErr
+		}
+	}
+	return fmt.Errorf(format+": %w", append(args, err)...)
+}
@@ -1,13 +1,87 @@
 package users
 
 import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"reflect"
 	"regexp"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
 )
 
+//userColumnNames are the columns of the rows returned for users
+var userColumnNames = []string{
+	"id",
+	"email",
+	"passhash",
+	"username",
+	"firstname",
+	"lastname",
+	"photourl",
+	"bio",
+	"targetroles",
+	"school",
+	"degree",
+	"majors",
+	"expectedgraduation",
+	"targetjobtypes",
+	"targetseasons",
+	"role",
+	"disabled",
+	"signedoutat",
+	"visibility",
+}
+
+//userRows returns mock rows holding the user
+func userRows(u *User) *sqlmock.Rows {
+	targetRoles, _ := pq.Array(u.TargetRoles).Value()
+	majors, _ := pq.Array(u.Majors).Value()
+	targetJobTypes, _ := pq.Array(u.TargetJobTypes).Value()
+	targetSeasons, _ := pq.Array(u.TargetSeasons).Value()
+	var signedOutAt driver.Value
+	if u.SignedOutAt != nil {
+		signedOutAt = *u.SignedOutAt
+	}
+	return sqlmock.NewRows(userColumnNames).AddRow(
+		u.ID,
+		u.Email,
+		u.PassHash,
+		u.UserName,
+		u.FirstName,
+		u.LastName,
+		u.PhotoURL,
+		u.Bio,
+		targetRoles,
+		u.School,
+		u.Degree,
+		majors,
+		u.ExpectedGraduation,
+		targetJobTypes,
+		targetSeasons,
+		u.Role,
+		u.Disabled,
+		signedOutAt,
+		u.Visibility,
+	)
+}
+
+//newMockStore returns a PostgresStore using the mock database,
+//expecting the statements it prepares
+func newMockStore(t *testing.T, db *sql.DB, mock sqlmock.Sqlmock) *PostgresStore {
+	mock.ExpectPrepare(regexp.QuoteMeta("select id, email, passhash, username, firstname, lastname, photourl, bio, targetroles, school, degree, majors, expectedgraduation, targetjobtypes, targetseasons, role, disabled, signedoutat, visibility from users where id = $1"))
+	mock.ExpectPrepare(regexp.QuoteMeta("select id, email, passhash, username, firstname, lastname, photourl, bio, targetroles, school, degree, majors, expectedgraduation, targetjobtypes, targetseasons, role, disabled, signedoutat, visibility from users where email = $1"))
+	postgresStore, err := NewPostgresStore(db)
+	if err != nil {
+		t.Fatalf("error creating PostgresStore: %v", err)
+	}
+	return postgresStore
+}
+
 func TestGetByID(t *testing.T) {
 	cases := []struct {
 		name         string
@@ -18,13 +92,14 @@ func TestGetByID(t *testing.T) {
 		{
 			"User Found",
 			&User{
-				1,
-				"test@test.com",
-				[]byte("passhash123"),
-				"username",
-				"firstname",
-				"lastname",
-				"photourl",
+				ID:          1,
+				Email:       "test@test.com",
+				PassHash:    []byte("passhash123"),
+				UserName:    "username",
+				FirstName:   "firstname",
+				LastName:    "lastname",
+				PhotoURL:    "photourl",
+				TargetRoles: []string{},
 			},
 			1,
 			false,
@@ -38,13 +113,14 @@ func TestGetByID(t *testing.T) {
 		{
 			"User With Large ID Found",
 			&User{
-				1234567890,
-				"test@test.com",
-				[]byte("passhash123"),
-				"username",
-				"firstname",
-				"lastname",
-				"photourl",
+				ID:          1234567890,
+				Email:       "test@test.com",
+				PassHash:    []byte("passhash123"),
+				UserName:    "username",
+				FirstName:   "firstname",
+				LastName:    "lastname",
+				PhotoURL:    "photourl",
+				TargetRoles: []string{},
 			},
 			1234567890,
 			false,
@@ -59,34 +135,18 @@ func TestGetByID(t *testing.T) {
 		}
 		defer db.Close()
 
-		postgresStore := &PostgresStore{db}
+		postgresStore := newMockStore(t, db, mock)
 
 		// Create an expected row to the mock DB
-		row := mock.NewRows([]string{
-			"id",
-			"email",
-			"passhash",
-			"username",
-			"firstname",
-			"lastname",
-			"photourl"},
-		).AddRow(
-			c.expectedUser.ID,
-			c.expectedUser.Email,
-			c.expectedUser.PassHash,
-			c.expectedUser.UserName,
-			c.expectedUser.FirstName,
-			c.expectedUser.LastName,
-			c.expectedUser.PhotoURL,
-		)
-
-		query := regexp.QuoteMeta("select * from users where id = $1")
+		row := userRows(c.expectedUser)
+
+		query := regexp.QuoteMeta("select id, email, passhash, username, firstname, lastname, photourl, bio, targetroles, school, degree, majors, expectedgraduation, targetjobtypes, targetseasons, role, disabled, signedoutat, visibility from users where id = $1")
 
 		if c.expectError {
 			// Set up expected query that will expect an error
 			mock.ExpectQuery(query).WithArgs(c.idToGet).WillReturnError(ErrUserNotFound)
 
-			user, err := postgresStore.GetByID(c.idToGet)
+			user, err := postgresStore.GetByID(context.Background(), c.idToGet)
 			if user != nil || err == nil {
 				t.Errorf("Expected error [%v] but got [%v] instead", ErrUserNotFound, err)
 			}
@@ -94,7 +154,7 @@ func TestGetByID(t *testing.T) {
 			// Set up an expected query with the expected row from the mock DB
 			mock.ExpectQuery(query).WithArgs(c.idToGet).WillReturnRows(row)
 
-			user, err := postgresStore.GetByID(c.idToGet)
+			user, err := postgresStore.GetByID(context.Background(), c.idToGet)
 			if err != nil {
 				t.Errorf("Unexpected error on successful test [%s]: %v", c.name, err)
 			}
@@ -120,13 +180,14 @@ func TestGetByEmail(t *testing.T) {
 		{
 			"User Found",
 			&User{
-				1,
-				"test@test.com",
-				[]byte("passhash123"),
-				"username",
-				"firstname",
-				"lastname",
-				"photourl",
+				ID:          1,
+				Email:       "test@test.com",
+				PassHash:    []byte("passhash123"),
+				UserName:    "username",
+				FirstName:   "firstname",
+				LastName:    "lastname",
+				PhotoURL:    "photourl",
+				TargetRoles: []string{},
 			},
 			"test@test.com",
 			false,
@@ -146,34 +207,18 @@ func TestGetByEmail(t *testing.T) {
 		}
 		defer db.Close()
 
-		postgresStore := &PostgresStore{db}
+		postgresStore := newMockStore(t, db, mock)
 
 		// Create an expected row to the mock DB
-		row := mock.NewRows([]string{
-			"id",
-			"email",
-			"passhash",
-			"username",
-			"firstname",
-			"lastname",
-			"photourl"},
-		).AddRow(
-			c.expectedUser.ID,
-			c.expectedUser.Email,
-			c.expectedUser.PassHash,
-			c.expectedUser.UserName,
-			c.expectedUser.FirstName,
-			c.expectedUser.LastName,
-			c.expectedUser.PhotoURL,
-		)
-
-		query := regexp.QuoteMeta("select * from users where email = $1")
+		row := userRows(c.expectedUser)
+
+		query := regexp.QuoteMeta("select id, email, passhash, username, firstname, lastname, photourl, bio, targetroles, school, degree, majors, expectedgraduation, targetjobtypes, targetseasons, role, disabled, signedoutat, visibility from users where email = $1")
 
 		if c.expectError {
 			// Set up expected query that will expect an error
 			mock.ExpectQuery(query).WithArgs(c.emailToGet).WillReturnError(ErrUserNotFound)
 
-			user, err := postgresStore.GetByEmail(c.emailToGet)
+			user, err := postgresStore.GetByEmail(context.Background(), c.emailToGet)
 			if user != nil || err == nil {
 				t.Errorf("Expected error [%v] but got [%v] instead", ErrUserNotFound, err)
 			}
@@ -181,7 +226,7 @@ func TestGetByEmail(t *testing.T) {
 			// Set up an expected query with the expected row from the mock DB
 			mock.ExpectQuery(query).WithArgs(c.emailToGet).WillReturnRows(row)
 
-			user, err := postgresStore.GetByEmail(c.emailToGet)
+			user, err := postgresStore.GetByEmail(context.Background(), c.emailToGet)
 			if err != nil {
 				t.Errorf("Unexpected error on successful test [%s]: %v", c.name, err)
 			}
@@ -206,13 +251,14 @@ func TestGetByUserName(t *testing.T) {
 		{
 			"User Found",
 			&User{
-				1,
-				"test@test.com",
-				[]byte("passhash123"),
-				"username",
-				"firstname",
-				"lastname",
-				"photourl",
+				ID:          1,
+				Email:       "test@test.com",
+				PassHash:    []byte("passhash123"),
+				UserName:    "username",
+				FirstName:   "firstname",
+				LastName:    "lastname",
+				PhotoURL:    "photourl",
+				TargetRoles: []string{},
 			},
 			"username",
 			false,
@@ -233,34 +279,18 @@ func TestGetByUserName(t *testing.T) {
 		}
 		defer db.Close()
 
-		postgresStore := &PostgresStore{db}
+		postgresStore := newMockStore(t, db, mock)
 
 		// Create an expected row to the mock DB
-		row := mock.NewRows([]string{
-			"id",
-			"email",
-			"passhash",
-			"username",
-			"firstname",
-			"lastname",
-			"photourl"},
-		).AddRow(
-			c.expectedUser.ID,
-			c.expectedUser.Email,
-			c.expectedUser.PassHash,
-			c.expectedUser.UserName,
-			c.expectedUser.FirstName,
-			c.expectedUser.LastName,
-			c.expectedUser.PhotoURL,
-		)
-
-		query := regexp.QuoteMeta("select * from users where username = $1")
+		row := userRows(c.expectedUser)
+
+		query := regexp.QuoteMeta("select id, email, passhash, username, firstname, lastname, photourl, bio, targetroles, school, degree, majors, expectedgraduation, targetjobtypes, targetseasons, role, disabled, signedoutat, visibility from users where username = $1")
 
 		if c.expectError {
 			// Set up expected query that will expect an error
 			mock.ExpectQuery(query).WithArgs(c.userNameToGet).WillReturnError(ErrUserNotFound)
 
-			user, err := postgresStore.GetByUserName(c.userNameToGet)
+			user, err := postgresStore.GetByUserName(context.Background(), c.userNameToGet)
 			if user != nil || err == nil {
 				t.Errorf("Expected error [%v] but got [%v] instead", ErrUserNotFound, err)
 			}
@@ -268,7 +298,7 @@ func TestGetByUserName(t *testing.T) {
 			// Set up an expected query with the expected row from the mock DB
 			mock.ExpectQuery(query).WithArgs(c.userNameToGet).WillReturnRows(row)
 
-			user, err := postgresStore.GetByUserName(c.userNameToGet)
+			user, err := postgresStore.GetByUserName(context.Background(), c.userNameToGet)
 			if err != nil {
 				t.Errorf("Unexpected error on successful test [%s]: %v", c.name, err)
 			}
@@ -310,17 +340,21 @@ func TestInsert(t *testing.T) {
 			t.Fatalf("There was a problem opening a database connection: [%v]", err)
 		}
 		defer db.Close()
-		postgresStore := &PostgresStore{db}
+		postgresStore := newMockStore(t, db, mock)
 
-		query := regexp.QuoteMeta("insert into users(email, passhash, username, firstname, lastname, photourl) values ($1, $2, $3, $4, $5, $6) returning id")
+		query := regexp.QuoteMeta("insert into users(email, passhash, username, firstname, lastname, photourl, bio, targetroles, " +
+			"school, degree, majors, expectedgraduation, targetjobtypes, targetseasons, role, visibility) " +
+			"values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16) returning id")
 		expectedRow := sqlmock.NewRows([]string{"id"}).AddRow(c.userToInsert.ID)
 		mock.ExpectQuery(query).WithArgs(
 			c.userToInsert.Email, c.userToInsert.PassHash, c.userToInsert.UserName,
 			c.userToInsert.FirstName, c.userToInsert.LastName, c.userToInsert.PhotoURL,
+			c.userToInsert.Bio, "{}", c.userToInsert.School, c.userToInsert.Degree, "{}",
+			c.userToInsert.ExpectedGraduation, "{}", "{}", RoleUser, VisibilityConnections,
 		).WillReturnRows(expectedRow)
 
 		//Test Insert implementation
-		postgresStore.Insert(c.userToInsert)
+		postgresStore.Insert(context.Background(), c.userToInsert)
 
 		if err := mock.ExpectationsWereMet(); err != nil {
 			t.Errorf("There were unfulfilled expectations: %s", err)
@@ -328,30 +362,95 @@ func TestInsert(t *testing.T) {
 	}
 }
 
+func stringPtr(s string) *string { return &s }
+
 func TestUpdate(t *testing.T) {
+	returning := " returning id, email, passhash, username, firstname, lastname, photourl, bio, targetroles, school, degree, majors, expectedgraduation, targetjobtypes, targetseasons, role, disabled, signedoutat, visibility"
 	cases := []struct {
 		name         string
 		expectedUser *User
 		idToUpdate   int64
 		updates      *Updates
+		query        string
+		args         []driver.Value
 		expectError  bool
 	}{
 		{
 			"User Found",
 			&User{
-				1,
-				"test@test.com",
-				[]byte("passhash123"),
-				"username",
-				"firstname",
-				"lastname",
-				"photourl",
+				ID:          1,
+				Email:       "test@test.com",
+				PassHash:    []byte("passhash123"),
+				UserName:    "username",
+				FirstName:   "updatedFirstName",
+				LastName:    "updatedLastName",
+				PhotoURL:    "photourl",
+				TargetRoles: []string{},
 			},
 			1,
 			&Updates{
-				FirstName: "updatedFirstName",
-				LastName:  "updatedLastName",
+				FirstName: stringPtr("updatedFirstName"),
+				LastName:  stringPtr("updatedLastName"),
 			},
+			"update users set firstname = $1, lastname = $2 where id = $3" + returning,
+			[]driver.Value{"updatedFirstName", "updatedLastName", 1},
+			false,
+		},
+		{
+			"Only Last Name",
+			&User{
+				ID:          1,
+				Email:       "test@test.com",
+				PassHash:    []byte("passhash123"),
+				UserName:    "username",
+				FirstName:   "firstname",
+				LastName:    "updatedLastName",
+				PhotoURL:    "photourl",
+				TargetRoles: []string{},
+			},
+			1,
+			&Updates{
+				LastName: stringPtr("updatedLastName"),
+			},
+			"update users set lastname = $1 where id = $2" + returning,
+			[]driver.Value{"updatedLastName", 1},
+			false,
+		},
+		{
+			"Profile Fields",
+			&User{
+				ID:                 1,
+				Email:              "test@test.com",
+				PassHash:           []byte("passhash123"),
+				UserName:           "newusername",
+				FirstName:          "firstname",
+				LastName:           "lastname",
+				PhotoURL:           "photourl",
+				Bio:                "bio",
+				TargetRoles:        []string{"Software Engineer", "PM"},
+				School:             "school",
+				Degree:             DegreeMaster,
+				Majors:             []string{"Statistics"},
+				ExpectedGraduation: "2023-12",
+				TargetJobTypes:     []string{JobTypeNewGrad},
+				TargetSeasons:      []string{"Winter 2024"},
+			},
+			1,
+			&Updates{
+				UserName:           stringPtr("newusername"),
+				Bio:                stringPtr("bio"),
+				TargetRoles:        &[]string{"Software Engineer", "PM"},
+				School:             stringPtr("school"),
+				Degree:             stringPtr(DegreeMaster),
+				Majors:             &[]string{"Statistics"},
+				ExpectedGraduation: stringPtr("2023-12"),
+				TargetJobTypes:     &[]string{JobTypeNewGrad},
+				TargetSeasons:      &[]string{"Winter 2024"},
+			},
+			"update users set username = $1, bio = $2, targetroles = $3, school = $4, degree = $5, majors = $6, " +
+				"expectedgraduation = $7, targetjobtypes = $8, targetseasons = $9 where id = $10" + returning,
+			[]driver.Value{"newusername", "bio", `{"Software Engineer","PM"}`, "school", DegreeMaster, `{"Statistics"}`,
+				"2023-12", `{"new-grad"}`, `{"Winter 2024"}`, 1},
 			false,
 		},
 		{
@@ -359,9 +458,11 @@ func TestUpdate(t *testing.T) {
 			&User{},
 			2,
 			&Updates{
-				FirstName: "updatedFirstName",
-				LastName:  "updatedLastName",
+				FirstName: stringPtr("updatedFirstName"),
+				LastName:  stringPtr("updatedLastName"),
 			},
+			"update users set firstname = $1, lastname = $2 where id = $3" + returning,
+			[]driver.Value{"updatedFirstName", "updatedLastName", 2},
 			true,
 		},
 	}
@@ -374,42 +475,26 @@ func TestUpdate(t *testing.T) {
 		}
 		defer db.Close()
 
-		postgresStore := &PostgresStore{db}
+		postgresStore := newMockStore(t, db, mock)
 
 		// Create an expected row to the mock DB
-		row := mock.NewRows([]string{
-			"id",
-			"email",
-			"passhash",
-			"username",
-			"firstname",
-			"lastname",
-			"photourl"},
-		).AddRow(
-			c.expectedUser.ID,
-			c.expectedUser.Email,
-			c.expectedUser.PassHash,
-			c.expectedUser.UserName,
-			c.expectedUser.FirstName,
-			c.expectedUser.LastName,
-			c.expectedUser.PhotoURL,
-		)
-
-		query := regexp.QuoteMeta("update users set firstname = $1, lastname = $2 where id = $3 returning *")
+		row := userRows(c.expectedUser)
+
+		query := regexp.QuoteMeta(c.query)
 
 		if c.expectError {
 			// Set up expected query that will expect an error
-			mock.ExpectQuery(query).WithArgs(c.updates.FirstName, c.updates.LastName, c.idToUpdate).WillReturnError(ErrUserNotFound)
+			mock.ExpectQuery(query).WithArgs(c.args...).WillReturnError(sql.ErrNoRows)
 
-			user, err := postgresStore.Update(c.idToUpdate, c.updates)
-			if user != nil || err == nil {
+			user, err := postgresStore.Update(context.Background(), c.idToUpdate, c.updates)
+			if user != nil || !errors.Is(err, ErrUserNotFound) {
 				t.Errorf("Expected error [%v] but got [%v] instead", ErrUserNotFound, err)
 			}
 		} else {
 			// Set up an expected query with the expected row from the mock DB
-			mock.ExpectQuery(query).WithArgs(c.updates.FirstName, c.updates.LastName, c.idToUpdate).WillReturnRows(row)
+			mock.ExpectQuery(query).WithArgs(c.args...).WillReturnRows(row)
 
-			user, err := postgresStore.Update(c.idToUpdate, c.updates)
+			user, err := postgresStore.Update(context.Background(), c.idToUpdate, c.updates)
 			if err != nil {
 				t.Errorf("Unexpected error on successful test [%s]: %v", c.name, err)
 			}
@@ -422,6 +507,72 @@ func TestUpdate(t *testing.T) {
 			t.Errorf("There were unfulfilled expectations: %s", err)
 		}
 	}
+
+	//invalid updates and empty updates never run an update
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("There was a problem opening a database connection: [%v]", err)
+	}
+	defer db.Close()
+	postgresStore := newMockStore(t, db, mock)
+	var validationErrs ValidationErrors
+	if _, err := postgresStore.Update(context.Background(), 1, &Updates{FirstName: stringPtr("$$$")}); !errors.As(err, &validationErrs) {
+		t.Errorf("Expected validation errors but got [%v] instead", err)
+	}
+	mock.ExpectQuery(regexp.QuoteMeta("select id, email")).WithArgs(1).WillReturnRows(userRows(&User{ID: 1, TargetRoles: []string{}}))
+	if user, err := postgresStore.Update(context.Background(), 1, &Updates{}); err != nil || user.ID != 1 {
+		t.Errorf("Expected the unchanged user but got %v, %v", user, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestUpdatePhotoURL(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("There was a problem opening a database connection: [%v]", err)
+	}
+	defer db.Close()
+	postgresStore := newMockStore(t, db, mock)
+
+	expectedUser := &User{ID: 1, PhotoURL: "/v1/users/1/avatar?v=1", TargetRoles: []string{}}
+	query := regexp.QuoteMeta("update users set photourl = $1 where id = $2 returning id, email")
+	mock.ExpectQuery(query).WithArgs(expectedUser.PhotoURL, 1).WillReturnRows(userRows(expectedUser))
+	user, err := postgresStore.UpdatePhotoURL(context.Background(), 1, expectedUser.PhotoURL)
+	if err != nil || !reflect.DeepEqual(user, expectedUser) {
+		t.Errorf("Expected the updated user but got %v, %v", user, err)
+	}
+
+	mock.ExpectQuery(query).WithArgs(expectedUser.PhotoURL, 2).WillReturnError(sql.ErrNoRows)
+	if _, err := postgresStore.UpdatePhotoURL(context.Background(), 2, expectedUser.PhotoURL); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected error [%v] but got [%v] instead", ErrUserNotFound, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestUpdatePassHash(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("There was a problem opening a database connection: [%v]", err)
+	}
+	defer db.Close()
+	postgresStore := newMockStore(t, db, mock)
+
+	query := regexp.QuoteMeta("update users set passhash = $1 where id = $2")
+	mock.ExpectExec(query).WithArgs([]byte("passhash"), 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := postgresStore.UpdatePassHash(context.Background(), 1, []byte("passhash")); err != nil {
+		t.Errorf("Unexpected error updating the password hash: %v", err)
+	}
+	mock.ExpectExec(query).WithArgs([]byte("passhash"), 2).WillReturnResult(sqlmock.NewResult(0, 0))
+	if err := postgresStore.UpdatePassHash(context.Background(), 2, []byte("passhash")); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected error [%v] but got [%v] instead", ErrUserNotFound, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
 }
 
 func TestDelete(t *testing.T) {
@@ -434,13 +585,14 @@ func TestDelete(t *testing.T) {
 		{
 			"User Found",
 			&User{
-				1,
-				"test@test.com",
-				[]byte("passhash123"),
-				"username",
-				"firstname",
-				"lastname",
-				"photourl",
+				ID:          1,
+				Email:       "test@test.com",
+				PassHash:    []byte("passhash123"),
+				UserName:    "username",
+				FirstName:   "firstname",
+				LastName:    "lastname",
+				PhotoURL:    "photourl",
+				TargetRoles: []string{},
 			},
 			1,
 			false,
@@ -461,40 +613,21 @@ func TestDelete(t *testing.T) {
 		}
 		defer db.Close()
 
-		postgresStore := &PostgresStore{db}
-
-		// Create an expected row to the mock DB
-		mock.NewRows([]string{
-			"id",
-			"email",
-			"passhash",
-			"username",
-			"firstname",
-			"lastname",
-			"photourl"},
-		).AddRow(
-			c.expectedUser.ID,
-			c.expectedUser.Email,
-			c.expectedUser.PassHash,
-			c.expectedUser.UserName,
-			c.expectedUser.FirstName,
-			c.expectedUser.LastName,
-			c.expectedUser.PhotoURL,
-		)
+		postgresStore := newMockStore(t, db, mock)
 
 		query := regexp.QuoteMeta("delete from users where id = $1")
 
 		if c.expectError {
 			// Set up expected query that will expect an error
 			mock.ExpectExec(query).WithArgs(c.idToDelete).WillReturnResult(sqlmock.NewResult(0, 0))
-			postgresStore.Delete(c.idToDelete)
+			postgresStore.Delete(context.Background(), c.idToDelete)
 			/*if err == nil {
 				t.Errorf("Expected error [%v] but got [%v] instead", ErrUserNotFound, err)
 			}*/
 		} else {
 			// Set up an expected query with the expected row from the mock DB
 			mock.ExpectExec(query).WithArgs(c.idToDelete).WillReturnResult(sqlmock.NewResult(1, 1))
-			postgresStore.Delete(c.idToDelete)
+			postgresStore.Delete(context.Background(), c.idToDelete)
 			/*if err != nil {
 				t.Errorf("Unexpected error on successful test [%s]: %v", c.name, err)
 			}*/
@@ -506,3 +639,169 @@ func TestDelete(t *testing.T) {
 
 	}
 }
+
+func TestPostgresStoreErrors(t *testing.T) {
+	dbErr := errors.New("connection refused")
+	insertq := regexp.QuoteMeta("insert into users(email, passhash, username, firstname, lastname, photourl, bio, targetroles, school, degree, majors, expectedgraduation, targetjobtypes, targetseasons, role, visibility) values")
+	cases := []struct {
+		name        string
+		queryErr    error
+		query       string
+		call        func(ps *PostgresStore) error
+		expectedErr error
+	}{
+		{
+			"GetByID No Rows",
+			sql.ErrNoRows,
+			regexp.QuoteMeta("select id, email, passhash, username, firstname, lastname, photourl, bio, targetroles, school, degree, majors, expectedgraduation, targetjobtypes, targetseasons, role, disabled, signedoutat, visibility from users where id = $1"),
+			func(ps *PostgresStore) error { _, err := ps.GetByID(context.Background(), 1); return err },
+			ErrUserNotFound,
+		},
+		{
+			"GetByEmail No Rows",
+			sql.ErrNoRows,
+			regexp.QuoteMeta("select id, email, passhash, username, firstname, lastname, photourl, bio, targetroles, school, degree, majors, expectedgraduation, targetjobtypes, targetseasons, role, disabled, signedoutat, visibility from users where email = $1"),
+			func(ps *PostgresStore) error { _, err := ps.GetByEmail(context.Background(), "test@test.com"); return err },
+			ErrUserNotFound,
+		},
+		{
+			"GetByUserName Database Down",
+			dbErr,
+			regexp.QuoteMeta("select id, email, passhash, username, firstname, lastname, photourl, bio, targetroles, school, degree, majors, expectedgraduation, targetjobtypes, targetseasons, role, disabled, signedoutat, visibility from users where username = $1"),
+			func(ps *PostgresStore) error { _, err := ps.GetByUserName(context.Background(), "username"); return err },
+			dbErr,
+		},
+		{
+			"Insert Duplicate Email",
+			&pq.Error{Code: pqUniqueViolation, Constraint: "users_email_key"},
+			insertq,
+			func(ps *PostgresStore) error { _, err := ps.Insert(context.Background(), &User{}); return err },
+			ErrDuplicateEmail,
+		},
+		{
+			"Insert Duplicate UserName",
+			&pq.Error{Code: pqUniqueViolation, Constraint: "users_username_key"},
+			insertq,
+			func(ps *PostgresStore) error { _, err := ps.Insert(context.Background(), &User{}); return err },
+			ErrDuplicateUserName,
+		},
+		{
+			"Update No Rows",
+			sql.ErrNoRows,
+			regexp.QuoteMeta("update users set firstname = $1 where id = $2 returning"),
+			func(ps *PostgresStore) error {
+				_, err := ps.Update(context.Background(), 1, &Updates{FirstName: stringPtr("Name")})
+				return err
+			},
+			ErrUserNotFound,
+		},
+	}
+
+	for _, c := range cases {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("There was a problem opening a database connection: [%v]", err)
+		}
+		defer db.Close()
+		postgresStore := newMockStore(t, db, mock)
+
+		mock.ExpectQuery(c.query).WillReturnError(c.queryErr)
+		err = c.call(postgresStore)
+		if !errors.Is(err, c.expectedErr) {
+			t.Errorf("case %s: expected error [%v] but got [%v] instead", c.name, c.expectedErr, err)
+		}
+		if c.expectedErr == dbErr && errors.Is(err, ErrUserNotFound) {
+			t.Errorf("case %s: database failure was reported as %v", c.name, ErrUserNotFound)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("There were unfulfilled expectations: %s", err)
+		}
+	}
+}
+
+func TestNewPostgresStore(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("There was a problem opening a database connection: [%v]", err)
+	}
+	defer db.Close()
+
+	//a failed prepare fails the constructor, closing what was prepared
+	prepareErr := errors.New("relation \"users\" does not exist")
+	mock.ExpectPrepare("select .* from users where id = \\$1").WillBeClosed()
+	mock.ExpectPrepare("select .* from users where email = \\$1").WillReturnError(prepareErr)
+	if _, err := NewPostgresStore(db); !errors.Is(err, prepareErr) {
+		t.Errorf("Expected error [%v] but got [%v] instead", prepareErr, err)
+	}
+
+	mock.ExpectPrepare("select .* from users where id = \\$1").WillBeClosed()
+	mock.ExpectPrepare("select .* from users where email = \\$1").WillBeClosed()
+	postgresStore, err := NewPostgresStore(db)
+	if err != nil {
+		t.Fatalf("Unexpected error creating PostgresStore: %v", err)
+	}
+	if stats := postgresStore.Stats(); stats.OpenConnections < 1 {
+		t.Errorf("Expected pool stats to count the open connection but got %+v", stats)
+	}
+	if err := postgresStore.Close(); err != nil {
+		t.Errorf("Unexpected error closing PostgresStore: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestAdminQueries(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("There was a problem opening a database connection: [%v]", err)
+	}
+	defer db.Close()
+	postgresStore := newMockStore(t, db, mock)
+	columns := "id, email, passhash, username, firstname, lastname, photourl, bio, targetroles, school, degree, majors, expectedgraduation, targetjobtypes, targetseasons, role, disabled, signedoutat, visibility"
+
+	signedOutAt := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	admin := &User{ID: 2, Email: "admin@test.com", TargetRoles: []string{}, Majors: []string{}, TargetJobTypes: []string{}, TargetSeasons: []string{},
+		Role: RoleAdmin, Disabled: true, SignedOutAt: &signedOutAt}
+	mock.ExpectQuery(regexp.QuoteMeta("select "+columns+" from users where id > $1 order by id limit $2")).
+		WithArgs(1, 10).WillReturnRows(userRows(admin))
+	listed, err := postgresStore.List(context.Background(), 1, 10)
+	if err != nil || len(listed) != 1 || !reflect.DeepEqual(listed[0], admin) {
+		t.Errorf("Unexpected users listed: %+v, %v", listed, err)
+	}
+
+	role, disabled := RoleAdmin, true
+	updateq := regexp.QuoteMeta("update users set role = coalesce($1, role), disabled = coalesce($2, disabled) where id = $3 returning " + columns)
+	mock.ExpectQuery(updateq).WithArgs(RoleAdmin, true, 2).WillReturnRows(userRows(admin))
+	if u, err := postgresStore.UpdateAccount(context.Background(), 2, &AccountUpdates{Role: &role, Disabled: &disabled}); err != nil || u.Role != RoleAdmin || !u.Disabled {
+		t.Errorf("Unexpected user after UpdateAccount: %+v, %v", u, err)
+	}
+	mock.ExpectQuery(updateq).WithArgs(nil, true, 3).WillReturnError(sql.ErrNoRows)
+	if _, err := postgresStore.UpdateAccount(context.Background(), 3, &AccountUpdates{Disabled: &disabled}); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected error [%v] but got [%v] instead", ErrUserNotFound, err)
+	}
+
+	signOutq := regexp.QuoteMeta("update users set signedoutat = $1 where id = $2")
+	mock.ExpectExec(signOutq).WithArgs(signedOutAt, 2).WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := postgresStore.SignOut(context.Background(), 2, signedOutAt); err != nil {
+		t.Errorf("Unexpected error signing out: %v", err)
+	}
+	mock.ExpectExec(signOutq).WithArgs(signedOutAt, 3).WillReturnResult(sqlmock.NewResult(0, 0))
+	if err := postgresStore.SignOut(context.Background(), 3, signedOutAt); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected error [%v] but got [%v] instead", ErrUserNotFound, err)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta("select id, userid, signintime, ip from usersignins where userid = $1 and ($2 = 0 or id < $2) order by id desc limit $3")).
+		WithArgs(2, 0, 20).WillReturnRows(sqlmock.NewRows([]string{"id", "userid", "signintime", "ip"}).
+		AddRow(5, 2, signedOutAt, "127.0.0.1").AddRow(4, 2, signedOutAt, "127.0.0.2"))
+	signIns, err := postgresStore.GetSignIns(context.Background(), 2, 0, 20)
+	if err != nil || len(signIns) != 2 || signIns[0].ID != 5 || signIns[1].IP != "127.0.0.2" {
+		t.Errorf("Unexpected sign-ins: %+v, %v", signIns, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
@@ -1,34 +1,69 @@
 package users
 
 import (
+	"context"
 	"errors"
+	"time"
 )
 
 //ErrUserNotFound is returned when the user can't be found
 var ErrUserNotFound = errors.New("user not found")
 
-//Store represents a store for Users
+//ErrDuplicateEmail is returned when inserting a user whose email is already in use
+var ErrDuplicateEmail = errors.New("this email address has already been used")
+
+//ErrDuplicateUserName is returned when inserting a user whose username is already in use
+var ErrDuplicateUserName = errors.New("this username has already been used")
+
+//Store represents a store for Users. Lookups and updates of
+//users that don't exist return ErrUserNotFound, and inserts that
+//reuse an email or username return ErrDuplicateEmail or
+//ErrDuplicateUserName; check for them with errors.Is. Any other
+//error means the store itself failed, including when `ctx` is
+//done before the store responds.
 type Store interface {
 	//GetByID returns the User with the given ID
-	GetByID(id int64) (*User, error)
+	GetByID(ctx context.Context, id int64) (*User, error)
 
 	//GetByEmail returns the User with the given email
-	GetByEmail(email string) (*User, error)
+	GetByEmail(ctx context.Context, email string) (*User, error)
 
 	//GetByUserName returns the User with the given Username
-	GetByUserName(username string) (*User, error)
+	GetByUserName(ctx context.Context, username string) (*User, error)
 
 	//Insert inserts the user into the database, and returns
 	//the newly-inserted User, complete with the DBMS-assigned ID
-	Insert(user *User) (*User, error)
+	Insert(ctx context.Context, user *User) (*User, error)
 
 	//Update applies UserUpdates to the given user ID
 	//and returns the newly-updated user
-	Update(id int64, updates *Updates) (*User, error)
+	Update(ctx context.Context, id int64, updates *Updates) (*User, error)
+
+	//UpdatePhotoURL sets the photo URL of the user with the given ID
+	//and returns the newly-updated user
+	UpdatePhotoURL(ctx context.Context, id int64, photoURL string) (*User, error)
+
+	//UpdatePassHash replaces the password hash of the user with the given ID
+	UpdatePassHash(ctx context.Context, id int64, passHash []byte) error
 
 	//Delete deletes the user with the given ID
-	Delete(id int64) error
+	Delete(ctx context.Context, id int64) error
 
 	//LogSignIn logs when a user successfully signs-in
-	LogSignIn(signin *UserSignIn) (*UserSignIn, error)
+	LogSignIn(ctx context.Context, signin *UserSignIn) (*UserSignIn, error)
+
+	//List returns up to `limit` users with IDs greater than
+	//`afterID`, in order of ID, so callers can page through users
+	List(ctx context.Context, afterID int64, limit int) ([]*User, error)
+
+	//UpdateAccount changes the role and disabled status of the user
+	//with the given ID together, and returns the newly-updated user
+	UpdateAccount(ctx context.Context, id int64, updates *AccountUpdates) (*User, error)
+
+	//SignOut ends every session the user with the given ID began before `at`
+	SignOut(ctx context.Context, id int64, at time.Time) error
+
+	//GetSignIns returns up to `limit` of the user's sign-ins, newest
+	//first, with IDs less than `beforeID`, or the newest if it is 0
+	GetSignIns(ctx context.Context, userID int64, beforeID int64, limit int) ([]*UserSignIn, error)
 }
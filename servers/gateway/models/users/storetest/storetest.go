@@ -0,0 +1,536 @@
+//Package storetest provides a conformance test suite for implementations
+//of users.Store. A new implementation proves its behavior matches the
+//others by calling Run from one of its tests:
+//
+//	func TestMyStore(t *testing.T) {
+//		storetest.Run(t, func(t *testing.T) users.Store {
+//			return NewMyStore()
+//		})
+//	}
+//
+//The suite creates users with unique emails and usernames, so stores
+//backed by a shared database don't need to be emptied between runs.
+package storetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"JobTracker/servers/gateway/models/users"
+)
+
+//NewStoreFunc returns the store to run a test against
+type NewStoreFunc func(t *testing.T) users.Store
+
+//runID keeps the users created by separate runs of the suite apart
+var runID = rand.New(rand.NewSource(time.Now().UnixNano())).Int63()
+
+//userCounter numbers the users created within a run
+var userCounter int64
+
+//Run runs the conformance suite as subtests of `t`
+func Run(t *testing.T, newStore NewStoreFunc) {
+	t.Run("NotFound", func(t *testing.T) { testNotFound(t, newStore(t)) })
+	t.Run("InsertAndGet", func(t *testing.T) { testInsertAndGet(t, newStore(t)) })
+	t.Run("Duplicates", func(t *testing.T) { testDuplicates(t, newStore(t)) })
+	t.Run("Update", func(t *testing.T) { testUpdate(t, newStore(t)) })
+	t.Run("UpdatePhotoURL", func(t *testing.T) { testUpdatePhotoURL(t, newStore(t)) })
+	t.Run("UpdatePassHash", func(t *testing.T) { testUpdatePassHash(t, newStore(t)) })
+	t.Run("Delete", func(t *testing.T) { testDelete(t, newStore(t)) })
+	t.Run("LogSignIn", func(t *testing.T) { testLogSignIn(t, newStore(t)) })
+	t.Run("GetSignIns", func(t *testing.T) { testGetSignIns(t, newStore(t)) })
+	t.Run("List", func(t *testing.T) { testList(t, newStore(t)) })
+	t.Run("RoleAndDisabled", func(t *testing.T) { testRoleAndDisabled(t, newStore(t)) })
+	t.Run("SignOut", func(t *testing.T) { testSignOut(t, newStore(t)) })
+	t.Run("Unicode", func(t *testing.T) { testUnicode(t, newStore(t)) })
+	t.Run("CancelledContext", func(t *testing.T) { testCancelledContext(t, newStore(t)) })
+	t.Run("Concurrent", func(t *testing.T) { testConcurrent(t, newStore(t)) })
+	t.Run("ConcurrentDuplicates", func(t *testing.T) { testConcurrentDuplicates(t, newStore(t)) })
+}
+
+//newUser returns a valid user with a unique email and username
+func newUser(t *testing.T) *users.User {
+	n := atomic.AddInt64(&userCounter, 1)
+	//stores don't interpret the hash, so skip the cost of bcrypt
+	u := &users.User{
+		Email:     fmt.Sprintf("storetest%d.%d@test.com", runID, n),
+		PassHash:  []byte("passhash"),
+		UserName:  fmt.Sprintf("storetest%d_%d", runID, n),
+		FirstName: "Testy",
+		LastName:  "Testerson",
+	}
+	if err := u.SetPhotoURL(u.Email); err != nil {
+		t.Fatalf("error creating test user: %v", err)
+	}
+	return u
+}
+
+//stringPtr returns a pointer to `s`, for setting Updates fields
+func stringPtr(s string) *string {
+	return &s
+}
+
+//insert inserts a new user, failing the test if it can't
+func insert(t *testing.T, store users.Store) *users.User {
+	u, err := store.Insert(context.Background(), newUser(t))
+	if err != nil {
+		t.Fatalf("error inserting user: %v", err)
+	}
+	return u
+}
+
+//checkUser fails the test if `actual` doesn't hold the same profile as `expected`
+func checkUser(t *testing.T, how string, expected *users.User, actual *users.User) {
+	t.Helper()
+	if actual == nil {
+		t.Errorf("%s: expected user %d but got nil", how, expected.ID)
+		return
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("%s: incorrect user:\nEXPECTED\n%+v\nACTUAL\n%+v", how, expected, actual)
+	}
+}
+
+func testNotFound(t *testing.T, store users.Store) {
+	u := newUser(t)
+	if _, err := store.GetByID(context.Background(), -1); !errors.Is(err, users.ErrUserNotFound) {
+		t.Errorf("GetByID: expected %v but got %v", users.ErrUserNotFound, err)
+	}
+	if _, err := store.GetByEmail(context.Background(), u.Email); !errors.Is(err, users.ErrUserNotFound) {
+		t.Errorf("GetByEmail: expected %v but got %v", users.ErrUserNotFound, err)
+	}
+	if _, err := store.GetByUserName(context.Background(), u.UserName); !errors.Is(err, users.ErrUserNotFound) {
+		t.Errorf("GetByUserName: expected %v but got %v", users.ErrUserNotFound, err)
+	}
+	if _, err := store.Update(context.Background(), -1, &users.Updates{FirstName: stringPtr("Nobody")}); !errors.Is(err, users.ErrUserNotFound) {
+		t.Errorf("Update: expected %v but got %v", users.ErrUserNotFound, err)
+	}
+}
+
+func testInsertAndGet(t *testing.T, store users.Store) {
+	u := insert(t, store)
+	if u.ID <= 0 {
+		t.Fatalf("Insert did not assign an ID: got %d", u.ID)
+	}
+	second := insert(t, store)
+	if second.ID == u.ID {
+		t.Errorf("Insert assigned the same ID to two users: %d", u.ID)
+	}
+
+	got, err := store.GetByID(context.Background(), u.ID)
+	if err != nil {
+		t.Fatalf("GetByID: unexpected error: %v", err)
+	}
+	checkUser(t, "GetByID", u, got)
+
+	got, err = store.GetByEmail(context.Background(), u.Email)
+	if err != nil {
+		t.Fatalf("GetByEmail: unexpected error: %v", err)
+	}
+	checkUser(t, "GetByEmail", u, got)
+
+	got, err = store.GetByUserName(context.Background(), u.UserName)
+	if err != nil {
+		t.Fatalf("GetByUserName: unexpected error: %v", err)
+	}
+	checkUser(t, "GetByUserName", u, got)
+}
+
+func testDuplicates(t *testing.T, store users.Store) {
+	u := insert(t, store)
+
+	dupEmail := newUser(t)
+	dupEmail.Email = u.Email
+	if _, err := store.Insert(context.Background(), dupEmail); !errors.Is(err, users.ErrDuplicateEmail) {
+		t.Errorf("Insert with a used email: expected %v but got %v", users.ErrDuplicateEmail, err)
+	}
+
+	dupUserName := newUser(t)
+	dupUserName.UserName = u.UserName
+	if _, err := store.Insert(context.Background(), dupUserName); !errors.Is(err, users.ErrDuplicateUserName) {
+		t.Errorf("Insert with a used username: expected %v but got %v", users.ErrDuplicateUserName, err)
+	}
+
+	//the failed inserts must not have replaced the original user
+	got, err := store.GetByEmail(context.Background(), u.Email)
+	if err != nil {
+		t.Fatalf("GetByEmail: unexpected error: %v", err)
+	}
+	checkUser(t, "GetByEmail after duplicate inserts", u, got)
+}
+
+func testUpdate(t *testing.T, store users.Store) {
+	u := insert(t, store)
+	updated, err := store.Update(context.Background(), u.ID, &users.Updates{FirstName: stringPtr("Updated"), LastName: stringPtr("Name")})
+	if err != nil {
+		t.Fatalf("Update: unexpected error: %v", err)
+	}
+	if updated.FirstName != "Updated" || updated.LastName != "Name" {
+		t.Errorf("Update: updates were not applied: %+v", updated)
+	}
+	got, err := store.GetByID(context.Background(), u.ID)
+	if err != nil {
+		t.Fatalf("GetByID after Update: unexpected error: %v", err)
+	}
+	checkUser(t, "GetByID after Update", updated, got)
+
+	//fields left out of the updates keep their values
+	targetRoles := []string{"Software Engineer", "Data Scientist"}
+	majors := []string{"Computer Science", "Mathematics"}
+	jobTypes := []string{users.JobTypeInternship, users.JobTypeNewGrad}
+	seasons := []string{"Summer 2024", "Fall 2024"}
+	expected := *updated
+	expected.UserName = u.UserName + "_renamed"
+	expected.Bio = "Looking for internships ✨"
+	expected.TargetRoles = targetRoles
+	expected.School = "University of Washington"
+	expected.Degree = users.DegreeBachelor
+	expected.Majors = majors
+	expected.ExpectedGraduation = "2025-06"
+	expected.TargetJobTypes = jobTypes
+	expected.TargetSeasons = seasons
+	expected.Visibility = users.VisibilityPublic
+	updated, err = store.Update(context.Background(), u.ID, &users.Updates{
+		UserName:           stringPtr(expected.UserName),
+		Bio:                stringPtr(expected.Bio),
+		TargetRoles:        &targetRoles,
+		School:             stringPtr(expected.School),
+		Degree:             stringPtr(expected.Degree),
+		Majors:             &majors,
+		ExpectedGraduation: stringPtr(expected.ExpectedGraduation),
+		TargetJobTypes:     &jobTypes,
+		TargetSeasons:      &seasons,
+		Visibility:         stringPtr(expected.Visibility),
+	})
+	if err != nil {
+		t.Fatalf("Update of profile fields: unexpected error: %v", err)
+	}
+	checkUser(t, "Update of profile fields", &expected, updated)
+	got, err = store.GetByUserName(context.Background(), expected.UserName)
+	if err != nil {
+		t.Fatalf("GetByUserName after Update: unexpected error: %v", err)
+	}
+	checkUser(t, "GetByUserName after Update", &expected, got)
+
+	//usernames stay unique
+	other := insert(t, store)
+	if _, err := store.Update(context.Background(), other.ID, &users.Updates{UserName: stringPtr(expected.UserName)}); !errors.Is(err, users.ErrDuplicateUserName) {
+		t.Errorf("Update to a used username: expected %v but got %v", users.ErrDuplicateUserName, err)
+	}
+
+	//invalid updates are rejected with the invalid fields
+	var validationErrs users.ValidationErrors
+	if _, err := store.Update(context.Background(), u.ID, &users.Updates{FirstName: stringPtr("L33t")}); !errors.As(err, &validationErrs) {
+		t.Errorf("Update with an invalid first name: expected validation errors but got %v", err)
+	}
+}
+
+func testUpdatePhotoURL(t *testing.T, store users.Store) {
+	u := insert(t, store)
+	expected := *u
+	expected.PhotoURL = fmt.Sprintf("/v1/users/%d/avatar?v=%d", u.ID, time.Now().UnixNano())
+	updated, err := store.UpdatePhotoURL(context.Background(), u.ID, expected.PhotoURL)
+	if err != nil {
+		t.Fatalf("UpdatePhotoURL: unexpected error: %v", err)
+	}
+	checkUser(t, "UpdatePhotoURL", &expected, updated)
+	got, err := store.GetByID(context.Background(), u.ID)
+	if err != nil {
+		t.Fatalf("GetByID after UpdatePhotoURL: unexpected error: %v", err)
+	}
+	checkUser(t, "GetByID after UpdatePhotoURL", &expected, got)
+
+	if _, err := store.UpdatePhotoURL(context.Background(), -1, expected.PhotoURL); !errors.Is(err, users.ErrUserNotFound) {
+		t.Errorf("UpdatePhotoURL of a missing user: expected %v but got %v", users.ErrUserNotFound, err)
+	}
+}
+
+func testUpdatePassHash(t *testing.T, store users.Store) {
+	u := insert(t, store)
+	other := insert(t, store)
+	passHash := []byte("newpasshash")
+	if err := store.UpdatePassHash(context.Background(), u.ID, passHash); err != nil {
+		t.Fatalf("UpdatePassHash: unexpected error: %v", err)
+	}
+	//the store must not keep the caller's slice
+	passHash[0] = 'X'
+	expected := *u
+	expected.PassHash = []byte("newpasshash")
+	got, err := store.GetByID(context.Background(), u.ID)
+	if err != nil {
+		t.Fatalf("GetByID after UpdatePassHash: unexpected error: %v", err)
+	}
+	checkUser(t, "GetByID after UpdatePassHash", &expected, got)
+	got, err = store.GetByID(context.Background(), other.ID)
+	if err != nil {
+		t.Fatalf("GetByID after UpdatePassHash: unexpected error: %v", err)
+	}
+	checkUser(t, "UpdatePassHash of another user", other, got)
+
+	if err := store.UpdatePassHash(context.Background(), -1, passHash); !errors.Is(err, users.ErrUserNotFound) {
+		t.Errorf("UpdatePassHash of a missing user: expected %v but got %v", users.ErrUserNotFound, err)
+	}
+}
+
+func testDelete(t *testing.T, store users.Store) {
+	u := insert(t, store)
+	other := insert(t, store)
+	if err := store.Delete(context.Background(), u.ID); err != nil {
+		t.Fatalf("Delete: unexpected error: %v", err)
+	}
+	if _, err := store.GetByID(context.Background(), u.ID); !errors.Is(err, users.ErrUserNotFound) {
+		t.Errorf("GetByID after Delete: expected %v but got %v", users.ErrUserNotFound, err)
+	}
+	if _, err := store.GetByEmail(context.Background(), u.Email); !errors.Is(err, users.ErrUserNotFound) {
+		t.Errorf("GetByEmail after Delete: expected %v but got %v", users.ErrUserNotFound, err)
+	}
+	if _, err := store.GetByID(context.Background(), other.ID); err != nil {
+		t.Errorf("deleting one user affected another: %v", err)
+	}
+}
+
+func testLogSignIn(t *testing.T, store users.Store) {
+	u := insert(t, store)
+	signIn := &users.UserSignIn{
+		UserID:     u.ID,
+		SignInTime: time.Now().UTC().Truncate(time.Second),
+		IP:         "127.0.0.1",
+	}
+	logged, err := store.LogSignIn(context.Background(), signIn)
+	if err != nil {
+		t.Fatalf("LogSignIn: unexpected error: %v", err)
+	}
+	if logged.ID <= 0 {
+		t.Errorf("LogSignIn did not assign an ID: got %d", logged.ID)
+	}
+	if logged.UserID != u.ID || logged.IP != signIn.IP || !logged.SignInTime.Equal(signIn.SignInTime) {
+		t.Errorf("LogSignIn: incorrect sign-in returned:\nEXPECTED\n%+v\nACTUAL\n%+v", signIn, logged)
+	}
+}
+
+func testGetSignIns(t *testing.T, store users.Store) {
+	u := insert(t, store)
+	other := insert(t, store)
+	logged := []*users.UserSignIn{}
+	for i := 0; i < 3; i++ {
+		si, err := store.LogSignIn(context.Background(), &users.UserSignIn{UserID: u.ID, SignInTime: time.Now().UTC(), IP: "127.0.0.1"})
+		if err != nil {
+			t.Fatalf("LogSignIn: unexpected error: %v", err)
+		}
+		logged = append(logged, si)
+		if _, err := store.LogSignIn(context.Background(), &users.UserSignIn{UserID: other.ID, SignInTime: time.Now().UTC(), IP: "127.0.0.2"}); err != nil {
+			t.Fatalf("LogSignIn: unexpected error: %v", err)
+		}
+	}
+
+	newest, err := store.GetSignIns(context.Background(), u.ID, 0, 2)
+	if err != nil {
+		t.Fatalf("GetSignIns: unexpected error: %v", err)
+	}
+	if len(newest) != 2 || newest[0].ID != logged[2].ID || newest[1].ID != logged[1].ID {
+		t.Errorf("GetSignIns: expected the two newest sign-ins but got %+v", newest)
+	}
+	older, err := store.GetSignIns(context.Background(), u.ID, newest[1].ID, 2)
+	if err != nil {
+		t.Fatalf("GetSignIns: unexpected error: %v", err)
+	}
+	if len(older) != 1 || older[0].ID != logged[0].ID || older[0].UserID != u.ID {
+		t.Errorf("GetSignIns: expected the oldest sign-in but got %+v", older)
+	}
+}
+
+func testList(t *testing.T, store users.Store) {
+	first := insert(t, store)
+	second := insert(t, store)
+	third := insert(t, store)
+
+	listed, err := store.List(context.Background(), first.ID-1, 2)
+	if err != nil {
+		t.Fatalf("List: unexpected error: %v", err)
+	}
+	if len(listed) != 2 {
+		t.Fatalf("List: expected 2 users but got %d", len(listed))
+	}
+	checkUser(t, "List", first, listed[0])
+	checkUser(t, "List", second, listed[1])
+	listed, err = store.List(context.Background(), second.ID, 1)
+	if err != nil || len(listed) != 1 || listed[0].ID != third.ID {
+		t.Errorf("List: expected the third user after the second but got %+v, %v", listed, err)
+	}
+}
+
+func testRoleAndDisabled(t *testing.T, store users.Store) {
+	u := insert(t, store)
+	if u.Role != users.RoleUser || u.Disabled || u.Visibility != users.VisibilityConnections {
+		t.Errorf("Insert: expected an enabled user with role %q, visible to connections, but got %q, disabled %v, visibility %q",
+			users.RoleUser, u.Role, u.Disabled, u.Visibility)
+	}
+	admin, disabled, enabled := users.RoleAdmin, true, false
+	updated, err := store.UpdateAccount(context.Background(), u.ID, &users.AccountUpdates{Role: &admin, Disabled: &disabled})
+	if err != nil || updated.Role != users.RoleAdmin || !updated.Disabled {
+		t.Errorf("UpdateAccount: expected a disabled admin but got %+v, %v", updated, err)
+	}
+	//fields that aren't set are left unchanged
+	updated, err = store.UpdateAccount(context.Background(), u.ID, &users.AccountUpdates{Disabled: &enabled})
+	if err != nil || updated.Disabled || updated.Role != users.RoleAdmin {
+		t.Errorf("UpdateAccount: expected an enabled admin but got %+v, %v", updated, err)
+	}
+	got, err := store.GetByID(context.Background(), u.ID)
+	if err != nil {
+		t.Fatalf("GetByID: unexpected error: %v", err)
+	}
+	checkUser(t, "GetByID after UpdateAccount", updated, got)
+
+	if _, err := store.UpdateAccount(context.Background(), -1, &users.AccountUpdates{Role: &admin}); !errors.Is(err, users.ErrUserNotFound) {
+		t.Errorf("UpdateAccount: expected %v but got %v", users.ErrUserNotFound, err)
+	}
+}
+
+func testSignOut(t *testing.T, store users.Store) {
+	u := insert(t, store)
+	if u.SignedOutAt != nil || !u.SessionValid(time.Now()) {
+		t.Errorf("Insert: a new user should not be signed out")
+	}
+	at := time.Now().UTC().Truncate(time.Second)
+	if err := store.SignOut(context.Background(), u.ID, at); err != nil {
+		t.Fatalf("SignOut: unexpected error: %v", err)
+	}
+	got, err := store.GetByID(context.Background(), u.ID)
+	if err != nil {
+		t.Fatalf("GetByID: unexpected error: %v", err)
+	}
+	if got.SignedOutAt == nil || !got.SignedOutAt.Equal(at) {
+		t.Errorf("SignOut: expected the user to be signed out at %v but got %v", at, got.SignedOutAt)
+	}
+	if got.SessionValid(at.Add(-time.Minute)) || !got.SessionValid(at.Add(time.Minute)) {
+		t.Errorf("SessionValid: only sessions begun after %v should be valid", at)
+	}
+	if err := store.SignOut(context.Background(), -1, at); !errors.Is(err, users.ErrUserNotFound) {
+		t.Errorf("SignOut: expected %v but got %v", users.ErrUserNotFound, err)
+	}
+}
+
+func testUnicode(t *testing.T, store users.Store) {
+	u := newUser(t)
+	u.FirstName = "Zoë"
+	u.LastName = "李小龍"
+	u.UserName = "ñandú_" + u.UserName
+	u, err := store.Insert(context.Background(), u)
+	if err != nil {
+		t.Fatalf("Insert: unexpected error: %v", err)
+	}
+	got, err := store.GetByUserName(context.Background(), u.UserName)
+	if err != nil {
+		t.Fatalf("GetByUserName: unexpected error: %v", err)
+	}
+	checkUser(t, "GetByUserName", u, got)
+
+	updated, err := store.Update(context.Background(), u.ID, &users.Updates{FirstName: stringPtr("Ελένη"), LastName: stringPtr("Ñúñez")})
+	if err != nil {
+		t.Fatalf("Update: unexpected error: %v", err)
+	}
+	got, err = store.GetByID(context.Background(), u.ID)
+	if err != nil {
+		t.Fatalf("GetByID: unexpected error: %v", err)
+	}
+	checkUser(t, "GetByID after Update", updated, got)
+}
+
+func testCancelledContext(t *testing.T, store users.Store) {
+	u := insert(t, store)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := store.GetByID(ctx, u.ID); !errors.Is(err, context.Canceled) {
+		t.Errorf("GetByID: expected %v but got %v", context.Canceled, err)
+	}
+	if _, err := store.GetByEmail(ctx, u.Email); !errors.Is(err, context.Canceled) {
+		t.Errorf("GetByEmail: expected %v but got %v", context.Canceled, err)
+	}
+	if _, err := store.Insert(ctx, newUser(t)); !errors.Is(err, context.Canceled) {
+		t.Errorf("Insert: expected %v but got %v", context.Canceled, err)
+	}
+}
+
+func testConcurrent(t *testing.T, store users.Store) {
+	const workers = 20
+	errs := make(chan error, workers)
+	ids := make([]int64, workers)
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			u, err := store.Insert(context.Background(), newUser(t))
+			if err != nil {
+				errs <- fmt.Errorf("worker %d: Insert: %v", i, err)
+				return
+			}
+			ids[i] = u.ID
+			got, err := store.GetByEmail(context.Background(), u.Email)
+			if err != nil || got.ID != u.ID {
+				errs <- fmt.Errorf("worker %d: GetByEmail returned %+v, %v", i, got, err)
+				return
+			}
+			if _, err := store.Update(context.Background(), u.ID, &users.Updates{FirstName: stringPtr("Worker")}); err != nil {
+				errs <- fmt.Errorf("worker %d: Update: %v", i, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	seen := map[int64]bool{}
+	for _, id := range ids {
+		if id != 0 && seen[id] {
+			t.Errorf("Insert assigned ID %d to more than one user", id)
+		}
+		seen[id] = true
+	}
+}
+
+func testConcurrentDuplicates(t *testing.T, store users.Store) {
+	//every insert races for the same email, so exactly one should win
+	const workers = 20
+	email := newUser(t).Email
+	toInsert := make([]*users.User, workers)
+	for i := range toInsert {
+		toInsert[i] = newUser(t)
+		toInsert[i].Email = email
+	}
+
+	errs := make(chan error, workers)
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := store.Insert(context.Background(), toInsert[i])
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	inserted := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			inserted++
+		case !errors.Is(err, users.ErrDuplicateEmail):
+			t.Errorf("Insert with a used email: expected %v but got %v", users.ErrDuplicateEmail, err)
+		}
+	}
+	if inserted != 1 {
+		t.Errorf("expected exactly one insert to succeed but %d did", inserted)
+	}
+}
@@ -0,0 +1,144 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"JobTracker/servers/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+//TracedStore is a Store that records each call to
+//the Store it wraps in a tracing span
+type TracedStore struct {
+	Store Store
+}
+
+//NewTracedStore returns a TracedStore wrapping `store`
+func NewTracedStore(store Store) *TracedStore {
+	return &TracedStore{Store: store}
+}
+
+//startSpan begins the span of a call to `method`
+func startSpan(ctx context.Context, method string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracing.Start(ctx, "users.Store."+method, tracing.KindInternal, attrs...)
+}
+
+//endSpan ends the span of a call that returned `err`. Users that
+//weren't found and duplicates aren't failures of the store.
+func endSpan(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, ErrUserNotFound) &&
+		!errors.Is(err, ErrDuplicateEmail) && !errors.Is(err, ErrDuplicateUserName) {
+		tracing.RecordError(span, err)
+	}
+	span.End()
+}
+
+//Store implementation
+
+//GetByID returns the User with the given ID
+func (ts *TracedStore) GetByID(ctx context.Context, id int64) (*User, error) {
+	ctx, span := startSpan(ctx, "GetByID", attribute.Int64("user.id", id))
+	u, err := ts.Store.GetByID(ctx, id)
+	endSpan(span, err)
+	return u, err
+}
+
+//GetByEmail returns the User with the given email
+func (ts *TracedStore) GetByEmail(ctx context.Context, email string) (*User, error) {
+	ctx, span := startSpan(ctx, "GetByEmail")
+	u, err := ts.Store.GetByEmail(ctx, email)
+	endSpan(span, err)
+	return u, err
+}
+
+//GetByUserName returns the User with the given Username
+func (ts *TracedStore) GetByUserName(ctx context.Context, username string) (*User, error) {
+	ctx, span := startSpan(ctx, "GetByUserName")
+	u, err := ts.Store.GetByUserName(ctx, username)
+	endSpan(span, err)
+	return u, err
+}
+
+//Insert inserts the user
+func (ts *TracedStore) Insert(ctx context.Context, user *User) (*User, error) {
+	ctx, span := startSpan(ctx, "Insert")
+	u, err := ts.Store.Insert(ctx, user)
+	endSpan(span, err)
+	return u, err
+}
+
+//Update applies the updates to the user with the given ID
+func (ts *TracedStore) Update(ctx context.Context, id int64, updates *Updates) (*User, error) {
+	ctx, span := startSpan(ctx, "Update", attribute.Int64("user.id", id))
+	u, err := ts.Store.Update(ctx, id, updates)
+	endSpan(span, err)
+	return u, err
+}
+
+//UpdatePhotoURL sets the photo URL of the user with the given ID
+func (ts *TracedStore) UpdatePhotoURL(ctx context.Context, id int64, photoURL string) (*User, error) {
+	ctx, span := startSpan(ctx, "UpdatePhotoURL", attribute.Int64("user.id", id))
+	u, err := ts.Store.UpdatePhotoURL(ctx, id, photoURL)
+	endSpan(span, err)
+	return u, err
+}
+
+//UpdatePassHash replaces the password hash of the user with the given ID
+func (ts *TracedStore) UpdatePassHash(ctx context.Context, id int64, passHash []byte) error {
+	ctx, span := startSpan(ctx, "UpdatePassHash", attribute.Int64("user.id", id))
+	err := ts.Store.UpdatePassHash(ctx, id, passHash)
+	endSpan(span, err)
+	return err
+}
+
+//Delete deletes the user with the given ID
+func (ts *TracedStore) Delete(ctx context.Context, id int64) error {
+	ctx, span := startSpan(ctx, "Delete", attribute.Int64("user.id", id))
+	err := ts.Store.Delete(ctx, id)
+	endSpan(span, err)
+	return err
+}
+
+//LogSignIn logs when a user successfully signs in
+func (ts *TracedStore) LogSignIn(ctx context.Context, signin *UserSignIn) (*UserSignIn, error) {
+	ctx, span := startSpan(ctx, "LogSignIn")
+	s, err := ts.Store.LogSignIn(ctx, signin)
+	endSpan(span, err)
+	return s, err
+}
+
+//List returns up to `limit` users with IDs greater than `afterID`
+func (ts *TracedStore) List(ctx context.Context, afterID int64, limit int) ([]*User, error) {
+	ctx, span := startSpan(ctx, "List", attribute.Int("limit", limit))
+	us, err := ts.Store.List(ctx, afterID, limit)
+	endSpan(span, err)
+	return us, err
+}
+
+//UpdateAccount changes the role and disabled status of the user with the given ID
+func (ts *TracedStore) UpdateAccount(ctx context.Context, id int64, updates *AccountUpdates) (*User, error) {
+	ctx, span := startSpan(ctx, "UpdateAccount", attribute.Int64("user.id", id))
+	u, err := ts.Store.UpdateAccount(ctx, id, updates)
+	endSpan(span, err)
+	return u, err
+}
+
+//SignOut ends every session the user with the given ID began before `at`
+func (ts *TracedStore) SignOut(ctx context.Context, id int64, at time.Time) error {
+	ctx, span := startSpan(ctx, "SignOut", attribute.Int64("user.id", id))
+	err := ts.Store.SignOut(ctx, id, at)
+	endSpan(span, err)
+	return err
+}
+
+//GetSignIns returns up to `limit` of the user's sign-ins, newest first
+func (ts *TracedStore) GetSignIns(ctx context.Context, userID int64, beforeID int64, limit int) ([]*UserSignIn, error) {
+	ctx, span := startSpan(ctx, "GetSignIns", attribute.Int64("user.id", userID), attribute.Int("limit", limit))
+	s, err := ts.Store.GetSignIns(ctx, userID, beforeID, limit)
+	endSpan(span, err)
+	return s, err
+}
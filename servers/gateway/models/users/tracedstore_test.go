@@ -0,0 +1,41 @@
+package users_test
+
+import (
+	"context"
+	"testing"
+
+	"JobTracker/servers/gateway/models/users"
+	"JobTracker/servers/gateway/models/users/storetest"
+	"JobTracker/servers/tracing"
+	"JobTracker/servers/tracing/tracingtest"
+
+	"go.opentelemetry.io/otel/codes"
+)
+
+func TestTracedStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) users.Store {
+		return users.NewTracedStore(users.NewMemStore())
+	})
+}
+
+func TestTracedStoreSpans(t *testing.T) {
+	recorder := tracingtest.NewRecorder(t)
+	store := users.NewTracedStore(users.NewMemStore())
+
+	ctx, parent := tracing.Start(context.Background(), "request", tracing.KindServer)
+	if _, err := store.GetByID(ctx, 1); err != users.ErrUserNotFound {
+		t.Fatalf("expected ErrUserNotFound but got %v", err)
+	}
+	parent.End()
+
+	spans := recorder.Named("users.Store.GetByID")
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 GetByID span but got %d", len(spans))
+	}
+	if spans[0].Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("the store's span should be a child of the request's span")
+	}
+	if spans[0].Status().Code == codes.Error {
+		t.Errorf("users that aren't found shouldn't mark the span as failed, got %+v", spans[0].Status())
+	}
+}
@@ -0,0 +1,285 @@
+package users
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+//Limits on profile fields, matching the column sizes in the users table
+const (
+	maxEmailLength      = 320
+	maxNameLength       = 32
+	maxUserNameLength   = 255
+	maxBioLength        = 4096
+	maxSchoolLength     = 128
+	maxTargetRoles      = 10
+	maxTargetRoleLength = 128
+	maxMajors           = 3
+	maxMajorLength      = 128
+	maxTargetSeasons    = 8
+	minGraduationYear   = 1900
+	maxGraduationYear   = 2100
+)
+
+//expectedGraduationLayout is the time layout of ExpectedGraduation
+const expectedGraduationLayout = "2006-01"
+
+//validDegrees are the values Degree can be set to
+var validDegrees = map[string]bool{
+	"":              true,
+	DegreeAssociate: true,
+	DegreeBachelor:  true,
+	DegreeMaster:    true,
+	DegreeDoctorate: true,
+	DegreeOther:     true,
+}
+
+//validVisibilities are the values Visibility can be set to
+var validVisibilities = map[string]bool{
+	VisibilityPublic:      true,
+	VisibilityConnections: true,
+	VisibilityPrivate:     true,
+}
+
+//validJobTypes are the values TargetJobTypes can hold
+var validJobTypes = map[string]bool{
+	JobTypeInternship: true,
+	JobTypeNewGrad:    true,
+}
+
+//validSeasons are the seasons a target season can start with
+var validSeasons = map[string]bool{
+	"Spring": true,
+	"Summer": true,
+	"Fall":   true,
+	"Winter": true,
+}
+
+//Updates represents allowed updates to a user profile.
+//Only the fields that are set (non-nil) are changed;
+//the rest of the profile is left as it is.
+type Updates struct {
+	FirstName          *string   `json:"firstName,omitempty"`
+	LastName           *string   `json:"lastName,omitempty"`
+	UserName           *string   `json:"userName,omitempty"`
+	Bio                *string   `json:"bio,omitempty"`
+	TargetRoles        *[]string `json:"targetRoles,omitempty"`
+	School             *string   `json:"school,omitempty"`
+	Degree             *string   `json:"degree,omitempty"`
+	Majors             *[]string `json:"majors,omitempty"`
+	ExpectedGraduation *string   `json:"expectedGraduation,omitempty"`
+	TargetJobTypes     *[]string `json:"targetJobTypes,omitempty"`
+	TargetSeasons      *[]string `json:"targetSeasons,omitempty"`
+	Visibility         *string   `json:"visibility,omitempty"`
+}
+
+//AccountUpdates are the changes admins can make to a user's
+//account. Fields that are nil are left unchanged.
+type AccountUpdates struct {
+	Role     *string `json:"role"`
+	Disabled *bool   `json:"disabled"`
+}
+
+//FieldError describes why the value of one field is invalid
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+//ValidationErrors is returned when one or more fields are invalid
+type ValidationErrors []*FieldError
+
+//Error implements the error interface
+func (ve ValidationErrors) Error() string {
+	msgs := make([]string, len(ve))
+	for i, fe := range ve {
+		msgs[i] = fe.Field + ": " + fe.Message
+	}
+	return "invalid fields: " + strings.Join(msgs, "; ")
+}
+
+//nameErrors returns why `name` can't be a first or last name,
+//or nil if it can. Names are checked the same way at signup.
+func nameErrors(name string) []string {
+	var messages []string
+	if utf8.RuneCountInString(name) > maxNameLength {
+		messages = append(messages, fmt.Sprintf("must be at most %d characters", maxNameLength))
+	}
+	for _, r := range name {
+		if !unicode.IsLetter(r) {
+			messages = append(messages, "must only contain letters")
+			break
+		}
+	}
+	return messages
+}
+
+//userNameError returns why `userName` can't be a user
+//name, or "" if it can
+func userNameError(userName string) string {
+	switch {
+	case len(userName) == 0:
+		return "cannot be empty"
+	case strings.Contains(userName, " "):
+		return "cannot contain spaces"
+	case utf8.RuneCountInString(userName) > maxUserNameLength:
+		return fmt.Sprintf("must be at most %d characters", maxUserNameLength)
+	}
+	return ""
+}
+
+//Validate validates each field that is set, and returns
+//ValidationErrors listing every invalid field, or nil if
+//all the updates are valid
+func (updates *Updates) Validate() error {
+	errs := ValidationErrors{}
+	add := func(field string, format string, args ...interface{}) {
+		errs = append(errs, &FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	names := []struct {
+		field string
+		value *string
+	}{
+		{"firstName", updates.FirstName},
+		{"lastName", updates.LastName},
+	}
+	for _, name := range names {
+		if name.value == nil {
+			continue
+		}
+		for _, message := range nameErrors(*name.value) {
+			add(name.field, "%s", message)
+		}
+	}
+	if updates.UserName != nil {
+		if message := userNameError(*updates.UserName); len(message) != 0 {
+			add("userName", "%s", message)
+		}
+	}
+	if updates.Bio != nil && utf8.RuneCountInString(*updates.Bio) > maxBioLength {
+		add("bio", "must be at most %d characters", maxBioLength)
+	}
+	if updates.School != nil && utf8.RuneCountInString(*updates.School) > maxSchoolLength {
+		add("school", "must be at most %d characters", maxSchoolLength)
+	}
+	if updates.TargetRoles != nil {
+		if len(*updates.TargetRoles) > maxTargetRoles {
+			add("targetRoles", "must have at most %d roles", maxTargetRoles)
+		}
+		for _, role := range *updates.TargetRoles {
+			if len(strings.TrimSpace(role)) == 0 || utf8.RuneCountInString(role) > maxTargetRoleLength {
+				add("targetRoles", "each role must be between 1 and %d characters", maxTargetRoleLength)
+				break
+			}
+		}
+	}
+	if updates.Degree != nil && !validDegrees[*updates.Degree] {
+		add("degree", "must be one of %s, %s, %s, %s or %s",
+			DegreeAssociate, DegreeBachelor, DegreeMaster, DegreeDoctorate, DegreeOther)
+	}
+	if updates.Majors != nil {
+		if len(*updates.Majors) > maxMajors {
+			add("majors", "must have at most %d majors", maxMajors)
+		}
+		for _, major := range *updates.Majors {
+			if len(strings.TrimSpace(major)) == 0 || utf8.RuneCountInString(major) > maxMajorLength {
+				add("majors", "each major must be between 1 and %d characters", maxMajorLength)
+				break
+			}
+		}
+	}
+	if updates.ExpectedGraduation != nil && len(*updates.ExpectedGraduation) != 0 {
+		graduation, err := time.Parse(expectedGraduationLayout, *updates.ExpectedGraduation)
+		if err != nil || graduation.Year() < minGraduationYear || graduation.Year() > maxGraduationYear {
+			add("expectedGraduation", "must be a month between %d and %d, formatted as YYYY-MM", minGraduationYear, maxGraduationYear)
+		}
+	}
+	if updates.TargetJobTypes != nil {
+		for _, jobType := range *updates.TargetJobTypes {
+			if !validJobTypes[jobType] {
+				add("targetJobTypes", "each job type must be %s or %s", JobTypeInternship, JobTypeNewGrad)
+				break
+			}
+		}
+	}
+	if updates.TargetSeasons != nil {
+		if len(*updates.TargetSeasons) > maxTargetSeasons {
+			add("targetSeasons", "must have at most %d seasons", maxTargetSeasons)
+		}
+		for _, season := range *updates.TargetSeasons {
+			if !validSeason(season) {
+				add("targetSeasons", "each season must be Spring, Summer, Fall or Winter followed by a year, such as \"Summer 2024\"")
+				break
+			}
+		}
+	}
+	if updates.Visibility != nil && !validVisibilities[*updates.Visibility] {
+		add("visibility", "must be %s, %s or %s", VisibilityPublic, VisibilityConnections, VisibilityPrivate)
+	}
+
+	if len(errs) != 0 {
+		return errs
+	}
+	return nil
+}
+
+//ApplyUpdates applies the updates to the user. An error
+//is returned if the updates are invalid
+func (u *User) ApplyUpdates(updates *Updates) error {
+	if err := updates.Validate(); err != nil {
+		return err
+	}
+	if updates.FirstName != nil {
+		u.FirstName = *updates.FirstName
+	}
+	if updates.LastName != nil {
+		u.LastName = *updates.LastName
+	}
+	if updates.UserName != nil {
+		u.UserName = *updates.UserName
+	}
+	if updates.Bio != nil {
+		u.Bio = *updates.Bio
+	}
+	if updates.TargetRoles != nil {
+		u.TargetRoles = append([]string{}, *updates.TargetRoles...)
+	}
+	if updates.School != nil {
+		u.School = *updates.School
+	}
+	if updates.Degree != nil {
+		u.Degree = *updates.Degree
+	}
+	if updates.Majors != nil {
+		u.Majors = append([]string{}, *updates.Majors...)
+	}
+	if updates.ExpectedGraduation != nil {
+		u.ExpectedGraduation = *updates.ExpectedGraduation
+	}
+	if updates.TargetJobTypes != nil {
+		u.TargetJobTypes = append([]string{}, *updates.TargetJobTypes...)
+	}
+	if updates.TargetSeasons != nil {
+		u.TargetSeasons = append([]string{}, *updates.TargetSeasons...)
+	}
+	if updates.Visibility != nil {
+		u.Visibility = *updates.Visibility
+	}
+	return nil
+}
+
+//validSeason returns true if `season` is a season
+//followed by a year, such as "Summer 2024"
+func validSeason(season string) bool {
+	parts := strings.Split(season, " ")
+	if len(parts) != 2 || !validSeasons[parts[0]] {
+		return false
+	}
+	year, err := strconv.Atoi(parts[1])
+	return err == nil && year >= minGraduationYear && year <= maxGraduationYear
+}
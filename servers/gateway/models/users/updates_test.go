@@ -0,0 +1,154 @@
+package users
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUpdatesValidate(t *testing.T) {
+	cases := []struct {
+		name           string
+		hint           string
+		updates        *Updates
+		expectedFields []string
+	}{
+		{
+			"No Updates",
+			"Remember that every field is optional",
+			&Updates{},
+			nil,
+		},
+		{
+			"Valid Profile",
+			"Remember to accept valid values for every field",
+			&Updates{
+				FirstName:          stringPtr("Ada"),
+				UserName:           stringPtr("ada"),
+				Bio:                stringPtr("Looking for my first internship"),
+				TargetRoles:        &[]string{"Software Engineer"},
+				School:             stringPtr("University of Washington"),
+				Degree:             stringPtr(DegreeBachelor),
+				Majors:             &[]string{"Computer Science", "Linguistics"},
+				ExpectedGraduation: stringPtr("2025-06"),
+				TargetJobTypes:     &[]string{JobTypeInternship, JobTypeNewGrad},
+				TargetSeasons:      &[]string{"Summer 2024", "Fall 2025"},
+				Visibility:         stringPtr(VisibilityPublic),
+			},
+			nil,
+		},
+		{
+			"Clearing Fields",
+			"Remember that empty values clear the optional fields",
+			&Updates{
+				FirstName:          stringPtr(""),
+				Bio:                stringPtr(""),
+				TargetRoles:        &[]string{},
+				Degree:             stringPtr(""),
+				Majors:             &[]string{},
+				ExpectedGraduation: stringPtr(""),
+				TargetJobTypes:     &[]string{},
+				TargetSeasons:      &[]string{},
+			},
+			nil,
+		},
+		{
+			"Every Field Invalid",
+			"Remember to report every invalid field, not just the first",
+			&Updates{
+				FirstName:          stringPtr("L33t"),
+				LastName:           stringPtr(strings.Repeat("a", maxNameLength+1)),
+				UserName:           stringPtr("has space"),
+				Bio:                stringPtr(strings.Repeat("a", maxBioLength+1)),
+				TargetRoles:        &[]string{" "},
+				School:             stringPtr(strings.Repeat("a", maxSchoolLength+1)),
+				Degree:             stringPtr("kindergarten"),
+				Majors:             &[]string{""},
+				ExpectedGraduation: stringPtr("June 2024"),
+				TargetJobTypes:     &[]string{"contract"},
+				TargetSeasons:      &[]string{"summer 2024"},
+			},
+			[]string{"firstName", "lastName", "userName", "bio", "school", "targetRoles",
+				"degree", "majors", "expectedGraduation", "targetJobTypes", "targetSeasons"},
+		},
+		{
+			"Empty UserName",
+			"Remember that a username can't be cleared",
+			&Updates{UserName: stringPtr("")},
+			[]string{"userName"},
+		},
+		{
+			"Too Many Target Roles",
+			"Remember to limit the number of target roles",
+			&Updates{TargetRoles: &[]string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11"}},
+			[]string{"targetRoles"},
+		},
+		{
+			"Too Many Majors",
+			"Remember to limit the number of majors",
+			&Updates{Majors: &[]string{"Math", "Physics", "Chemistry", "Biology"}},
+			[]string{"majors"},
+		},
+		{
+			"Invalid Graduation Month",
+			"Remember that the expected graduation is a year and a month between 01 and 12",
+			&Updates{ExpectedGraduation: stringPtr("2024-13")},
+			[]string{"expectedGraduation"},
+		},
+		{
+			"Season Without Year",
+			"Remember that a target season needs a year",
+			&Updates{TargetSeasons: &[]string{"Summer"}},
+			[]string{"targetSeasons"},
+		},
+		{
+			"Unknown Visibility",
+			"Remember that profiles are public, connections-only or private",
+			&Updates{Visibility: stringPtr("friends")},
+			[]string{"visibility"},
+		},
+	}
+
+	for _, c := range cases {
+		err := c.updates.Validate()
+		if c.expectedFields == nil {
+			if err != nil {
+				t.Errorf("case %s: unexpected error: %v\nHINT: %s", c.name, err, c.hint)
+			}
+			continue
+		}
+		var validationErrs ValidationErrors
+		if !errors.As(err, &validationErrs) {
+			t.Errorf("case %s: expected ValidationErrors but got %v\nHINT: %s", c.name, err, c.hint)
+			continue
+		}
+		fields := []string{}
+		for _, fe := range validationErrs {
+			fields = append(fields, fe.Field)
+		}
+		if !reflect.DeepEqual(fields, c.expectedFields) {
+			t.Errorf("case %s: incorrect invalid fields: expected %v but got %v\nHINT: %s", c.name, c.expectedFields, fields, c.hint)
+		}
+	}
+}
+
+func TestApplyPartialUpdates(t *testing.T) {
+	u := &User{
+		FirstName:   "Keanu",
+		LastName:    "Reeves",
+		TargetRoles: []string{"Actor"},
+	}
+	roles := []string{"Software Engineer"}
+	if err := u.ApplyUpdates(&Updates{LastName: stringPtr("Smith"), TargetRoles: &roles}); err != nil {
+		t.Fatalf("unexpected error applying updates: %v", err)
+	}
+	if u.FirstName != "Keanu" || u.LastName != "Smith" {
+		t.Errorf("incorrect names after a partial update: got %q %q", u.FirstName, u.LastName)
+	}
+	//the user must not share the updates' slice
+	roles[0] = "Changed"
+	if !reflect.DeepEqual(u.TargetRoles, []string{"Software Engineer"}) {
+		t.Errorf("incorrect target roles: got %v", u.TargetRoles)
+	}
+}
@@ -7,29 +7,72 @@ import (
 	"net/mail"
 	"strings"
 	"time"
-	"unicode"
-
-	"golang.org/x/crypto/bcrypt"
+	"unicode/utf8"
 )
 
 //gravatarBasePhotoURL is the base URL for Gravatar image requests.
 //See https://id.gravatar.com/site/implement/images/ for details
 const gravatarBasePhotoURL = "https://www.gravatar.com/avatar/"
 
-//bcryptCost is the default bcrypt cost to use when hashing passwords
-var bcryptCost = 13
-
-//User represents a user account in the database
+//User represents a user account in the database.
+//Slices are never nil once the user is stored.
 type User struct {
-	ID        int64  `json:"id"`
-	Email     string `json:"-"` //never JSON encoded/decoded
-	PassHash  []byte `json:"-"` //never JSON encoded/decoded
-	UserName  string `json:"userName"`
-	FirstName string `json:"firstName"`
-	LastName  string `json:"lastName"`
-	PhotoURL  string `json:"photoURL"`
+	ID                 int64    `json:"id"`
+	Email              string   `json:"-"` //never JSON encoded/decoded
+	PassHash           []byte   `json:"-"` //never JSON encoded/decoded
+	UserName           string   `json:"userName"`
+	FirstName          string   `json:"firstName"`
+	LastName           string   `json:"lastName"`
+	PhotoURL           string   `json:"photoURL"`
+	Bio                string   `json:"bio"`
+	TargetRoles        []string `json:"targetRoles"`
+	School             string   `json:"school"`
+	Degree             string   `json:"degree"` //one of the Degree constants, or ""
+	Majors             []string `json:"majors"`
+	ExpectedGraduation string   `json:"expectedGraduation"` //"YYYY-MM", or ""
+	TargetJobTypes     []string `json:"targetJobTypes"`     //JobTypeInternship or JobTypeNewGrad
+	TargetSeasons      []string `json:"targetSeasons"`      //"<Season> <Year>", such as "Summer 2024"
+	Role               string   `json:"role"`               //RoleUser or RoleAdmin
+	Visibility         string   `json:"visibility"`         //who can see the whole profile
+	Disabled           bool     `json:"-"`                  //disabled users can't sign in
+	//SignedOutAt ends every session begun before it, or is nil
+	SignedOutAt *time.Time `json:"-"`
 }
 
+//Roles a user can have. Admins can manage other users.
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+//ValidRole returns true if `role` is one of the Role constants
+func ValidRole(role string) bool {
+	return role == RoleUser || role == RoleAdmin
+}
+
+//Who can see a user's whole profile. Everyone else sees their
+//PublicProfile without the details.
+const (
+	VisibilityPublic      = "public"
+	VisibilityConnections = "connections"
+	VisibilityPrivate     = "private"
+)
+
+//Degrees a user can be studying for
+const (
+	DegreeAssociate = "associate"
+	DegreeBachelor  = "bachelor"
+	DegreeMaster    = "master"
+	DegreeDoctorate = "doctorate"
+	DegreeOther     = "other"
+)
+
+//Kinds of jobs a user can be looking for
+const (
+	JobTypeInternship = "internship"
+	JobTypeNewGrad    = "new-grad"
+)
+
 //Credentials represents user sign-in credentials
 type Credentials struct {
 	Email    string `json:"email"`
@@ -46,12 +89,6 @@ type NewUser struct {
 	LastName     string `json:"lastName"`
 }
 
-//Updates represents allowed updates to a user profile
-type Updates struct {
-	FirstName string `json:"firstName"`
-	LastName  string `json:"lastName"`
-}
-
 //UserSignIn represents a succcessful sign-in by a user
 type UserSignIn struct {
 	ID         int64     `json:"id"`
@@ -60,42 +97,55 @@ type UserSignIn struct {
 	IP         string    `json:"ip"`
 }
 
-//Validate validates the new user and returns an error if
-//any of the validation rules fail, or nil if its valid
-func (nu *NewUser) Validate() error {
-	_, err := mail.ParseAddress(nu.Email)
-	if err != nil {
-		return fmt.Errorf("invalid email address")
+//Validate validates the new user, checking their password against
+//`policy`, and returns ValidationErrors listing every invalid field,
+//or ErrPasswordCheckFailed if the password couldn't be checked, or nil
+//if its valid. A nil policy means DefaultPasswordPolicy.
+func (nu *NewUser) Validate(policy *PasswordPolicy) error {
+	errs := ValidationErrors{}
+	add := func(field string, message string) {
+		errs = append(errs, &FieldError{Field: field, Message: message})
 	}
-	if len(nu.Password) < 6 {
-		return fmt.Errorf("password must be at least 6 characters")
+
+	if _, err := mail.ParseAddress(nu.Email); err != nil {
+		add("email", "must be a valid email address")
+	} else if utf8.RuneCountInString(strings.TrimSpace(nu.Email)) > maxEmailLength {
+		add("email", fmt.Sprintf("must be at most %d characters", maxEmailLength))
+	}
+	err := policy.Check(nu.Password, nu.UserName, nu.Email)
+	var passwordErrs ValidationErrors
+	if errors.As(err, &passwordErrs) {
+		errs = append(errs, passwordErrs...)
+	} else if err != nil {
+		return err
 	}
 	if nu.Password != nu.PasswordConf {
-		return fmt.Errorf("passwords are mismatched")
+		add("passwordConf", "must match the password")
 	}
-	if len(nu.UserName) == 0 {
-		return fmt.Errorf("username cannot be empty")
+	//the profile fields are checked like Updates.Validate does,
+	//so they fit their columns
+	if message := userNameError(nu.UserName); len(message) != 0 {
+		add("userName", message)
 	}
-	if strings.Contains(nu.UserName, " ") {
-		return fmt.Errorf("username cannot contain spaces")
+	for _, message := range nameErrors(nu.FirstName) {
+		add("firstName", message)
 	}
-	for _, r := range nu.FirstName {
-		if !unicode.IsLetter(r) {
-			return fmt.Errorf("illegal character in First Name")
-		}
+	for _, message := range nameErrors(nu.LastName) {
+		add("lastName", message)
 	}
-	for _, r := range nu.LastName {
-		if !unicode.IsLetter(r) {
-			return fmt.Errorf("illegal character in Last Name")
-		}
+
+	if len(errs) != 0 {
+		return errs
 	}
 	return nil
 }
 
-//ToUser converts the NewUser to a User, setting the
-//PhotoURL and PassHash fields appropriately
-func (nu *NewUser) ToUser() (*User, error) {
-	err := nu.Validate()
+//ToUser validates the NewUser against the password `policy` and
+//converts it to a User, setting the PhotoURL field and the PassHash
+//field to the password hashed with `hasher`. A nil hasher means
+//DefaultHasher.
+func (nu *NewUser) ToUser(policy *PasswordPolicy, hasher PasswordHasher) (*User, error) {
+	err := nu.Validate(policy)
 	if err != nil {
 		return nil, err
 	}
@@ -106,8 +156,13 @@ func (nu *NewUser) ToUser() (*User, error) {
 		FirstName: nu.FirstName,
 		LastName:  nu.LastName,
 	}
-	u.SetPassword(nu.Password)
-	u.SetPhotoURL(nu.Email)
+	u.initDefaults()
+	if err := u.SetPasswordWith(hasher, nu.Password); err != nil {
+		return nil, err
+	}
+	if err := u.SetPhotoURL(nu.Email); err != nil {
+		return nil, err
+	}
 	return u, nil
 }
 
@@ -130,16 +185,38 @@ func (u *User) FullName() string {
 
 //SetPhotoURL sets the user's photo URL to a gravatar image URL
 func (u *User) SetPhotoURL(email string) error {
-	//TODO: handle invalid email address
-	email = strings.ToLower(strings.TrimSpace(email))
-	emailHash := md5.Sum([]byte(email))
-	u.PhotoURL = gravatarBasePhotoURL + fmt.Sprintf("%x", emailHash)
+	photoURL, err := GravatarURL(email)
+	if err != nil {
+		return err
+	}
+	u.PhotoURL = photoURL
 	return nil
 }
 
-//SetPassword hashes the password and stores it in the PassHash field
+//GravatarURL returns the URL of the gravatar image for the email
+//address, which is used as a user's photo until they upload one
+func GravatarURL(email string) (string, error) {
+	addr, err := mail.ParseAddress(strings.TrimSpace(email))
+	if err != nil {
+		return "", fmt.Errorf("invalid email address")
+	}
+	emailHash := md5.Sum([]byte(strings.ToLower(addr.Address)))
+	return gravatarBasePhotoURL + fmt.Sprintf("%x", emailHash), nil
+}
+
+//SetPassword hashes the password with DefaultHasher
+//and stores it in the PassHash field
 func (u *User) SetPassword(password string) error {
-	passHash, err := bcrypt.GenerateFromPassword([]byte(password), bcryptCost)
+	return u.SetPasswordWith(nil, password)
+}
+
+//SetPasswordWith hashes the password with `hasher` and stores it in
+//the PassHash field. A nil hasher means DefaultHasher.
+func (u *User) SetPasswordWith(hasher PasswordHasher, password string) error {
+	if hasher == nil {
+		hasher = DefaultHasher
+	}
+	passHash, err := hasher.Hash(password)
 	if err != nil {
 		return err
 	}
@@ -150,23 +227,92 @@ func (u *User) SetPassword(password string) error {
 //Authenticate compares the plaintext password against the stored hash
 //and returns an error if they don't match, or nil if they do
 func (u *User) Authenticate(password string) error {
-	return bcrypt.CompareHashAndPassword(u.PassHash, []byte(password))
+	return VerifyPassword(u.PassHash, password)
+}
+
+//HasPassword returns whether the user has a password. Users created
+//by signing in with an OpenID Connect provider have none until they set one.
+func (u *User) HasPassword() bool {
+	return len(u.PassHash) != 0
 }
 
-//ApplyUpdates applies the updates to the user. An error
-//is returned if the updates are invalid
-func (u *User) ApplyUpdates(updates *Updates) error {
-	for _, r := range updates.FirstName {
-		if !unicode.IsLetter(r) {
-			return errors.New("illegal character in First Name")
+//initDefaults replaces the user's nil slices with empty ones,
+//so they are stored as empty lists and encoded as [] in JSON,
+//and gives the user RoleUser if they have no role and
+//VisibilityConnections if they have no visibility
+func (u *User) initDefaults() {
+	for _, slice := range []*[]string{&u.TargetRoles, &u.Majors, &u.TargetJobTypes, &u.TargetSeasons} {
+		if *slice == nil {
+			*slice = []string{}
 		}
 	}
-	for _, r := range updates.LastName {
-		if !unicode.IsLetter(r) {
-			return errors.New("illegal character in Last Name")
-		}
+	if len(u.Role) == 0 {
+		u.Role = RoleUser
 	}
-	u.FirstName = updates.FirstName
-	u.LastName = updates.LastName
-	return nil
+	if len(u.Visibility) == 0 {
+		u.Visibility = VisibilityConnections
+	}
+}
+
+//SessionValid returns true if a session the user began at
+//`startTime` hasn't been ended by signing them out everywhere
+func (u *User) SessionValid(startTime time.Time) bool {
+	return u.SignedOutAt == nil || startTime.After(*u.SignedOutAt)
+}
+
+//PublicProfile is a user's profile as other users see it. Users who
+//can't see the whole profile get a Limited one, which only has the
+//names they need to recognize the user and ask to connect.
+type PublicProfile struct {
+	ID                 int64    `json:"id"`
+	UserName           string   `json:"userName"`
+	FirstName          string   `json:"firstName"`
+	LastName           string   `json:"lastName"`
+	Limited            bool     `json:"limited"`
+	PhotoURL           string   `json:"photoURL,omitempty"`
+	Bio                string   `json:"bio,omitempty"`
+	TargetRoles        []string `json:"targetRoles,omitempty"`
+	School             string   `json:"school,omitempty"`
+	Degree             string   `json:"degree,omitempty"`
+	Majors             []string `json:"majors,omitempty"`
+	ExpectedGraduation string   `json:"expectedGraduation,omitempty"`
+	TargetJobTypes     []string `json:"targetJobTypes,omitempty"`
+	TargetSeasons      []string `json:"targetSeasons,omitempty"`
+}
+
+//VisibleTo returns true if another user can see the user's whole
+//profile. `connected` is whether the two users are connected.
+func (u *User) VisibleTo(connected bool) bool {
+	switch u.Visibility {
+	case VisibilityPublic:
+		return true
+	case VisibilityConnections:
+		return connected
+	default:
+		return false
+	}
+}
+
+//PublicProfile returns the user's profile as another user sees it.
+//`connected` is whether the two users are connected.
+func (u *User) PublicProfile(connected bool) *PublicProfile {
+	profile := &PublicProfile{
+		ID:        u.ID,
+		UserName:  u.UserName,
+		FirstName: u.FirstName,
+		LastName:  u.LastName,
+		Limited:   !u.VisibleTo(connected),
+	}
+	if !profile.Limited {
+		profile.PhotoURL = u.PhotoURL
+		profile.Bio = u.Bio
+		profile.TargetRoles = u.TargetRoles
+		profile.School = u.School
+		profile.Degree = u.Degree
+		profile.Majors = u.Majors
+		profile.ExpectedGraduation = u.ExpectedGraduation
+		profile.TargetJobTypes = u.TargetJobTypes
+		profile.TargetSeasons = u.TargetSeasons
+	}
+	return profile
 }
@@ -5,11 +5,11 @@ package users
 
 import (
 	"crypto/md5"
+	"errors"
 	"fmt"
+	"reflect"
 	"strings"
 	"testing"
-
-	"golang.org/x/crypto/bcrypt"
 )
 
 func TestValidate(t *testing.T) {
@@ -47,8 +47,8 @@ func TestValidate(t *testing.T) {
 			expectError:  true,
 		},
 		{
-			name:         "Password less than 6 characters",
-			hint:         "Check that the password length is at least 6 characters",
+			name:         "Password breaks the policy",
+			hint:         "Check the password against the password policy",
 			email:        "neo@matrix.net",
 			password:     "trin",
 			passwordConf: "trin",
@@ -122,7 +122,7 @@ func TestValidate(t *testing.T) {
 			FirstName:    c.firstName,
 			LastName:     c.lastName,
 		}
-		err := nu.Validate()
+		err := nu.Validate(nil)
 		if c.expectError && err == nil {
 			t.Errorf("Case: %s, Expecting an error but got nil, HINT: %s", c.name, c.hint)
 		}
@@ -167,7 +167,7 @@ func TestToUser(t *testing.T) {
 			FirstName:    "Thomas",
 			LastName:     "Anderson",
 		}
-		u, err := nu.ToUser()
+		u, err := nu.ToUser(nil, nil)
 		// Error validation
 		if c.expectError && err == nil {
 			t.Errorf("Case: %s, Expecting an error but got nil, HINT: %s", c.name, c.hint)
@@ -196,7 +196,7 @@ func TestToUser(t *testing.T) {
 				t.Errorf("Case: %s, Expected PhotoURL to be %s but got %s, HINT: %s", c.name, expectedPhotoURL, u.PhotoURL, c.hint)
 			}
 			// TODO: check PassHash is set correctly
-			err := bcrypt.CompareHashAndPassword(u.PassHash, []byte(nu.Password))
+			err := VerifyPassword(u.PassHash, nu.Password)
 			if err != nil {
 				t.Errorf("Case: %s, The PassHash was not set correctly and failed validation", c.name)
 			}
@@ -253,7 +253,43 @@ func TestFullName(t *testing.T) {
 	}
 }
 
-//TODO: Add unit test for SetPhotoURL
+func TestSetPhotoURL(t *testing.T) {
+	cases := []struct {
+		name        string
+		hint        string
+		email       string
+		expectError bool
+	}{
+		{
+			name:        "Valid email",
+			hint:        "Hash the lowercase, trimmed email address",
+			email:       " NEO@matrix.net ",
+			expectError: false,
+		},
+		{
+			name:        "Invalid email",
+			hint:        "Return an error rather than hashing an invalid email address",
+			email:       "not an email",
+			expectError: true,
+		},
+	}
+	for _, c := range cases {
+		u := &User{PhotoURL: "unchanged"}
+		err := u.SetPhotoURL(c.email)
+		if c.expectError {
+			if err == nil || u.PhotoURL != "unchanged" {
+				t.Errorf("Case: %s, Expecting an error and an unchanged PhotoURL but got %v, %s, HINT: %s", c.name, err, u.PhotoURL, c.hint)
+			}
+			continue
+		}
+		emailHash := md5.Sum([]byte("neo@matrix.net"))
+		expectedPhotoURL := gravatarBasePhotoURL + fmt.Sprintf("%x", emailHash)
+		if err != nil || u.PhotoURL != expectedPhotoURL {
+			t.Errorf("Case: %s, Expected PhotoURL to be %s but got %s, %v, HINT: %s", c.name, expectedPhotoURL, u.PhotoURL, err, c.hint)
+		}
+	}
+}
+
 //TODO: Add unit test for SetPassword
 
 func TestAuthenticate(t *testing.T) {
@@ -265,7 +301,7 @@ func TestAuthenticate(t *testing.T) {
 	}{
 		{
 			name:        "Incorrect password",
-			hint:        "Use bcrypt to verify that the password matches the hash",
+			hint:        "Verify that the password matches the hash",
 			password:    "wrongpassword",
 			expectError: true,
 		},
@@ -284,7 +320,7 @@ func TestAuthenticate(t *testing.T) {
 	}
 	for _, c := range cases {
 		correctPassword := "bingo!"
-		passHash, _ := bcrypt.GenerateFromPassword([]byte(correctPassword), bcryptCost)
+		passHash, _ := DefaultHasher.Hash(correctPassword)
 		u := &User{
 			PassHash: passHash,
 		}
@@ -342,8 +378,8 @@ func TestApplyUpdates(t *testing.T) {
 			LastName:  "Reeves",
 		}
 		updates := &Updates{
-			FirstName: c.firstName,
-			LastName:  c.lastName,
+			FirstName: &c.firstName,
+			LastName:  &c.lastName,
 		}
 		err := u.ApplyUpdates(updates)
 		if c.expectError && err == nil {
@@ -352,8 +388,96 @@ func TestApplyUpdates(t *testing.T) {
 		if !c.expectError && err != nil {
 			t.Errorf("Case: %s, Unexpected error: \"%v\", HINT: %s", c.name, err, c.hint)
 		}
-		if !c.expectError && (u.FirstName != updates.FirstName || u.LastName != updates.LastName) {
+		if !c.expectError && (u.FirstName != c.firstName || u.LastName != c.lastName) {
 			t.Errorf("Case: %s, HINT: %s", c.name, c.hint)
 		}
 	}
 }
+
+func TestPublicProfile(t *testing.T) {
+	u := &User{
+		ID:          1,
+		UserName:    "ada",
+		FirstName:   "Ada",
+		LastName:    "Lovelace",
+		PhotoURL:    "https://www.gravatar.com/avatar/1",
+		Bio:         "Looking for my first internship",
+		School:      "University of Washington",
+		TargetRoles: []string{"Software Engineer"},
+	}
+	cases := []struct {
+		visibility string
+		connected  bool
+		limited    bool
+	}{
+		{VisibilityPublic, false, false},
+		{VisibilityConnections, true, false},
+		{VisibilityConnections, false, true},
+		{VisibilityPrivate, true, true},
+		{"", true, true},
+	}
+	for _, c := range cases {
+		u.Visibility = c.visibility
+		profile := u.PublicProfile(c.connected)
+		if profile.Limited != c.limited {
+			t.Errorf("visibility %q, connected %v: expected limited to be %v", c.visibility, c.connected, c.limited)
+		}
+		if profile.ID != u.ID || profile.UserName != u.UserName || profile.FirstName != u.FirstName {
+			t.Errorf("visibility %q: every profile should identify the user: %+v", c.visibility, profile)
+		}
+		if c.limited && (len(profile.PhotoURL) != 0 || len(profile.Bio) != 0 || len(profile.School) != 0 || profile.TargetRoles != nil) {
+			t.Errorf("visibility %q: limited profile should hide the details: %+v", c.visibility, profile)
+		}
+		if !c.limited && (profile.PhotoURL != u.PhotoURL || profile.Bio != u.Bio || profile.School != u.School || len(profile.TargetRoles) != 1) {
+			t.Errorf("visibility %q: whole profile is missing details: %+v", c.visibility, profile)
+		}
+	}
+}
+
+func TestValidateFieldErrors(t *testing.T) {
+	nu := &NewUser{
+		Email:        "not an email",
+		Password:     "trinity123",
+		PasswordConf: "trinity321",
+		UserName:     "the one",
+		FirstName:    "Thomas",
+		LastName:     "And3rson",
+	}
+	var validationErrs ValidationErrors
+	if err := nu.Validate(nil); !errors.As(err, &validationErrs) {
+		t.Fatalf("expected ValidationErrors but got %v", err)
+	}
+	fields := []string{}
+	for _, fe := range validationErrs {
+		fields = append(fields, fe.Field)
+	}
+	expected := []string{"email", "passwordConf", "userName", "lastName"}
+	if !reflect.DeepEqual(fields, expected) {
+		t.Errorf("incorrect invalid fields: expected %v but got %v", expected, fields)
+	}
+}
+
+func TestValidateLengths(t *testing.T) {
+	//signup fields are limited like profile updates,
+	//so they fit their columns
+	nu := &NewUser{
+		Email:        strings.Repeat("n", maxEmailLength) + "@matrix.net",
+		Password:     "trinity123",
+		PasswordConf: "trinity123",
+		UserName:     strings.Repeat("n", maxUserNameLength+1),
+		FirstName:    strings.Repeat("T", maxNameLength+1),
+		LastName:     strings.Repeat("A", maxNameLength),
+	}
+	var validationErrs ValidationErrors
+	if err := nu.Validate(nil); !errors.As(err, &validationErrs) {
+		t.Fatalf("expected ValidationErrors but got %v", err)
+	}
+	fields := []string{}
+	for _, fe := range validationErrs {
+		fields = append(fields, fe.Field)
+	}
+	expected := []string{"email", "userName", "firstName"}
+	if !reflect.DeepEqual(fields, expected) {
+		t.Errorf("incorrect invalid fields: expected %v but got %v", expected, fields)
+	}
+}
@@ -0,0 +1,215 @@
+//Package oidctest runs a fake OpenID Connect provider for tests. It
+//serves discovery, keys and a token endpoint that checks PKCE, and
+//stands in for the user signing in at the authorization endpoint:
+//
+//	provider := oidctest.NewProvider(t, "client", "secret")
+//	...
+//	code, state := provider.Authorize(t, authURL, oidctest.Claims{"sub": "1", "email": "a@b.edu"})
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+//keyID identifies the provider's signing key
+const keyID = "oidctest"
+
+//Claims are the claims about the user to put in the ID token
+type Claims map[string]interface{}
+
+//Provider is a fake OpenID Connect provider
+type Provider struct {
+	Server       *httptest.Server
+	ClientID     string
+	ClientSecret string
+	key          *rsa.PrivateKey
+	mx           sync.Mutex
+	codes        map[string]*authorization
+}
+
+//authorization is a code waiting to be exchanged
+type authorization struct {
+	redirectURI string
+	challenge   string
+	nonce       string
+	claims      Claims
+}
+
+//NewProvider starts a fake provider for the client,
+//which is stopped when the test finishes
+func NewProvider(t *testing.T, clientID string, clientSecret string) *Provider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("error generating signing key: %v", err)
+	}
+	p := &Provider{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		key:          key,
+		codes:        map[string]*authorization{},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.serveDiscovery)
+	mux.HandleFunc("/keys", p.serveKeys)
+	mux.HandleFunc("/token", p.serveToken)
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Server.Close)
+	return p
+}
+
+//Issuer returns the provider's issuer URL
+func (p *Provider) Issuer() string {
+	return p.Server.URL
+}
+
+//Authorize stands in for the user signing in at `authURL` with an
+//account described by `claims`. It checks the request like a real
+//provider would and returns the code and state it would redirect with.
+func (p *Provider) Authorize(t *testing.T, authURL string, claims Claims) (string, string) {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("invalid authorization URL: %v", err)
+	}
+	query := u.Query()
+	if u.Scheme+"://"+u.Host != p.Issuer() || u.Path != "/authorize" {
+		t.Fatalf("authorization URL is not for this provider: %s", authURL)
+	}
+	if query.Get("client_id") != p.ClientID || query.Get("response_type") != "code" {
+		t.Fatalf("authorization URL is not for a code for %s: %s", p.ClientID, authURL)
+	}
+	if query.Get("code_challenge_method") != "S256" || len(query.Get("code_challenge")) == 0 {
+		t.Fatalf("authorization URL is missing an S256 PKCE challenge: %s", authURL)
+	}
+	if len(query.Get("nonce")) == 0 || len(query.Get("state")) == 0 {
+		t.Fatalf("authorization URL is missing a nonce or state: %s", authURL)
+	}
+
+	code := randomString()
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	p.codes[code] = &authorization{
+		redirectURI: query.Get("redirect_uri"),
+		challenge:   query.Get("code_challenge"),
+		nonce:       query.Get("nonce"),
+		claims:      claims,
+	}
+	return code, query.Get("state")
+}
+
+//serveDiscovery serves the provider's metadata
+func (p *Provider) serveDiscovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                p.Issuer(),
+		"authorization_endpoint":                p.Issuer() + "/authorize",
+		"token_endpoint":                        p.Issuer() + "/token",
+		"jwks_uri":                              p.Issuer() + "/keys",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+//serveKeys serves the public key ID tokens are signed with
+func (p *Provider) serveKeys(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, &jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+		{Key: &p.key.PublicKey, KeyID: keyID, Algorithm: string(jose.RS256), Use: "sig"},
+	}})
+}
+
+//serveToken exchanges a code for an ID token
+func (p *Provider) serveToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientID != p.ClientID || clientSecret != p.ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	//codes can only be used once
+	p.mx.Lock()
+	auth, found := p.codes[r.PostForm.Get("code")]
+	delete(p.codes, r.PostForm.Get("code"))
+	p.mx.Unlock()
+	verifierHash := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !found || auth.redirectURI != r.PostForm.Get("redirect_uri") ||
+		base64.RawURLEncoding.EncodeToString(verifierHash[:]) != auth.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	claims := map[string]interface{}{
+		"iss":   p.Issuer(),
+		"aud":   p.ClientID,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+		"nonce": auth.nonce,
+	}
+	for name, value := range auth.claims {
+		claims[name] = value
+	}
+	idToken, err := p.sign(claims)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+//sign returns the claims as a signed JWT
+func (p *Provider) sign(claims map[string]interface{}) (string, error) {
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.RS256, Key: jose.JSONWebKey{Key: p.key, KeyID: keyID}},
+		(&jose.SignerOptions{}).WithType("JWT"),
+	)
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signed, err := signer.Sign(payload)
+	if err != nil {
+		return "", err
+	}
+	return signed.CompactSerialize()
+}
+
+//randomString returns a random string for codes and tokens
+func randomString() string {
+	random := make([]byte, 16)
+	rand.Read(random)
+	return base64.RawURLEncoding.EncodeToString(random)
+}
+
+//writeJSON responds with `v` encoded as JSON
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
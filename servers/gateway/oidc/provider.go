@@ -0,0 +1,138 @@
+//Package oidc signs users in with OpenID Connect providers, such as
+//Google or a university's identity provider, using the authorization
+//code flow with PKCE (RFC 7636). Providers are configured by their
+//issuer URL, from which their endpoints and keys are discovered.
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+
+	coreoidc "github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+//ErrExchangeFailed is returned when the provider rejects an
+//authorization code, or returns an ID token that isn't valid
+var ErrExchangeFailed = errors.New("the provider did not accept the sign in")
+
+//Config configures an OpenID Connect provider
+type Config struct {
+	//Name identifies the provider in URLs, such as "google"
+	Name string
+	//Issuer is the provider's issuer URL, such as https://accounts.google.com
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	//RedirectURL is where the provider sends users after they sign in.
+	//It must be registered with the provider.
+	RedirectURL string
+	//Scopes are requested in addition to "openid", "email" and "profile"
+	Scopes []string
+	//HTTPClient is used to talk to the provider. If nil,
+	//http.DefaultClient is used.
+	HTTPClient *http.Client
+}
+
+//Claims are the claims about the user from a verified ID token
+type Claims struct {
+	Issuer        string `json:"iss"`
+	Subject       string `json:"sub"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+	GivenName     string `json:"given_name"`
+	FamilyName    string `json:"family_name"`
+}
+
+//Provider is an OpenID Connect provider users can sign in with
+type Provider struct {
+	Name       string
+	Issuer     string
+	oauth2     *oauth2.Config
+	verifier   *coreoidc.IDTokenVerifier
+	httpClient *http.Client
+}
+
+//NewProvider discovers the provider's endpoints and keys from its
+//issuer URL and returns a new Provider. The provider's keys are
+//refreshed with `ctx`, so it must last as long as the Provider.
+func NewProvider(ctx context.Context, cfg *Config) (*Provider, error) {
+	if len(cfg.Name) == 0 || len(cfg.Issuer) == 0 || len(cfg.ClientID) == 0 || len(cfg.RedirectURL) == 0 {
+		return nil, fmt.Errorf("a provider needs a name, issuer, client ID and redirect URL")
+	}
+	httpClient := cfg.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	discovered, err := coreoidc.NewProvider(coreoidc.ClientContext(ctx, httpClient), cfg.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("error discovering the %s provider: %v", cfg.Name, err)
+	}
+	return &Provider{
+		Name:   cfg.Name,
+		Issuer: cfg.Issuer,
+		oauth2: &oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			Endpoint:     discovered.Endpoint(),
+			RedirectURL:  cfg.RedirectURL,
+			Scopes:       append([]string{coreoidc.ScopeOpenID, "email", "profile"}, cfg.Scopes...),
+		},
+		verifier:   discovered.Verifier(&coreoidc.Config{ClientID: cfg.ClientID}),
+		httpClient: httpClient,
+	}, nil
+}
+
+//AuthCodeURL returns the URL to send the user to to sign in with
+//the provider. `state` is returned to the redirect URL, the ID token
+//must contain `nonce`, and `verifier` must be given to Exchange.
+func (p *Provider) AuthCodeURL(state string, nonce string, verifier string) string {
+	return p.oauth2.AuthCodeURL(state,
+		coreoidc.Nonce(nonce),
+		oauth2.SetAuthURLParam("code_challenge", CodeChallenge(verifier)),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	)
+}
+
+//Exchange exchanges the authorization code from the redirect for
+//an ID token, verifies it and returns its claims. It returns an error
+//wrapping ErrExchangeFailed if the provider rejects the code or the
+//ID token is not valid, or another error if the provider can't be reached.
+func (p *Provider) Exchange(ctx context.Context, code string, verifier string, nonce string) (*Claims, error) {
+	ctx = coreoidc.ClientContext(ctx, p.httpClient)
+	token, err := p.oauth2.Exchange(ctx, code, oauth2.SetAuthURLParam("code_verifier", verifier))
+	var retrieveErr *oauth2.RetrieveError
+	if errors.As(err, &retrieveErr) {
+		return nil, fmt.Errorf("%w: %v", ErrExchangeFailed, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error exchanging the code with the %s provider: %v", p.Name, err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, fmt.Errorf("%w: no ID token was returned", ErrExchangeFailed)
+	}
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrExchangeFailed, err)
+	}
+	if idToken.Nonce != nonce {
+		return nil, fmt.Errorf("%w: the ID token's nonce doesn't match", ErrExchangeFailed)
+	}
+	claims := &Claims{}
+	if err := idToken.Claims(claims); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrExchangeFailed, err)
+	}
+	return claims, nil
+}
+
+//CodeChallenge returns the S256 PKCE code challenge for the verifier
+func CodeChallenge(verifier string) string {
+	hash := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
@@ -0,0 +1,101 @@
+package oidc_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"JobTracker/servers/gateway/oidc"
+	"JobTracker/servers/gateway/oidc/oidctest"
+)
+
+func newProvider(t *testing.T, fake *oidctest.Provider) *oidc.Provider {
+	provider, err := oidc.NewProvider(context.Background(), &oidc.Config{
+		Name:         "school",
+		Issuer:       fake.Issuer(),
+		ClientID:     fake.ClientID,
+		ClientSecret: fake.ClientSecret,
+		RedirectURL:  "https://jobtracker.fyi/signin/school",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating provider: %v", err)
+	}
+	return provider
+}
+
+func TestProviderExchange(t *testing.T) {
+	fake := oidctest.NewProvider(t, "jobtracker", "secret")
+	provider := newProvider(t, fake)
+	account := oidctest.Claims{"sub": "1234", "email": "neo@uw.edu", "email_verified": true, "given_name": "Thomas"}
+
+	//signIn goes through the flow as the user,
+	//returning the sign in and the code from the redirect
+	signIn := func() (*oidc.SignIn, string) {
+		s, err := oidc.NewSignIn()
+		if err != nil {
+			t.Fatalf("unexpected error creating sign in: %v", err)
+		}
+		code, state := fake.Authorize(t, provider.AuthCodeURL(s.State, s.Nonce, s.Verifier), account)
+		if state != s.State {
+			t.Fatalf("the provider redirected with state %q but expected %q", state, s.State)
+		}
+		return s, code
+	}
+
+	s, code := signIn()
+	claims, err := provider.Exchange(context.Background(), code, s.Verifier, s.Nonce)
+	if err != nil {
+		t.Fatalf("unexpected error exchanging code: %v", err)
+	}
+	expected := oidc.Claims{Issuer: fake.Issuer(), Subject: "1234", Email: "neo@uw.edu", EmailVerified: true, GivenName: "Thomas"}
+	if *claims != expected {
+		t.Errorf("incorrect claims: expected %+v but got %+v", expected, *claims)
+	}
+	if _, err := provider.Exchange(context.Background(), code, s.Verifier, s.Nonce); !errors.Is(err, oidc.ErrExchangeFailed) {
+		t.Errorf("incorrect error reusing a code: expected %v but got %v", oidc.ErrExchangeFailed, err)
+	}
+
+	//an intercepted code is useless without the verifier
+	s, code = signIn()
+	if _, err := provider.Exchange(context.Background(), code, "stolen", s.Nonce); !errors.Is(err, oidc.ErrExchangeFailed) {
+		t.Errorf("incorrect error with the wrong verifier: expected %v but got %v", oidc.ErrExchangeFailed, err)
+	}
+	//an ID token from another sign in is refused
+	s, code = signIn()
+	if _, err := provider.Exchange(context.Background(), code, s.Verifier, "other"); !errors.Is(err, oidc.ErrExchangeFailed) {
+		t.Errorf("incorrect error with the wrong nonce: expected %v but got %v", oidc.ErrExchangeFailed, err)
+	}
+}
+
+func TestNewProviderErrors(t *testing.T) {
+	fake := oidctest.NewProvider(t, "jobtracker", "secret")
+	cases := []struct {
+		name string
+		cfg  *oidc.Config
+	}{
+		{"Missing Client ID", &oidc.Config{Name: "school", Issuer: fake.Issuer(), RedirectURL: "https://jobtracker.fyi/signin"}},
+		{"Wrong Issuer", &oidc.Config{Name: "school", Issuer: fake.Issuer() + "/other", ClientID: "jobtracker", RedirectURL: "https://jobtracker.fyi/signin"}},
+	}
+	for _, c := range cases {
+		if _, err := oidc.NewProvider(context.Background(), c.cfg); err == nil {
+			t.Errorf("case %s: expected an error creating the provider", c.name)
+		}
+	}
+}
+
+func TestNewSignIn(t *testing.T) {
+	s, err := oidc.NewSignIn()
+	if err != nil {
+		t.Fatalf("unexpected error creating sign in: %v", err)
+	}
+	if len(s.State) == 0 || s.State == s.Verifier || s.State == s.Nonce || s.Verifier == s.Nonce {
+		t.Errorf("the state, verifier and nonce should be different random values: %+v", s)
+	}
+	other, _ := oidc.NewSignIn()
+	if other.State == s.State || other.Verifier == s.Verifier || other.Nonce == s.Nonce {
+		t.Errorf("each sign in should have its own values: %+v and %+v", s, other)
+	}
+	if string(oidc.HashState(s.State)) == string(oidc.HashState(other.State)) {
+		t.Errorf("each state should have its own hash")
+	}
+}
@@ -0,0 +1,43 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"time"
+)
+
+//StateDuration is how long a user has to sign in with the provider
+const StateDuration = 10 * time.Minute
+
+//SignIn holds the random values for one sign in with a provider.
+//The gateway keeps the nonce until the user comes back, under the hash
+//of the state, and forgets it once the sign in finishes. The client
+//keeps the verifier, so a code can only be exchanged by the browser
+//that began signing in.
+type SignIn struct {
+	State    string
+	Verifier string
+	Nonce    string
+}
+
+//NewSignIn returns a SignIn with new random values
+func NewSignIn() (*SignIn, error) {
+	values := make([]string, 3)
+	for i := range values {
+		random := make([]byte, 32)
+		if _, err := rand.Read(random); err != nil {
+			return nil, fmt.Errorf("error generating sign in: %v", err)
+		}
+		values[i] = base64.RawURLEncoding.EncodeToString(random)
+	}
+	return &SignIn{State: values[0], Verifier: values[1], Nonce: values[2]}, nil
+}
+
+//HashState returns the SHA-256 hash a sign in is stored under,
+//so states can't be read back from the store
+func HashState(state string) []byte {
+	hash := sha256.Sum256([]byte(state))
+	return hash[:]
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"JobTracker/servers/gateway/models/users"
+)
+
+// promoteUsage describes the promote subcommand
+const promoteUsage = `usage: gateway promote EMAIL
+
+Gives the user with EMAIL the admin role, in the Postgres database
+at DSN, using POSTGRES_PASSWORD. Admins can promote other users
+through the admin API, so this is only needed for the first one.`
+
+// runPromote runs the promote subcommand with the given arguments.
+// It returns errors rather than exiting, so the store is closed.
+func runPromote(args []string) error {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, promoteUsage)
+		os.Exit(2)
+	}
+
+	db := openDB()
+	defer db.Close()
+	store, err := users.NewPostgresStore(db)
+	if err != nil {
+		return fmt.Errorf("unexpected error creating new user store: %w", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	u, err := store.GetByEmail(ctx, args[0])
+	if err != nil {
+		return fmt.Errorf("error finding the user: %w", err)
+	}
+	admin := users.RoleAdmin
+	if _, err := store.UpdateAccount(ctx, u.ID, &users.AccountUpdates{Role: &admin}); err != nil {
+		return fmt.Errorf("error promoting the user: %w", err)
+	}
+	log.Printf("%s is now an admin", u.UserName)
+	return nil
+}
@@ -1,6 +1,7 @@
 package sessions
 
 import (
+	"context"
 	"encoding/json"
 	"time"
 
@@ -14,6 +15,14 @@ type MemStore struct {
 	entries *cache.Cache
 }
 
+//memEntry is a session kept in a MemStore, with
+//its owner if its state is an Owner
+type memEntry struct {
+	state []byte
+	owner int64
+	owned bool
+}
+
 //NewMemStore constructs and returns a new MemStore
 func NewMemStore(sessionDuration time.Duration, purgeInterval time.Duration) *MemStore {
 	return &MemStore{
@@ -24,29 +33,53 @@ func NewMemStore(sessionDuration time.Duration, purgeInterval time.Duration) *Me
 //Save saves the provided `sessionState` and associated SessionID to the store.
 //The `sessionState` parameter is typically a pointer to a struct containing
 //all the data you want to associated with the given SessionID.
-func (ms *MemStore) Save(sid SessionID, state interface{}) error {
+func (ms *MemStore) Save(ctx context.Context, sid SessionID, state interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	j, err := json.Marshal(state)
 	if nil != err {
 		return err
 	}
-	ms.entries.Set(sid.String(), j, cache.DefaultExpiration)
+	entry := &memEntry{state: j}
+	entry.owner, entry.owned = sessionOwner(state)
+	ms.entries.Set(sid.String(), entry, cache.DefaultExpiration)
 	return nil
 }
 
 //Get populates `sessionState` with the data previously saved
 //for the given SessionID
-func (ms *MemStore) Get(sid SessionID, state interface{}) error {
-	j, found := ms.entries.Get(sid.String())
+func (ms *MemStore) Get(ctx context.Context, sid SessionID, state interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	entry, found := ms.entries.Get(sid.String())
 	if !found {
 		return ErrStateNotFound
 	}
 	//reset TTL
-	ms.entries.Set(sid.String(), j, 0)
-	return json.Unmarshal(j.([]byte), state)
+	ms.entries.Set(sid.String(), entry, 0)
+	return json.Unmarshal(entry.(*memEntry).state, state)
 }
 
 //Delete deletes all state data associated with the SessionID from the store.
-func (ms *MemStore) Delete(sid SessionID) error {
+func (ms *MemStore) Delete(ctx context.Context, sid SessionID) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	ms.entries.Delete(sid.String())
 	return nil
 }
+
+//DeleteUserSessions deletes every session of the user with the given ID
+func (ms *MemStore) DeleteUserSessions(ctx context.Context, userID int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	for sid, item := range ms.entries.Items() {
+		if entry := item.Object.(*memEntry); entry.owned && entry.owner == userID {
+			ms.entries.Delete(sid)
+		}
+	}
+	return nil
+}
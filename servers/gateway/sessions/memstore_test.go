@@ -1,10 +1,12 @@
-package sessions
+package sessions_test
 
 import (
-	"encoding/json"
-	"reflect"
+	"context"
 	"testing"
 	"time"
+
+	"JobTracker/servers/gateway/sessions"
+	"JobTracker/servers/gateway/sessions/storetest"
 )
 
 /*
@@ -12,66 +14,38 @@ TestMemStore tests the MemStore object
 
 Since a Store is like a database, you can't really test methods like Get()
 or Delete() without also calling (and therefore testing) methods like Save(),
-so instead of testing individual methods in isolation, this test runs through
-a full CRUD cycle, ensuring the correct behavior occurs at each point in that
-cycle. You should use a similar approach when testing your RedisStore implementation.
+so instead of testing individual methods in isolation, the storetest suite
+runs through full CRUD cycles, ensuring the correct behavior occurs at each
+point in those cycles. Every Store implementation runs the same suite.
 */
 func TestMemStore(t *testing.T) {
-	type sessionState struct {
-		Sval string
-		Ival int
-	}
+	storetest.Run(t, storetest.Harness{
+		NewStore: func(t *testing.T, ttl time.Duration) sessions.Store {
+			return sessions.NewMemStore(ttl, time.Minute)
+		},
+		TTL: 200 * time.Millisecond,
+	})
+}
 
-	state := &sessionState{
-		Sval: "testing",
-		Ival: 99,
-	}
-	stateRet := &sessionState{}
+func TestMemStoreCancelledContext(t *testing.T) {
+	//verify that calls made after the request that
+	//owns the context was cancelled are abandoned
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
 
-	sid, err := NewSessionID("test key")
+	sid, err := sessions.NewSessionID("test key")
 	if err != nil {
 		t.Fatalf("error generating new SessionID: %v", err)
 	}
-
-	store := NewMemStore(time.Hour, time.Minute)
-
-	if err := store.Get(sid, stateRet); err != ErrStateNotFound {
-		t.Errorf("incorrect error when getting state that was never stored: expected %v but got %v", ErrStateNotFound, err)
-	}
-
-	if err := store.Save(sid, &state); err != nil {
-		t.Fatalf("error saving state: %v", err)
-	}
-
-	if err := store.Get(sid, &stateRet); err != nil {
-		t.Fatalf("error getting state: %v", err)
-	}
-	if !reflect.DeepEqual(state, stateRet) {
-		jexp, _ := json.MarshalIndent(state, "", "  ")
-		jact, _ := json.MarshalIndent(state, "", "  ")
-		t.Errorf("incorrect state retrieved:\nEXPECTED\n%s\nACTUAL\n%s", string(jexp), string(jact))
-	}
-
-	if err := store.Delete(sid); err != nil {
-		t.Errorf("error deleting state: %v", err)
-	}
-
-	if err := store.Get(sid, &stateRet); err != ErrStateNotFound {
-		t.Fatalf("incorrect error when getting state that was deleted: expected %v but got %v", ErrStateNotFound, err)
+	store := sessions.NewMemStore(time.Hour, time.Minute)
+	if err := store.Save(ctx, sid, 1); err != context.Canceled {
+		t.Errorf("incorrect error when saving with a cancelled context: expected %v but got %v", context.Canceled, err)
 	}
-}
-
-func TestMemStoreSaveUnmarshalble(t *testing.T) {
-	//verify that saving an umarshalalbe session state
-	//generates an error
-	state := func() {} //function values can't be marshaled into JSON
-
-	sid, err := NewSessionID("test key")
-	if err != nil {
-		t.Fatalf("error generating new SessionID: %v", err)
+	var state int
+	if err := store.Get(ctx, sid, &state); err != context.Canceled {
+		t.Errorf("incorrect error when getting with a cancelled context: expected %v but got %v", context.Canceled, err)
 	}
-	store := NewMemStore(time.Hour, time.Minute)
-	if err := store.Save(sid, state); err == nil {
-		t.Error("expected error when attempting to save a session state with an unmarshalable field")
+	if err := store.Delete(ctx, sid); err != context.Canceled {
+		t.Errorf("incorrect error when deleting with a cancelled context: expected %v but got %v", context.Canceled, err)
 	}
 }
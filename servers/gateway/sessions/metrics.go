@@ -0,0 +1,84 @@
+package sessions
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+//storeDuration times session store operations, by operation
+var storeDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "gateway_session_store_duration_seconds",
+	Help:    "How long session store operations took, by operation.",
+	Buckets: prometheus.DefBuckets,
+}, []string{"operation"})
+
+//storeErrors counts failed session store operations, by operation.
+//Sessions that aren't found, expired or revoked tokens, and saves to
+//a TokenStore are what clients do, so they aren't failures.
+var storeErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "gateway_session_store_errors_total",
+	Help: "How many session store operations failed, by operation.",
+}, []string{"operation"})
+
+//MeteredStore is a Store that records how long each
+//operation on the Store it wraps takes, and its failures
+type MeteredStore struct {
+	Store Store
+}
+
+//NewMeteredStore returns a MeteredStore wrapping `store`
+func NewMeteredStore(store Store) *MeteredStore {
+	return &MeteredStore{Store: store}
+}
+
+//observe records an operation that began at `start` and returned `err`
+func observe(operation string, start time.Time, err error) {
+	storeDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	if err != nil && !expectedError(err) {
+		storeErrors.WithLabelValues(operation).Inc()
+	}
+}
+
+//expectedError returns whether `err` is a result of what the client
+//sent, rather than a failure of the store
+func expectedError(err error) bool {
+	return errors.Is(err, ErrStateNotFound) ||
+		errors.Is(err, ErrTokenExpired) ||
+		errors.Is(err, ErrTokenRevoked) ||
+		errors.Is(err, ErrStatelessSave)
+}
+
+//Unwrap returns the wrapped store
+func (ms *MeteredStore) Unwrap() Store {
+	return ms.Store
+}
+
+//Store implementation
+
+//Save saves the session state to the wrapped store
+func (ms *MeteredStore) Save(ctx context.Context, sid SessionID, sessionState interface{}) error {
+	start := time.Now()
+	err := ms.Store.Save(ctx, sid, sessionState)
+	observe("save", start, err)
+	return err
+}
+
+//Get gets the session state from the wrapped store
+func (ms *MeteredStore) Get(ctx context.Context, sid SessionID, sessionState interface{}) error {
+	start := time.Now()
+	err := ms.Store.Get(ctx, sid, sessionState)
+	observe("get", start, err)
+	return err
+}
+
+//Delete deletes the session state from the wrapped store
+func (ms *MeteredStore) Delete(ctx context.Context, sid SessionID) error {
+	start := time.Now()
+	err := ms.Store.Delete(ctx, sid)
+	observe("delete", start, err)
+	return err
+}
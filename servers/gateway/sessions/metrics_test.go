@@ -0,0 +1,60 @@
+package sessions_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"JobTracker/servers/gateway/sessions"
+	"JobTracker/servers/gateway/sessions/storetest"
+	"JobTracker/servers/metrics"
+)
+
+//TestMeteredStore checks that a MeteredStore still behaves like
+//the Store it wraps
+func TestMeteredStore(t *testing.T) {
+	storetest.Run(t, storetest.Harness{
+		NewStore: func(t *testing.T, ttl time.Duration) sessions.Store {
+			return sessions.NewMeteredStore(sessions.NewMemStore(ttl, time.Minute))
+		},
+		TTL: 200 * time.Millisecond,
+	})
+}
+
+func TestMeteredStoreMetrics(t *testing.T) {
+	sid, err := sessions.NewSessionID("test key")
+	if err != nil {
+		t.Fatalf("error generating new SessionID: %v", err)
+	}
+	store := sessions.NewMeteredStore(sessions.NewMemStore(time.Hour, time.Minute))
+
+	//a session that isn't found isn't an error, but a cancelled call is
+	var state int
+	if err := store.Get(context.Background(), sid, &state); err != sessions.ErrStateNotFound {
+		t.Fatalf("incorrect error getting a missing session: expected %v but got %v", sessions.ErrStateNotFound, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := store.Delete(ctx, sid); err != context.Canceled {
+		t.Fatalf("incorrect error deleting with a cancelled context: expected %v but got %v", context.Canceled, err)
+	}
+
+	resp := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := resp.Body.String()
+	for _, line := range []string{
+		`gateway_session_store_duration_seconds_count{operation="get"}`,
+		`gateway_session_store_errors_total{operation="delete"} `,
+	} {
+		if !strings.Contains(body, line) {
+			t.Errorf("expected the metrics to contain %q but got\n%s", line, body)
+		}
+	}
+	if regexp.MustCompile(`gateway_session_store_errors_total{operation="get"} [1-9]`).MatchString(body) {
+		t.Errorf("missing sessions should not be counted as errors:\n%s", body)
+	}
+}
@@ -0,0 +1,124 @@
+package sessions
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"time"
+)
+
+//PostgresStore represents a session.Store backed by postgres,
+//for deployments that would rather not run redis. Session state
+//is kept as JSONB in the "sessions" table next to its expiry time:
+//
+//	create table sessions (
+//	    sid        varchar(128) primary key,
+//	    state      jsonb        not null,
+//	    expiresat  timestamptz  not null,
+//	    userid     bigint
+//	);
+//
+//userid is set for states that are Owners.
+//Expired rows are ignored by Get and removed by Sweep.
+type PostgresStore struct {
+	//Database connection pool.
+	DB *sql.DB
+	//How long a session lasts without being used.
+	SessionDuration time.Duration
+	//Deadlines for each kind of query.
+	Timeouts Timeouts
+}
+
+//NewPostgresStore constructs a new PostgresStore
+func NewPostgresStore(db *sql.DB, sessionDuration time.Duration) *PostgresStore {
+	if db == nil {
+		panic("missing database connection")
+	}
+	return &PostgresStore{
+		DB:              db,
+		SessionDuration: sessionDuration,
+	}
+}
+
+//Store implementation
+
+//Save saves the provided `sessionState` and associated SessionID to the store.
+//The `sessionState` parameter is typically a pointer to a struct containing
+//all the data you want to associated with the given SessionID.
+func (ps *PostgresStore) Save(ctx context.Context, sid SessionID, sessionState interface{}) error {
+	sessionStateJSON, err := json.Marshal(sessionState)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := withTimeout(ctx, ps.Timeouts.Save)
+	defer cancel()
+	var userID sql.NullInt64
+	userID.Int64, userID.Valid = sessionOwner(sessionState)
+	saveq := "insert into sessions(sid, state, expiresat, userid) values ($1, $2, $3, $4) " +
+		"on conflict (sid) do update set state = excluded.state, expiresat = excluded.expiresat, userid = excluded.userid"
+	_, err = ps.DB.ExecContext(ctx, saveq, sid.String(), sessionStateJSON, time.Now().Add(ps.SessionDuration), userID)
+	return err
+}
+
+//Get populates `sessionState` with the data previously saved
+//for the given SessionID, and extends the session's expiry
+func (ps *PostgresStore) Get(ctx context.Context, sid SessionID, sessionState interface{}) error {
+	ctx, cancel := withTimeout(ctx, ps.Timeouts.Get)
+	defer cancel()
+	//extend the expiry and read the state in one round-trip,
+	//skipping rows that have expired but not been swept yet
+	now := time.Now()
+	getq := "update sessions set expiresat = $2 where sid = $1 and expiresat > $3 returning state"
+	var storedState []byte
+	err := ps.DB.QueryRowContext(ctx, getq, sid.String(), now.Add(ps.SessionDuration), now).Scan(&storedState)
+	switch {
+	case err == sql.ErrNoRows:
+		return ErrStateNotFound
+	case err != nil:
+		return err
+	}
+	return json.Unmarshal(storedState, sessionState)
+}
+
+//Delete deletes all state data associated with the SessionID from the store.
+func (ps *PostgresStore) Delete(ctx context.Context, sid SessionID) error {
+	ctx, cancel := withTimeout(ctx, ps.Timeouts.Delete)
+	defer cancel()
+	_, err := ps.DB.ExecContext(ctx, "delete from sessions where sid = $1", sid.String())
+	return err
+}
+
+//DeleteUserSessions deletes every session of the user with the given ID
+func (ps *PostgresStore) DeleteUserSessions(ctx context.Context, userID int64) error {
+	ctx, cancel := withTimeout(ctx, ps.Timeouts.Delete)
+	defer cancel()
+	_, err := ps.DB.ExecContext(ctx, "delete from sessions where userid = $1", userID)
+	return err
+}
+
+//Sweep deletes all expired sessions and returns how many were deleted
+func (ps *PostgresStore) Sweep(ctx context.Context) (int64, error) {
+	res, err := ps.DB.ExecContext(ctx, "delete from sessions where expiresat <= $1", time.Now())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+//RunSweeper calls Sweep every `interval` until `ctx` is done.
+//It is meant to be started in its own goroutine.
+func (ps *PostgresStore) RunSweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := ps.Sweep(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("error sweeping expired sessions: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package sessions_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+
+	"JobTracker/servers/gateway/sessions"
+	"JobTracker/servers/gateway/sessions/storetest"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	_ "github.com/lib/pq"
+)
+
+func TestPostgresStoreQueries(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("There was a problem opening a database connection: [%v]", err)
+	}
+	defer db.Close()
+
+	store := sessions.NewPostgresStore(db, time.Hour)
+	sid, err := sessions.NewSessionID("test key")
+	if err != nil {
+		t.Fatalf("error generating new SessionID: %v", err)
+	}
+
+	saveq := regexp.QuoteMeta("insert into sessions(sid, state, expiresat, userid) values ($1, $2, $3, $4) on conflict (sid) do update")
+	mock.ExpectExec(saveq).WithArgs(sid.String(), []byte(`{"Ival":99}`), sqlmock.AnyArg(), nil).WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := store.Save(ctx, sid, struct{ Ival int }{99}); err != nil {
+		t.Errorf("unexpected error saving state: %v", err)
+	}
+
+	getq := regexp.QuoteMeta("update sessions set expiresat = $2 where sid = $1 and expiresat > $3 returning state")
+	mock.ExpectQuery(getq).WithArgs(sid.String(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"state"}).AddRow([]byte(`{"Ival":99}`)))
+	state := struct{ Ival int }{}
+	if err := store.Get(ctx, sid, &state); err != nil || state.Ival != 99 {
+		t.Errorf("incorrect state retrieved: got %+v, %v", state, err)
+	}
+
+	mock.ExpectQuery(getq).WithArgs(sid.String(), sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnError(sql.ErrNoRows)
+	if err := store.Get(ctx, sid, &state); err != sessions.ErrStateNotFound {
+		t.Errorf("incorrect error when getting a missing session: expected %v but got %v", sessions.ErrStateNotFound, err)
+	}
+
+	dbErr := errors.New("connection refused")
+	mock.ExpectQuery(getq).WithArgs(sid.String(), sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnError(dbErr)
+	if err := store.Get(ctx, sid, &state); err != dbErr {
+		t.Errorf("incorrect error when the database fails: expected %v but got %v", dbErr, err)
+	}
+
+	mock.ExpectExec(regexp.QuoteMeta("delete from sessions where sid = $1")).WithArgs(sid.String()).WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := store.Delete(ctx, sid); err != nil {
+		t.Errorf("unexpected error deleting state: %v", err)
+	}
+
+	mock.ExpectExec(regexp.QuoteMeta("delete from sessions where userid = $1")).WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 2))
+	if err := store.DeleteUserSessions(ctx, 7); err != nil {
+		t.Errorf("unexpected error deleting the user's sessions: %v", err)
+	}
+
+	mock.ExpectExec(regexp.QuoteMeta("delete from sessions where expiresat <= $1")).WithArgs(sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 3))
+	if n, err := store.Sweep(ctx); err != nil || n != 3 {
+		t.Errorf("incorrect sweep result: expected 3 rows but got %d, %v", n, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+/*
+TestPostgresStore runs the storetest suite against
+a real postgres database. Set the POSTGRESDSN environment variable to
+a data source name to run it; it is skipped otherwise.
+*/
+func TestPostgresStore(t *testing.T) {
+	dsn := os.Getenv("POSTGRESDSN")
+	if len(dsn) == 0 {
+		t.Skip("set POSTGRESDSN to run against a postgres database")
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("There was a problem opening a database connection: [%v]", err)
+	}
+	defer db.Close()
+
+	storetest.Run(t, storetest.Harness{
+		NewStore: func(t *testing.T, ttl time.Duration) sessions.Store {
+			return sessions.NewPostgresStore(db, ttl)
+		},
+		TTL: 200 * time.Millisecond,
+	})
+
+	//the sweeper removes sessions once they expire
+	ctx := context.Background()
+	store := sessions.NewPostgresStore(db, time.Millisecond)
+	sid, _ := sessions.NewSessionID("test key")
+	if err := store.Save(ctx, sid, 1); err != nil {
+		t.Fatalf("error saving state: %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if n, err := store.Sweep(ctx); err != nil || n < 1 {
+		t.Errorf("expected the expired session to be swept but got %d, %v", n, err)
+	}
+}
@@ -0,0 +1,64 @@
+package sessions
+
+import (
+	"crypto/tls"
+	"errors"
+
+	"github.com/go-redis/redis/v8"
+)
+
+//RedisConfig describes how to connect to a redis deployment,
+//which may be a standalone server, a Sentinel-managed
+//failover group, or a Cluster.
+type RedisConfig struct {
+	//Addresses of the server, the sentinels, or the cluster seed nodes.
+	Addrs []string
+	//Name of the Sentinel master; setting this selects failover mode.
+	MasterName string
+	//Whether Addrs are cluster nodes, even if only one is given.
+	Cluster bool
+	//ACL username; leave empty to authenticate with only a password.
+	Username string
+	Password string
+	//Database to select. Not supported by Cluster deployments.
+	DB int
+	//TLS settings for every connection; nil disables TLS.
+	TLSConfig *tls.Config
+}
+
+//ErrNoRedisAddrs is returned from NewRedisClient when no addresses are configured
+var ErrNoRedisAddrs = errors.New("at least one redis address is required")
+
+//ErrClusterDB is returned from NewRedisClient when a cluster is asked to select a database
+var ErrClusterDB = errors.New("redis cluster deployments only support database 0")
+
+//NewRedisClient returns a client for the deployment described by `cfg`
+func NewRedisClient(cfg *RedisConfig) (redis.UniversalClient, error) {
+	if len(cfg.Addrs) == 0 {
+		return nil, ErrNoRedisAddrs
+	}
+	opts := cfg.universalOptions()
+	switch {
+	case len(cfg.MasterName) != 0:
+		return redis.NewFailoverClient(opts.Failover()), nil
+	case cfg.Cluster:
+		if cfg.DB != 0 {
+			return nil, ErrClusterDB
+		}
+		return redis.NewClusterClient(opts.Cluster()), nil
+	default:
+		return redis.NewClient(opts.Simple()), nil
+	}
+}
+
+//universalOptions converts the config to go-redis options
+func (cfg *RedisConfig) universalOptions() *redis.UniversalOptions {
+	return &redis.UniversalOptions{
+		Addrs:      cfg.Addrs,
+		MasterName: cfg.MasterName,
+		Username:   cfg.Username,
+		Password:   cfg.Password,
+		DB:         cfg.DB,
+		TLSConfig:  cfg.TLSConfig,
+	}
+}
@@ -3,28 +3,44 @@ package sessions
 import (
 	"context"
 	"encoding/json"
+	"strconv"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 )
 
-// TODO: figureout correct context
-var ctx = context.TODO()
+//defaultSessionKeyPrefix keeps SessionID keys separate from other
+//keys that might end up in the same redis instance
+const defaultSessionKeyPrefix = "sid:"
+
+//defaultUserKeyPrefix is prepended to a user's ID to form the key
+//of the set of their SessionIDs
+const defaultUserKeyPrefix = "usersids:"
 
 //RedisStore represents a session.Store backed by redis.
 type RedisStore struct {
-	//Redis client used to talk to redis server.
-	Client *redis.Client
+	//Redis client used to talk to a standalone server,
+	//a Sentinel failover group, or a Cluster.
+	Client redis.UniversalClient
 	//Used for key expiry time on redis.
 	SessionDuration time.Duration
+	//Prepended to every SessionID to form its redis key.
+	KeyPrefix string
+	//Prepended to a user's ID to form the key of the set of
+	//their SessionIDs, for states that are Owners.
+	UserKeyPrefix string
+	//Deadlines for each kind of redis call.
+	Timeouts Timeouts
 }
 
 //NewRedisStore constructs a new RedisStore
-func NewRedisStore(client *redis.Client, sessionDuration time.Duration) *RedisStore {
+func NewRedisStore(client redis.UniversalClient, sessionDuration time.Duration) *RedisStore {
 	//initialize and return a new RedisStore struct
 	return &RedisStore{
 		Client:          client,
 		SessionDuration: sessionDuration,
+		KeyPrefix:       defaultSessionKeyPrefix,
+		UserKeyPrefix:   defaultUserKeyPrefix,
 	}
 }
 
@@ -33,25 +49,36 @@ func NewRedisStore(client *redis.Client, sessionDuration time.Duration) *RedisSt
 //Save saves the provided `sessionState` and associated SessionID to the store.
 //The `sessionState` parameter is typically a pointer to a struct containing
 //all the data you want to associated with the given SessionID.
-func (rs *RedisStore) Save(sid SessionID, sessionState interface{}) error {
+func (rs *RedisStore) Save(ctx context.Context, sid SessionID, sessionState interface{}) error {
 	sessionStateJSON, err := json.Marshal(sessionState)
 	if err != nil {
 		return err
 	}
-	err = rs.Client.Set(ctx, sid.getRedisKey(), sessionStateJSON, rs.SessionDuration).Err()
-	if err != nil {
-		return err
+	ctx, cancel := withTimeout(ctx, rs.Timeouts.Save)
+	defer cancel()
+	owner, owned := sessionOwner(sessionState)
+	if !owned {
+		return rs.Client.Set(ctx, rs.getRedisKey(sid), sessionStateJSON, rs.SessionDuration).Err()
 	}
-	return nil
+	//the user's set lasts as long as their newest session. The keys may
+	//be on different cluster nodes, so this can't be a transaction.
+	pipe := rs.Client.Pipeline()
+	pipe.Set(ctx, rs.getRedisKey(sid), sessionStateJSON, rs.SessionDuration)
+	pipe.SAdd(ctx, rs.getUserKey(owner), sid.String())
+	pipe.Expire(ctx, rs.getUserKey(owner), rs.SessionDuration)
+	_, err = pipe.Exec(ctx)
+	return err
 }
 
 //Get populates `sessionState` with the data previously saved
 //for the given SessionID
-func (rs *RedisStore) Get(sid SessionID, sessionState interface{}) error {
+func (rs *RedisStore) Get(ctx context.Context, sid SessionID, sessionState interface{}) error {
+	ctx, cancel := withTimeout(ctx, rs.Timeouts.Get)
+	defer cancel()
 	pipe := rs.Client.Pipeline()
 
-	get := pipe.Get(ctx, sid.getRedisKey())
-	pipe.Expire(ctx, sid.getRedisKey(), rs.SessionDuration)
+	get := pipe.Get(ctx, rs.getRedisKey(sid))
+	pipe.Expire(ctx, rs.getRedisKey(sid), rs.SessionDuration)
 
 	_, err := pipe.Exec(ctx)
 	switch {
@@ -62,18 +89,48 @@ func (rs *RedisStore) Get(sid SessionID, sessionState interface{}) error {
 	}
 	// value is available only after Exec
 	storedState := get.Val()
-	return json.Unmarshal([]byte(storedState), sessionState)
+	if err := json.Unmarshal([]byte(storedState), sessionState); err != nil {
+		return err
+	}
+	//keep the user's set as long as the session it was extended with
+	if owner, ok := sessionOwner(sessionState); ok {
+		return rs.Client.Expire(ctx, rs.getUserKey(owner), rs.SessionDuration).Err()
+	}
+	return nil
 }
 
 //Delete deletes all state data associated with the SessionID from the store.
-func (rs *RedisStore) Delete(sid SessionID) error {
-	return rs.Client.Del(ctx, sid.getRedisKey()).Err()
+func (rs *RedisStore) Delete(ctx context.Context, sid SessionID) error {
+	ctx, cancel := withTimeout(ctx, rs.Timeouts.Delete)
+	defer cancel()
+	return rs.Client.Del(ctx, rs.getRedisKey(sid)).Err()
+}
+
+//DeleteUserSessions deletes every session of the user with the given ID
+func (rs *RedisStore) DeleteUserSessions(ctx context.Context, userID int64) error {
+	ctx, cancel := withTimeout(ctx, rs.Timeouts.Delete)
+	defer cancel()
+	sids, err := rs.Client.SMembers(ctx, rs.getUserKey(userID)).Result()
+	if err != nil {
+		return err
+	}
+	//sessions may be on different cluster nodes, so
+	//they are deleted one key at a time
+	pipe := rs.Client.Pipeline()
+	for _, sid := range sids {
+		pipe.Del(ctx, rs.KeyPrefix+sid)
+	}
+	pipe.Del(ctx, rs.getUserKey(userID))
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+//getUserKey returns the redis key of the set of the user's SessionIDs
+func (rs *RedisStore) getUserKey(userID int64) string {
+	return rs.UserKeyPrefix + strconv.FormatInt(userID, 10)
 }
 
 //getRedisKey() returns the redis key to use for the SessionID
-func (sid SessionID) getRedisKey() string {
-	//convert the SessionID to a string and add the prefix "sid:" to keep
-	//SessionID keys separate from other keys that might end up in this
-	//redis instance
-	return "sid:" + sid.String()
+func (rs *RedisStore) getRedisKey(sid SessionID) string {
+	return rs.KeyPrefix + sid.String()
 }
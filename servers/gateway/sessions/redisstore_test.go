@@ -1,83 +1,179 @@
-package sessions
+package sessions_test
 
 import (
-	"encoding/json"
+	"context"
+	"os"
 	"reflect"
 	"testing"
 	"time"
 
-	"os"
+	"JobTracker/servers/gateway/sessions"
+	"JobTracker/servers/gateway/sessions/storetest"
 
+	"github.com/alicebob/miniredis/v2"
 	"github.com/go-redis/redis/v8"
 )
 
 /*
-TestRedisStore tests the RedisStore object
-Because the redis.Client is a struct and not an interface,
-this is really more of an integration than a unit test.
-It tests the basic CRUD cycle, ensuring that session state
-saved to redis can be retrieved again.
-
-By default, the test will try to use a local instance of
-redis running on its default port (6379). If you want to
-use a different address, set the REDISADDR environment variable.
+newTestRedisClient returns a client for the redis server used by these tests.
+
+By default, the tests run against miniredis, an in-process stand-in
+for a redis server, which is also returned so that tests can inspect
+keys and move its clock forward. If you want to run against a real
+redis server, set the REDISADDR environment variable; tests that need
+the stand-in are skipped in that case.
+*/
+func newTestRedisClient(t *testing.T) (redis.UniversalClient, *miniredis.Miniredis) {
+	if redisaddr := os.Getenv("REDISADDR"); len(redisaddr) != 0 {
+		return redis.NewClient(&redis.Options{Addr: redisaddr}), nil
+	}
+	mr := miniredis.RunT(t)
+	return redis.NewClient(&redis.Options{Addr: mr.Addr()}), mr
+}
+
+/*
+TestRedisStore runs the storetest suite against the RedisStore object,
+ensuring that session state saved to redis can be retrieved again.
 */
 func TestRedisStore(t *testing.T) {
-	type sessionState struct {
-		Sval string
-		Ival int
+	client, mr := newTestRedisClient(t)
+	sleep := time.Sleep
+	if mr != nil {
+		sleep = mr.FastForward
 	}
+	storetest.Run(t, storetest.Harness{
+		NewStore: func(t *testing.T, ttl time.Duration) sessions.Store {
+			return sessions.NewRedisStore(client, ttl)
+		},
+		Sleep: sleep,
+	})
+}
 
-	state := &sessionState{
-		Sval: "testing",
-		Ival: 99,
+func TestRedisStoreKeysAndExpiry(t *testing.T) {
+	ctx := context.Background()
+	client, mr := newTestRedisClient(t)
+	if mr == nil {
+		t.Skip("inspecting keys requires the miniredis stand-in")
 	}
-	stateRet := &sessionState{}
 
-	sid, err := NewSessionID("test key")
+	sid, err := sessions.NewSessionID("test key")
 	if err != nil {
 		t.Fatalf("error generating new SessionID: %v", err)
 	}
+	store := sessions.NewRedisStore(client, time.Minute)
+	store.KeyPrefix = "jobtracker:sid:"
 
-	redisaddr := os.Getenv("REDISADDR")
-	if len(redisaddr) == 0 {
-		redisaddr = "127.0.0.1:6379"
+	if err := store.Save(ctx, sid, 1); err != nil {
+		t.Fatalf("error saving state: %v", err)
 	}
-
-	client := redis.NewClient(&redis.Options{
-		Addr: redisaddr,
-	})
-
-	store := NewRedisStore(client, time.Hour)
-
-	if err := store.Get(sid, stateRet); err != ErrStateNotFound {
-		t.Errorf("incorrect error when getting state that was never stored: expected %v but got %v", ErrStateNotFound, err)
+	if !mr.Exists("jobtracker:sid:" + sid.String()) {
+		t.Errorf("state was not saved under the configured key prefix; keys are %v", mr.Keys())
 	}
 
-	if err := store.Save(sid, &state); err != nil {
-		t.Fatalf("error saving state: %v", err)
+	//getting the state should reset its TTL
+	mr.FastForward(45 * time.Second)
+	var state int
+	if err := store.Get(ctx, sid, &state); err != nil {
+		t.Fatalf("error getting state: %v", err)
+	}
+	if ttl := mr.TTL("jobtracker:sid:" + sid.String()); ttl != time.Minute {
+		t.Errorf("incorrect TTL after Get: expected %v but got %v", time.Minute, ttl)
 	}
 
-	//verify that trying to save an unmarshalable session state
-	//generates an error (function values can't be encoded in JSON)
-	if err := store.Save(sid, func() {}); err == nil {
-		t.Error("expected erorr when attempting to save an unmarshalable session state")
+	mr.FastForward(2 * time.Minute)
+	if err := store.Get(ctx, sid, &state); err != sessions.ErrStateNotFound {
+		t.Errorf("incorrect error when getting state that expired: expected %v but got %v", sessions.ErrStateNotFound, err)
 	}
+}
 
-	if err := store.Get(sid, &stateRet); err != nil {
-		t.Fatalf("error getting state: %v", err)
+func TestRedisRevocationList(t *testing.T) {
+	ctx := context.Background()
+	client, _ := newTestRedisClient(t)
+	list := sessions.NewRedisRevocationList(client)
+
+	if revoked, err := list.IsRevoked(ctx, "id"); err != nil || revoked {
+		t.Errorf("expected id to not be revoked but got %v, %v", revoked, err)
+	}
+	if err := list.Revoke(ctx, "id", time.Minute); err != nil {
+		t.Fatalf("error revoking id: %v", err)
+	}
+	if revoked, err := list.IsRevoked(ctx, "id"); err != nil || !revoked {
+		t.Errorf("expected id to be revoked but got %v, %v", revoked, err)
 	}
-	if !reflect.DeepEqual(state, stateRet) {
-		jexp, _ := json.MarshalIndent(state, "", "  ")
-		jact, _ := json.MarshalIndent(stateRet, "", "  ")
-		t.Errorf("incorrect state retrieved:\nEXPECTED\n%s\nACTUAL\n%s", string(jexp), string(jact))
+}
+
+func TestNewRedisClient(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	mr.RequireUserAuth("gateway", "secret")
+
+	cases := []struct {
+		name        string
+		cfg         *sessions.RedisConfig
+		expectedErr error
+		canPing     bool
+	}{
+		{
+			"ACL Username and Password",
+			&sessions.RedisConfig{Addrs: []string{mr.Addr()}, Username: "gateway", Password: "secret"},
+			nil,
+			true,
+		},
+		{
+			"Wrong Password",
+			&sessions.RedisConfig{Addrs: []string{mr.Addr()}, Username: "gateway", Password: "wrong"},
+			nil,
+			false,
+		},
+		{
+			"No Addresses",
+			&sessions.RedisConfig{},
+			sessions.ErrNoRedisAddrs,
+			false,
+		},
+		{
+			"Cluster With Database",
+			&sessions.RedisConfig{Addrs: []string{mr.Addr()}, Cluster: true, DB: 1},
+			sessions.ErrClusterDB,
+			false,
+		},
 	}
 
-	if err := store.Delete(sid); err != nil {
-		t.Errorf("error deleting state: %v", err)
+	for _, c := range cases {
+		client, err := sessions.NewRedisClient(c.cfg)
+		if err != c.expectedErr {
+			t.Errorf("case %s: incorrect error: expected %v but got %v", c.name, c.expectedErr, err)
+		}
+		if err != nil {
+			continue
+		}
+		err = client.Ping(ctx).Err()
+		if c.canPing && err != nil {
+			t.Errorf("case %s: unexpected error pinging redis: %v", c.name, err)
+		}
+		if !c.canPing && err == nil {
+			t.Errorf("case %s: expected error pinging redis", c.name)
+		}
+		client.Close()
 	}
 
-	if err := store.Get(sid, &stateRet); err != ErrStateNotFound {
-		t.Fatalf("incorrect error when getting state that was deleted: expected %v but got %v", ErrStateNotFound, err)
+	//each kind of deployment gets the matching client
+	kinds := []struct {
+		cfg      *sessions.RedisConfig
+		expected redis.UniversalClient
+	}{
+		{&sessions.RedisConfig{Addrs: []string{mr.Addr()}}, &redis.Client{}},
+		{&sessions.RedisConfig{Addrs: []string{mr.Addr()}, MasterName: "mymaster"}, &redis.Client{}},
+		{&sessions.RedisConfig{Addrs: []string{mr.Addr()}, Cluster: true}, &redis.ClusterClient{}},
+	}
+	for _, k := range kinds {
+		client, err := sessions.NewRedisClient(k.cfg)
+		if err != nil {
+			t.Fatalf("unexpected error creating client: %v", err)
+		}
+		if reflect.TypeOf(client) != reflect.TypeOf(k.expected) {
+			t.Errorf("incorrect client for %+v: expected %T but got %T", k.cfg, k.expected, client)
+		}
+		client.Close()
 	}
 }
@@ -0,0 +1,84 @@
+package sessions
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/patrickmn/go-cache"
+)
+
+//RevocationList records the IDs of signed session tokens that were
+//ended before they expired. Entries only need to be kept until the
+//token would have expired on its own.
+type RevocationList interface {
+	//Revoke adds `id` to the list for the given duration
+	Revoke(ctx context.Context, id string, duration time.Duration) error
+
+	//IsRevoked reports whether `id` is on the list
+	IsRevoked(ctx context.Context, id string) (bool, error)
+}
+
+//MemRevocationList represents an in-process memory revocation list.
+//This should be used only for testing and prototyping.
+type MemRevocationList struct {
+	entries *cache.Cache
+}
+
+//NewMemRevocationList constructs and returns a new MemRevocationList
+func NewMemRevocationList(purgeInterval time.Duration) *MemRevocationList {
+	return &MemRevocationList{
+		entries: cache.New(cache.NoExpiration, purgeInterval),
+	}
+}
+
+//Revoke adds `id` to the list for the given duration
+func (ml *MemRevocationList) Revoke(ctx context.Context, id string, duration time.Duration) error {
+	ml.entries.Set(id, true, duration)
+	return nil
+}
+
+//IsRevoked reports whether `id` is on the list
+func (ml *MemRevocationList) IsRevoked(ctx context.Context, id string) (bool, error) {
+	_, found := ml.entries.Get(id)
+	return found, nil
+}
+
+//defaultRevokedKeyPrefix keeps revoked token IDs separate from other
+//keys that might end up in the same redis instance
+const defaultRevokedKeyPrefix = "revoked:"
+
+//RedisRevocationList represents a RevocationList backed by redis.
+type RedisRevocationList struct {
+	//Redis client used to talk to redis server.
+	Client redis.UniversalClient
+	//Prepended to every token ID to form its redis key.
+	KeyPrefix string
+}
+
+//NewRedisRevocationList constructs a new RedisRevocationList
+func NewRedisRevocationList(client redis.UniversalClient) *RedisRevocationList {
+	return &RedisRevocationList{
+		Client:    client,
+		KeyPrefix: defaultRevokedKeyPrefix,
+	}
+}
+
+//Revoke adds `id` to the list for the given duration
+func (rl *RedisRevocationList) Revoke(ctx context.Context, id string, duration time.Duration) error {
+	return rl.Client.Set(ctx, rl.getRedisKey(id), 1, duration).Err()
+}
+
+//IsRevoked reports whether `id` is on the list
+func (rl *RedisRevocationList) IsRevoked(ctx context.Context, id string) (bool, error) {
+	n, err := rl.Client.Exists(ctx, rl.getRedisKey(id)).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+//getRedisKey returns the redis key to use for a revoked token ID
+func (rl *RedisRevocationList) getRedisKey(id string) string {
+	return rl.KeyPrefix + id
+}
@@ -1,9 +1,12 @@
 package sessions
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"strings"
+
+	"JobTracker/servers/tracing"
 )
 
 const headerAuthorization = "Authorization"
@@ -17,13 +20,24 @@ var ErrNoSessionID = errors.New("no session ID found in " + headerAuthorization
 var ErrInvalidScheme = errors.New("authorization scheme not supported")
 
 //BeginSession creates a new SessionID, saves the `sessionState` to the store, adds an
-//Authorization header to the response with the SessionID, and returns the new SessionID
-func BeginSession(signingKey string, store Store, sessionState interface{}, w http.ResponseWriter) (SessionID, error) {
+//Authorization header to the response with the SessionID, and returns the new SessionID.
+//If the store, or the store it wraps, is a TokenIssuer, the `sessionState` is encoded into
+//the SessionID instead. The `ctx` is typically the context of the request that is beginning
+//the session.
+func BeginSession(ctx context.Context, signingKey string, store Store, sessionState interface{}, w http.ResponseWriter) (SessionID, error) {
+	if issuer, ok := tokenIssuer(store); ok {
+		sid, err := issuer.IssueToken(sessionState)
+		if err != nil {
+			return InvalidSessionID, err
+		}
+		w.Header().Add(headerAuthorization, schemeBearer+sid.String())
+		return sid, nil
+	}
 	sid, err := NewSessionID(signingKey)
 	if err != nil {
 		return InvalidSessionID, err
 	}
-	err = store.Save(sid, sessionState)
+	err = store.Save(ctx, sid, sessionState)
 	if err != nil {
 		return InvalidSessionID, err
 	}
@@ -47,6 +61,14 @@ func GetSessionID(r *http.Request, signingKey string) (SessionID, error) {
 	if len(id) == 0 {
 		return InvalidSessionID, ErrNoSessionID
 	}
+	// signed session tokens embed a SessionID, which is validated here;
+	// the rest of the token is verified by the TokenStore
+	if isToken(id) {
+		if _, err := ValidateID(strings.SplitN(id, tokenSeparator, 2)[0], signingKey); err != nil {
+			return InvalidSessionID, err
+		}
+		return SessionID(id), nil
+	}
 	sid, err := ValidateID(id, signingKey)
 	if err != nil {
 		return InvalidSessionID, err
@@ -58,12 +80,17 @@ func GetSessionID(r *http.Request, signingKey string) (SessionID, error) {
 //gets the associated state from the provided store into
 //the `sessionState` parameter, and returns the SessionID
 func GetState(r *http.Request, signingKey string, store Store, sessionState interface{}) (SessionID, error) {
+	ctx, span := tracing.Start(r.Context(), "sessions.GetState", tracing.KindInternal)
+	defer span.End()
 	sid, err := GetSessionID(r, signingKey)
 	if err != nil {
 		return InvalidSessionID, err
 	}
-	err = store.Get(sid, sessionState)
+	err = store.Get(ctx, sid, sessionState)
 	if err != nil {
+		if !errors.Is(err, ErrStateNotFound) {
+			tracing.RecordError(span, err)
+		}
 		return InvalidSessionID, err
 	}
 	return sid, nil
@@ -77,7 +104,7 @@ func EndSession(r *http.Request, signingKey string, store Store) (SessionID, err
 	if err != nil {
 		return InvalidSessionID, err
 	}
-	err = store.Delete(sid)
+	err = store.Delete(r.Context(), sid)
 	if err != nil {
 		return InvalidSessionID, err
 	}
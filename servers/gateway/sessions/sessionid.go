@@ -65,6 +65,9 @@ func ValidateID(id string, signingKey string) (SessionID, error) {
 	if err != nil {
 		return InvalidSessionID, err
 	}
+	if len(decodedID) != signedLength {
+		return InvalidSessionID, ErrInvalidID
+	}
 	idPortion := decodedID[0:idLength]
 	compare := decodedID[idLength:]
 	remaining := hmac.New(sha256.New, []byte(signingKey))
@@ -1,7 +1,9 @@
 package sessions
 
 import (
+	"context"
 	"errors"
+	"time"
 )
 
 //ErrStateNotFound is returned from Store.Get() when the requested
@@ -13,16 +15,90 @@ var ErrStateNotFound = errors.New("no session state was found in the session sto
 //against several different types of data stores. For example,
 //session data could be stored in memory in a concurrent map,
 //or more typically in a shared key/value server store like redis.
+//
+//Every method takes a context.Context, so that calls to a remote
+//store are abandoned when the client's request is cancelled.
 type Store interface {
 	//Save saves the provided `sessionState` and associated SessionID to the store.
 	//The `sessionState` parameter is typically a pointer to a struct containing
 	//all the data you want to associated with the given SessionID.
-	Save(sid SessionID, sessionState interface{}) error
+	Save(ctx context.Context, sid SessionID, sessionState interface{}) error
 
 	//Get populates `sessionState` with the data previously saved
 	//for the given SessionID
-	Get(sid SessionID, sessionState interface{}) error
+	Get(ctx context.Context, sid SessionID, sessionState interface{}) error
 
 	//Delete deletes all state data associated with the SessionID from the store.
-	Delete(sid SessionID) error
+	Delete(ctx context.Context, sid SessionID) error
+}
+
+//Owner is implemented by session states that belong to a user, so
+//stores that are UserSessionDeleters can find each user's sessions
+type Owner interface {
+	//SessionOwner returns the ID of the user the session belongs
+	//to, or false if it doesn't belong to one yet
+	SessionOwner() (int64, bool)
+}
+
+//sessionOwner returns the ID of the user `state` belongs to,
+//or false if it isn't an Owner or has no user
+func sessionOwner(state interface{}) (int64, bool) {
+	owner, ok := state.(Owner)
+	if !ok {
+		return 0, false
+	}
+	return owner.SessionOwner()
+}
+
+//UserSessionDeleter is implemented by stores that can delete every
+//session of a user. Only sessions whose state is an Owner are found.
+type UserSessionDeleter interface {
+	//DeleteUserSessions deletes every session of the user with the given ID
+	DeleteUserSessions(ctx context.Context, userID int64) error
+}
+
+//Wrapper is implemented by stores that add behavior
+//to another Store, such as MeteredStore
+type Wrapper interface {
+	//Unwrap returns the wrapped Store
+	Unwrap() Store
+}
+
+//DeleteUserSessions deletes every session of the user from `store`, or
+//from the store it wraps. It returns false if the store can't find a
+//user's sessions, like TokenStore, whose sessions can only be ended by
+//checking them against the user.
+func DeleteUserSessions(ctx context.Context, store Store, userID int64) (bool, error) {
+	for {
+		if deleter, ok := store.(UserSessionDeleter); ok {
+			return true, deleter.DeleteUserSessions(ctx, userID)
+		}
+		wrapper, ok := store.(Wrapper)
+		if !ok {
+			return false, nil
+		}
+		store = wrapper.Unwrap()
+	}
+}
+
+//Timeouts limits how long each kind of Store operation may take.
+//A zero duration leaves the operation bounded only by its context.
+type Timeouts struct {
+	Save   time.Duration
+	Get    time.Duration
+	Delete time.Duration
+}
+
+//NewTimeouts returns Timeouts that apply the same duration to every operation
+func NewTimeouts(d time.Duration) Timeouts {
+	return Timeouts{Save: d, Get: d, Delete: d}
+}
+
+//withTimeout derives a context that expires after `d`,
+//or returns `ctx` unchanged if `d` is zero
+func withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, d)
 }
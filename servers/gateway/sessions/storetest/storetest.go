@@ -0,0 +1,308 @@
+//Package storetest provides a conformance test suite for implementations
+//of sessions.Store. A new implementation proves its behavior matches the
+//others by calling Run from one of its tests:
+//
+//	func TestMyStore(t *testing.T) {
+//		storetest.Run(t, storetest.Harness{
+//			NewStore: func(t *testing.T, ttl time.Duration) sessions.Store {
+//				return NewMyStore(ttl)
+//			},
+//		})
+//	}
+package storetest
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"JobTracker/servers/gateway/sessions"
+)
+
+//signingKey is used for every SessionID the suite generates
+const signingKey = "storetest key"
+
+//Harness describes how to run the suite against one Store implementation
+type Harness struct {
+	//NewStore returns an empty store whose sessions
+	//expire after `ttl` without being used
+	NewStore func(t *testing.T, ttl time.Duration) sessions.Store
+	//Sleep lets `d` pass on the store's clock. Defaults to time.Sleep;
+	//stores with a fake clock can advance it instead.
+	Sleep func(d time.Duration)
+	//TTL is used by the expiry tests, and must be one the store
+	//supports exactly (redis, for example, works in whole seconds).
+	//Defaults to one second.
+	TTL time.Duration
+}
+
+//state is the session state saved by the suite
+type state struct {
+	StartTime time.Time         `json:"startTime"`
+	Name      string            `json:"name"`
+	Count     int               `json:"count"`
+	Tags      []string          `json:"tags"`
+	Extra     map[string]string `json:"extra"`
+}
+
+//ownedState is session state that belongs to a user
+type ownedState struct {
+	UserID int64 `json:"userID"`
+}
+
+//SessionOwner returns the ID of the user the session belongs to
+func (s *ownedState) SessionOwner() (int64, bool) {
+	return s.UserID, s.UserID != 0
+}
+
+//Run runs the conformance suite as subtests of `t`
+func Run(t *testing.T, h Harness) {
+	if h.Sleep == nil {
+		h.Sleep = time.Sleep
+	}
+	if h.TTL == 0 {
+		h.TTL = time.Second
+	}
+	t.Run("NotFound", func(t *testing.T) { testNotFound(t, h) })
+	t.Run("CRUD", func(t *testing.T) { testCRUD(t, h) })
+	t.Run("Unmarshalable", func(t *testing.T) { testUnmarshalable(t, h) })
+	t.Run("Unicode", func(t *testing.T) { testUnicode(t, h) })
+	t.Run("LargeState", func(t *testing.T) { testLargeState(t, h) })
+	t.Run("Concurrent", func(t *testing.T) { testConcurrent(t, h) })
+	t.Run("TTLExtension", func(t *testing.T) { testTTLExtension(t, h) })
+	t.Run("UserSessions", func(t *testing.T) { testUserSessions(t, h) })
+}
+
+//newSessionID returns a new SessionID, failing the test if it can't
+func newSessionID(t *testing.T) sessions.SessionID {
+	sid, err := sessions.NewSessionID(signingKey)
+	if err != nil {
+		t.Fatalf("error generating new SessionID: %v", err)
+	}
+	return sid
+}
+
+//roundTrip saves `st` under a new SessionID and checks
+//that the same state is read back
+func roundTrip(t *testing.T, store sessions.Store, st *state) {
+	ctx := context.Background()
+	sid := newSessionID(t)
+	if err := store.Save(ctx, sid, st); err != nil {
+		t.Fatalf("error saving state: %v", err)
+	}
+	stateRet := &state{}
+	if err := store.Get(ctx, sid, stateRet); err != nil {
+		t.Fatalf("error getting state: %v", err)
+	}
+	if !reflect.DeepEqual(st, stateRet) {
+		t.Errorf("incorrect state retrieved:\nEXPECTED\n%+v\nACTUAL\n%+v", st, stateRet)
+	}
+}
+
+func testNotFound(t *testing.T, h Harness) {
+	ctx := context.Background()
+	store := h.NewStore(t, time.Hour)
+	sid := newSessionID(t)
+	if err := store.Get(ctx, sid, &state{}); err != sessions.ErrStateNotFound {
+		t.Errorf("incorrect error when getting state that was never stored: expected %v but got %v", sessions.ErrStateNotFound, err)
+	}
+	if err := store.Delete(ctx, sid); err != nil {
+		t.Errorf("unexpected error deleting state that was never stored: %v", err)
+	}
+}
+
+func testCRUD(t *testing.T, h Harness) {
+	ctx := context.Background()
+	store := h.NewStore(t, time.Hour)
+	sid := newSessionID(t)
+	st := &state{
+		StartTime: time.Date(2021, time.June, 3, 12, 0, 0, 0, time.UTC),
+		Name:      "testing",
+		Count:     99,
+		Tags:      []string{"a", "b"},
+		Extra:     map[string]string{"k": "v"},
+	}
+	stateRet := &state{}
+
+	if err := store.Save(ctx, sid, st); err != nil {
+		t.Fatalf("error saving state: %v", err)
+	}
+	if err := store.Get(ctx, sid, stateRet); err != nil {
+		t.Fatalf("error getting state: %v", err)
+	}
+	if !reflect.DeepEqual(st, stateRet) {
+		t.Errorf("incorrect state retrieved:\nEXPECTED\n%+v\nACTUAL\n%+v", st, stateRet)
+	}
+
+	//saving again replaces the state
+	st.Count = 100
+	if err := store.Save(ctx, sid, st); err != nil {
+		t.Fatalf("error saving state again: %v", err)
+	}
+	if err := store.Get(ctx, sid, stateRet); err != nil || stateRet.Count != 100 {
+		t.Errorf("state was not replaced: got %+v, %v", stateRet, err)
+	}
+
+	//other sessions are unaffected
+	other := newSessionID(t)
+	if err := store.Save(ctx, other, &state{Name: "other"}); err != nil {
+		t.Fatalf("error saving other state: %v", err)
+	}
+
+	if err := store.Delete(ctx, sid); err != nil {
+		t.Errorf("error deleting state: %v", err)
+	}
+	if err := store.Get(ctx, sid, stateRet); err != sessions.ErrStateNotFound {
+		t.Errorf("incorrect error when getting state that was deleted: expected %v but got %v", sessions.ErrStateNotFound, err)
+	}
+	if err := store.Get(ctx, other, stateRet); err != nil || stateRet.Name != "other" {
+		t.Errorf("deleting one session affected another: got %+v, %v", stateRet, err)
+	}
+}
+
+func testUnmarshalable(t *testing.T, h Harness) {
+	//function values can't be marshaled into JSON
+	store := h.NewStore(t, time.Hour)
+	if err := store.Save(context.Background(), newSessionID(t), func() {}); err == nil {
+		t.Error("expected error when attempting to save a session state with an unmarshalable field")
+	}
+}
+
+func testUnicode(t *testing.T, h Harness) {
+	store := h.NewStore(t, time.Hour)
+	roundTrip(t, store, &state{
+		Name: "Zoë Ñandú 李小龍 👩‍💻",
+		Tags: []string{"ひらがな", "Ελληνικά", "עברית", "é vs é"},
+		Extra: map[string]string{
+			"emoji":  "🎉🚀",
+			"quotes": `"'\<>&`,
+			"escape": "tab\tnewline\n",
+		},
+	})
+}
+
+func testLargeState(t *testing.T, h Harness) {
+	store := h.NewStore(t, time.Hour)
+	extra := map[string]string{}
+	for i := 0; i < 1000; i++ {
+		extra[fmt.Sprintf("key%d", i)] = strings.Repeat("v", 100)
+	}
+	roundTrip(t, store, &state{
+		Name:  strings.Repeat("x", 1<<20),
+		Extra: extra,
+	})
+}
+
+func testConcurrent(t *testing.T, h Harness) {
+	ctx := context.Background()
+	store := h.NewStore(t, time.Hour)
+	shared := newSessionID(t)
+	if err := store.Save(ctx, shared, &state{Name: "shared"}); err != nil {
+		t.Fatalf("error saving shared state: %v", err)
+	}
+
+	const workers = 20
+	errs := make(chan error, workers*4)
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			//every worker reads the shared session...
+			sharedRet := &state{}
+			if err := store.Get(ctx, shared, sharedRet); err != nil || sharedRet.Name != "shared" {
+				errs <- fmt.Errorf("worker %d: incorrect shared state: %+v, %v", i, sharedRet, err)
+			}
+			//...and runs through a session of its own
+			sid, err := sessions.NewSessionID(signingKey)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if err := store.Save(ctx, sid, &state{Count: i}); err != nil {
+				errs <- fmt.Errorf("worker %d: error saving state: %v", i, err)
+				return
+			}
+			stateRet := &state{}
+			if err := store.Get(ctx, sid, stateRet); err != nil || stateRet.Count != i {
+				errs <- fmt.Errorf("worker %d: incorrect state: %+v, %v", i, stateRet, err)
+			}
+			if err := store.Delete(ctx, sid); err != nil {
+				errs <- fmt.Errorf("worker %d: error deleting state: %v", i, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func testTTLExtension(t *testing.T, h Harness) {
+	ctx := context.Background()
+	store := h.NewStore(t, h.TTL)
+	sid := newSessionID(t)
+	if err := store.Save(ctx, sid, &state{}); err != nil {
+		t.Fatalf("error saving state: %v", err)
+	}
+
+	//each Get resets the session's TTL, so a session
+	//that keeps being used outlives a single TTL
+	for i := 0; i < 3; i++ {
+		h.Sleep(h.TTL / 2)
+		if err := store.Get(ctx, sid, &state{}); err != nil {
+			t.Fatalf("error getting state after %d uses: %v", i, err)
+		}
+	}
+
+	//and once it stops being used, it expires
+	h.Sleep(h.TTL * 2)
+	if err := store.Get(ctx, sid, &state{}); err != sessions.ErrStateNotFound {
+		t.Errorf("incorrect error when getting state that expired: expected %v but got %v", sessions.ErrStateNotFound, err)
+	}
+}
+
+func testUserSessions(t *testing.T, h Harness) {
+	ctx := context.Background()
+	store := h.NewStore(t, time.Hour)
+	if found, _ := sessions.DeleteUserSessions(ctx, store, 3); !found {
+		t.Skip("the store can't find a user's sessions")
+	}
+	mine := []sessions.SessionID{newSessionID(t), newSessionID(t)}
+	for _, sid := range mine {
+		if err := store.Save(ctx, sid, &ownedState{UserID: 1}); err != nil {
+			t.Fatalf("error saving state: %v", err)
+		}
+	}
+	theirs, unowned := newSessionID(t), newSessionID(t)
+	if err := store.Save(ctx, theirs, &ownedState{UserID: 2}); err != nil {
+		t.Fatalf("error saving state: %v", err)
+	}
+	if err := store.Save(ctx, unowned, &state{Name: "unowned"}); err != nil {
+		t.Fatalf("error saving state: %v", err)
+	}
+
+	if _, err := sessions.DeleteUserSessions(ctx, store, 1); err != nil {
+		t.Fatalf("error deleting the user's sessions: %v", err)
+	}
+	for _, sid := range mine {
+		if err := store.Get(ctx, sid, &ownedState{}); err != sessions.ErrStateNotFound {
+			t.Errorf("incorrect error getting a deleted session of the user: expected %v but got %v", sessions.ErrStateNotFound, err)
+		}
+	}
+	if err := store.Get(ctx, theirs, &ownedState{}); err != nil {
+		t.Errorf("another user's session was deleted: %v", err)
+	}
+	if err := store.Get(ctx, unowned, &state{}); err != nil {
+		t.Errorf("a session without a user was deleted: %v", err)
+	}
+	//deleting again is fine
+	if _, err := sessions.DeleteUserSessions(ctx, store, 1); err != nil {
+		t.Errorf("unexpected error deleting the user's sessions again: %v", err)
+	}
+}
@@ -0,0 +1,203 @@
+package sessions
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+//tokenSeparator separates the parts of a signed session token
+const tokenSeparator = "."
+
+//tokenKeyContext is mixed into the signing key so that token signatures
+//can never be confused with SessionID signatures made with the same key
+const tokenKeyContext = "jobtracker session token v1"
+
+//ErrTokenExpired is returned when a signed session token is past its expiry
+var ErrTokenExpired = errors.New("session token has expired")
+
+//ErrTokenRevoked is returned when a signed session token was ended before it expired
+var ErrTokenRevoked = errors.New("session token has been revoked")
+
+//ErrStatelessSave is returned from TokenStore.Save(), since the state of a
+//signed session token is fixed when the token is issued
+var ErrStatelessSave = errors.New("session state cannot be saved to an issued session token")
+
+//TokenIssuer is implemented by stores that encode the session state into
+//the SessionID itself. BeginSession uses it in place of NewSessionID and Save.
+type TokenIssuer interface {
+	//IssueToken returns a new SessionID that carries `sessionState`
+	IssueToken(sessionState interface{}) (SessionID, error)
+}
+
+//tokenIssuer returns `store`, or the store it wraps,
+//if it is a TokenIssuer
+func tokenIssuer(store Store) (TokenIssuer, bool) {
+	for {
+		if issuer, ok := store.(TokenIssuer); ok {
+			return issuer, true
+		}
+		wrapper, ok := store.(Wrapper)
+		if !ok {
+			return nil, false
+		}
+		store = wrapper.Unwrap()
+	}
+}
+
+//tokenClaims is the signed payload of a session token
+type tokenClaims struct {
+	IssuedAt  int64           `json:"iat"`
+	ExpiresAt int64           `json:"exp"`
+	State     json.RawMessage `json:"state"`
+}
+
+//TokenStore represents a stateless session.Store. Rather than keeping
+//session state on a server, the state is encoded into a signed, expiring
+//token that is handed to the client as its SessionID:
+//+-------------------------------------------------------------+
+//|SessionID|.|base64 JSON claims|.|base64 HMAC of the first two|
+//+-------------------------------------------------------------+
+//Tokens are verified locally, so the only round-trip per request is the
+//check against the revocation list, which records tokens that were
+//ended before their expiry.
+//
+//Unlike the other stores, token expiry is fixed when the token is
+//issued and is not extended by Get.
+type TokenStore struct {
+	//Key used to sign the SessionID embedded in each token.
+	signingKey string
+	//Key derived from signingKey, used to sign and verify token claims.
+	tokenKey []byte
+	//How long an issued token remains valid.
+	SessionDuration time.Duration
+	//Tokens that were deleted before they expired.
+	Revoked RevocationList
+	//Deadlines for calls to the revocation list.
+	Timeouts Timeouts
+}
+
+//NewTokenStore constructs a new TokenStore that signs tokens with a key
+//derived from `signingKey`, the same key used for SessionIDs
+func NewTokenStore(signingKey string, sessionDuration time.Duration, revoked RevocationList) *TokenStore {
+	mac := hmac.New(sha256.New, []byte(signingKey))
+	mac.Write([]byte(tokenKeyContext))
+	return &TokenStore{
+		signingKey:      signingKey,
+		tokenKey:        mac.Sum(nil),
+		SessionDuration: sessionDuration,
+		Revoked:         revoked,
+	}
+}
+
+//IssueToken returns a new signed token carrying `sessionState`
+func (ts *TokenStore) IssueToken(sessionState interface{}) (SessionID, error) {
+	state, err := json.Marshal(sessionState)
+	if err != nil {
+		return InvalidSessionID, err
+	}
+	now := time.Now()
+	claims, err := json.Marshal(&tokenClaims{
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(ts.SessionDuration).Unix(),
+		State:     state,
+	})
+	if err != nil {
+		return InvalidSessionID, err
+	}
+	//the embedded SessionID is the token's unique ID, used for revocation
+	sid, err := NewSessionID(ts.signingKey)
+	if err != nil {
+		return InvalidSessionID, err
+	}
+	unsigned := sid.String() + tokenSeparator + base64.RawURLEncoding.EncodeToString(claims)
+	signature := base64.RawURLEncoding.EncodeToString(ts.sign(unsigned))
+	return SessionID(unsigned + tokenSeparator + signature), nil
+}
+
+//Store implementation
+
+//Save always returns ErrStatelessSave, since the state of an issued
+//token can't be changed. Use IssueToken (via BeginSession) instead.
+func (ts *TokenStore) Save(ctx context.Context, sid SessionID, sessionState interface{}) error {
+	return ErrStatelessSave
+}
+
+//Get verifies the token and populates `sessionState` with the
+//state that was encoded into it
+func (ts *TokenStore) Get(ctx context.Context, sid SessionID, sessionState interface{}) error {
+	id, claims, err := ts.verify(sid)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := withTimeout(ctx, ts.Timeouts.Get)
+	defer cancel()
+	revoked, err := ts.Revoked.IsRevoked(ctx, id)
+	if err != nil {
+		return err
+	}
+	if revoked {
+		return ErrTokenRevoked
+	}
+	return json.Unmarshal(claims.State, sessionState)
+}
+
+//Delete revokes the token until it would have expired anyway
+func (ts *TokenStore) Delete(ctx context.Context, sid SessionID) error {
+	id, claims, err := ts.verify(sid)
+	if err == ErrTokenExpired {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	ctx, cancel := withTimeout(ctx, ts.Timeouts.Delete)
+	defer cancel()
+	return ts.Revoked.Revoke(ctx, id, time.Until(time.Unix(claims.ExpiresAt, 0)))
+}
+
+//verify checks the token signature and expiry, returning
+//the token's unique ID and its decoded claims
+func (ts *TokenStore) verify(sid SessionID) (string, *tokenClaims, error) {
+	parts := strings.Split(sid.String(), tokenSeparator)
+	if len(parts) != 3 {
+		return "", nil, ErrStateNotFound
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", nil, ErrInvalidID
+	}
+	if !hmac.Equal(signature, ts.sign(parts[0]+tokenSeparator+parts[1])) {
+		return "", nil, ErrInvalidID
+	}
+	claimsJSON, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", nil, ErrInvalidID
+	}
+	claims := &tokenClaims{}
+	if err := json.Unmarshal(claimsJSON, claims); err != nil {
+		return "", nil, ErrInvalidID
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return "", nil, ErrTokenExpired
+	}
+	return parts[0], claims, nil
+}
+
+//sign returns the HMAC signature of `unsigned`
+func (ts *TokenStore) sign(unsigned string) []byte {
+	mac := hmac.New(sha256.New, ts.tokenKey)
+	mac.Write([]byte(unsigned))
+	return mac.Sum(nil)
+}
+
+//isToken reports whether `id` looks like a signed session token
+//rather than a plain SessionID
+func isToken(id string) bool {
+	return strings.Contains(id, tokenSeparator)
+}
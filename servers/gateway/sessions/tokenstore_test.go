@@ -0,0 +1,198 @@
+package sessions
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+/*
+TestTokenStore runs a signed session token through its lifecycle:
+issued by BeginSession, read back by GetState, and revoked by EndSession.
+*/
+func TestTokenStore(t *testing.T) {
+	ctx := context.Background()
+	type sessionState struct {
+		Sval string
+		Ival int
+	}
+
+	key := "test key"
+	state := &sessionState{
+		Sval: "testing",
+		Ival: 99,
+	}
+	store := NewTokenStore(key, time.Hour, NewMemRevocationList(time.Minute))
+
+	w := httptest.NewRecorder()
+	sid, err := BeginSession(context.Background(), key, store, state, w)
+	if err != nil {
+		t.Fatalf("error beginning session: %v", err)
+	}
+	header := w.Header().Get(headerAuthorization)
+	if header != schemeBearer+sid.String() {
+		t.Errorf("incorrect %s header: expected %s but got %s", headerAuthorization, schemeBearer+sid.String(), header)
+	}
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set(headerAuthorization, header)
+
+	stateRet := &sessionState{}
+	if _, err := GetState(r, key, store, stateRet); err != nil {
+		t.Fatalf("error getting state: %v", err)
+	}
+	if !reflect.DeepEqual(state, stateRet) {
+		t.Errorf("incorrect state retrieved: expected %v but got %v", state, stateRet)
+	}
+
+	if err := store.Save(ctx, sid, state); err != ErrStatelessSave {
+		t.Errorf("incorrect error when saving to an issued token: expected %v but got %v", ErrStatelessSave, err)
+	}
+
+	if _, err := EndSession(r, key, store); err != nil {
+		t.Fatalf("error ending session: %v", err)
+	}
+	if _, err := GetState(r, key, store, stateRet); err != ErrTokenRevoked {
+		t.Errorf("incorrect error when getting state that was revoked: expected %v but got %v", ErrTokenRevoked, err)
+	}
+}
+
+//TestTokenStoreWrapped checks that BeginSession still issues
+//a token when the TokenStore is wrapped, as the gateway does
+func TestTokenStoreWrapped(t *testing.T) {
+	key := "test key"
+	store := NewMeteredStore(NewTokenStore(key, time.Hour, NewMemRevocationList(time.Minute)))
+
+	w := httptest.NewRecorder()
+	if _, err := BeginSession(context.Background(), key, store, "state", w); err != nil {
+		t.Fatalf("error beginning session: %v", err)
+	}
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set(headerAuthorization, w.Header().Get(headerAuthorization))
+	state := ""
+	if _, err := GetState(r, key, store, &state); err != nil || state != "state" {
+		t.Errorf("incorrect state from a wrapped token store: expected %q but got %q, %v", "state", state, err)
+	}
+}
+
+//TestTokenStoreMetered checks that expired and revoked tokens, and
+//saves to issued tokens, aren't counted as session store errors
+func TestTokenStoreMetered(t *testing.T) {
+	ctx := context.Background()
+	key := "test key"
+	revoked := NewMemRevocationList(time.Minute)
+	store := NewMeteredStore(NewTokenStore(key, time.Hour, revoked))
+	sid, err := NewTokenStore(key, time.Hour, revoked).IssueToken("state")
+	if err != nil {
+		t.Fatalf("error issuing token: %v", err)
+	}
+	expiredSid, err := NewTokenStore(key, -time.Second, revoked).IssueToken("state")
+	if err != nil {
+		t.Fatalf("error issuing token: %v", err)
+	}
+	getErrors := testutil.ToFloat64(storeErrors.WithLabelValues("get"))
+	saveErrors := testutil.ToFloat64(storeErrors.WithLabelValues("save"))
+
+	state := ""
+	if err := store.Save(ctx, sid, state); err != ErrStatelessSave {
+		t.Errorf("incorrect error when saving to an issued token: expected %v but got %v", ErrStatelessSave, err)
+	}
+	if err := store.Get(ctx, expiredSid, &state); err != ErrTokenExpired {
+		t.Errorf("incorrect error when getting an expired token: expected %v but got %v", ErrTokenExpired, err)
+	}
+	if err := store.Delete(ctx, sid); err != nil {
+		t.Fatalf("error revoking token: %v", err)
+	}
+	if err := store.Get(ctx, sid, &state); err != ErrTokenRevoked {
+		t.Errorf("incorrect error when getting a revoked token: expected %v but got %v", ErrTokenRevoked, err)
+	}
+
+	if got := testutil.ToFloat64(storeErrors.WithLabelValues("get")); got != getErrors {
+		t.Errorf("expired and revoked tokens should not be counted as errors: expected %v but got %v", getErrors, got)
+	}
+	if got := testutil.ToFloat64(storeErrors.WithLabelValues("save")); got != saveErrors {
+		t.Errorf("saves to issued tokens should not be counted as errors: expected %v but got %v", saveErrors, got)
+	}
+}
+
+func TestTokenStoreVerify(t *testing.T) {
+	ctx := context.Background()
+	key := "test key"
+	store := NewTokenStore(key, time.Hour, NewMemRevocationList(time.Minute))
+	sid, err := store.IssueToken("state")
+	if err != nil {
+		t.Fatalf("error issuing token: %v", err)
+	}
+	parts := strings.Split(sid.String(), tokenSeparator)
+
+	expired := NewTokenStore(key, -time.Second, NewMemRevocationList(time.Minute))
+	expiredSid, err := expired.IssueToken("state")
+	if err != nil {
+		t.Fatalf("error issuing token: %v", err)
+	}
+
+	otherSid, err := NewTokenStore("other key", time.Hour, NewMemRevocationList(time.Minute)).IssueToken("state")
+	if err != nil {
+		t.Fatalf("error issuing token: %v", err)
+	}
+
+	cases := []struct {
+		name        string
+		hint        string
+		sid         SessionID
+		expectedErr error
+	}{
+		{
+			"Valid Token",
+			"Remember to return the decoded state for a valid token",
+			sid,
+			nil,
+		},
+		{
+			"Expired Token",
+			"Remember to check the expiry in the claims",
+			expiredSid,
+			ErrTokenExpired,
+		},
+		{
+			"Tampered Claims",
+			"Remember to verify the signature over the claims",
+			SessionID(parts[0] + tokenSeparator + parts[1] + "A" + tokenSeparator + parts[2]),
+			ErrInvalidID,
+		},
+		{
+			"Different Signing Key",
+			"Remember to verify the signature with the store's key",
+			otherSid,
+			ErrInvalidID,
+		},
+		{
+			"Plain SessionID",
+			"Remember that plain SessionIDs carry no state",
+			SessionID(parts[0]),
+			ErrStateNotFound,
+		},
+	}
+
+	for _, c := range cases {
+		var state string
+		err := store.Get(ctx, c.sid, &state)
+		if err != c.expectedErr {
+			t.Errorf("case %s: incorrect error: expected %v but got %v\nHINT: %s", c.name, c.expectedErr, err, c.hint)
+		}
+		if err == nil && state != "state" {
+			t.Errorf("case %s: incorrect state: expected %q but got %q", c.name, "state", state)
+		}
+	}
+
+	//deleting an expired token is a no-op
+	if err := expired.Delete(ctx, expiredSid); err != nil {
+		t.Errorf("unexpected error deleting expired token: %v", err)
+	}
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"JobTracker/servers/gateway/handlers"
+	"JobTracker/servers/problem"
+	"JobTracker/servers/tracing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	// breakerFailures is how many connection failures in a row
+	// open an upstream's circuit
+	breakerFailures = 5
+	// breakerCooldown is how long an open circuit stops requests to
+	// its upstream before one request is let through to test it
+	breakerCooldown = 30 * time.Second
+)
+
+// statusClientClosedRequest is the status code, as in nginx's logs,
+// of requests the client canceled before the upstream responded. It
+// is recorded but never received, since the client is gone.
+const statusClientClosedRequest = 499
+
+// errCircuitOpen is returned when every upstream of a
+// microservice has an open circuit, so none was tried
+var errCircuitOpen = errors.New("every upstream's circuit is open")
+
+// upstreamDuration times requests proxied to the microservices,
+// by upstream and status code, or "error" when none was received
+// and "canceled" when the client gave up first
+var upstreamDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "gateway_upstream_request_duration_seconds",
+	Help:    "How long requests proxied to microservices took, by upstream and status code, error or canceled.",
+	Buckets: prometheus.DefBuckets,
+}, []string{"upstream", "status"})
+
+// upstreamRejected counts requests not sent to an
+// upstream because its circuit was open
+var upstreamRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "gateway_upstream_circuit_open_total",
+	Help: "How many requests were not sent to an upstream because its circuit was open.",
+}, []string{"upstream"})
+
+// upstreamRetries counts requests sent to another upstream
+// after the one the Director chose could not be reached
+var upstreamRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "gateway_upstream_retries_total",
+	Help: "How many requests were retried against another upstream after a connection failure.",
+}, []string{"upstream"})
+
+// breaker is the circuit breaker of an upstream. After breakerFailures
+// connection failures in a row its circuit opens, and requests go to
+// other upstreams until breakerCooldown passes and a trial request
+// succeeds.
+type breaker struct {
+	upstream string
+	now      func() time.Time
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	trial     bool
+}
+
+// allow reports whether a request can be sent to the upstream, and
+// whether it is the trial request of an open circuit
+func (b *breaker) allow() (allowed bool, trial bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < breakerFailures {
+		return true, false
+	}
+	if b.trial || b.now().Before(b.openUntil) {
+		return false, false
+	}
+	// Let one request through to test whether the upstream recovered
+	b.trial = true
+	return true, true
+}
+
+// record records the result of a request allowed to the upstream.
+// `trial` is whether allow let it through as the trial request, so
+// requests sent before the circuit opened don't end the trial when
+// they finish while it is still in flight.
+func (b *breaker) record(err error, trial bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if trial {
+		b.trial = false
+	}
+	// A client that gave up says nothing about the upstream
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	if err == nil {
+		if b.failures >= breakerFailures {
+			log.Printf("circuit of upstream %s closed", b.upstream)
+		}
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= breakerFailures {
+		if b.failures == breakerFailures {
+			log.Printf("circuit of upstream %s opened after %d failures: %v", b.upstream, b.failures, err)
+		}
+		b.openUntil = b.now().Add(breakerCooldown)
+	}
+}
+
+// upstreamTransport is the Transport of the reverse proxies. It
+// records how long each upstream takes to respond, skips upstreams
+// whose circuits are open, and retries idempotent requests against
+// another upstream when the one the Director chose can't be reached.
+type upstreamTransport struct {
+	next     http.RoundTripper
+	targets  []*url.URL
+	breakers map[string]*breaker
+}
+
+// newUpstreamTransport returns an upstreamTransport that sends
+// requests to `targets`, each in a tracing span, giving up on
+// connecting after `dialTimeout` and on a response after
+// `responseTimeout`
+func newUpstreamTransport(targets []*url.URL, dialTimeout time.Duration, responseTimeout time.Duration) *upstreamTransport {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   dialTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   20,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: responseTimeout,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+	ut := &upstreamTransport{
+		next:     tracing.Transport(transport),
+		targets:  targets,
+		breakers: map[string]*breaker{},
+	}
+	for _, targ := range targets {
+		name := upstreamName(targ)
+		ut.breakers[name] = &breaker{upstream: name, now: time.Now}
+	}
+	return ut
+}
+
+// upstreamName returns the name of the upstream
+// at `u`, such as "http://applications:80"
+func upstreamName(u *url.URL) string {
+	return u.Scheme + "://" + u.Host
+}
+
+// retryable reports whether the request can be sent to another upstream
+// after failing with `err`: it is idempotent, has no body that may have
+// been read, and the upstream could not be connected to, so it never
+// received the request. Requests the client canceled aren't retried.
+func retryable(r *http.Request, err error) bool {
+	if r.Context().Err() != nil {
+		return false
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+	default:
+		return false
+	}
+	if r.Body != nil && r.Body != http.NoBody {
+		return false
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// RoundTrip sends the request to the upstream the Director chose,
+// or the next ones in turn if that one's circuit is open or it
+// can't be connected to
+func (ut *upstreamTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	first := -1
+	for i, targ := range ut.targets {
+		if upstreamName(targ) == upstreamName(r.URL) {
+			first = i
+			break
+		}
+	}
+	if first == -1 {
+		return ut.send(r, nil, false)
+	}
+
+	err := errCircuitOpen
+	tried := false
+	for i := range ut.targets {
+		targ := ut.targets[(first+i)%len(ut.targets)]
+		name := upstreamName(targ)
+		b := ut.breakers[name]
+		allowed, trial := b.allow()
+		if !allowed {
+			upstreamRejected.WithLabelValues(name).Inc()
+			continue
+		}
+		attempt := r
+		if i != 0 {
+			// RoundTrippers must not change the request, so send a copy
+			attempt = r.Clone(r.Context())
+			attempt.Host = targ.Host
+			attempt.URL.Host = targ.Host
+			attempt.URL.Scheme = targ.Scheme
+			handlers.LogUpstream(attempt, targ.String())
+		}
+		if tried {
+			upstreamRetries.WithLabelValues(name).Inc()
+		}
+		tried = true
+		resp, attemptErr := ut.send(attempt, b, trial)
+		if attemptErr == nil {
+			return resp, nil
+		}
+		err = attemptErr
+		if !retryable(r, err) {
+			break
+		}
+	}
+	return nil, err
+}
+
+// send sends the request to its upstream, recording the result with
+// the upstream's breaker, if any. `trial` is whether it is the trial
+// request of the breaker's open circuit.
+func (ut *upstreamTransport) send(r *http.Request, b *breaker, trial bool) (*http.Response, error) {
+	start := time.Now()
+	resp, err := ut.next.RoundTrip(r)
+	status := "error"
+	if err == nil {
+		status = strconv.Itoa(resp.StatusCode)
+	} else if errors.Is(err, context.Canceled) {
+		status = "canceled"
+	}
+	upstreamDuration.WithLabelValues(upstreamName(r.URL), status).Observe(time.Since(start).Seconds())
+	if b != nil {
+		b.record(err, trial)
+	}
+	return resp, err
+}
+
+// proxyErrorHandler returns the ErrorHandler of the reverse proxy
+// to `service`, which responds with a problem naming the service:
+// 503 when every upstream's circuit is open, 504 when the upstream
+// timed out and 502 when it couldn't be reached. When the client
+// canceled the request, only statusClientClosedRequest is recorded.
+func proxyErrorHandler(service string) func(http.ResponseWriter, *http.Request, error) {
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		var netErr net.Error
+		switch {
+		case errors.Is(err, errCircuitOpen):
+			w.Header().Set("Retry-After", strconv.Itoa(int(breakerCooldown.Seconds())))
+			problem.Error(w, r, "the "+service+" service is unavailable", http.StatusServiceUnavailable)
+		case errors.Is(err, context.Canceled):
+			// The client gave up, so no one will read the response, and
+			// the upstream didn't fail. The status is only for the
+			// request log and metrics.
+			w.WriteHeader(statusClientClosedRequest)
+		case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+			problem.Internal(w, r, err, "the "+service+" service took too long to respond", http.StatusGatewayTimeout)
+		default:
+			problem.Internal(w, r, err, "the "+service+" service could not be reached", http.StatusBadGateway)
+		}
+	}
+}
+
+// newReverseProxy returns a reverse proxy to the `service`
+// microservice's instances at `targets`. PROXYDIALTIMEOUT and
+// PROXYRESPONSETIMEOUT optionally bound how long connecting to an
+// instance (default 2s) and waiting for its response headers
+// (default 30s) take.
+func newReverseProxy(service string, targets []*url.URL) *httputil.ReverseProxy {
+	return &httputil.ReverseProxy{
+		Director: CustomDirector(targets),
+		Transport: newUpstreamTransport(targets,
+			getEnvDuration("PROXYDIALTIMEOUT", 2*time.Second),
+			getEnvDuration("PROXYRESPONSETIMEOUT", 30*time.Second)),
+		ErrorHandler: proxyErrorHandler(service),
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"JobTracker/servers/problem"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// deadURL returns the URL of an address nothing listens at
+func deadURL(t *testing.T) *url.URL {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error listening: %v", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+	return &url.URL{Scheme: "http", Host: addr}
+}
+
+// newTestProxy returns a reverse proxy to the applications service
+// at `targets` that always chooses the first one, like the Director
+// would in turn
+func newTestProxy(targets []*url.URL, responseTimeout time.Duration) (*httputil.ReverseProxy, *upstreamTransport) {
+	transport := newUpstreamTransport(targets, time.Second, responseTimeout)
+	return &httputil.ReverseProxy{
+		Director: func(r *http.Request) {
+			r.Host = targets[0].Host
+			r.URL.Host = targets[0].Host
+			r.URL.Scheme = targets[0].Scheme
+		},
+		Transport:    transport,
+		ErrorHandler: proxyErrorHandler("applications"),
+	}, transport
+}
+
+// checkProblem checks that the response is a problem
+// with the status code that names the applications service
+func checkProblem(t *testing.T, rr *httptest.ResponseRecorder, status int) {
+	t.Helper()
+	if rr.Code != status {
+		t.Fatalf("incorrect status code: expected %d but got %d", status, rr.Code)
+	}
+	if contentType := rr.Header().Get("Content-Type"); contentType != problem.ContentType {
+		t.Errorf("incorrect Content-Type: expected %s but got %s", problem.ContentType, contentType)
+	}
+	p := &problem.Problem{}
+	if err := json.Unmarshal(rr.Body.Bytes(), p); err != nil {
+		t.Fatalf("error decoding problem: %v", err)
+	}
+	if p.Code != problem.StatusCode(status) || !strings.Contains(p.Detail, "applications service") {
+		t.Errorf("incorrect problem: got code %s and detail %q", p.Code, p.Detail)
+	}
+}
+
+func TestProxyRetries(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Method))
+	}))
+	defer upstream.Close()
+	upstreamURL, _ := url.Parse(upstream.URL)
+	proxy, _ := newTestProxy([]*url.URL{deadURL(t), upstreamURL}, time.Second)
+
+	// idempotent requests are sent to the next upstream
+	rr := httptest.NewRecorder()
+	proxy.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/applications", nil))
+	if rr.Code != http.StatusOK || rr.Body.String() != http.MethodGet {
+		t.Errorf("expected the GET to be retried against the live upstream but got %d %s", rr.Code, rr.Body.String())
+	}
+
+	// other requests are not
+	rr = httptest.NewRecorder()
+	proxy.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/applications", strings.NewReader(`{}`)))
+	checkProblem(t, rr, http.StatusBadGateway)
+}
+
+func TestProxyTimeout(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer upstream.Close()
+	upstreamURL, _ := url.Parse(upstream.URL)
+	proxy, _ := newTestProxy([]*url.URL{upstreamURL}, 50*time.Millisecond)
+
+	rr := httptest.NewRecorder()
+	proxy.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/applications", nil))
+	checkProblem(t, rr, http.StatusGatewayTimeout)
+}
+
+func TestProxyCircuitBreaker(t *testing.T) {
+	dead := deadURL(t)
+	proxy, transport := newTestProxy([]*url.URL{dead}, time.Second)
+	b := transport.breakers[upstreamName(dead)]
+	now := time.Now()
+	b.now = func() time.Time { return now }
+
+	// connection failures are bad gateways until the circuit opens
+	for i := 0; i < breakerFailures; i++ {
+		rr := httptest.NewRecorder()
+		proxy.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/applications", nil))
+		checkProblem(t, rr, http.StatusBadGateway)
+	}
+	rr := httptest.NewRecorder()
+	proxy.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/applications", nil))
+	checkProblem(t, rr, http.StatusServiceUnavailable)
+	if len(rr.Header().Get("Retry-After")) == 0 {
+		t.Errorf("503 responses should have a Retry-After header")
+	}
+
+	// after the cooldown, one request tests the upstream again
+	now = now.Add(breakerCooldown)
+	if allowed, trial := b.allow(); !allowed || !trial {
+		t.Fatalf("a trial request should be allowed after the cooldown")
+	}
+	if allowed, _ := b.allow(); allowed {
+		t.Errorf("only one trial request should be allowed at a time")
+	}
+	b.record(nil, true)
+	for i := 0; i < 2; i++ {
+		if allowed, trial := b.allow(); !allowed || trial {
+			t.Errorf("requests should be allowed once the trial request succeeds")
+		}
+	}
+}
+
+func TestBreakerTrialInFlight(t *testing.T) {
+	now := time.Now()
+	b := &breaker{upstream: "http://applications:80", now: func() time.Time { return now }}
+	for i := 0; i < breakerFailures; i++ {
+		b.record(errors.New("connection refused"), false)
+	}
+	now = now.Add(breakerCooldown)
+	if allowed, trial := b.allow(); !allowed || !trial {
+		t.Fatalf("a trial request should be allowed after the cooldown")
+	}
+
+	// a request sent before the circuit opened finishes while the trial
+	// request is still in flight, which shouldn't let another trial through
+	b.record(context.Canceled, false)
+	if allowed, _ := b.allow(); allowed {
+		t.Errorf("only one trial request should be allowed while the trial is in flight")
+	}
+
+	// once the trial request fails, the circuit stays open for another cooldown
+	b.record(errors.New("connection refused"), true)
+	if allowed, _ := b.allow(); allowed {
+		t.Errorf("requests should not be allowed after the trial request fails")
+	}
+	now = now.Add(breakerCooldown)
+	if allowed, trial := b.allow(); !allowed || !trial {
+		t.Errorf("a new trial request should be allowed after the next cooldown")
+	}
+}
+
+func TestProxyClientCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the client gives up while the upstream is responding
+		cancel()
+		<-r.Context().Done()
+	}))
+	defer upstream.Close()
+	upstreamURL, _ := url.Parse(upstream.URL)
+	proxy, transport := newTestProxy([]*url.URL{upstreamURL, deadURL(t)}, time.Second)
+	b := transport.breakers[upstreamName(upstreamURL)]
+
+	rr := httptest.NewRecorder()
+	proxy.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/applications", nil).WithContext(ctx))
+	if rr.Code != statusClientClosedRequest || rr.Body.Len() != 0 {
+		t.Errorf("expected %d without a body but got %d %s", statusClientClosedRequest, rr.Code, rr.Body.String())
+	}
+	if b.failures != 0 {
+		t.Errorf("a canceled request shouldn't count as a failure of the upstream but got %d failures", b.failures)
+	}
+	if n := testutil.ToFloat64(upstreamRetries.WithLabelValues(upstreamName(transport.targets[1]))); n != 0 {
+		t.Errorf("a canceled request shouldn't be retried but got %v retries", n)
+	}
+}
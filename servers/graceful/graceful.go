@@ -0,0 +1,40 @@
+//Package graceful serves HTTP until the process is asked to stop,
+//letting requests in progress finish, so services can export what
+//they still hold, such as batched spans, before they exit.
+package graceful
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+//Timeout is how long Serve waits for requests in progress to finish
+const Timeout = 10 * time.Second
+
+//Serve runs `listen`, such as server.ListenAndServe, until it fails or
+//the process gets SIGINT or SIGTERM, as from docker stop. Then `server`
+//stops accepting requests and waits up to Timeout for those in
+//progress. It returns nil if the server was asked to stop.
+func Serve(server *http.Server, listen func() error) error {
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(stop)
+	stopped := make(chan error, 1)
+	go func() {
+		sig := <-stop
+		log.Printf("received %v, shutting down", sig)
+		ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+		defer cancel()
+		stopped <- server.Shutdown(ctx)
+	}()
+
+	if err := listen(); err != http.ErrServerClosed {
+		return err
+	}
+	return <-stopped
+}
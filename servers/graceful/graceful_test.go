@@ -0,0 +1,52 @@
+package graceful
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestServeStopsOnSignal(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error listening: %v", err)
+	}
+	started := make(chan struct{})
+	finished := atomic.Bool{}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		finished.Store(true)
+	})}
+	served := make(chan error, 1)
+	go func() {
+		served <- Serve(server, func() error { return server.Serve(listener) })
+	}()
+
+	//a request in progress is allowed to finish
+	go http.Get("http://" + listener.Addr().String())
+	<-started
+	syscall.Kill(os.Getpid(), syscall.SIGTERM)
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("unexpected error stopping: %v", err)
+		}
+		if !finished.Load() {
+			t.Errorf("the request in progress should finish before Serve returns")
+		}
+	case <-time.After(Timeout):
+		t.Fatalf("Serve did not return after SIGTERM")
+	}
+}
+
+func TestServeReturnsListenErrors(t *testing.T) {
+	server := &http.Server{Addr: "bad address"}
+	if err := Serve(server, server.ListenAndServe); err == nil {
+		t.Errorf("expected an error listening on a bad address")
+	}
+}
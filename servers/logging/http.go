@@ -0,0 +1,103 @@
+package logging
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"time"
+)
+
+//RequestIDHeader is the header that holds the ID of the request. The
+//gateway assigns it, services pass it on and log it, and problems
+//include it so users can report it.
+const RequestIDHeader = "X-Request-ID"
+
+//MaxRequestIDLength is the longest request ID accepted from clients
+//and load balancers. Longer or unusual IDs are replaced.
+const MaxRequestIDLength = 128
+
+//ValidRequestID reports whether `id` is a request ID that can be
+//passed on as is: short and only letters, digits and -_.:
+func ValidRequestID(id string) bool {
+	if len(id) == 0 || len(id) > MaxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case c == '-' || c == '_' || c == '.' || c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+//NewRequestID returns a random request ID
+func NewRequestID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		//the ID only correlates logs, so a timestamp will do
+		return time.Now().UTC().Format("20060102T150405.000000000")
+	}
+	return hex.EncodeToString(id)
+}
+
+//StatusRecorder is a ResponseWriter that records the status code
+//and the number of bytes of the response, for middleware that
+//log, measure or trace requests
+type StatusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+//NewStatusRecorder returns a StatusRecorder that writes to `w`
+func NewStatusRecorder(w http.ResponseWriter) *StatusRecorder {
+	return &StatusRecorder{ResponseWriter: w}
+}
+
+//WriteHeader records the status code
+func (sr *StatusRecorder) WriteHeader(status int) {
+	if sr.status == 0 {
+		sr.status = status
+	}
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+//Write records the number of bytes written
+func (sr *StatusRecorder) Write(p []byte) (int, error) {
+	if sr.status == 0 {
+		sr.status = http.StatusOK
+	}
+	n, err := sr.ResponseWriter.Write(p)
+	sr.bytes += int64(n)
+	return n, err
+}
+
+//Flush flushes the response if the ResponseWriter supports it,
+//so proxied responses can still be streamed
+func (sr *StatusRecorder) Flush() {
+	if f, ok := sr.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+//Unwrap returns the ResponseWriter, for http.ResponseController
+func (sr *StatusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
+
+//Status returns the status code of the response. Like net/http,
+//it is 200 if the handler didn't write a status code.
+func (sr *StatusRecorder) Status() int {
+	if sr.status == 0 {
+		return http.StatusOK
+	}
+	return sr.status
+}
+
+//Bytes returns the number of bytes of the response body
+func (sr *StatusRecorder) Bytes() int64 {
+	return sr.bytes
+}
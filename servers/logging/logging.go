@@ -0,0 +1,70 @@
+//Package logging writes structured logs as JSON lines with log/slog,
+//one record per line with "time", "level" and "msg" followed by the
+//record's attributes. Values that could identify users, such as
+//credentials and email addresses, are redacted. It also holds what
+//request logging middleware share: the request ID header and a
+//ResponseWriter that records the response's status code.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+//Redacted replaces the values of redacted attributes
+const Redacted = "[REDACTED]"
+
+//redactedKeys are the attribute keys, lowercased, whose values are
+//always redacted. Keys ending in "email" are redacted too.
+var redactedKeys = map[string]bool{
+	"authorization": true,
+	"cookie":        true,
+	"password":      true,
+	"token":         true,
+}
+
+//emailPattern matches email addresses inside other values,
+//such as paths and error messages
+var emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+
+//bearerPattern matches credentials in Authorization header values
+var bearerPattern = regexp.MustCompile(`(?i)\bBearer\s+\S+`)
+
+//New returns a logger that writes records to `out` as JSON lines,
+//redacting their messages and attributes
+func New(out io.Writer) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(out, &slog.HandlerOptions{ReplaceAttr: redactAttr}))
+}
+
+//RedactString replaces email addresses and bearer
+//credentials in `s` with Redacted
+func RedactString(s string) string {
+	s = emailPattern.ReplaceAllString(s, Redacted)
+	return bearerPattern.ReplaceAllString(s, "Bearer "+Redacted)
+}
+
+//redactAttr returns the attribute to log in place of `a`. The
+//handler calls it for the message too, so it is redacted the same way.
+func redactAttr(groups []string, a slog.Attr) slog.Attr {
+	lower := strings.ToLower(a.Key)
+	if redactedKeys[lower] || strings.HasSuffix(lower, "email") {
+		return slog.String(a.Key, Redacted)
+	}
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, RedactString(a.Value.String()))
+	case slog.KindAny:
+		switch v := a.Value.Any().(type) {
+		case error:
+			return slog.String(a.Key, RedactString(v.Error()))
+		case slog.Level:
+			return a
+		case fmt.Stringer:
+			return slog.String(a.Key, RedactString(v.String()))
+		}
+	}
+	return a
+}
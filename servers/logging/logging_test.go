@@ -0,0 +1,109 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+//newTestLogger returns a logger that writes to the returned buffer
+func newTestLogger() (*slog.Logger, *bytes.Buffer) {
+	buf := &bytes.Buffer{}
+	return New(buf), buf
+}
+
+//decodeRecords decodes each line in `buf` as a record
+func decodeRecords(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	records := []map[string]interface{}{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		record := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("error decoding record %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestLog(t *testing.T) {
+	logger, buf := newTestLogger()
+	logger.With("service", "gateway").Info("request", "status", 200, "latency", 1500*time.Microsecond, "ok", true)
+
+	record := decodeRecords(t, buf)[0]
+	if _, err := time.Parse(time.RFC3339Nano, record["time"].(string)); err != nil {
+		t.Errorf("the time should be RFC 3339 but got %v", record["time"])
+	}
+	delete(record, "time")
+	expected := map[string]interface{}{"level": "INFO", "msg": "request", "service": "gateway", "status": float64(200), "latency": float64(1500000), "ok": true}
+	if len(record) != len(expected) {
+		t.Errorf("incorrect record: expected %v but got %v", expected, record)
+	}
+	for key, value := range expected {
+		if record[key] != value {
+			t.Errorf("incorrect %s: expected %v but got %v", key, value, record[key])
+		}
+	}
+}
+
+func TestLogErrors(t *testing.T) {
+	logger, buf := newTestLogger()
+	logger.Error("error", "err", errors.New("failed"))
+
+	record := decodeRecords(t, buf)[0]
+	if record["level"] != slog.LevelError.String() || record["err"] != "failed" {
+		t.Errorf("errors should be logged as their message but got %v", record)
+	}
+}
+
+func TestLogRedaction(t *testing.T) {
+	cases := []struct {
+		name     string
+		key      string
+		value    interface{}
+		expected string
+	}{
+		{"Authorization Header", "Authorization", "Bearer jt_secret", Redacted},
+		{"Email", "email", "someone@example.com", Redacted},
+		{"Email Suffix", "userEmail", "someone@example.com", Redacted},
+		{"Email In Path", "path", "/v1/users/someone@example.com", "/v1/users/" + Redacted},
+		{"Bearer In Error", "err", errors.New("bad header: Bearer jt_secret"), "bad header: Bearer " + Redacted},
+		{"Other Values", "path", "/v1/users/me", "/v1/users/me"},
+	}
+	for _, c := range cases {
+		logger, buf := newTestLogger()
+		logger.Info("request", c.key, c.value)
+		record := decodeRecords(t, buf)[0]
+		if record[c.key] != c.expected {
+			t.Errorf("case %s: expected %q but got %v", c.name, c.expected, record[c.key])
+		}
+	}
+
+	logger, buf := newTestLogger()
+	logger.Info("signed in someone@example.com")
+	if strings.Contains(buf.String(), "someone@example.com") {
+		t.Errorf("emails in messages should be redacted but got %s", buf.String())
+	}
+}
+
+func TestStatusRecorder(t *testing.T) {
+	response := httptest.NewRecorder()
+	recorder := NewStatusRecorder(response)
+	if recorder.Status() != http.StatusOK {
+		t.Errorf("the status should be 200 before anything is written but got %d", recorder.Status())
+	}
+	recorder.WriteHeader(http.StatusCreated)
+	recorder.WriteHeader(http.StatusInternalServerError)
+	recorder.Write([]byte("created"))
+	if recorder.Status() != http.StatusCreated || recorder.Bytes() != int64(len("created")) {
+		t.Errorf("expected the first status code and the body's length but got %d and %d", recorder.Status(), recorder.Bytes())
+	}
+	if response.Body.String() != "created" {
+		t.Errorf("the response should be written through but got %q", response.Body.String())
+	}
+}
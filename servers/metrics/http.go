@@ -0,0 +1,67 @@
+//Package metrics has what every JobTracker service needs to be scraped
+//by Prometheus the same way: the handler that serves the metrics
+//registered with prometheus/client_golang's default registry, and the
+//middleware that times requests by route.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"JobTracker/servers/logging"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+//RequestDuration times the requests a service serves,
+//by the route that handled them, method and status code
+var RequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "http_request_duration_seconds",
+	Help:    "How long requests took to serve, by route, method and status code.",
+	Buckets: prometheus.DefBuckets,
+}, []string{"route", "method", "status"})
+
+//unmatchedRoute is the route of requests that matched no pattern
+const unmatchedRoute = "unmatched"
+
+//knownMethods are the methods requests are labeled with.
+//Others are labeled "OTHER", so clients can't add series.
+var knownMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodOptions: true,
+}
+
+//Handler returns a handler that serves the metrics
+//in the default registry
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+//InstrumentMux returns a handler that serves requests with `mux` and
+//records them in RequestDuration. Requests are labeled with the pattern
+//they matched, such as "/v1/users/", rather than their path, so
+//the number of series stays bounded.
+func InstrumentMux(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		_, route := mux.Handler(r)
+		if len(route) == 0 {
+			route = unmatchedRoute
+		}
+		recorder := logging.NewStatusRecorder(w)
+		mux.ServeHTTP(recorder, r)
+		method := r.Method
+		if !knownMethods[method] {
+			method = "OTHER"
+		}
+		RequestDuration.WithLabelValues(route, method, strconv.Itoa(recorder.Status())).Observe(time.Since(start).Seconds())
+	})
+}
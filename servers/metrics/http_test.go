@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+//observations returns how many requests
+//RequestDuration timed with the labels
+func observations(t *testing.T, labels ...string) uint64 {
+	m := &dto.Metric{}
+	if err := RequestDuration.WithLabelValues(labels...).(prometheus.Metric).Write(m); err != nil {
+		t.Fatalf("error reading %v: %v", labels, err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestInstrumentMux(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/users/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	handler := InstrumentMux(mux)
+
+	for _, request := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/v1/users/1", nil),
+		httptest.NewRequest(http.MethodGet, "/v1/users/2", nil),
+		httptest.NewRequest("BREW", "/v1/users/3", nil),
+		httptest.NewRequest(http.MethodGet, "/nowhere", nil),
+	} {
+		handler.ServeHTTP(httptest.NewRecorder(), request)
+	}
+
+	cases := []struct {
+		labels   []string
+		expected uint64
+	}{
+		{[]string{"/v1/users/", http.MethodGet, "404"}, 2},
+		{[]string{"/v1/users/", "OTHER", "404"}, 1},
+		{[]string{unmatchedRoute, http.MethodGet, "404"}, 1},
+	}
+	for _, c := range cases {
+		if count := observations(t, c.labels...); count != c.expected {
+			t.Errorf("incorrect requests timed with %v: expected %d but got %d", c.labels, c.expected, count)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+//Package problem writes error responses as JSON problem details
+//(RFC 7807), so every JobTracker service reports errors the same
+//way. Each problem has a stable code clients can check instead of
+//the human-readable detail, which may change.
+package problem
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"JobTracker/servers/logging"
+)
+
+//ContentType is the media type of problem responses
+const ContentType = "application/problem+json"
+
+//Codes of the problems with each status code. Handlers can use
+//more specific codes, such as "email_taken" for a conflict.
+const (
+	CodeBadRequest           = "bad_request"
+	CodeUnauthorized         = "unauthorized"
+	CodeForbidden            = "forbidden"
+	CodeNotFound             = "not_found"
+	CodeMethodNotAllowed     = "method_not_allowed"
+	CodeConflict             = "conflict"
+	CodePayloadTooLarge      = "payload_too_large"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodeValidationFailed     = "validation_failed"
+	CodeTooManyRequests      = "too_many_requests"
+	CodeInternal             = "internal_error"
+	CodeNotImplemented       = "not_implemented"
+	CodeBadGateway           = "bad_gateway"
+	CodeUnavailable          = "unavailable"
+	CodeGatewayTimeout       = "gateway_timeout"
+	CodeUnknown              = "error"
+)
+
+//statusCodes maps status codes to the codes of their problems
+var statusCodes = map[int]string{
+	http.StatusBadRequest:            CodeBadRequest,
+	http.StatusUnauthorized:          CodeUnauthorized,
+	http.StatusForbidden:             CodeForbidden,
+	http.StatusNotFound:              CodeNotFound,
+	http.StatusMethodNotAllowed:      CodeMethodNotAllowed,
+	http.StatusConflict:              CodeConflict,
+	http.StatusRequestEntityTooLarge: CodePayloadTooLarge,
+	http.StatusUnsupportedMediaType:  CodeUnsupportedMediaType,
+	http.StatusUnprocessableEntity:   CodeValidationFailed,
+	http.StatusTooManyRequests:       CodeTooManyRequests,
+	http.StatusInternalServerError:   CodeInternal,
+	http.StatusNotImplemented:        CodeNotImplemented,
+	http.StatusBadGateway:            CodeBadGateway,
+	http.StatusServiceUnavailable:    CodeUnavailable,
+	http.StatusGatewayTimeout:        CodeGatewayTimeout,
+}
+
+//StatusCode returns the code of problems with the status code
+func StatusCode(status int) string {
+	if code, found := statusCodes[status]; found {
+		return code
+	}
+	return CodeUnknown
+}
+
+//FieldError describes why the value of one field in a request is invalid
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+//Problem represents the details of an error response. Type is always
+//"about:blank", so Title is the status code's text; Code says what
+//went wrong and Detail explains it to the user.
+type Problem struct {
+	Type      string        `json:"type"`
+	Title     string        `json:"title"`
+	Status    int           `json:"status"`
+	Code      string        `json:"code"`
+	Detail    string        `json:"detail,omitempty"`
+	Instance  string        `json:"instance,omitempty"`
+	RequestID string        `json:"requestID,omitempty"`
+	Errors    []*FieldError `json:"errors,omitempty"`
+}
+
+//New returns a problem with the status code, code and detail
+func New(status int, code string, detail string) *Problem {
+	return &Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Code:   code,
+		Detail: detail,
+	}
+}
+
+//Write responds to the request with the problem, adding
+//the request's path and ID
+func Write(w http.ResponseWriter, r *http.Request, p *Problem) {
+	p.Instance = r.URL.Path
+	p.RequestID = r.Header.Get(logging.RequestIDHeader)
+	body, err := json.Marshal(p)
+	if err != nil {
+		//problems only hold strings and numbers, so this can't happen
+		slog.Error("error encoding problem", "err", err)
+		return
+	}
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	w.Write(body)
+}
+
+//Error responds to the request with a problem with the status code
+//and its code. Like http.Error, `detail` is shown to the user, so it
+//must not include internal errors; use Internal for those.
+func Error(w http.ResponseWriter, r *http.Request, detail string, status int) {
+	Write(w, r, New(status, StatusCode(status), detail))
+}
+
+//ErrorCode responds to the request with a problem with the status
+//code and a more specific code than the status code's
+func ErrorCode(w http.ResponseWriter, r *http.Request, code string, detail string, status int) {
+	Write(w, r, New(status, code, detail))
+}
+
+//Internal logs `err` with the request's ID and responds with a problem
+//with the status code and `detail`, keeping the error's details, which
+//may reveal how the service works, from the user
+func Internal(w http.ResponseWriter, r *http.Request, err error, detail string, status int) {
+	slog.Error("request failed", "requestID", r.Header.Get(logging.RequestIDHeader), "path", r.URL.Path, "err", err)
+	Error(w, r, detail, status)
+}
+
+//Validation responds to the request with a 422 problem
+//listing each invalid field and what is wrong with it
+func Validation(w http.ResponseWriter, r *http.Request, errs []*FieldError) {
+	p := New(http.StatusUnprocessableEntity, CodeValidationFailed, "some fields are invalid")
+	p.Errors = errs
+	Write(w, r, p)
+}
@@ -0,0 +1,132 @@
+package problem
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"JobTracker/servers/logging"
+)
+
+//decodeProblem checks that the response is a problem
+//with the status code and returns it
+func decodeProblem(t *testing.T, resp *httptest.ResponseRecorder, status int) *Problem {
+	if resp.Code != status {
+		t.Errorf("incorrect status code: expected %d but got %d", status, resp.Code)
+	}
+	if ctype := resp.Header().Get("Content-Type"); ctype != ContentType {
+		t.Errorf("incorrect content type: expected %s but got %s", ContentType, ctype)
+	}
+	p := &Problem{}
+	if err := json.NewDecoder(resp.Body).Decode(p); err != nil {
+		t.Fatalf("error decoding problem: %v", err)
+	}
+	if p.Status != status {
+		t.Errorf("incorrect status in problem: expected %d but got %d", status, p.Status)
+	}
+	return p
+}
+
+func TestError(t *testing.T) {
+	cases := []struct {
+		name   string
+		status int
+		code   string
+	}{
+		{"Bad Request", http.StatusBadRequest, CodeBadRequest},
+		{"Unauthorized", http.StatusUnauthorized, CodeUnauthorized},
+		{"Not Found", http.StatusNotFound, CodeNotFound},
+		{"Method Not Allowed", http.StatusMethodNotAllowed, CodeMethodNotAllowed},
+		{"Service Unavailable", http.StatusServiceUnavailable, CodeUnavailable},
+		{"Unknown Status", http.StatusTeapot, CodeUnknown},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest(http.MethodGet, "/v1/users/me", nil)
+		r.Header.Set(logging.RequestIDHeader, "abc123")
+		resp := httptest.NewRecorder()
+		Error(resp, r, "something went wrong", c.status)
+
+		p := decodeProblem(t, resp, c.status)
+		expected := &Problem{
+			Type:      "about:blank",
+			Title:     http.StatusText(c.status),
+			Status:    c.status,
+			Code:      c.code,
+			Detail:    "something went wrong",
+			Instance:  "/v1/users/me",
+			RequestID: "abc123",
+		}
+		if !reflect.DeepEqual(p, expected) {
+			t.Errorf("case %s: incorrect problem: expected %+v but got %+v", c.name, expected, p)
+		}
+		if nosniff := resp.Header().Get("X-Content-Type-Options"); nosniff != "nosniff" {
+			t.Errorf("case %s: X-Content-Type-Options should be nosniff but got %q", c.name, nosniff)
+		}
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/v1/users", nil)
+	resp := httptest.NewRecorder()
+	ErrorCode(resp, r, "email_taken", "email is already taken", http.StatusConflict)
+
+	p := decodeProblem(t, resp, http.StatusConflict)
+	if p.Code != "email_taken" {
+		t.Errorf("incorrect code: expected email_taken but got %s", p.Code)
+	}
+	if len(p.RequestID) != 0 {
+		t.Errorf("request ID should be empty without the header but got %s", p.RequestID)
+	}
+}
+
+func TestInternal(t *testing.T) {
+	logs := &bytes.Buffer{}
+	log.SetOutput(logs)
+	defer log.SetOutput(os.Stderr)
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/users/1", nil)
+	r.Header.Set(logging.RequestIDHeader, "abc123")
+	resp := httptest.NewRecorder()
+	Internal(resp, r, errors.New("pq: connection refused"), "please try again later", http.StatusServiceUnavailable)
+
+	p := decodeProblem(t, resp, http.StatusServiceUnavailable)
+	if p.Detail != "please try again later" {
+		t.Errorf("incorrect detail: expected %q but got %q", "please try again later", p.Detail)
+	}
+	if body, _ := json.Marshal(p); bytes.Contains(body, []byte("pq:")) {
+		t.Errorf("the internal error should not be in the response: %s", body)
+	}
+	if !strings.Contains(logs.String(), "abc123") || !strings.Contains(logs.String(), "pq: connection refused") {
+		t.Errorf("the internal error should be logged with the request ID but got %q", logs.String())
+	}
+}
+
+func TestValidation(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/v1/users", nil)
+	resp := httptest.NewRecorder()
+	errs := []*FieldError{
+		{Field: "email", Message: "must be a valid email address"},
+		{Field: "password", Message: "must be at least 8 characters"},
+	}
+	Validation(resp, r, errs)
+
+	p := decodeProblem(t, resp, http.StatusUnprocessableEntity)
+	if p.Code != CodeValidationFailed {
+		t.Errorf("incorrect code: expected %s but got %s", CodeValidationFailed, p.Code)
+	}
+	if len(p.Errors) != len(errs) {
+		t.Fatalf("incorrect number of field errors: expected %d but got %d", len(errs), len(p.Errors))
+	}
+	for i, fieldErr := range errs {
+		if *p.Errors[i] != *fieldErr {
+			t.Errorf("incorrect field error: expected %+v but got %+v", fieldErr, p.Errors[i])
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,7 +11,13 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
+	"JobTracker/servers/problem"
+	"JobTracker/servers/tracing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"golang.org/x/net/html"
 )
 
@@ -37,6 +44,26 @@ type PageSummary struct {
 	Images      []*PreviewImage `json:"images,omitempty"`
 }
 
+//errNotHTML is returned when the page fetched isn't an HTML page
+var errNotHTML = errors.New("content type is not HTML")
+
+//fetchDuration times fetching pages to summarize, by
+//whether an HTML page was fetched
+var fetchDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "summary_fetch_duration_seconds",
+	Help:    "How long fetching pages to summarize took, by result.",
+	Buckets: prometheus.DefBuckets,
+}, []string{"result"})
+
+//observeFetch records a fetch that began at `start` and returned `err`
+func observeFetch(start time.Time, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	fetchDuration.WithLabelValues(result).Observe(time.Since(start).Seconds())
+}
+
 //SummaryHandler handles requests for the page summary API.
 //This API expects one query string parameter named `url`,
 //which should contain a URL to a web page. It responds with
@@ -45,31 +72,35 @@ type PageSummary struct {
 func SummaryHandler(w http.ResponseWriter, r *http.Request) {
 	inputURL := r.FormValue("url")
 	if len(inputURL) == 0 {
-		http.Error(w, "400: BadRequest - Please supply a URL", http.StatusBadRequest)
+		problem.Error(w, r, "please supply a URL", http.StatusBadRequest)
+		return
+	}
+	if u, err := url.Parse(inputURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+		problem.Error(w, r, "please supply an absolute http or https URL", http.StatusBadRequest)
+		return
+	}
+	start := time.Now()
+	HTMLStream, err := fetchHTML(r.Context(), inputURL)
+	observeFetch(start, err)
+	if errors.Is(err, errNotHTML) {
+		problem.Error(w, r, "the URL is not an HTML page", http.StatusBadRequest)
 		return
 	}
-	HTMLStream, err := fetchHTML(inputURL)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("400: BadRequest - %s", err), http.StatusBadRequest)
+		//the page's server failing isn't the client's fault, and errors
+		//making the request can name hosts and addresses on our network
+		problem.Internal(w, r, err, "the page could not be fetched", http.StatusBadGateway)
 		return
 	}
+	defer HTMLStream.Close()
 	metadata, err := extractSummary(inputURL, HTMLStream)
 	if err != nil {
-		http.Error(
-			w,
-			fmt.Sprintf("500: InternalServerError - there was an error extracting the page summary: %s", err),
-			http.StatusInternalServerError,
-		)
+		problem.Internal(w, r, err, "there was an error extracting the page summary", http.StatusInternalServerError)
 		return
 	}
-	defer HTMLStream.Close()
 	response, err := json.Marshal(metadata)
 	if err != nil {
-		http.Error(
-			w,
-			fmt.Sprintf("500: InternalServerError - there was an error returning converting the page summary to JSON: %s", err),
-			http.StatusInternalServerError,
-		)
+		problem.Internal(w, r, err, "there was an error converting the page summary to JSON", http.StatusInternalServerError)
 		return
 	}
 
@@ -77,12 +108,23 @@ func SummaryHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write(response)
 }
 
+//fetchClient fetches pages, each request in a tracing span
+var fetchClient = &http.Client{Transport: tracing.Transport(http.DefaultTransport)}
+
 //fetchHTML fetches `pageURL` and returns the body stream or an error.
 //Errors are returned if the response status code is an error (>=400),
 //or if the content type indicates the URL is not an HTML page.
-func fetchHTML(pageURL string) (io.ReadCloser, error) {
-	resp, err := http.Get(pageURL)
+func fetchHTML(ctx context.Context, pageURL string) (io.ReadCloser, error) {
+	ctx, span := tracing.Start(ctx, "summary.fetchHTML", tracing.KindInternal)
+	defer span.End()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+	if err != nil {
+		tracing.RecordError(span, err)
+		return nil, err
+	}
+	resp, err := fetchClient.Do(req)
 	if err != nil {
+		tracing.RecordError(span, err)
 		return nil, err
 	}
 
@@ -90,10 +132,12 @@ func fetchHTML(pageURL string) (io.ReadCloser, error) {
 	contentType := resp.Header.Get("Content-Type")
 	mediaType, _, _ := mime.ParseMediaType(contentType)
 	if statusCode >= 400 {
+		resp.Body.Close()
 		return nil, fmt.Errorf("response status code is %d", statusCode)
 	}
 	if mediaType != "text/html" {
-		return nil, errors.New("content type is not HTML")
+		resp.Body.Close()
+		return nil, errNotHTML
 	}
 	return resp.Body, nil
 }
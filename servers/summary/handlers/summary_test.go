@@ -1,14 +1,18 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"reflect"
 	"strings"
 	"testing"
+
+	"JobTracker/servers/problem"
 )
 
 func TestToAbsoluteURL(t *testing.T) {
@@ -468,7 +472,7 @@ func TestFetchHTML(t *testing.T) {
 	}
 
 	for _, c := range cases {
-		stream, err := fetchHTML(c.URL)
+		stream, err := fetchHTML(context.Background(), c.URL)
 
 		if err != nil && !c.expectError {
 			t.Errorf("case %s: unexpected error %v\nHINT: %s", c.name, err, c.hint)
@@ -501,3 +505,49 @@ func TestSummaryHandler(t *testing.T) {
 		t.Errorf("incorrect `Content-Type` header value: expected it to start with `%s` but got `%s`", expectedctype, ctype)
 	}
 }
+
+func TestSummaryHandlerProblems(t *testing.T) {
+	page := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/image.png":
+			w.Header().Set("Content-Type", "image/png")
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer page.Close()
+	//nothing listens at the closed server's address
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	cases := []struct {
+		name         string
+		pageURL      string
+		expectedCode int
+	}{
+		{"No URL", "", http.StatusBadRequest},
+		{"Relative URL", "/tests/ogall.html", http.StatusBadRequest},
+		{"Unsupported scheme", "ftp://example.com/page.html", http.StatusBadRequest},
+		{"Not HTML", page.URL + "/image.png", http.StatusBadRequest},
+		{"Page error", page.URL + "/broken.html", http.StatusBadGateway},
+		{"Unreachable page", closed.URL + "/page.html", http.StatusBadGateway},
+	}
+	for _, c := range cases {
+		resp := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/v1/summary?url="+url.QueryEscape(c.pageURL), nil)
+		SummaryHandler(resp, req)
+		if resp.Code != c.expectedCode {
+			t.Errorf("case %s: incorrect status code: expected %d but got %d", c.name, c.expectedCode, resp.Code)
+		}
+		if ctype := resp.Header().Get("Content-Type"); ctype != problem.ContentType {
+			t.Errorf("case %s: incorrect Content-Type: expected %s but got %s", c.name, problem.ContentType, ctype)
+		}
+		p := &problem.Problem{}
+		if err := json.Unmarshal(resp.Body.Bytes(), p); err != nil || p.Code != problem.StatusCode(c.expectedCode) {
+			t.Errorf("case %s: incorrect problem %s: %v", c.name, resp.Body.String(), err)
+		}
+		if strings.Contains(resp.Body.String(), "127.0.0.1") {
+			t.Errorf("case %s: the problem should not reveal addresses: %s", c.name, resp.Body.String())
+		}
+	}
+}
@@ -1,9 +1,14 @@
 package main
 
 import (
+	"JobTracker/servers/graceful"
+	"JobTracker/servers/metrics"
 	"JobTracker/servers/summary/handlers"
+	"JobTracker/servers/tracing"
+	"context"
 	"log"
 	"net/http"
+	"os"
 )
 
 // main is the main entry point for the server
@@ -15,7 +20,39 @@ func main() {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/v1/summary", handlers.SummaryHandler)
 
-	// Listen and serve TLS traffic
+	// ADMINADDR is optional: when set, Prometheus metrics are served
+	// at /metrics there, apart from the API
+	if adminAddr := os.Getenv("ADMINADDR"); len(adminAddr) != 0 {
+		adminMux := http.NewServeMux()
+		adminMux.Handle("/metrics", metrics.Handler())
+		go func() {
+			log.Printf("admin server is listening at %s", adminAddr)
+			log.Fatal(http.ListenAndServe(adminAddr, adminMux))
+		}()
+	}
+
+	// Trace requests when OTEL_TRACES_EXPORTER is set, continuing
+	// the traces of the gateway's requests
+	tracerProvider, err := tracing.FromEnv(context.Background(), "summary")
+	if err != nil {
+		log.Fatalf("unexpected error creating tracer provider: %v", err)
+	}
+
+	// Listen and serve HTTP traffic, timing requests by route, until
+	// the server fails or is asked to stop, then export the spans
+	// still held. log.Fatal exits without running deferred calls, so
+	// this can't be deferred.
+	server := &http.Server{Addr: addr, Handler: tracing.Handler(metrics.InstrumentMux(mux))}
 	log.Printf("server is listening at %s", addr)
-	log.Fatal(http.ListenAndServe(addr, mux))
+	err = graceful.Serve(server, server.ListenAndServe)
+	if tracerProvider != nil {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), graceful.Timeout)
+		if err := tracerProvider.Shutdown(shutdownCtx); err != nil {
+			log.Printf("error exporting the remaining spans: %v", err)
+		}
+		cancel()
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
 }
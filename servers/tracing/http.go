@@ -0,0 +1,68 @@
+package tracing
+
+import (
+	"fmt"
+	"net/http"
+
+	"JobTracker/servers/logging"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+//Handler returns a handler that serves each request with `next` in a
+//server span, continuing the trace of the service that sent it
+func Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := Start(ctx, "HTTP "+r.Method, KindServer,
+			attribute.String("http.method", r.Method),
+			attribute.String("http.target", r.URL.Path),
+		)
+		defer span.End()
+		recorder := logging.NewStatusRecorder(w)
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+		span.SetAttributes(attribute.Int("http.status_code", recorder.Status()))
+		if recorder.Status() >= 500 {
+			span.SetStatus(codes.Error, fmt.Sprintf("responded with status code %d", recorder.Status()))
+		}
+	})
+}
+
+//transport is a RoundTripper that sends
+//each request in a client span
+type transport struct {
+	next http.RoundTripper
+}
+
+//Transport returns a RoundTripper that sends each request with `next`
+//in a client span, propagating the trace to the server with the
+//traceparent header
+func Transport(next http.RoundTripper) http.RoundTripper {
+	return &transport{next: next}
+}
+
+//RoundTrip sends the request in a client span
+func (t *transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	ctx, span := Start(r.Context(), "HTTP "+r.Method, KindClient,
+		attribute.String("http.method", r.Method),
+		attribute.String("http.url", r.URL.Scheme+"://"+r.URL.Host+r.URL.Path),
+		attribute.String("net.peer.name", r.URL.Hostname()),
+	)
+	defer span.End()
+	//RoundTrippers must not change the request, so send a copy
+	r = r.Clone(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(r.Header))
+	resp, err := t.next.RoundTrip(r)
+	if err != nil {
+		RecordError(span, err)
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
+	if resp.StatusCode >= 500 {
+		span.SetStatus(codes.Error, fmt.Sprintf("responded with status code %d", resp.StatusCode))
+	}
+	return resp, nil
+}
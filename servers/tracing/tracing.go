@@ -0,0 +1,42 @@
+//Package tracing records spans of work, such as handling a request or
+//querying a store, with OpenTelemetry, so the time a request took can
+//be broken down across services. Services set up the SDK with FromEnv,
+//and trace context is propagated between them with the W3C traceparent
+//header.
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+//instrumentationName names the tracer JobTracker's spans are started with
+const instrumentationName = "JobTracker/servers/tracing"
+
+//Kinds of spans
+const (
+	KindInternal = trace.SpanKindInternal
+	KindServer   = trace.SpanKindServer
+	KindClient   = trace.SpanKindClient
+)
+
+//Start begins a span named `name` as a child of the current span in
+//`ctx`, with the attributes, and returns a context with it as the
+//current span. The caller must End the span. Until FromEnv sets up a
+//tracer provider, spans aren't recorded.
+func Start(ctx context.Context, name string, kind trace.SpanKind, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithSpanKind(kind), trace.WithAttributes(attrs...))
+}
+
+//RecordError marks the span as failed because of `err`, if it isn't nil
+func RecordError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
@@ -0,0 +1,136 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"JobTracker/servers/tracing"
+	"JobTracker/servers/tracing/tracingtest"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestStartWithoutProvider(t *testing.T) {
+	ctx, span := tracing.Start(context.Background(), "work", tracing.KindInternal)
+	if span.IsRecording() {
+		t.Errorf("spans should not be recorded without a tracer provider")
+	}
+	tracing.RecordError(span, errors.New("failed"))
+	span.End()
+	if trace.SpanContextFromContext(ctx).IsValid() {
+		t.Errorf("the context should not have a span context")
+	}
+}
+
+func TestSpans(t *testing.T) {
+	recorder := tracingtest.NewRecorder(t)
+
+	ctx, parent := tracing.Start(context.Background(), "parent", tracing.KindServer, attribute.String("http.method", "GET"))
+	_, child := tracing.Start(ctx, "child", tracing.KindInternal)
+	tracing.RecordError(child, errors.New("failed"))
+	tracing.RecordError(parent, nil)
+	child.End()
+	parent.End()
+
+	spans := recorder.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans but got %d", len(spans))
+	}
+	childSpan, parentSpan := spans[0], spans[1]
+	if childSpan.Name() != "child" || parentSpan.Name() != "parent" {
+		t.Fatalf("incorrect spans: got %s and %s", childSpan.Name(), parentSpan.Name())
+	}
+	if childSpan.Parent().SpanID() != parentSpan.SpanContext().SpanID() || childSpan.SpanContext().TraceID() != parentSpan.SpanContext().TraceID() {
+		t.Errorf("the child should be in the parent's trace, under the parent")
+	}
+	if childSpan.Status().Code != codes.Error || childSpan.Status().Description != "failed" {
+		t.Errorf("incorrect status: expected the error but got %+v", childSpan.Status())
+	}
+	if parentSpan.Status().Code != codes.Unset {
+		t.Errorf("a nil error should not mark the span as failed but got %+v", parentSpan.Status())
+	}
+	if attrs := parentSpan.Attributes(); len(attrs) != 1 || attrs[0] != attribute.String("http.method", "GET") {
+		t.Errorf("incorrect attributes: %+v", attrs)
+	}
+}
+
+func TestHandlerAndTransport(t *testing.T) {
+	recorder := tracingtest.NewRecorder(t)
+	received := ""
+	upstream := httptest.NewServer(tracing.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})))
+	defer upstream.Close()
+
+	client := &http.Client{Transport: tracing.Transport(http.DefaultTransport)}
+	gateway := tracing.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, _ := http.NewRequestWithContext(r.Context(), http.MethodGet, upstream.URL+"/v1/applications", nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error sending request upstream: %v", err)
+		}
+		resp.Body.Close()
+		w.WriteHeader(resp.StatusCode)
+	}))
+	//the gateway continues the trace of the client that sent the request
+	request := httptest.NewRequest(http.MethodGet, "/v1/applications", nil)
+	request.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	gateway.ServeHTTP(httptest.NewRecorder(), request)
+
+	spans := recorder.Spans()
+	if len(spans) != 3 {
+		t.Fatalf("expected server, client and upstream server spans but got %d", len(spans))
+	}
+	upstreamSpan, clientSpan, gatewaySpan := spans[0], spans[1], spans[2]
+	if gatewaySpan.SpanKind() != tracing.KindServer || clientSpan.SpanKind() != tracing.KindClient || upstreamSpan.SpanKind() != tracing.KindServer {
+		t.Errorf("incorrect kinds: %v, %v, %v", gatewaySpan.SpanKind(), clientSpan.SpanKind(), upstreamSpan.SpanKind())
+	}
+	if gatewaySpan.SpanContext().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" || gatewaySpan.Parent().SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("the gateway's span should continue the incoming trace but got parent %v", gatewaySpan.Parent())
+	}
+	if clientSpan.Parent().SpanID() != gatewaySpan.SpanContext().SpanID() || upstreamSpan.Parent().SpanID() != clientSpan.SpanContext().SpanID() {
+		t.Errorf("the upstream's span should be a child of the client span, a child of the gateway's span")
+	}
+	if !strings.Contains(received, clientSpan.SpanContext().SpanID().String()) {
+		t.Errorf("the upstream should receive the client span in traceparent but got %q", received)
+	}
+	if clientSpan.Status().Code != codes.Error || gatewaySpan.Status().Code != codes.Error {
+		t.Errorf("5xx responses should mark the spans as failed")
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	cases := []struct {
+		exporter    string
+		hasProvider bool
+		expectErr   bool
+	}{
+		{"", false, false},
+		{"none", false, false},
+		{"console", true, false},
+		{"otlp", true, false},
+		{"jaeger", false, true},
+	}
+	defer os.Unsetenv("OTEL_TRACES_EXPORTER")
+	for _, c := range cases {
+		os.Setenv("OTEL_TRACES_EXPORTER", c.exporter)
+		provider, err := tracing.FromEnv(context.Background(), "gateway")
+		if (err != nil) != c.expectErr {
+			t.Errorf("case %q: unexpected error: %v", c.exporter, err)
+		}
+		if (provider != nil) != c.hasProvider {
+			t.Errorf("case %q: expected a tracer provider %v but got %v", c.exporter, c.hasProvider, provider)
+		}
+		if provider != nil {
+			provider.Shutdown(context.Background())
+		}
+	}
+}
@@ -0,0 +1,54 @@
+//Package tracingtest records the spans code under test makes:
+//
+//	recorder := tracingtest.NewRecorder(t)
+//	...
+//	spans := recorder.Spans()
+package tracingtest
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+//Recorder keeps the spans that end while a test runs
+type Recorder struct {
+	spans *tracetest.SpanRecorder
+}
+
+//NewRecorder returns a Recorder and makes the global tracer provider
+//record to it until the test finishes, propagating trace context like
+//tracing.FromEnv. Tests using it must not run in parallel.
+func NewRecorder(t *testing.T) *Recorder {
+	spans := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(noop.NewTracerProvider())
+		otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+		provider.Shutdown(context.Background())
+	})
+	return &Recorder{spans: spans}
+}
+
+//Spans returns every span that has ended, in the order they ended
+func (rec *Recorder) Spans() []sdktrace.ReadOnlySpan {
+	return rec.spans.Ended()
+}
+
+//Named returns the spans named `name`
+func (rec *Recorder) Named(name string) []sdktrace.ReadOnlySpan {
+	named := []sdktrace.ReadOnlySpan{}
+	for _, span := range rec.Spans() {
+		if span.Name() == name {
+			named = append(named, span)
+		}
+	}
+	return named
+}